@@ -27,13 +27,22 @@ type Async struct {
 	Done       chan Command
 	Wait       *sync.WaitGroup
 	Error      error
-	rb         *backoff.Backoff // rb - Retry Backoff
-	enqueuedAt time.Time
-	executeAt  time.Time
-	qb         *backoff.Backoff // qb - Queue Backoff
+	ExecutedBy *DatacenterCluster // NB: set when executed by a MultiCluster
+	rb         *backoff.Backoff   // rb - Retry Backoff
+	queueSeq   uint64             // NB: position in the Cluster command queue
+	startedAt  time.Time
+	deadline   time.Time
+	attempts   byte
+	cancel     chan struct{} // NB: closed when a hedged copy of the command is no longer needed
+	internal   bool          // NB: executes a copy of a hedged command
+	admitted   bool          // NB: admitted by the Cluster's rate and concurrency limits
+	sent       bool          // NB: a node sent the command to Riak, which may have applied it
 }
 
 func (a *Async) onExecute() {
+	if a.startedAt.IsZero() {
+		a.startedAt = time.Now()
+	}
 	if a.rb == nil {
 		a.rb = &backoff.Backoff{
 			Jitter: true,
@@ -43,23 +52,28 @@ func (a *Async) onExecute() {
 	}
 }
 
+func (a *Async) isCancelled() bool {
+	if a.cancel == nil {
+		return false
+	}
+	select {
+	case <-a.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *Async) isPastDeadline() bool {
+	return !a.deadline.IsZero() && time.Now().After(a.deadline)
+}
+
 func (a *Async) onRetry() {
 	d := a.rb.Duration()
 	logDebug("[Async]", "onRetry cmd: %s sleep: %v", a.Command.Name(), d)
 	time.Sleep(d)
 }
 
-func (a *Async) onEnqueued() {
-	if a.qb == nil {
-		a.enqueuedAt = time.Now()
-		a.qb = &backoff.Backoff{
-			Factor: 1.5,
-			Jitter: true,
-		}
-	}
-	a.executeAt = a.enqueuedAt.Add(a.qb.Duration())
-}
-
 func (a *Async) done(err error) {
 	if err != nil {
 		// TODO FUTURE evaluate debug logging
@@ -18,7 +18,13 @@ package riak
 
 import (
 	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/basho/riak-go-client/rpb/riak_ts"
+
+	"github.com/golang/protobuf/proto"
 )
 
 func BenchmarkPuttingManyObjects(b *testing.B) {
@@ -46,3 +52,118 @@ func BenchmarkPuttingManyObjects(b *testing.B) {
 		}
 	}
 }
+
+func benchmarkTsRows(n int) [][]TsCell {
+	rows := make([][]TsCell, n)
+	for i := range rows {
+		rows[i] = []TsCell{
+			NewStringTsCell("South Atlantic"),
+			NewStringTsCell("South Carolina"),
+			NewTimestampTsCell(time.Unix(1443806900, 0).Add(time.Duration(i) * time.Second)),
+			NewStringTsCell("hot"),
+			NewDoubleTsCell(23.5),
+			NewSint64TsCell(10),
+			NewBooleanTsCell(true),
+			NewBlobTsCell(randomBytes[:16]),
+		}
+	}
+	return rows
+}
+
+func benchmarkTsStoreRowsEncoding(b *testing.B, useTtb bool) {
+	cmd, err := NewTsStoreRowsCommandBuilder().
+		WithTable("WeatherByRegion").
+		WithRows(benchmarkTsRows(100)).
+		WithTermToBinary(useTtb).
+		Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := getRiakMessage(cmd); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTsStoreRowsEncodingProtobuf(b *testing.B) {
+	benchmarkTsStoreRowsEncoding(b, false)
+}
+
+func BenchmarkTsStoreRowsEncodingTtb(b *testing.B) {
+	benchmarkTsStoreRowsEncoding(b, true)
+}
+
+var benchmarkTsColumns = []*riak_ts.TsColumnDescription{
+	{Name: []byte("region"), Type: riak_ts.TsColumnType_VARCHAR.Enum()},
+	{Name: []byte("state"), Type: riak_ts.TsColumnType_VARCHAR.Enum()},
+	{Name: []byte("time"), Type: riak_ts.TsColumnType_TIMESTAMP.Enum()},
+	{Name: []byte("weather"), Type: riak_ts.TsColumnType_VARCHAR.Enum()},
+	{Name: []byte("temperature"), Type: riak_ts.TsColumnType_DOUBLE.Enum()},
+	{Name: []byte("uv_index"), Type: riak_ts.TsColumnType_SINT64.Enum()},
+	{Name: []byte("observed"), Type: riak_ts.TsColumnType_BOOLEAN.Enum()},
+	{Name: []byte("binary"), Type: riak_ts.TsColumnType_BLOB.Enum()},
+}
+
+func benchmarkTsQueryDecoding(b *testing.B, useTtb bool) {
+	rows := benchmarkTsRows(100)
+	var data []byte
+	if useTtb {
+		e := newTtbEncoder()
+		e.writeTupleHeader(2)
+		e.writeAtom(ttbTsQueryResp)
+		e.writeTupleHeader(3)
+		e.writeList(len(benchmarkTsColumns), func(i int) {
+			e.writeBinary(benchmarkTsColumns[i].GetName())
+		})
+		e.writeList(len(benchmarkTsColumns), func(i int) {
+			e.writeAtom(strings.ToLower(benchmarkTsColumns[i].GetType().String()))
+		})
+		e.writeList(len(rows), func(i int) {
+			e.writeTupleHeader(len(rows[i]))
+			for _, cell := range rows[i] {
+				writeTsTtbCell(e, cell.cell)
+			}
+		})
+		data = append([]byte{rpbCode_TsTtbMsg}, e.bytes()...)
+	} else {
+		done := true
+		pb, err := proto.Marshal(&riak_ts.TsQueryResp{
+			Columns: benchmarkTsColumns,
+			Rows:    convertFromTsRows(rows),
+			Done:    &done,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		data = append([]byte{rpbCode_TsQueryResp}, pb...)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cmd, err := NewTsQueryCommandBuilder().
+			WithQuery("select * from WeatherByRegion").
+			WithTermToBinary(useTtb).
+			Build()
+		if err != nil {
+			b.Fatal(err)
+		}
+		msg, err := decodeRiakMessage(cmd, data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := cmd.onSuccess(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTsQueryDecodingProtobuf(b *testing.B) {
+	benchmarkTsQueryDecoding(b, false)
+}
+
+func BenchmarkTsQueryDecodingTtb(b *testing.B) {
+	benchmarkTsQueryDecoding(b, true)
+}
@@ -0,0 +1,632 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	rpbRiak "github.com/basho/riak-go-client/rpb/riak"
+)
+
+// Kinds of objects managed by a BucketSchemaConfig
+const (
+	BucketSchemaKindSchema     = "schema"
+	BucketSchemaKindIndex      = "index"
+	BucketSchemaKindBucketType = "bucket_type"
+	BucketSchemaKindBucket     = "bucket"
+)
+
+const defaultSearchSchema = "_yz_default"
+
+var (
+	ErrBucketSchemaConfigNameRequired = newClientError("[BucketSchemaConfig] every bucket type, bucket, schema and index requires a name", nil)
+	ErrBucketSchemaConfigSchemaSource = newClientError("[BucketSchemaConfig] a schema requires exactly one of content or file", nil)
+	ErrBucketSchemaConfigHllPrecision = newClientError("[BucketSchemaConfig] hll_precision must be between 4 and 16", nil)
+	ErrBucketSchemaConfigBucketType   = newClientError("[BucketSchemaConfig] datatype may only be set on bucket types", nil)
+)
+
+// BucketProps are the bucket type or bucket properties managed by a
+// BucketSchemaConfig. Properties that are not set are left as they are in
+// Riak. JSON property names are those used by riak-admin, for instance:
+//
+//	{"n_val": 3, "allow_mult": true, "search_index": "animals",
+//	 "precommit": [{"modfun": {"module": "validate", "function": "precommit"}}]}
+//
+// DataType can only be set when a bucket type is created with riak-admin, so
+// it is checked against Riak but never written.
+type BucketProps struct {
+	NVal          *uint32       `json:"n_val,omitempty"`
+	AllowMult     *bool         `json:"allow_mult,omitempty"`
+	LastWriteWins *bool         `json:"last_write_wins,omitempty"`
+	OldVClock     *uint32       `json:"old_vclock,omitempty"`
+	YoungVClock   *uint32       `json:"young_vclock,omitempty"`
+	BigVClock     *uint32       `json:"big_vclock,omitempty"`
+	SmallVClock   *uint32       `json:"small_vclock,omitempty"`
+	R             *uint32       `json:"r,omitempty"`
+	Pr            *uint32       `json:"pr,omitempty"`
+	W             *uint32       `json:"w,omitempty"`
+	Pw            *uint32       `json:"pw,omitempty"`
+	Dw            *uint32       `json:"dw,omitempty"`
+	Rw            *uint32       `json:"rw,omitempty"`
+	BasicQuorum   *bool         `json:"basic_quorum,omitempty"`
+	NotFoundOk    *bool         `json:"notfound_ok,omitempty"`
+	Search        *bool         `json:"search,omitempty"`
+	Backend       *string       `json:"backend,omitempty"`
+	SearchIndex   *string       `json:"search_index,omitempty"`
+	DataType      string        `json:"datatype,omitempty"`
+	PreCommit     []*CommitHook `json:"precommit,omitempty"`
+	PostCommit    []*CommitHook `json:"postcommit,omitempty"`
+	ChashKeyFun   *ModFun       `json:"chash_keyfun,omitempty"`
+	HllPrecision  *uint32       `json:"hll_precision,omitempty"`
+}
+
+// BucketTypeDefinition describes a bucket type and buckets within it. The
+// bucket type must already have been created and activated with riak-admin
+type BucketTypeDefinition struct {
+	Name    string              `json:"name"`
+	Props   *BucketProps        `json:"props,omitempty"`
+	Buckets []*BucketDefinition `json:"buckets,omitempty"`
+}
+
+// BucketDefinition describes the properties of a bucket
+type BucketDefinition struct {
+	Name  string       `json:"name"`
+	Props *BucketProps `json:"props,omitempty"`
+}
+
+// SearchSchemaDefinition describes a Yokozuna schema. Content is the schema
+// XML; File may be used instead to read it from a file, relative to the config
+// file when loaded with LoadBucketSchemaConfig and to the working directory
+// otherwise. The file is read by Diff and Apply
+type SearchSchemaDefinition struct {
+	Name    string `json:"name"`
+	Content string `json:"content,omitempty"`
+	File    string `json:"file,omitempty"`
+}
+
+// SearchIndexDefinition describes a Yokozuna index. Schema defaults to
+// _yz_default and NVal to the Riak default
+type SearchIndexDefinition struct {
+	Name   string  `json:"name"`
+	Schema string  `json:"schema,omitempty"`
+	NVal   *uint32 `json:"n_val,omitempty"`
+}
+
+// BucketSchemaConfig is a declarative description of bucket types, buckets and
+// Yokozuna schemas and indexes. Diff compares it with Riak and Apply writes
+// only the differences:
+//
+//	config, err := riak.LoadBucketSchemaConfig("riak.json")
+//	changes, err := config.Apply(cluster)
+//
+// Schemas are stored before indexes, and indexes before bucket types and
+// buckets, so that a search_index property may refer to an index in the same
+// config. Yokozuna creates indexes asynchronously, so storing a bucket that
+// refers to a new index may fail until the index is available; see
+// SetupSearchIndex and Cluster.WaitForSearchIndex.
+type BucketSchemaConfig struct {
+	Schemas     []*SearchSchemaDefinition `json:"schemas,omitempty"`
+	Indexes     []*SearchIndexDefinition  `json:"indexes,omitempty"`
+	BucketTypes []*BucketTypeDefinition   `json:"bucket_types,omitempty"`
+}
+
+// BucketSchemaChange describes one difference between a BucketSchemaConfig and
+// Riak. Property is empty when the object does not exist in Riak
+type BucketSchemaChange struct {
+	Kind     string
+	Name     string
+	Property string
+	Current  interface{}
+	Desired  interface{}
+}
+
+func (c *BucketSchemaChange) String() string {
+	if c.Property == "" {
+		return fmt.Sprintf("create %s %s", c.Kind, c.Name)
+	}
+	return fmt.Sprintf("%s %s: %s %v -> %v", c.Kind, c.Name, c.Property, formatBucketSchemaValue(c.Current), formatBucketSchemaValue(c.Desired))
+}
+
+// ParseBucketSchemaConfig parses and validates a JSON BucketSchemaConfig
+func ParseBucketSchemaConfig(data []byte) (*BucketSchemaConfig, error) {
+	config := &BucketSchemaConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, newClientError("[BucketSchemaConfig] invalid JSON", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadBucketSchemaConfig reads, parses and validates a JSON BucketSchemaConfig
+// file, reading schema files relative to it
+func LoadBucketSchemaConfig(path string) (*BucketSchemaConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseBucketSchemaConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	for _, schema := range config.Schemas {
+		if schema.File == "" {
+			continue
+		}
+		file := schema.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		schema.Content = string(content)
+		schema.File = ""
+	}
+	return config, nil
+}
+
+// Validate checks the config for errors that can be found without Riak
+func (config *BucketSchemaConfig) Validate() error {
+	for _, schema := range config.Schemas {
+		if schema.Name == "" {
+			return ErrBucketSchemaConfigNameRequired
+		}
+		if (schema.Content == "") == (schema.File == "") {
+			return ErrBucketSchemaConfigSchemaSource
+		}
+	}
+	for _, index := range config.Indexes {
+		if index.Name == "" {
+			return ErrBucketSchemaConfigNameRequired
+		}
+	}
+	for _, bucketType := range config.BucketTypes {
+		if bucketType.Name == "" {
+			return ErrBucketSchemaConfigNameRequired
+		}
+		if err := bucketType.Props.validate(); err != nil {
+			return err
+		}
+		for _, bucket := range bucketType.Buckets {
+			if bucket.Name == "" {
+				return ErrBucketSchemaConfigNameRequired
+			}
+			if bucket.Props != nil && bucket.Props.DataType != "" {
+				return ErrBucketSchemaConfigBucketType
+			}
+			if err := bucket.Props.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Diff fetches the current state of the objects in the config and returns the
+// changes Apply would make. It returns an error for differences that cannot be
+// applied, such as a bucket type's datatype or an existing index's schema
+func (config *BucketSchemaConfig) Diff(executor CommandExecutor) ([]*BucketSchemaChange, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	var changes []*BucketSchemaChange
+	for _, schema := range config.Schemas {
+		c, err := diffSearchSchema(executor, schema)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c...)
+	}
+	for _, index := range config.Indexes {
+		c, err := diffSearchIndex(executor, index)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c...)
+	}
+	for _, bucketType := range config.BucketTypes {
+		cmd, err := NewFetchBucketTypePropsCommandBuilder().
+			WithBucketType(bucketType.Name).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		if err = executor.Execute(cmd); err != nil {
+			return nil, newClientError(fmt.Sprintf("[BucketSchemaConfig] could not fetch bucket type %s", bucketType.Name), err)
+		}
+		current := cmd.(*FetchBucketTypePropsCommand).Response
+		if props := bucketType.Props; props != nil && props.DataType != "" && current.DataType != props.DataType {
+			return nil, fmt.Errorf("[BucketSchemaConfig] bucket type %s has datatype '%s', not '%s'", bucketType.Name, current.DataType, props.DataType)
+		}
+		changes = append(changes, bucketType.Props.diff(BucketSchemaKindBucketType, bucketType.Name, current)...)
+
+		for _, bucket := range bucketType.Buckets {
+			cmd, err := NewFetchBucketPropsCommandBuilder().
+				WithBucketType(bucketType.Name).
+				WithBucket(bucket.Name).
+				Build()
+			if err != nil {
+				return nil, err
+			}
+			name := bucketType.Name + "/" + bucket.Name
+			if err = executor.Execute(cmd); err != nil {
+				return nil, newClientError(fmt.Sprintf("[BucketSchemaConfig] could not fetch bucket %s", name), err)
+			}
+			changes = append(changes, bucket.Props.diff(BucketSchemaKindBucket, name, cmd.(*FetchBucketPropsCommand).Response)...)
+		}
+	}
+	return changes, nil
+}
+
+// Apply writes the differences between the config and Riak and returns the
+// changes made. If a write fails, the changes made before it are returned
+// with the error
+func (config *BucketSchemaConfig) Apply(executor CommandExecutor) ([]*BucketSchemaChange, error) {
+	changes, err := config.Diff(executor)
+	if err != nil {
+		return nil, err
+	}
+	var applied []*BucketSchemaChange
+	for i := 0; i < len(changes); {
+		// NB: changes to the same object are written with one command
+		j := i + 1
+		for j < len(changes) && changes[j].Kind == changes[i].Kind && changes[j].Name == changes[i].Name {
+			j++
+		}
+		cmd, err := config.buildCommand(changes[i:j])
+		if err != nil {
+			return applied, err
+		}
+		logDebug("[BucketSchemaConfig]", "applying %v", changes[i:j])
+		if err = executor.Execute(cmd); err != nil {
+			return applied, newClientError(fmt.Sprintf("[BucketSchemaConfig] could not store %s %s", changes[i].Kind, changes[i].Name), err)
+		}
+		applied = append(applied, changes[i:j]...)
+		i = j
+	}
+	return applied, nil
+}
+
+func (config *BucketSchemaConfig) buildCommand(changes []*BucketSchemaChange) (Command, error) {
+	kind, name := changes[0].Kind, changes[0].Name
+	switch kind {
+	case BucketSchemaKindSchema:
+		for _, schema := range config.Schemas {
+			if schema.Name == name {
+				content, err := schema.content()
+				if err != nil {
+					return nil, err
+				}
+				return NewStoreSchemaCommandBuilder().
+					WithSchemaName(schema.Name).
+					WithSchema(content).
+					Build()
+			}
+		}
+	case BucketSchemaKindIndex:
+		for _, index := range config.Indexes {
+			if index.Name == name {
+				builder := NewStoreIndexCommandBuilder().
+					WithIndexName(index.Name).
+					WithSchemaName(index.schema())
+				if index.NVal != nil {
+					builder.WithNVal(*index.NVal)
+				}
+				return builder.Build()
+			}
+		}
+	case BucketSchemaKindBucketType:
+		for _, bucketType := range config.BucketTypes {
+			if bucketType.Name == name {
+				builder := NewStoreBucketTypePropsCommandBuilder().WithBucketType(name)
+				bucketType.Props.setRpbProps(builder.props, changes)
+				return builder.Build()
+			}
+		}
+	case BucketSchemaKindBucket:
+		for _, bucketType := range config.BucketTypes {
+			for _, bucket := range bucketType.Buckets {
+				if bucketType.Name+"/"+bucket.Name == name {
+					builder := NewStoreBucketPropsCommandBuilder().
+						WithBucketType(bucketType.Name).
+						WithBucket(bucket.Name)
+					bucket.Props.setRpbProps(builder.props, changes)
+					return builder.Build()
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("[BucketSchemaConfig] unknown %s %s", kind, name)
+}
+
+func (index *SearchIndexDefinition) schema() string {
+	if index.Schema == "" {
+		return defaultSearchSchema
+	}
+	return index.Schema
+}
+
+func diffSearchSchema(executor CommandExecutor, schema *SearchSchemaDefinition) ([]*BucketSchemaChange, error) {
+	cmd, err := NewFetchSchemaCommandBuilder().
+		WithSchemaName(schema.Name).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	if err = executor.Execute(cmd); err != nil && !isNotFoundError(err) {
+		return nil, newClientError(fmt.Sprintf("[BucketSchemaConfig] could not fetch schema %s", schema.Name), err)
+	}
+	current := cmd.(*FetchSchemaCommand).Response
+	if err != nil || current == nil {
+		return []*BucketSchemaChange{{Kind: BucketSchemaKindSchema, Name: schema.Name}}, nil
+	}
+	content, err := schema.content()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(current.Content) != strings.TrimSpace(content) {
+		return []*BucketSchemaChange{{
+			Kind:     BucketSchemaKindSchema,
+			Name:     schema.Name,
+			Property: "content",
+			Current:  current.Content,
+			Desired:  content,
+		}}, nil
+	}
+	return nil, nil
+}
+
+// content returns the schema XML, reading File if it is set
+func (schema *SearchSchemaDefinition) content() (string, error) {
+	if schema.File == "" {
+		return schema.Content, nil
+	}
+	content, err := ioutil.ReadFile(schema.File)
+	if err != nil {
+		return "", newClientError(fmt.Sprintf("[BucketSchemaConfig] could not read schema %s", schema.Name), err)
+	}
+	return string(content), nil
+}
+
+func diffSearchIndex(executor CommandExecutor, index *SearchIndexDefinition) ([]*BucketSchemaChange, error) {
+	cmd, err := NewFetchIndexCommandBuilder().
+		WithIndexName(index.Name).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	if err = executor.Execute(cmd); err != nil && !isNotFoundError(err) {
+		return nil, newClientError(fmt.Sprintf("[BucketSchemaConfig] could not fetch index %s", index.Name), err)
+	}
+	response := cmd.(*FetchIndexCommand).Response
+	if err != nil || len(response) == 0 {
+		return []*BucketSchemaChange{{Kind: BucketSchemaKindIndex, Name: index.Name}}, nil
+	}
+	// NB: Yokozuna cannot change the schema or n_val of an existing index
+	current := response[0]
+	if current.Schema != index.schema() {
+		return nil, fmt.Errorf("[BucketSchemaConfig] index %s has schema '%s', not '%s'", index.Name, current.Schema, index.schema())
+	}
+	if index.NVal != nil && current.NVal != *index.NVal {
+		return nil, fmt.Errorf("[BucketSchemaConfig] index %s has n_val %d, not %d", index.Name, current.NVal, *index.NVal)
+	}
+	return nil, nil
+}
+
+// isNotFoundError returns true if Riak responded that the requested object
+// does not exist
+func isNotFoundError(err error) bool {
+	if e, ok := err.(ClientError); ok {
+		err = e.InnerError
+	}
+	if e, ok := err.(RiakError); ok {
+		return strings.Contains(e.Errmsg, "notfound")
+	}
+	return false
+}
+
+func (props *BucketProps) validate() error {
+	if props != nil && props.HllPrecision != nil && (*props.HllPrecision < 4 || *props.HllPrecision > 16) {
+		return ErrBucketSchemaConfigHllPrecision
+	}
+	return nil
+}
+
+func (props *BucketProps) diff(kind, name string, current *FetchBucketPropsResponse) []*BucketSchemaChange {
+	if props == nil {
+		return nil
+	}
+	var changes []*BucketSchemaChange
+	add := func(property string, currentValue, desired interface{}) {
+		if !reflect.DeepEqual(currentValue, desired) {
+			changes = append(changes, &BucketSchemaChange{
+				Kind:     kind,
+				Name:     name,
+				Property: property,
+				Current:  currentValue,
+				Desired:  desired,
+			})
+		}
+	}
+	if props.NVal != nil {
+		add("n_val", current.NVal, *props.NVal)
+	}
+	if props.AllowMult != nil {
+		add("allow_mult", current.AllowMult, *props.AllowMult)
+	}
+	if props.LastWriteWins != nil {
+		add("last_write_wins", current.LastWriteWins, *props.LastWriteWins)
+	}
+	if props.OldVClock != nil {
+		add("old_vclock", current.OldVClock, *props.OldVClock)
+	}
+	if props.YoungVClock != nil {
+		add("young_vclock", current.YoungVClock, *props.YoungVClock)
+	}
+	if props.BigVClock != nil {
+		add("big_vclock", current.BigVClock, *props.BigVClock)
+	}
+	if props.SmallVClock != nil {
+		add("small_vclock", current.SmallVClock, *props.SmallVClock)
+	}
+	if props.R != nil {
+		add("r", current.R, *props.R)
+	}
+	if props.Pr != nil {
+		add("pr", current.Pr, *props.Pr)
+	}
+	if props.W != nil {
+		add("w", current.W, *props.W)
+	}
+	if props.Pw != nil {
+		add("pw", current.Pw, *props.Pw)
+	}
+	if props.Dw != nil {
+		add("dw", current.Dw, *props.Dw)
+	}
+	if props.Rw != nil {
+		add("rw", current.Rw, *props.Rw)
+	}
+	if props.BasicQuorum != nil {
+		add("basic_quorum", current.BasicQuorum, *props.BasicQuorum)
+	}
+	if props.NotFoundOk != nil {
+		add("notfound_ok", current.NotFoundOk, *props.NotFoundOk)
+	}
+	if props.Search != nil {
+		add("search", current.Search, *props.Search)
+	}
+	if props.Backend != nil {
+		add("backend", current.Backend, *props.Backend)
+	}
+	if props.SearchIndex != nil {
+		add("search_index", current.SearchIndex, *props.SearchIndex)
+	}
+	if props.PreCommit != nil {
+		add("precommit", nonNilCommitHooks(current.PreCommit), props.PreCommit)
+	}
+	if props.PostCommit != nil {
+		add("postcommit", nonNilCommitHooks(current.PostCommit), props.PostCommit)
+	}
+	if props.ChashKeyFun != nil {
+		add("chash_keyfun", current.ChashKeyFun, props.ChashKeyFun)
+	}
+	if props.HllPrecision != nil {
+		add("hll_precision", current.HllPrecision, *props.HllPrecision)
+	}
+	return changes
+}
+
+// setRpbProps sets the properties that changed on rpbProps
+func (props *BucketProps) setRpbProps(rpbProps *rpbRiak.RpbBucketProps, changes []*BucketSchemaChange) {
+	for _, change := range changes {
+		switch change.Property {
+		case "n_val":
+			rpbProps.NVal = props.NVal
+		case "allow_mult":
+			rpbProps.AllowMult = props.AllowMult
+		case "last_write_wins":
+			rpbProps.LastWriteWins = props.LastWriteWins
+		case "old_vclock":
+			rpbProps.OldVclock = props.OldVClock
+		case "young_vclock":
+			rpbProps.YoungVclock = props.YoungVClock
+		case "big_vclock":
+			rpbProps.BigVclock = props.BigVClock
+		case "small_vclock":
+			rpbProps.SmallVclock = props.SmallVClock
+		case "r":
+			rpbProps.R = props.R
+		case "pr":
+			rpbProps.Pr = props.Pr
+		case "w":
+			rpbProps.W = props.W
+		case "pw":
+			rpbProps.Pw = props.Pw
+		case "dw":
+			rpbProps.Dw = props.Dw
+		case "rw":
+			rpbProps.Rw = props.Rw
+		case "basic_quorum":
+			rpbProps.BasicQuorum = props.BasicQuorum
+		case "notfound_ok":
+			rpbProps.NotfoundOk = props.NotFoundOk
+		case "search":
+			rpbProps.Search = props.Search
+		case "backend":
+			rpbProps.Backend = []byte(*props.Backend)
+		case "search_index":
+			rpbProps.SearchIndex = []byte(*props.SearchIndex)
+		case "precommit":
+			// NB: has_precommit allows an empty list to remove existing hooks
+			hasPrecommit := true
+			rpbProps.HasPrecommit = &hasPrecommit
+			for _, hook := range props.PreCommit {
+				rpbProps.Precommit = addCommitHookTo(rpbProps.Precommit, toRpbCommitHook(hook))
+			}
+		case "postcommit":
+			hasPostcommit := true
+			rpbProps.HasPostcommit = &hasPostcommit
+			for _, hook := range props.PostCommit {
+				rpbProps.Postcommit = addCommitHookTo(rpbProps.Postcommit, toRpbCommitHook(hook))
+			}
+		case "chash_keyfun":
+			rpbProps.ChashKeyfun = &rpbRiak.RpbModFun{
+				Module:   []byte(props.ChashKeyFun.Module),
+				Function: []byte(props.ChashKeyFun.Function),
+			}
+		case "hll_precision":
+			rpbProps.HllPrecision = props.HllPrecision
+		}
+	}
+}
+
+func nonNilCommitHooks(hooks []*CommitHook) []*CommitHook {
+	if hooks == nil {
+		return []*CommitHook{}
+	}
+	return hooks
+}
+
+func formatBucketSchemaValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "<unset>"
+	case string:
+		return fmt.Sprintf("%q", value)
+	case *ModFun:
+		return fmt.Sprintf("%s:%s", value.Module, value.Function)
+	case []*CommitHook:
+		hooks := make([]string, len(value))
+		for i, hook := range value {
+			if hook.ModFun != nil {
+				hooks[i] = fmt.Sprintf("%s:%s", hook.ModFun.Module, hook.ModFun.Function)
+			} else {
+				hooks[i] = hook.Name
+			}
+		}
+		return "[" + strings.Join(hooks, " ") + "]"
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,341 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testBucketSchemaExecutor answers fetch commands from its fields and records
+// store commands
+type testBucketSchemaExecutor struct {
+	schemas     map[string]string
+	indexes     map[string]*SearchIndex
+	bucketTypes map[string]*FetchBucketPropsResponse
+	buckets     map[string]*FetchBucketPropsResponse
+	stored      []Command
+}
+
+func newTestBucketSchemaExecutor() *testBucketSchemaExecutor {
+	return &testBucketSchemaExecutor{
+		schemas:     make(map[string]string),
+		indexes:     make(map[string]*SearchIndex),
+		bucketTypes: make(map[string]*FetchBucketPropsResponse),
+		buckets:     make(map[string]*FetchBucketPropsResponse),
+	}
+}
+
+func (e *testBucketSchemaExecutor) Execute(cmd Command) error {
+	notFound := RiakError{Errmsg: "notfound"}
+	switch c := cmd.(type) {
+	case *FetchSchemaCommand:
+		content, ok := e.schemas[string(c.protobuf.Name)]
+		if !ok {
+			return notFound
+		}
+		c.Response = &Schema{Name: string(c.protobuf.Name), Content: content}
+	case *FetchIndexCommand:
+		index, ok := e.indexes[string(c.protobuf.Name)]
+		if !ok {
+			return notFound
+		}
+		c.Response = []*SearchIndex{index}
+	case *FetchBucketTypePropsCommand:
+		props, ok := e.bucketTypes[string(c.protobuf.Type)]
+		if !ok {
+			return RiakError{Errmsg: "no_type"}
+		}
+		c.Response = props
+	case *FetchBucketPropsCommand:
+		props, ok := e.buckets[string(c.protobuf.Type)+"/"+string(c.protobuf.Bucket)]
+		if !ok {
+			props = &FetchBucketPropsResponse{NVal: 3}
+		}
+		c.Response = props
+	default:
+		e.stored = append(e.stored, cmd)
+	}
+	return nil
+}
+
+const testBucketSchemaConfig = `{
+	"schemas": [{"name": "animals", "content": "<schema/>"}],
+	"indexes": [{"name": "animals", "schema": "animals", "n_val": 3}],
+	"bucket_types": [{
+		"name": "maps",
+		"props": {"n_val": 3, "allow_mult": true, "datatype": "map", "hll_precision": 12},
+		"buckets": [{
+			"name": "dogs",
+			"props": {"search_index": "animals", "precommit": [{"modfun": {"module": "validate", "function": "precommit"}}]}
+		}]
+	}]
+}`
+
+func TestParseBucketSchemaConfig(t *testing.T) {
+	config, err := ParseBucketSchemaConfig([]byte(testBucketSchemaConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucketType := config.BucketTypes[0]
+	if expected, actual := uint32(3), *bucketType.Props.NVal; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "map", bucketType.Props.DataType; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if bucketType.Props.LastWriteWins != nil {
+		t.Error("expected last_write_wins to be unset")
+	}
+	hook := bucketType.Buckets[0].Props.PreCommit[0]
+	if expected, actual := "validate", hook.ModFun.Module; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	invalid := []struct {
+		config   string
+		expected error
+	}{
+		{`{"indexes": [{"schema": "animals"}]}`, ErrBucketSchemaConfigNameRequired},
+		{`{"schemas": [{"name": "animals"}]}`, ErrBucketSchemaConfigSchemaSource},
+		{`{"bucket_types": [{"name": "maps", "props": {"hll_precision": 17}}]}`, ErrBucketSchemaConfigHllPrecision},
+		{`{"bucket_types": [{"name": "maps", "buckets": [{"name": "dogs", "props": {"datatype": "map"}}]}]}`, ErrBucketSchemaConfigBucketType},
+	}
+	for _, i := range invalid {
+		if _, err := ParseBucketSchemaConfig([]byte(i.config)); err != i.expected {
+			t.Errorf("%s: expected %v, got %v", i.config, i.expected, err)
+		}
+	}
+	if _, err := ParseBucketSchemaConfig([]byte(`{"schemas": `)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestLoadBucketSchemaConfigReadsSchemaFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riak-go-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "animals.xml"), []byte("<schema/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "riak.json")
+	if err = ioutil.WriteFile(path, []byte(`{"schemas": [{"name": "animals", "file": "animals.xml"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadBucketSchemaConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "<schema/>", config.Schemas[0].Content; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestBucketSchemaConfigApplyReadsSchemaFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riak-go-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "animals.xml")
+	if err = ioutil.WriteFile(path, []byte("<schema/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&BucketSchemaConfig{
+		Schemas: []*SearchSchemaDefinition{{Name: "animals", File: path}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := ParseBucketSchemaConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor := newTestBucketSchemaExecutor()
+	if _, err = config.Apply(executor); err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 1, len(executor.stored); e != a {
+		t.Fatalf("expected %v, got %v", e, a)
+	}
+	schema, ok := executor.stored[0].(*StoreSchemaCommand)
+	if !ok {
+		t.Fatalf("expected StoreSchemaCommand, got %v", executor.stored[0].Name())
+	}
+	if e, a := "<schema/>", string(schema.protobuf.Schema.Content); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+
+	executor.schemas["animals"] = "<schema/>\n"
+	changes, err := config.Diff(executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 0, len(changes); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+
+	config.Schemas[0].File = filepath.Join(dir, "missing.xml")
+	if _, err = config.Diff(executor); err == nil {
+		t.Error("expected an error for a missing schema file")
+	}
+}
+
+func TestBucketSchemaConfigDiffAndApply(t *testing.T) {
+	config, err := ParseBucketSchemaConfig([]byte(testBucketSchemaConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := newTestBucketSchemaExecutor()
+	executor.bucketTypes["maps"] = &FetchBucketPropsResponse{
+		NVal:         3,
+		AllowMult:    false,
+		DataType:     "map",
+		HllPrecision: 14,
+	}
+
+	changes, err := config.Diff(executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, change := range changes {
+		actual = append(actual, change.String())
+	}
+	expected := []string{
+		"create schema animals",
+		"create index animals",
+		"bucket_type maps: allow_mult false -> true",
+		"bucket_type maps: hll_precision 14 -> 12",
+		`bucket maps/dogs: search_index "" -> "animals"`,
+		"bucket maps/dogs: precommit [] -> [validate:precommit]",
+	}
+	if e, a := strings.Join(expected, "\n"), strings.Join(actual, "\n"); e != a {
+		t.Errorf("expected\n%v\ngot\n%v", e, a)
+	}
+	if len(executor.stored) != 0 {
+		t.Errorf("expected Diff not to store anything, got %v", executor.stored)
+	}
+
+	applied, err := config.Apply(executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := len(changes), len(applied); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	// NB: one command per object, not per property
+	if e, a := 4, len(executor.stored); e != a {
+		t.Fatalf("expected %v, got %v", e, a)
+	}
+	if _, ok := executor.stored[0].(*StoreSchemaCommand); !ok {
+		t.Errorf("expected StoreSchemaCommand, got %v", executor.stored[0].Name())
+	}
+	index, ok := executor.stored[1].(*StoreIndexCommand)
+	if !ok {
+		t.Fatalf("expected StoreIndexCommand, got %v", executor.stored[1].Name())
+	}
+	if e, a := "animals", string(index.protobuf.Index.Schema); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	bucketType, ok := executor.stored[2].(*StoreBucketTypePropsCommand)
+	if !ok {
+		t.Fatalf("expected StoreBucketTypePropsCommand, got %v", executor.stored[2].Name())
+	}
+	props := bucketType.protobuf.Props
+	if props.NVal != nil {
+		t.Error("expected unchanged n_val not to be written")
+	}
+	if e, a := true, props.GetAllowMult(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := uint32(12), props.GetHllPrecision(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	bucket, ok := executor.stored[3].(*StoreBucketPropsCommand)
+	if !ok {
+		t.Fatalf("expected StoreBucketPropsCommand, got %v", executor.stored[3].Name())
+	}
+	if e, a := "animals", string(bucket.protobuf.Props.SearchIndex); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := "validate", string(bucket.protobuf.Props.Precommit[0].Modfun.Module); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func TestBucketSchemaConfigDiffUnchanged(t *testing.T) {
+	config, err := ParseBucketSchemaConfig([]byte(testBucketSchemaConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := newTestBucketSchemaExecutor()
+	executor.schemas["animals"] = "<schema/>\n"
+	executor.indexes["animals"] = &SearchIndex{Name: "animals", Schema: "animals", NVal: 3}
+	executor.bucketTypes["maps"] = &FetchBucketPropsResponse{
+		NVal:         3,
+		AllowMult:    true,
+		DataType:     "map",
+		HllPrecision: 12,
+	}
+	executor.buckets["maps/dogs"] = &FetchBucketPropsResponse{
+		SearchIndex:  "animals",
+		HasPrecommit: true,
+		PreCommit:    []*CommitHook{{ModFun: &ModFun{Module: "validate", Function: "precommit"}}},
+	}
+
+	changes, err := config.Apply(executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 0, len(changes); e != a {
+		t.Errorf("expected %v, got %v: %v", e, a, changes)
+	}
+	if e, a := 0, len(executor.stored); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func TestBucketSchemaConfigDiffReturnsErrorsForImmutableProperties(t *testing.T) {
+	config, err := ParseBucketSchemaConfig([]byte(testBucketSchemaConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor := newTestBucketSchemaExecutor()
+	executor.indexes["animals"] = &SearchIndex{Name: "animals", Schema: "_yz_default", NVal: 3}
+	if _, err = config.Diff(executor); err == nil || !strings.Contains(err.Error(), "schema '_yz_default'") {
+		t.Errorf("expected index schema error, got %v", err)
+	}
+
+	executor = newTestBucketSchemaExecutor()
+	executor.bucketTypes["maps"] = &FetchBucketPropsResponse{DataType: "set"}
+	if _, err = config.Diff(executor); err == nil || !strings.Contains(err.Error(), "datatype 'set'") {
+		t.Errorf("expected datatype error, got %v", err)
+	}
+
+	executor = newTestBucketSchemaExecutor()
+	if _, err = config.Diff(executor); err == nil || !strings.Contains(err.Error(), "bucket type maps") {
+		t.Errorf("expected missing bucket type error, got %v", err)
+	}
+}
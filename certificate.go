@@ -0,0 +1,151 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertificateReloader loads a client certificate and key from PEM files and
+// reloads them when either file changes, so that certificates can be rotated
+// without restarting the Cluster. Use it by setting GetClientCertificate on the
+// tls.Config in AuthOptions:
+//
+//	reloader, err := riak.NewCertificateReloader("client-cert.pem", "client-key.pem")
+//	tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+type CertificateReloader struct {
+	certFile    string
+	keyFile     string
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	sync.RWMutex
+}
+
+// NewCertificateReloader returns a CertificateReloader for the provided files,
+// which must contain a valid certificate and key
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate and key from disk. If they cannot be loaded the
+// previous certificate continues to be used and an error is returned
+func (r *CertificateReloader) Reload() error {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.cert = &cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	return nil
+}
+
+// Certificate returns the currently loaded certificate
+func (r *CertificateReloader) Certificate() *tls.Certificate {
+	r.RLock()
+	defer r.RUnlock()
+	return r.cert
+}
+
+// GetClientCertificate implements the tls.Config function of the same name,
+// reloading the certificate first if its files have changed
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if r.isChanged() {
+		if err := r.Reload(); err != nil {
+			logErr("[CertificateReloader]", err)
+		} else {
+			logDebug("[CertificateReloader]", "reloaded certificate from %s", r.certFile)
+		}
+	}
+	return r.Certificate(), nil
+}
+
+func (r *CertificateReloader) isChanged() bool {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		// NB: files may be mid-rotation, keep using the current certificate
+		return false
+	}
+	r.RLock()
+	defer r.RUnlock()
+	return !certModTime.Equal(r.certModTime) || !keyModTime.Equal(r.keyModTime)
+}
+
+func (r *CertificateReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// clientCertificate returns the client certificate that config will present
+func clientCertificate(config *tls.Config) (*x509.Certificate, error) {
+	var cert *tls.Certificate
+	if config.GetClientCertificate != nil {
+		var err error
+		if cert, err = config.GetClientCertificate(&tls.CertificateRequestInfo{}); err != nil {
+			return nil, err
+		}
+	} else if len(config.Certificates) > 0 {
+		cert = &config.Certificates[0]
+	}
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, ErrAuthMissingCertificate
+	}
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// nodeTlsConfig returns a copy of config for a single Node, with a session
+// cache shared by the connections in the Node's pool so that connections
+// after the first can resume a TLS session rather than perform a full
+// handshake
+func nodeTlsConfig(config *tls.Config, maxConnections uint16) *tls.Config {
+	c := config.Clone()
+	if c.ClientSessionCache == nil && !c.SessionTicketsDisabled {
+		c.ClientSessionCache = tls.NewLRUClientSessionCache(int(maxConnections))
+	}
+	return c
+}
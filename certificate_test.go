@@ -0,0 +1,211 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCertificate returns a self-signed certificate and key in PEM format
+func newTestCertificate(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem
+}
+
+func newTestTlsCertificate(t *testing.T, commonName string) tls.Certificate {
+	certPem, keyPem := newTestCertificate(t, commonName)
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writeTestCertificate(t *testing.T, dir, commonName string, modTime time.Time) (string, string) {
+	certPem, keyPem := newTestCertificate(t, commonName)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	for file, data := range map[string][]byte{certFile: certPem, keyFile: keyPem} {
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func TestCertificateReloaderReloadsChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riak-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	certFile, keyFile := writeTestCertificate(t, dir, "riakuser", now.Add(-time.Minute))
+	r, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := r.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "riakuser", cert.Leaf.Subject.CommonName; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	writeTestCertificate(t, dir, "rotated", now)
+	if cert, err = r.GetClientCertificate(nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "rotated", cert.Leaf.Subject.CommonName; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// NB: an invalid certificate is not loaded
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(certFile, now.Add(time.Minute), now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = r.GetClientCertificate(nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "rotated", cert.Leaf.Subject.CommonName; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestCreateCertificateReloaderWithMissingFiles(t *testing.T) {
+	if _, err := NewCertificateReloader("missing-cert.pem", "missing-key.pem"); err == nil {
+		t.Error("expected non-nil error")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	if _, err := clientCertificate(&tls.Config{}); err != ErrAuthMissingCertificate {
+		t.Errorf("expected %v, got %v", ErrAuthMissingCertificate, err)
+	}
+
+	cert := newTestTlsCertificate(t, "riakuser")
+	x509Cert, err := clientCertificate(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "riakuser", x509Cert.Subject.CommonName; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	x509Cert, err = clientCertificate(&tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "riakuser", x509Cert.Subject.CommonName; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestNodeTlsConfigHasSessionCache(t *testing.T) {
+	config := &tls.Config{
+		ServerName: "riak-test",
+	}
+	nodeConfig := nodeTlsConfig(config, 4)
+	if nodeConfig == config {
+		t.Error("expected a copy of the TLS config")
+	}
+	if config.ClientSessionCache != nil {
+		t.Error("expected original TLS config to be unchanged")
+	}
+	if nodeConfig.ClientSessionCache == nil {
+		t.Error("expected TLS config to have a session cache")
+	}
+	if expected, actual := "riak-test", nodeConfig.ServerName; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	config.SessionTicketsDisabled = true
+	if nodeTlsConfig(config, 4).ClientSessionCache != nil {
+		t.Error("expected no session cache when session tickets are disabled")
+	}
+}
+
+func TestNodeSessionCachesAreNotShared(t *testing.T) {
+	authOptions := &AuthOptions{
+		User:      "riakuser",
+		TlsConfig: &tls.Config{},
+	}
+	var caches []tls.ClientSessionCache
+	for i := 0; i < 2; i++ {
+		node, err := NewNode(&NodeOptions{
+			AuthOptions: authOptions,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		caches = append(caches, node.cm.authOptions.TlsConfig.ClientSessionCache)
+	}
+	if caches[0] == nil || caches[0] == caches[1] {
+		t.Error("expected each node to have its own session cache")
+	}
+	if authOptions.TlsConfig.ClientSessionCache != nil {
+		t.Error("expected AuthOptions to be unchanged")
+	}
+}
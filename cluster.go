@@ -38,18 +38,28 @@ type ClusterOptions struct {
 	ExecutionAttempts      byte
 	QueueMaxDepth          uint16
 	QueueExecutionInterval time.Duration
+	CommandDeadlines       map[string]time.Duration // NB: keyed by command type, e.g. "FetchValue"
+	HedgeOptions           *HedgeOptions
+	RateLimit              *RateLimitOptions
+	CommandRateLimits      map[string]*RateLimitOptions // NB: keyed by command type, e.g. "FetchValue"
+	ConcurrencyLimit       *ConcurrencyLimitOptions
 }
 
 // Cluster object contains your pool of Node objects, the NodeManager and the
 // current stateData object of the cluster
 type Cluster struct {
-	stopChan           chan struct{}
-	nodes              []*Node
-	nodeManager        NodeManager
-	executionAttempts  byte
-	queueCommands      bool
-	cq                 *queue
-	commandQueueTicker *time.Ticker
+	stopChan          chan struct{}
+	nodes             []*Node
+	nodeManager       NodeManager
+	executionAttempts byte
+	queueCommands     bool
+	cq                *commandQueue
+	queueInterval     time.Duration
+	deadlines         map[string]time.Duration
+	hedger            *hedger
+	limiter           *limiter
+	observer          CommandObserver
+	observerMutex     sync.RWMutex
 	sync.Mutex
 	stateData
 }
@@ -62,6 +72,8 @@ var (
 	ErrClusterEnqueueWhileShuttingDown        = newClientError("[Cluster] will not enqueue command, shutting down", nil)
 	ErrClusterShuttingDown                    = newClientError("[Cluster] will not execute command, shutting down", nil)
 	ErrClusterNodeMustBeNonNil                = newClientError("[Cluster] node argument must be non-nil", nil)
+	ErrClusterCommandDeadlineExceeded         = newClientError("[Cluster] command deadline exceeded", nil)
+	ErrClusterCommandCancelled                = newClientError("[Cluster] command cancelled", nil)
 )
 
 const ErrClusterNoNodesAvailable = "[Cluster] all retries exhausted and/or no nodes available to execute command"
@@ -87,6 +99,11 @@ func NewCluster(options *ClusterOptions) (*Cluster, error) {
 	c := &Cluster{
 		executionAttempts: options.ExecutionAttempts,
 		nodeManager:       options.NodeManager,
+		deadlines:         options.CommandDeadlines,
+		limiter:           newLimiter(options),
+	}
+	if options.HedgeOptions != nil {
+		c.hedger = newHedger(options.HedgeOptions)
 	}
 	c.initStateData("clusterCreated", "clusterRunning", "clusterShuttingDown", "clusterShutdown", "clusterError")
 
@@ -116,8 +133,11 @@ func NewCluster(options *ClusterOptions) (*Cluster, error) {
 		}
 		c.queueCommands = true
 		c.stopChan = make(chan struct{})
-		c.cq = newQueue(options.QueueMaxDepth)
-		c.commandQueueTicker = time.NewTicker(options.QueueExecutionInterval)
+		c.cq = newCommandQueue(options.QueueMaxDepth)
+		c.queueInterval = options.QueueExecutionInterval
+		for _, node := range c.nodes {
+			node.addAvailableChan(c.cq.waitChan)
+		}
 		go c.executeEnqueuedCommands()
 	}
 
@@ -146,8 +166,21 @@ func (c *Cluster) Start() error {
 
 	c.Lock()
 	defer c.Unlock()
-	for _, node := range c.nodes {
-		if err := node.start(); err != nil {
+
+	// NB: nodes are started in parallel so that warming up each
+	// connection pool does not delay the others
+	errs := make([]error, len(c.nodes))
+	wg := &sync.WaitGroup{}
+	for i, node := range c.nodes {
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			errs[i] = node.start()
+		}(i, node)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
 			return err
 		}
 	}
@@ -171,24 +204,13 @@ func (c *Cluster) Stop() (err error) {
 
 	if c.queueCommands {
 		close(c.stopChan)
-		c.commandQueueTicker.Stop()
-		qc := c.cq.count()
-		if qc > 0 {
-			logWarn("[Cluster]", "commands in queue during shutdown: %d", qc)
-			var f = func(v interface{}) (bool, bool) {
-				if v == nil {
-					return true, false
-				}
-				if a, ok := v.(*Async); ok {
-					a.done(ErrClusterShuttingDown)
-				}
-				return false, false
-			}
-			if qerr := c.cq.iterate(f); qerr != nil {
-				logErr("[Cluster]", qerr)
+		asyncs := c.cq.drain()
+		if len(asyncs) > 0 {
+			logWarn("[Cluster]", "commands in queue during shutdown: %d", len(asyncs))
+			for _, a := range asyncs {
+				c.commandDone(a, ErrClusterShuttingDown)
 			}
 		}
-		c.cq.destroy()
 	}
 
 	c.Lock()
@@ -220,6 +242,22 @@ func (c *Cluster) Stop() (err error) {
 	return
 }
 
+// isHealthy returns true if the Cluster is running and at least one of its
+// Nodes is running
+func (c *Cluster) isHealthy() bool {
+	if !c.isCurrentState(clusterRunning) {
+		return false
+	}
+	c.Lock()
+	defer c.Unlock()
+	for _, node := range c.nodes {
+		if node.isCurrentState(nodeRunning) {
+			return true
+		}
+	}
+	return false
+}
+
 // Adds a node to the cluster and starts it
 func (c *Cluster) AddNode(n *Node) error {
 	if n == nil {
@@ -237,6 +275,9 @@ func (c *Cluster) AddNode(n *Node) error {
 			return err
 		}
 	}
+	if c.queueCommands {
+		n.addAvailableChan(c.cq.waitChan)
+	}
 	c.nodes = append(c.nodes, n)
 	return nil
 }
@@ -253,6 +294,9 @@ func (c *Cluster) RemoveNode(n *Node) error {
 		if n == node {
 			l := len(cn) - 1
 			cn[i], cn[l], c.nodes = cn[l], nil, cn[:l]
+			if c.queueCommands {
+				node.removeAvailableChan(c.cq.waitChan)
+			}
 			if !node.isCurrentState(nodeCreated) {
 				if err := node.stop(); err != nil {
 					return err
@@ -284,17 +328,29 @@ func (c *Cluster) Execute(command Command) error {
 	if command == nil {
 		return ErrClusterCommandRequired
 	}
+	_, err := c.executeAndWait(command)
+	return err
+}
+
+// executeAndWait executes the Command and waits for it to complete, returning
+// its Async and the error of the execution or of the Command
+func (c *Cluster) executeAndWait(command Command) (*Async, error) {
 	async := &Async{
 		Command: command,
+		Wait:    &sync.WaitGroup{},
 	}
+	// NB: the command may be enqueued, in which case it completes on
+	// another goroutine
+	async.Wait.Add(1)
 	c.execute(async)
+	async.Wait.Wait()
 	if async.Error != nil {
-		return async.Error
+		return async, async.Error
 	}
 	if cerr := command.Error(); cerr != nil {
-		return cerr
+		return async, cerr
 	}
-	return nil
+	return async, nil
 }
 
 // NB: will be executed in a goroutine
@@ -318,14 +374,47 @@ func (c *Cluster) execute(async *Async) {
 	}
 
 	async.onExecute()
+	if c.limiter != nil && !async.internal && !async.admitted {
+		// NB: shed load before the command can reach a node or the queue
+		if err = c.limiter.admit(commandTypeName(cmd)); err != nil {
+			logDebug("[Cluster]", "rejected cmd '%s': %v", cmd.Name(), err)
+			c.commandDone(async, err)
+			return
+		}
+		async.admitted = true
+	}
+	if async.deadline.IsZero() {
+		if d, ok := c.deadlines[commandTypeName(cmd)]; ok && d > 0 {
+			async.deadline = async.startedAt.Add(d)
+		}
+	}
+	if dc, ok := cmd.(deadlineCommand); ok && !async.deadline.IsZero() {
+		dc.setDeadline(async.deadline)
+	}
+	if !async.internal {
+		if hc, ok := c.getHedgeableCommand(cmd); ok {
+			c.executeHedged(async, hc)
+			return
+		}
+	}
 	for tries > 0 {
 		if err = c.stateCheck(clusterRunning); err != nil {
 			break
 		}
+		if async.isCancelled() {
+			err = ErrClusterCommandCancelled
+			break
+		}
+		if async.isPastDeadline() {
+			err = ErrClusterCommandDeadlineExceeded
+			break
+		}
+		async.attempts++
 		executed, err = c.nodeManager.ExecuteOnNode(c.nodes, cmd, lastExeNode)
 		// NB: do *not* call cmd.onError here as it will have been called in connection
 		if executed {
 			// NB: "executed" means that a node sent the data to Riak and received a response
+			async.sent = true
 			if err == nil {
 				// No need to re-try
 				logDebug("[Cluster]", "successfully executed cmd '%s'", cmd.Name())
@@ -336,16 +425,18 @@ func (c *Cluster) execute(async *Async) {
 			}
 		} else {
 			// Command did NOT execute
-			if err == nil {
-				logDebug("[Cluster]", "did NOT execute cmd '%s', nil err", cmd.Name())
-				// Command did not execute but there was no error, so enqueue it
+			if c.queueCommands && (err == nil || err == ErrConnMgrAllConnectionsInUse) {
+				// Command did not execute because no connection was available,
+				// so enqueue it until a Node signals that one has been returned
 				// TODO FUTURE should this only happen if retries exhausted?
-				if c.queueCommands {
-					if err = c.enqueueCommand(async); err == nil {
-						enqueued = true
-					}
-					break
+				logDebug("[Cluster]", "did NOT execute cmd '%s', enqueuing due to '%v'", cmd.Name(), err)
+				if err = c.enqueueCommand(async); err == nil {
+					enqueued = true
 				}
+				break
+			}
+			if err == nil {
+				logDebug("[Cluster]", "did NOT execute cmd '%s', nil err", cmd.Name())
 			} else {
 				// NB: retry since error occurred
 				logDebug("[Cluster]", "did NOT execute cmd '%s': re-try due to error '%v'", cmd.Name(), err)
@@ -363,8 +454,32 @@ func (c *Cluster) execute(async *Async) {
 		}
 	}
 	if !enqueued {
-		async.done(err)
+		c.commandDone(async, err)
+	}
+}
+
+// commandDone is called once a command has finished executing, successfully
+// or not
+func (c *Cluster) commandDone(async *Async, err error) {
+	if !async.internal {
+		c.traceCommand(async, err)
 	}
+	if async.admitted {
+		c.limiter.release(async, err)
+	}
+	async.done(err)
+}
+
+// freeConnections returns the number of commands the running nodes can
+// execute without waiting for a connection
+func (c *Cluster) freeConnections() int {
+	c.Lock()
+	defer c.Unlock()
+	free := 0
+	for _, node := range c.nodes {
+		free += node.freeConnections()
+	}
+	return free
 }
 
 func (c *Cluster) enqueueCommand(async *Async) error {
@@ -372,55 +487,46 @@ func (c *Cluster) enqueueCommand(async *Async) error {
 	if c.isStateLessThan(clusterShuttingDown) {
 		command := async.Command
 		logDebug("[Cluster]", "enqueuing command '%s'", command.Name())
-		async.onEnqueued()
 		err = c.cq.enqueue(async)
-		if err != nil {
-			async.done(err)
-		}
 	} else {
 		err = ErrClusterEnqueueWhileShuttingDown
-		async.done(err)
 	}
+	// NB: on error, the caller completes the command
 	return err
 }
 
+// executeEnqueuedCommands dispatches queued commands, oldest first, whenever a
+// Node signals that a connection has been returned to its pool or that it has
+// recovered. Only as many commands are dispatched as there are free
+// connections, and at least the oldest, so that the rest keep their place in
+// the queue rather than all racing for connections. Commands that
+// still cannot execute are put back in their original position. The queue is
+// also checked every QueueExecutionInterval in case a signal arrived before a
+// command was enqueued
 func (c *Cluster) executeEnqueuedCommands() {
 	logDebug("[Cluster]", "(%v) command queue routine is starting", c)
+	ticker := time.NewTicker(c.queueInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-c.stopChan:
 			logDebug("[Cluster]", "(%v) command queue routine is quitting", c)
 			return
-		case t := <-c.commandQueueTicker.C:
-			// NB: ensure we're not already shutting down
-			if c.isStateLessThan(clusterShuttingDown) {
-				var f = func(v interface{}) (bool, bool) {
-					if !c.isStateLessThan(clusterShuttingDown) {
-						logDebug("[Cluster]", "(%v) shutting down, command queue routine is quitting")
-						return true, false
-					}
-					if v == nil {
-						return true, false
-					}
-					var re_enqueue bool
-					async := v.(*Async)
-					if t.After(async.executeAt) {
-						re_enqueue = false
-						logDebug("[Cluster]", "(%v) executing queued command '%s' at %v", c, async.Command.Name(), t)
-						go c.execute(async) // NB: *may* re-enqueue, so goroutine required
-					} else {
-						re_enqueue = true
-						logDebug("[Cluster]", "(%v) skipping queued command '%s'", c, async.Command.Name())
-					}
-					return false, re_enqueue
-				}
-				if qerr := c.cq.iterate(f); qerr != nil {
-					logErr("[Cluster]", qerr)
-				}
-			} else {
-				logDebug("[Cluster]", "(%v) shutting down, command queue routine is quitting")
-				return
-			}
+		case <-c.cq.waitChan:
+		case <-ticker.C:
+		}
+		// NB: ensure we're not already shutting down
+		if !c.isStateLessThan(clusterShuttingDown) {
+			logDebug("[Cluster]", "(%v) shutting down, command queue routine is quitting", c)
+			return
+		}
+		free := c.freeConnections()
+		if free < 1 {
+			free = 1
+		}
+		for _, async := range c.cq.dequeue(free) {
+			logDebug("[Cluster]", "(%v) executing queued command '%s'", c, async.Command.Name())
+			go c.execute(async) // NB: *may* re-enqueue, so goroutine required
 		}
 	}
 }
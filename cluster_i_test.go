@@ -525,3 +525,142 @@ func TestRecoverFromReadTimeout(t *testing.T) {
 		}
 	}
 }
+
+func TestHedgedFetchValueUsesFirstResponse(t *testing.T) {
+	var onConn = func(slow bool) func(c net.Conn) bool {
+		return func(c net.Conn) bool {
+			if _, err := readClientMessage(c); err != nil {
+				c.Close()
+				return true
+			}
+			if slow {
+				time.Sleep(time.Second)
+			}
+			// NB: an empty RpbGetResp is a "not found" response
+			if _, err := c.Write(buildRiakMessage(rpbCode_RpbGetResp, nil)); err != nil {
+				c.Close()
+				return true
+			}
+			return false
+		}
+	}
+
+	nodes := make([]*Node, 2)
+	for i := 0; i < len(nodes); i++ {
+		o := &testListenerOpts{
+			test:   t,
+			onConn: onConn(i == 0),
+		}
+		tl := newTestListener(o)
+		defer tl.stop()
+		tl.start()
+
+		nodeOpts := &NodeOptions{
+			MinConnections: 1,
+			MaxConnections: 2,
+			RemoteAddress:  tl.addr.String(),
+		}
+		node, err := NewNode(nodeOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = node
+	}
+
+	opts := &ClusterOptions{
+		Nodes: nodes,
+		HedgeOptions: &HedgeOptions{
+			Delay: time.Millisecond * 50,
+		},
+	}
+	cluster, err := NewCluster(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Stop(); err != nil {
+			t.Error(err.Error())
+		}
+	}()
+
+	cmd, err := NewFetchValueCommandBuilder().
+		WithBucket("b").
+		WithKey("k").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := cluster.Execute(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected hedged request to complete before slow node responded, took %v", elapsed)
+	}
+	fcmd := cmd.(*FetchValueCommand)
+	if fcmd.Response == nil || !fcmd.Response.IsNotFound {
+		t.Errorf("expected not found response, got %v", fcmd.Response)
+	}
+	if expected, actual := nodes[1], fcmd.getExecutedOn(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestCommandDeadlineExceeded(t *testing.T) {
+	var onConn = func(c net.Conn) bool {
+		if _, err := readClientMessage(c); err != nil {
+			c.Close()
+			return true
+		}
+		time.Sleep(time.Millisecond * 500)
+		if _, err := c.Write(buildRiakMessage(rpbCode_RpbPingResp, nil)); err != nil {
+			c.Close()
+			return true
+		}
+		return false
+	}
+	o := &testListenerOpts{
+		test:   t,
+		onConn: onConn,
+	}
+	tl := newTestListener(o)
+	defer tl.stop()
+	tl.start()
+
+	node, err := NewNode(&NodeOptions{
+		RemoteAddress: tl.addr.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &ClusterOptions{
+		Nodes: []*Node{node},
+		CommandDeadlines: map[string]time.Duration{
+			"Ping": time.Millisecond * 100,
+		},
+	}
+	cluster, err := NewCluster(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Stop(); err != nil {
+			t.Error(err.Error())
+		}
+	}()
+
+	start := time.Now()
+	err = cluster.Execute(&PingCommand{})
+	if expected, actual := ErrClusterCommandDeadlineExceeded, err; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Millisecond*500 {
+		t.Errorf("expected command to fail at its deadline, took %v", elapsed)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 )
 
 func TestCreateClusterWithDefaultOptions(t *testing.T) {
@@ -183,6 +184,95 @@ func TestCreateClusterWithFourNodes(t *testing.T) {
 	}
 }
 
+func TestClusterStats(t *testing.T) {
+	cluster, err := NewCluster(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := cluster.Stats()
+	if expected, actual := "clusterCreated", stats.State; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint16(0), stats.QueueMaxDepth; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 1, len(stats.Nodes); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	ns := stats.Nodes[0]
+	if expected, actual := defaultRemoteAddress, ns.Address; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "nodeCreated", ns.State; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := defaultMinConnections, ns.MinConnections; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := defaultMaxConnections, ns.MaxConnections; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint16(0), ns.OpenConnections; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+type testCommandObserver struct {
+	traces []*CommandTrace
+}
+
+func (o *testCommandObserver) CommandExecuted(trace *CommandTrace) {
+	o.traces = append(o.traces, trace)
+}
+
+func TestClusterNotifiesCommandObserver(t *testing.T) {
+	opts := &ClusterOptions{
+		NoDefaultNode:     true,
+		ExecutionAttempts: 1,
+	}
+	cluster, err := NewCluster(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cluster.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Stop()
+	o := &testCommandObserver{}
+	cluster.SetCommandObserver(o)
+	cmd := &PingCommand{}
+	if err = cluster.Execute(cmd); err == nil {
+		t.Error("expected non-nil error executing without nodes")
+	}
+	if expected, actual := 1, len(o.traces); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	trace := o.traces[0]
+	if expected, actual := cmd.Name(), trace.Command; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "", trace.Node; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := byte(1), trace.Attempts; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if trace.Start.IsZero() {
+		t.Error("expected non-zero start time")
+	}
+	if trace.Error == nil {
+		t.Error("expected trace to include error")
+	}
+
+	cluster.SetCommandObserver(nil)
+	if err = cluster.Execute(&PingCommand{}); err == nil {
+		t.Error("expected non-nil error executing without nodes")
+	}
+	if expected, actual := 1, len(o.traces); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
 func ExampleNewCluster() {
 	cluster, err := NewCluster(nil)
 	if err != nil {
@@ -191,3 +281,85 @@ func ExampleNewCluster() {
 	fmt.Println(cluster.nodes[0].addr.String())
 	// Output: 127.0.0.1:8087
 }
+
+func TestClusterExecutesQueuedCommandWhenNodeSignals(t *testing.T) {
+	node, err := NewNode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := NewCluster(&ClusterOptions{
+		Nodes:                  []*Node{node},
+		QueueMaxDepth:          4,
+		QueueExecutionInterval: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(cluster.stopChan)
+
+	async := &Async{
+		Command: &PingCommand{},
+		Done:    make(chan Command, 1),
+	}
+	if err := cluster.enqueueCommand(async); err != nil {
+		t.Fatal(err)
+	}
+	node.notifyAvailable()
+
+	select {
+	case <-async.Done:
+		// NB: cluster was never started, so execution fails, but the command
+		// must have been taken from the queue well before the next interval
+		if async.Error == nil {
+			t.Error("expected error executing command on cluster that is not running")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected queued command to execute when node signaled availability")
+	}
+	if expected, actual := uint16(0), cluster.cq.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestClusterDispatchesQueuedCommandsInOrderUpToFreeConnections(t *testing.T) {
+	node, err := NewNode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := NewCluster(&ClusterOptions{
+		Nodes:                  []*Node{node},
+		QueueMaxDepth:          4,
+		QueueExecutionInterval: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(cluster.stopChan)
+
+	asyncs := make([]*Async, 3)
+	for i := range asyncs {
+		asyncs[i] = &Async{
+			Command: &PingCommand{},
+			Done:    make(chan Command, 1),
+		}
+		if err := cluster.enqueueCommand(asyncs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// NB: the node is not running so has no free connections, and only the
+	// oldest command is dispatched
+	node.notifyAvailable()
+	select {
+	case <-asyncs[0].Done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected oldest queued command to execute when node signaled availability")
+	}
+	if expected, actual := uint16(2), cluster.cq.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	for _, a := range asyncs[1:] {
+		if a.queueSeq == 0 {
+			t.Error("expected queued command to keep its sequence number")
+		}
+	}
+}
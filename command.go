@@ -18,6 +18,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -35,24 +37,53 @@ type retryableCommand interface {
 
 // Implementation of retryableCommand
 type retryableCommandImpl struct {
-	lastNode *Node
+	lastNode      *Node
+	lastNodeMutex sync.RWMutex // NB: a hedged request reads lastNode while it is executing
 }
 
 func (cmd *retryableCommandImpl) setLastNode(lastNode *Node) {
 	if lastNode == nil {
 		panic("[retryableCommandImpl] nil last node")
 	}
+	cmd.lastNodeMutex.Lock()
+	defer cmd.lastNodeMutex.Unlock()
 	cmd.lastNode = lastNode
 }
 
 func (cmd *retryableCommandImpl) getLastNode() *Node {
+	cmd.lastNodeMutex.RLock()
+	defer cmd.lastNodeMutex.RUnlock()
 	return cmd.lastNode
 }
 
+// Interface implemented by read Command types that can be executed on more
+// than one node at once, see HedgeOptions
+type hedgeableCommand interface {
+	// hedgeClone returns a new Command for the same request
+	hedgeClone() Command
+	// hedgeAdopt copies the outcome of a Command returned by hedgeClone
+	hedgeAdopt(Command)
+}
+
+// Interface implemented by Command types that record the Node they were
+// executed on
+type executedOnCommand interface {
+	setExecutedOn(*Node)
+	getExecutedOn() *Node
+}
+
+// Interface implemented by Command types that must complete by a deadline
+type deadlineCommand interface {
+	setDeadline(time.Time)
+	getDeadline() time.Time
+}
+
 type commandImpl struct {
-	error   error
-	success bool
-	name    string
+	error      error
+	success    bool
+	name       string
+	executedOn *Node
+	deadline   time.Time
 }
 
 func (cmd *commandImpl) Success() bool {
@@ -72,6 +103,29 @@ func (cmd *commandImpl) onRetry() {
 	cmd.error = nil
 }
 
+func (cmd *commandImpl) setExecutedOn(n *Node) {
+	cmd.executedOn = n
+}
+
+func (cmd *commandImpl) getExecutedOn() *Node {
+	return cmd.executedOn
+}
+
+func (cmd *commandImpl) setDeadline(t time.Time) {
+	cmd.deadline = t
+}
+
+func (cmd *commandImpl) getDeadline() time.Time {
+	return cmd.deadline
+}
+
+// adopt copies the outcome of another execution of the same request
+func (cmd *commandImpl) adopt(other *commandImpl) {
+	cmd.success = other.success
+	cmd.error = other.error
+	cmd.executedOn = other.executedOn
+}
+
 func (cmd *commandImpl) getName(n string) string {
 	if n == "" {
 		panic("getName: n must not be empty")
@@ -86,6 +140,16 @@ func (cmd *commandImpl) getName(n string) string {
 	return cmd.name
 }
 
+// commandTypeName returns the name of the Command without the unique suffix
+// added when debug logging is enabled, e.g. "FetchValue"
+func commandTypeName(cmd Command) string {
+	name := cmd.Name()
+	if i := strings.IndexByte(name, '-'); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
 // Interface implemented by Command types that can be streamed
 type streamingCommand interface {
 	isDone() bool
@@ -117,6 +181,31 @@ func (cmd *listingImpl) getAllowListing() bool {
 	return cmd.allowListing
 }
 
+// Interface implemented by Commands that can be encoded with term-to-binary
+// rather than protobuf
+type ttbCommand interface {
+	isTtb() bool
+}
+
+type ttbImpl struct {
+	useTtb bool
+}
+
+func (cmd *ttbImpl) isTtb() bool {
+	return cmd.useTtb
+}
+
+func useTtb(cmd Command) bool {
+	tc, ok := cmd.(ttbCommand)
+	return ok && tc.isTtb()
+}
+
+// CommandExecutor executes a Command synchronously. It is implemented by Cluster
+// and Client
+type CommandExecutor interface {
+	Execute(cmd Command) error
+}
+
 // CommandBuilder interface requires Build() method for generating the Command
 // to be executed
 type CommandBuilder interface {
@@ -150,7 +239,12 @@ func getRiakMessage(cmd Command) (msg []byte, err error) {
 	}
 
 	var bytes []byte
-	if rpb != nil {
+	if useTtb(cmd) {
+		requestCode = rpbCode_TsTtbMsg
+		if bytes, err = encodeTsTtbRequest(rpb); err != nil {
+			return nil, err
+		}
+	} else if rpb != nil {
 		bytes, err = proto.Marshal(rpb)
 		if err != nil {
 			return nil, err
@@ -167,6 +261,13 @@ func decodeRiakMessage(cmd Command, data []byte) (msg proto.Message, err error)
 		panic(fmt.Sprintf("Must have non-zero value for getResponseCode(): %s", cmd.Name()))
 	}
 
+	if useTtb(cmd) {
+		if err = rpbValidateResp(data, rpbCode_TsTtbMsg); err != nil {
+			return
+		}
+		return decodeTsTtbResponse(data[1:], cmd.getResponseProtobufMessage())
+	}
+
 	err = rpbValidateResp(data, responseCode)
 	if err != nil {
 		return
@@ -34,10 +34,23 @@ var (
 )
 
 // AuthOptions object contains the authentication credentials and tls config
+//
+// When UseClientCertificate is true, the client certificate in TlsConfig is
+// the credential: no password is sent, and if User is empty the Common Name of
+// the certificate is used. The certificate may be provided via Certificates or
+// GetClientCertificate, see CertificateReloader.
+//
+// If CredentialsProvider is set, it is consulted each time a connection is
+// opened and User and Password are ignored.
+//
+// Each Node keeps a TLS session cache shared by the connections in its pool,
+// unless TlsConfig has its own ClientSessionCache or disables session tickets
 type AuthOptions struct {
-	User      string
-	Password  string
-	TlsConfig *tls.Config
+	User                 string
+	Password             string
+	TlsConfig            *tls.Config
+	UseClientCertificate bool
+	CredentialsProvider  CredentialsProvider
 }
 
 type connectionOptions struct {
@@ -45,6 +58,7 @@ type connectionOptions struct {
 	connectTimeout      time.Duration
 	requestTimeout      time.Duration
 	authOptions         *AuthOptions
+	credentials         *Credentials
 	tempNetErrorRetries uint16
 }
 
@@ -62,11 +76,13 @@ type connection struct {
 	requestTimeout      time.Duration
 	tempNetErrorRetries uint16
 	authOptions         *AuthOptions
+	credentials         *Credentials // NB: if nil, the User and Password in authOptions are used
 	sizeBuf             []byte
 	dataBuf             []byte
 	active              bool
 	inFlight            bool
 	lastUsed            time.Time
+	expiresAt           time.Time // NB: zero value means the connection never expires
 	stateData
 }
 
@@ -92,6 +108,7 @@ func newConnection(options *connectionOptions) (*connection, error) {
 		requestTimeout:      options.requestTimeout,
 		tempNetErrorRetries: options.tempNetErrorRetries,
 		authOptions:         options.authOptions,
+		credentials:         options.credentials,
 		sizeBuf:             make([]byte, 4),
 		dataBuf:             make([]byte, defaultInitBuffer),
 		inFlight:            false,
@@ -147,13 +164,36 @@ func (c *connection) startTls() error {
 		user:     c.authOptions.User,
 		password: c.authOptions.Password,
 	}
-	return c.execute(authCmd)
+	if c.credentials != nil {
+		authCmd.user = c.credentials.User
+		authCmd.password = c.credentials.Password
+	}
+	if c.authOptions.UseClientCertificate {
+		authCmd.password = ""
+		if authCmd.user == "" {
+			cert, err := clientCertificate(c.authOptions.TlsConfig)
+			if err != nil {
+				return AuthError{InnerError: err}
+			}
+			authCmd.user = cert.Subject.CommonName
+		}
+	}
+	err := c.execute(authCmd)
+	if _, ok := err.(RiakError); ok {
+		// NB: Riak rejected the credentials
+		return AuthError{User: authCmd.user, InnerError: err}
+	}
+	return err
 }
 
 func (c *connection) available() bool {
 	return (c.conn != nil && c.isStateLessThan(connInactive))
 }
 
+func (c *connection) isExpired(t time.Time) bool {
+	return !c.expiresAt.IsZero() && !t.Before(c.expiresAt)
+}
+
 func (c *connection) close() error {
 	if c.conn != nil {
 		err := c.conn.Close()
@@ -201,6 +241,17 @@ func (c *connection) execute(cmd Command) (err error) {
 			timeout = tc
 		}
 	}
+	// ... but never past the Command's deadline, if any
+	if dc, ok := cmd.(deadlineCommand); ok {
+		if d := dc.getDeadline(); !d.IsZero() {
+			if remaining := d.Sub(time.Now()); remaining < timeout {
+				timeout = remaining
+				if timeout < time.Millisecond {
+					timeout = time.Millisecond
+				}
+			}
+		}
+	}
 
 	if err = c.write(message, timeout); err != nil {
 		return
@@ -17,11 +17,17 @@
 package riak
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
 	"io"
 	"net"
 	"reflect"
 	"testing"
 	"time"
+
+	rpb_riak "github.com/basho/riak-go-client/rpb/riak"
+	proto "github.com/golang/protobuf/proto"
 )
 
 func TestSuccessfulConnection(t *testing.T) {
@@ -162,3 +168,255 @@ func TestConnectionSuccess(t *testing.T) {
 		t.Error("unexpected error:", err)
 	}
 }
+
+type testAuthRequest struct {
+	user      string
+	password  string
+	didResume bool
+}
+
+func TestClientCertificateAuthAndSessionResumption(t *testing.T) {
+	serverCert := newTestTlsCertificate(t, "riak-test")
+	clientCert := newTestTlsCertificate(t, "riakuser")
+	serverCertPool := x509.NewCertPool()
+	serverCertPool.AddCert(mustParseCertificate(t, serverCert))
+
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}
+	authChan := make(chan *testAuthRequest, 2)
+
+	var onConn = func(c net.Conn) bool {
+		defer c.Close()
+		if msgCode, err := readClientMessage(c); err != nil || msgCode != rpbCode_RpbStartTls {
+			t.Errorf("expected StartTls, got %v %v", msgCode, err)
+			return true
+		}
+		if _, err := c.Write(buildRiakMessage(rpbCode_RpbStartTls, nil)); err != nil {
+			t.Error(err)
+			return true
+		}
+		tlsConn := tls.Server(c, serverConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			t.Error(err)
+			return true
+		}
+
+		sizeBuf := make([]byte, 4)
+		if _, err := io.ReadFull(tlsConn, sizeBuf); err != nil {
+			t.Error(err)
+			return true
+		}
+		data := make([]byte, binary.BigEndian.Uint32(sizeBuf))
+		if _, err := io.ReadFull(tlsConn, data); err != nil {
+			t.Error(err)
+			return true
+		}
+		if data[0] != rpbCode_RpbAuthReq {
+			t.Errorf("expected auth request, got %v", data[0])
+			return true
+		}
+		req := &rpb_riak.RpbAuthReq{}
+		if err := proto.Unmarshal(data[1:], req); err != nil {
+			t.Error(err)
+			return true
+		}
+		authChan <- &testAuthRequest{
+			user:      string(req.User),
+			password:  string(req.Password),
+			didResume: tlsConn.ConnectionState().DidResume,
+		}
+		if _, err := tlsConn.Write(buildRiakMessage(rpbCode_RpbAuthResp, nil)); err != nil {
+			t.Error(err)
+			return true
+		}
+		for readWriteResp(t, tlsConn, false) {
+		}
+		return true
+	}
+	tl := newTestListener(&testListenerOpts{
+		test:   t,
+		onConn: onConn,
+	})
+	defer tl.stop()
+	tl.start()
+
+	node, err := NewNode(&NodeOptions{
+		RemoteAddress:  tl.addr.String(),
+		MinConnections: 0,
+		AuthOptions: &AuthOptions{
+			Password: "ignored",
+			TlsConfig: &tls.Config{
+				ServerName:   "riak-test",
+				RootCAs:      serverCertPool,
+				Certificates: []tls.Certificate{clientCert},
+			},
+			UseClientCertificate: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		conn, err := node.cm.create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.close()
+		if err := conn.execute(&PingCommand{}); err != nil {
+			t.Fatal(err)
+		}
+
+		var auth *testAuthRequest
+		select {
+		case auth = <-authChan:
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for auth request")
+		}
+		if expected, actual := "riakuser", auth.user; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if expected, actual := "", auth.password; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		// NB: the second connection resumes the session of the first
+		if expected, actual := i == 1, auth.didResume; expected != actual {
+			t.Errorf("connection %d: expected session resumption %v, got %v", i, expected, actual)
+		}
+	}
+}
+
+func mustParseCertificate(t *testing.T, cert tls.Certificate) *x509.Certificate {
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCredentialsProviderRotationAndAuthError(t *testing.T) {
+	serverCert := newTestTlsCertificate(t, "riak-test")
+	serverCertPool := x509.NewCertPool()
+	serverCertPool.AddCert(mustParseCertificate(t, serverCert))
+
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+	}
+	authChan := make(chan *testAuthRequest, 2)
+
+	var onConn = func(c net.Conn) bool {
+		defer c.Close()
+		if msgCode, err := readClientMessage(c); err != nil || msgCode != rpbCode_RpbStartTls {
+			t.Errorf("expected StartTls, got %v %v", msgCode, err)
+			return true
+		}
+		if _, err := c.Write(buildRiakMessage(rpbCode_RpbStartTls, nil)); err != nil {
+			t.Error(err)
+			return true
+		}
+		tlsConn := tls.Server(c, serverConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			t.Error(err)
+			return true
+		}
+
+		sizeBuf := make([]byte, 4)
+		if _, err := io.ReadFull(tlsConn, sizeBuf); err != nil {
+			t.Error(err)
+			return true
+		}
+		data := make([]byte, binary.BigEndian.Uint32(sizeBuf))
+		if _, err := io.ReadFull(tlsConn, data); err != nil {
+			t.Error(err)
+			return true
+		}
+		req := &rpb_riak.RpbAuthReq{}
+		if err := proto.Unmarshal(data[1:], req); err != nil {
+			t.Error(err)
+			return true
+		}
+		authChan <- &testAuthRequest{
+			user:     string(req.User),
+			password: string(req.Password),
+		}
+		if string(req.Password) != "rotated" {
+			resp, err := buildRiakError("Authentication failed")
+			if err != nil {
+				t.Error(err)
+				return true
+			}
+			tlsConn.Write(resp)
+			return true
+		}
+		if _, err := tlsConn.Write(buildRiakMessage(rpbCode_RpbAuthResp, nil)); err != nil {
+			t.Error(err)
+			return true
+		}
+		for readWriteResp(t, tlsConn, false) {
+		}
+		return true
+	}
+	tl := newTestListener(&testListenerOpts{
+		test:   t,
+		onConn: onConn,
+	})
+	defer tl.stop()
+	tl.start()
+
+	password := "expired"
+	node, err := NewNode(&NodeOptions{
+		RemoteAddress:  tl.addr.String(),
+		MinConnections: 0,
+		AuthOptions: &AuthOptions{
+			User:     "ignored",
+			Password: "ignored",
+			TlsConfig: &tls.Config{
+				ServerName: "riak-test",
+				RootCAs:    serverCertPool,
+			},
+			CredentialsProvider: CredentialsProviderFunc(func() (*Credentials, error) {
+				return &Credentials{User: "riakuser", Password: password}, nil
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, p := range []string{"expired", "rotated"} {
+		password = p
+		conn, err := node.cm.create()
+		if i == 0 {
+			if err == nil {
+				conn.close()
+				t.Fatal("expected auth error")
+			}
+			if !IsAuthError(err) {
+				t.Errorf("expected AuthError, got %v", err)
+			}
+		} else {
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.close()
+			if err := conn.execute(&PingCommand{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var auth *testAuthRequest
+		select {
+		case auth = <-authChan:
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for auth request")
+		}
+		if expected, actual := "riakuser", auth.user; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if expected, actual := p, auth.password; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
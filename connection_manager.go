@@ -15,8 +15,10 @@
 package riak
 
 import (
+	"container/list"
 	"fmt"
 	"math"
+	"math/rand"
 	"net"
 	"sync"
 	"time"
@@ -82,6 +84,12 @@ func (counter *connectionCounter) decrement() uint16 {
 	return counter.value
 }
 
+// connWaiter is a caller waiting for a connection to be returned to the pool
+type connWaiter struct {
+	c      chan *connection
+	handed bool // NB: protected by waitersMutex
+}
+
 type connectionManagerOptions struct {
 	addr                   *net.TCPAddr
 	minConnections         uint16
@@ -89,6 +97,8 @@ type connectionManagerOptions struct {
 	tempNetErrorRetries    uint16
 	idleExpirationInterval time.Duration
 	idleTimeout            time.Duration
+	maxLifetime            time.Duration
+	waitTimeout            time.Duration
 	connectTimeout         time.Duration
 	requestTimeout         time.Duration
 	authOptions            *AuthOptions
@@ -101,6 +111,8 @@ type connectionManager struct {
 	tempNetErrorRetries    uint16
 	idleExpirationInterval time.Duration
 	idleTimeout            time.Duration
+	maxLifetime            time.Duration
+	waitTimeout            time.Duration
 	connectTimeout         time.Duration
 	requestTimeout         time.Duration
 	authOptions            *AuthOptions
@@ -108,6 +120,9 @@ type connectionManager struct {
 	q                      *queue
 	expireTicker           *time.Ticker
 	connectionCounter      connectionCounter
+	waiters                *list.List
+	waitersMutex           sync.Mutex
+	onReleased             func()
 	sync.RWMutex
 	stateData
 }
@@ -117,6 +132,7 @@ var (
 	ErrConnectionManagerRequiresAddress         = newClientError("[connectionManager] new manager requires non-nil address", nil)
 	ErrConnectionManagerMaxMustBeGreaterThanMin = newClientError("[connectionManager] new connection manager maxConnections must be greater than minConnections", nil)
 	ErrConnMgrAllConnectionsInUse               = newClientError("[connectionManager] all connections in use / max connections reached", nil)
+	ErrConnMgrShuttingDown                      = newClientError("[connectionManager] shutting down", nil)
 )
 
 func newConnectionManager(options *connectionManagerOptions) (*connectionManager, error) {
@@ -157,11 +173,14 @@ func newConnectionManager(options *connectionManagerOptions) (*connectionManager
 		tempNetErrorRetries:    options.tempNetErrorRetries,
 		idleExpirationInterval: options.idleExpirationInterval,
 		idleTimeout:            options.idleTimeout,
+		maxLifetime:            options.maxLifetime,
+		waitTimeout:            options.waitTimeout,
 		connectTimeout:         options.connectTimeout,
 		requestTimeout:         options.requestTimeout,
 		authOptions:            options.authOptions,
 		stopChan:               make(chan struct{}),
 		q:                      newQueue(options.maxConnections),
+		waiters:                list.New(),
 	}
 	cm.initStateData("connMgrError", "connMgrCreated", "connMgrRunning", "connMgrShuttingDown", "connMgrShutdown")
 	cm.setState(cmCreated)
@@ -176,16 +195,7 @@ func (cm *connectionManager) start() error {
 	if err := cm.stateCheck(cmCreated); err != nil {
 		return err
 	}
-	for i := uint16(0); i < cm.minConnections; i++ {
-		conn, err := cm.create()
-		if err == nil {
-			if perr := cm.put(conn); perr != nil {
-				logErr("[connectionManager]", perr)
-			}
-		} else {
-			logErr("[connectionManager]", err)
-		}
-	}
+	cm.warmUp()
 	cm.expireTicker = time.NewTicker(cm.idleExpirationInterval)
 	go cm.manageConnections()
 	cm.setState(cmRunning)
@@ -241,33 +251,97 @@ func (cm *connectionManager) count() uint16 {
 	return cm.connectionCounter.count()
 }
 
+// warmUp dials connections in parallel until minConnections are open
+func (cm *connectionManager) warmUp() {
+	c := cm.count()
+	if c >= cm.minConnections {
+		return
+	}
+	wg := &sync.WaitGroup{}
+	for i := c; i < cm.minConnections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := cm.create()
+			if err == nil {
+				if conn == nil {
+					return // NB: shutting down
+				}
+				if perr := cm.put(conn); perr != nil {
+					logErr("[connectionManager]", perr)
+				}
+			} else {
+				logErr("[connectionManager]", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func (cm *connectionManager) create() (*connection, error) {
 	if !cm.isStateLessThan(cmShuttingDown) {
 		return nil, nil
 	}
 
 	cm.Lock()
-	defer cm.Unlock()
-
 	if cm.connectionCounter.isGreaterThanOrEqual(cm.maxConnections) {
+		cm.Unlock()
 		return nil, ErrConnMgrAllConnectionsInUse
 	}
+	// NB: reserve a slot for this connection so that dialing can happen
+	// without holding the lock
+	cm.connectionCounter.increment()
+	cm.Unlock()
 
 	conn, err := cm.createConnection()
 	if err != nil {
+		cm.connectionCounter.decrement()
 		return nil, err
 	}
 
-	cm.connectionCounter.increment()
+	if cm.maxLifetime > 0 {
+		conn.expiresAt = time.Now().Add(cm.connectionLifetime())
+	}
 	return conn, nil
 }
 
+// connectionLifetime returns maxLifetime reduced by up to 10% so that
+// connections opened at the same time do not all expire at once
+func (cm *connectionManager) connectionLifetime() time.Duration {
+	jitter := int64(cm.maxLifetime / 10)
+	if jitter <= 0 {
+		return cm.maxLifetime
+	}
+	return cm.maxLifetime - time.Duration(rand.Int63n(jitter))
+}
+
+// credentials returns the Credentials for a new connection from the
+// configured CredentialsProvider, if any
+func (cm *connectionManager) credentials() (*Credentials, error) {
+	if cm.authOptions == nil || cm.authOptions.CredentialsProvider == nil {
+		return nil, nil
+	}
+	credentials, err := cm.authOptions.CredentialsProvider.Credentials()
+	if err == nil && credentials == nil {
+		err = ErrAuthMissingCredentials
+	}
+	if err != nil {
+		return nil, AuthError{InnerError: err}
+	}
+	return credentials, nil
+}
+
 func (cm *connectionManager) createConnection() (*connection, error) {
+	credentials, err := cm.credentials()
+	if err != nil {
+		return nil, err
+	}
 	opts := &connectionOptions{
 		remoteAddress:       cm.addr,
 		connectTimeout:      cm.connectTimeout,
 		requestTimeout:      cm.requestTimeout,
 		authOptions:         cm.authOptions,
+		credentials:         credentials,
 		tempNetErrorRetries: cm.tempNetErrorRetries,
 	}
 	conn, err := newConnection(opts)
@@ -279,39 +353,105 @@ func (cm *connectionManager) createConnection() (*connection, error) {
 }
 
 func (cm *connectionManager) get() (*connection, error) {
+	if cm.waitTimeout == 0 {
+		return cm.getAvailable()
+	}
+
+	deadline := time.Now().Add(cm.waitTimeout)
+	atFront := false
+	for {
+		// NB: callers already waiting for a connection are served first
+		if atFront || !cm.hasWaiters() {
+			conn, err := cm.getAvailable()
+			if err != ErrConnMgrAllConnectionsInUse {
+				return conn, err
+			}
+		}
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return nil, ErrConnMgrAllConnectionsInUse
+		}
+		e, conn, freed := cm.addWaiter(atFront)
+		if conn != nil {
+			return conn, nil
+		}
+		if freed {
+			atFront = true
+			continue
+		}
+		logDebug("[connectionManager]", "(%v) all connections in use, waiting up to %v", cm, remaining)
+		conn, err := cm.wait(e, remaining)
+		if err != nil || conn != nil {
+			return conn, err
+		}
+		// NB: a connection slot was freed, try to fill it without losing our place
+		atFront = true
+	}
+}
+
+func (cm *connectionManager) getAvailable() (*connection, error) {
+	conn, freed := cm.getIdle()
+	if conn == nil && freed > 0 {
+		freed-- // NB: keep one freed slot for ourselves
+	}
+	cm.slotsFreed(freed)
+
+	if conn != nil {
+		return conn, nil
+	}
+
+	// NB: if we get here, there were no available connections
+	return cm.create()
+}
+
+// getIdle returns the first usable connection in the pool, closing any
+// unusable ones it finds along the way. The number of connections closed is
+// also returned
+func (cm *connectionManager) getIdle() (*connection, uint16) {
 	var conn *connection
+	freed := uint16(0)
+	now := time.Now()
 	var f = func(v interface{}) (bool, bool) {
 		if v == nil {
 			// connection pool is empty
 			return true, false
 		}
 		conn = v.(*connection)
-		if conn.available() {
+		if conn.available() && !conn.isExpired(now) {
 			// we found our connection, don't re-queue
 			return true, false
 		} else {
 			// Remove connection, don't re-queue, keep going
-			cm.remove(conn)
+			cm.connectionCounter.decrement()
+			conn.close() // NB: discard error
+			freed++
 			conn = nil // GH-47
 			return false, false
 		}
 	}
-	err := cm.q.iterate(f)
-	if err != nil {
-		return nil, err
-	}
-
-	if conn != nil {
-		return conn, nil
+	if err := cm.q.iterate(f); err != nil {
+		logErr("[connectionManager]", err)
+		return nil, freed
 	}
-
-	// NB: if we get here, there were no available connections
-	return cm.create()
+	return conn, freed
 }
 
 func (cm *connectionManager) put(conn *connection) error {
 	if cm.isStateLessThan(cmShuttingDown) {
-		return cm.q.enqueue(conn)
+		if conn.isExpired(time.Now()) {
+			logDebug("[connectionManager]", "(%v) closing connection that exceeded max lifetime", cm)
+			return cm.remove(conn)
+		}
+		cm.waitersMutex.Lock()
+		defer cm.waitersMutex.Unlock()
+		if cm.handOff(conn) {
+			return nil
+		}
+		if err := cm.q.enqueue(conn); err != nil {
+			return err
+		}
+		cm.notifyReleased()
+		return nil
 	} else {
 		// shutting down
 		logDebug("[connectionManager]", "(%v)|Connection returned during shutdown.", cm)
@@ -324,11 +464,121 @@ func (cm *connectionManager) put(conn *connection) error {
 func (cm *connectionManager) remove(conn *connection) error {
 	if cm.isStateLessThan(cmShuttingDown) {
 		cm.connectionCounter.decrement()
-		return conn.close()
+		err := conn.close()
+		cm.slotsFreed(1)
+		return err
 	}
 	return nil
 }
 
+func (cm *connectionManager) hasWaiters() bool {
+	cm.waitersMutex.Lock()
+	defer cm.waitersMutex.Unlock()
+	return cm.waiters.Len() > 0
+}
+
+// addWaiter registers the caller to be handed the next connection returned to
+// the pool. If an idle connection or a free slot is found while holding the
+// waiters lock, the caller is not registered
+func (cm *connectionManager) addWaiter(atFront bool) (*list.Element, *connection, bool) {
+	cm.waitersMutex.Lock()
+	defer cm.waitersMutex.Unlock()
+	conn, freed := cm.getIdle()
+	if conn == nil && freed > 0 {
+		freed-- // NB: keep one freed slot for the caller
+		for ; freed > 0 && cm.handOff(nil); freed-- {
+		}
+		return nil, nil, true
+	}
+	for ; freed > 0 && cm.handOff(nil); freed-- {
+	}
+	if conn != nil {
+		return nil, conn, false
+	}
+	w := &connWaiter{
+		c: make(chan *connection, 1),
+	}
+	if atFront {
+		return cm.waiters.PushFront(w), nil, false
+	}
+	return cm.waiters.PushBack(w), nil, false
+}
+
+// wait blocks until the waiter is handed a connection, or a nil connection if
+// a connection slot was freed instead
+func (cm *connectionManager) wait(e *list.Element, timeout time.Duration) (*connection, error) {
+	w := e.Value.(*connWaiter)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case conn := <-w.c:
+		return conn, nil
+	case <-timer.C:
+		err = ErrConnMgrAllConnectionsInUse
+	case <-cm.stopChan:
+		err = ErrConnMgrShuttingDown
+	}
+
+	cm.waitersMutex.Lock()
+	handed := w.handed
+	if !handed {
+		cm.waiters.Remove(e)
+	}
+	cm.waitersMutex.Unlock()
+	if !handed {
+		return nil, err
+	}
+
+	// NB: a connection or slot was handed to this waiter as it gave up
+	conn := <-w.c
+	if conn == nil {
+		cm.slotsFreed(1)
+		return nil, err
+	}
+	if err == ErrConnMgrShuttingDown {
+		cm.put(conn) // NB: will close the connection
+		return nil, err
+	}
+	return conn, nil
+}
+
+// handOff passes conn, or nil to indicate a free connection slot, to the
+// longest waiting caller. The waiters lock must be held
+func (cm *connectionManager) handOff(conn *connection) bool {
+	e := cm.waiters.Front()
+	if e == nil {
+		return false
+	}
+	cm.waiters.Remove(e)
+	w := e.Value.(*connWaiter)
+	w.handed = true
+	w.c <- conn
+	return true
+}
+
+// slotsFreed hands freed connection slots to waiting callers, notifying the
+// Node if there are none
+func (cm *connectionManager) slotsFreed(count uint16) {
+	if count == 0 {
+		return
+	}
+	cm.waitersMutex.Lock()
+	defer cm.waitersMutex.Unlock()
+	for ; count > 0 && cm.handOff(nil); count-- {
+	}
+	if count > 0 {
+		cm.notifyReleased()
+	}
+}
+
+func (cm *connectionManager) notifyReleased() {
+	if cm.onReleased != nil {
+		cm.onReleased()
+	}
+}
+
 func (cm *connectionManager) manageConnections() {
 	logDebug("[connectionManager]", "connection expiration routine is starting")
 	for {
@@ -357,20 +607,22 @@ func (cm *connectionManager) manageConnections() {
 				conn := v.(*connection)
 				cm.Lock()
 				defer cm.Unlock()
-				if cm.connectionCounter.isGreaterThan(cm.minConnections) {
+				// connections past their max lifetime are closed regardless of
+				// minConnections, the pool is replenished below
+				expire := conn.isExpired(now)
+				if !expire && cm.connectionCounter.isGreaterThan(cm.minConnections) {
 					// expire connection if not available or if it has passed idle timeout
-					if !conn.available() || (now.Sub(conn.lastUsed) >= cm.idleTimeout) {
-						cm.connectionCounter.decrement()
-						if err := conn.close(); err != nil {
-							logErr("[connectionManager]", err)
-						}
-						count++
-						return false, false // don't break, don't re-enqueue
-					} else {
-						return false, true // don't break, re-enqueue
+					expire = !conn.available() || (now.Sub(conn.lastUsed) >= cm.idleTimeout)
+				}
+				if expire {
+					cm.connectionCounter.decrement()
+					if err := conn.close(); err != nil {
+						logErr("[connectionManager]", err)
 					}
+					count++
+					return false, false // don't break, don't re-enqueue
 				}
-				return true, true // break, re-enqueue
+				return false, true // don't break, re-enqueue
 			}
 
 			if err := cm.q.iterate(f); err != nil {
@@ -379,6 +631,13 @@ func (cm *connectionManager) manageConnections() {
 
 			logDebug("[connectionManager]", "(%v) expired %d connections.", cm, count)
 
+			if count > 0 {
+				cm.slotsFreed(count)
+				if cm.isStateLessThan(cmShuttingDown) {
+					cm.warmUp()
+				}
+			}
+
 			if !cm.isStateLessThan(cmShuttingDown) {
 				logDebug("[connectionManager]", "(%v) connection expiration routine is quitting.", cm)
 			}
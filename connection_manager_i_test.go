@@ -65,3 +65,114 @@ func TestConnectionManagerDoesNotExpirePastMinConnections(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestConnectionManagerWarmsUpToMinConnections(t *testing.T) {
+	minConnections := uint16(8)
+
+	o := &testListenerOpts{
+		test: t,
+		host: "127.0.0.1",
+		port: 13341,
+	}
+	tl := newTestListener(o)
+	tl.start()
+	defer tl.stop()
+
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:13341")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmopts := &connectionManagerOptions{
+		addr:           addr,
+		minConnections: minConnections,
+		maxConnections: 16,
+	}
+
+	cm, err := newConnectionManager(cmopts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cm.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, expected := cm.count(), minConnections; actual != expected {
+		t.Errorf("got: %v, expected: %v", actual, expected)
+	}
+	if actual, expected := cm.q.count(), minConnections; actual != expected {
+		t.Errorf("got: %v, expected: %v", actual, expected)
+	}
+
+	if err = cm.stop(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectionManagerReplacesConnectionsPastMaxLifetime(t *testing.T) {
+	minConnections := uint16(2)
+
+	o := &testListenerOpts{
+		test: t,
+		host: "127.0.0.1",
+		port: 13342,
+	}
+	tl := newTestListener(o)
+	tl.start()
+	defer tl.stop()
+
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:13342")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmopts := &connectionManagerOptions{
+		addr:                   addr,
+		minConnections:         minConnections,
+		maxConnections:         4,
+		idleExpirationInterval: time.Millisecond * 50,
+		maxLifetime:            time.Millisecond * 100,
+	}
+
+	cm, err := newConnectionManager(cmopts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cm.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	original := make(map[*connection]bool)
+	f := func(v interface{}) (bool, bool) {
+		if v == nil {
+			return true, false
+		}
+		original[v.(*connection)] = true
+		return false, true
+	}
+	if err = cm.q.iterate(f); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 300)
+
+	if actual, expected := cm.count(), minConnections; actual != expected {
+		t.Errorf("got: %v, expected: %v", actual, expected)
+	}
+	f = func(v interface{}) (bool, bool) {
+		if v == nil {
+			return true, false
+		}
+		if original[v.(*connection)] {
+			t.Error("expected connection past max lifetime to be replaced")
+		}
+		return false, true
+	}
+	if err = cm.q.iterate(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cm.stop(); err != nil {
+		t.Error(err)
+	}
+}
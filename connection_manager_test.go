@@ -15,7 +15,9 @@
 package riak
 
 import (
+	"net"
 	"testing"
+	"time"
 )
 
 func TestCreateConnectionManager(t *testing.T) {
@@ -24,3 +26,236 @@ func TestCreateConnectionManager(t *testing.T) {
 		t.Error("expected non-nil error when creating without options")
 	}
 }
+
+func newTestConnectionManager(t *testing.T, options *connectionManagerOptions) *connectionManager {
+	addr, err := net.ResolveTCPAddr("tcp4", "127.0.0.1:8087")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.addr = addr
+	cm, err := newConnectionManager(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+// newTestPipeConnection returns an active connection that is not connected to
+// a Riak node, and is accounted for by cm
+func newTestPipeConnection(t *testing.T, cm *connectionManager) *connection {
+	conn, err := newConnection(&connectionOptions{remoteAddress: cm.addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	server.Close()
+	conn.conn = client
+	conn.setState(connActive)
+	cm.connectionCounter.increment()
+	return conn
+}
+
+func TestConnectionManagerWithoutWaitTimeoutFailsImmediately(t *testing.T) {
+	cm := newTestConnectionManager(t, &connectionManagerOptions{
+		minConnections: 1,
+		maxConnections: 1,
+	})
+	newTestPipeConnection(t, cm) // NB: in use, not in pool
+	if _, err := cm.get(); err != ErrConnMgrAllConnectionsInUse {
+		t.Errorf("expected %v, got %v", ErrConnMgrAllConnectionsInUse, err)
+	}
+}
+
+func TestConnectionManagerWaitsForReturnedConnection(t *testing.T) {
+	cm := newTestConnectionManager(t, &connectionManagerOptions{
+		minConnections: 1,
+		maxConnections: 1,
+		waitTimeout:    time.Second * 5,
+	})
+	inUse := newTestPipeConnection(t, cm)
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		if err := cm.put(inUse); err != nil {
+			t.Error(err)
+		}
+	}()
+	start := time.Now()
+	conn, err := cm.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != inUse {
+		t.Error("expected returned connection to be handed to waiting caller")
+	}
+	if elapsed := time.Since(start); elapsed >= cm.waitTimeout {
+		t.Errorf("expected caller to be woken before wait timeout, waited %v", elapsed)
+	}
+}
+
+func TestConnectionManagerWaitTimesOut(t *testing.T) {
+	cm := newTestConnectionManager(t, &connectionManagerOptions{
+		minConnections: 1,
+		maxConnections: 1,
+		waitTimeout:    time.Millisecond * 50,
+	})
+	newTestPipeConnection(t, cm)
+	start := time.Now()
+	if _, err := cm.get(); err != ErrConnMgrAllConnectionsInUse {
+		t.Errorf("expected %v, got %v", ErrConnMgrAllConnectionsInUse, err)
+	}
+	if elapsed := time.Since(start); elapsed < cm.waitTimeout {
+		t.Errorf("expected to wait at least %v, waited %v", cm.waitTimeout, elapsed)
+	}
+}
+
+func waitForConnectionWaiters(t *testing.T, cm *connectionManager, count int) {
+	for i := 0; i < 500; i++ {
+		cm.waitersMutex.Lock()
+		l := cm.waiters.Len()
+		cm.waitersMutex.Unlock()
+		if l == count {
+			return
+		}
+		time.Sleep(time.Millisecond * 2)
+	}
+	t.Fatalf("expected %d waiters", count)
+}
+
+func TestConnectionManagerHandsConnectionsToWaitersInOrder(t *testing.T) {
+	cm := newTestConnectionManager(t, &connectionManagerOptions{
+		minConnections: 1,
+		maxConnections: 1,
+		waitTimeout:    time.Second * 5,
+	})
+	inUse := newTestPipeConnection(t, cm)
+
+	waiterCount := 4
+	order := make(chan int, waiterCount)
+	for i := 0; i < waiterCount; i++ {
+		go func(i int) {
+			conn, err := cm.get()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			if err := cm.put(conn); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		waitForConnectionWaiters(t, cm, i+1)
+	}
+
+	if err := cm.put(inUse); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < waiterCount; i++ {
+		select {
+		case actual := <-order:
+			if i != actual {
+				t.Errorf("expected waiter %d to be served, got %d", i, actual)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for waiters to be served")
+		}
+	}
+}
+
+func TestConnectionManagerWakesWaiterWhenConnectionRemoved(t *testing.T) {
+	cm := newTestConnectionManager(t, &connectionManagerOptions{
+		minConnections: 1,
+		maxConnections: 1,
+		connectTimeout: time.Second,
+		waitTimeout:    time.Second * 5,
+	})
+	inUse := newTestPipeConnection(t, cm)
+	released := false
+	go func() {
+		waitForConnectionWaiters(t, cm, 1)
+		released = true
+		if err := cm.remove(inUse); err != nil {
+			t.Error(err)
+		}
+	}()
+	start := time.Now()
+	conn, err := cm.get()
+	// NB: the freed slot is used to dial a new connection, which may fail
+	// if Riak is not running
+	if err == ErrConnMgrAllConnectionsInUse {
+		t.Error("expected waiter to be given the freed connection slot")
+	}
+	if conn != nil {
+		cm.remove(conn)
+	}
+	if !released {
+		t.Error("expected get to wait until connection was removed")
+	}
+	if elapsed := time.Since(start); elapsed >= cm.waitTimeout {
+		t.Errorf("expected caller to be woken before wait timeout, waited %v", elapsed)
+	}
+}
+
+func TestConnectionManagerClosesExpiredConnectionOnPut(t *testing.T) {
+	cm := newTestConnectionManager(t, &connectionManagerOptions{
+		minConnections: 1,
+		maxConnections: 2,
+		maxLifetime:    time.Minute,
+	})
+	conn := newTestPipeConnection(t, cm)
+	conn.expiresAt = time.Now().Add(-time.Second)
+	if err := cm.put(conn); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := uint16(0), cm.q.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint16(0), cm.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if conn.available() {
+		t.Error("expected expired connection to be closed")
+	}
+}
+
+func TestConnectionManagerSkipsExpiredConnectionOnGet(t *testing.T) {
+	cm := newTestConnectionManager(t, &connectionManagerOptions{
+		minConnections: 1,
+		maxConnections: 2,
+		maxLifetime:    time.Minute,
+	})
+	expired := newTestPipeConnection(t, cm)
+	fresh := newTestPipeConnection(t, cm)
+	fresh.expiresAt = time.Now().Add(time.Minute)
+	if err := cm.q.enqueue(expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.q.enqueue(fresh); err != nil {
+		t.Fatal(err)
+	}
+	expired.expiresAt = time.Now().Add(-time.Second)
+	conn, err := cm.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != fresh {
+		t.Error("expected unexpired connection")
+	}
+	if expired.available() {
+		t.Error("expected expired connection to be closed")
+	}
+	if expected, actual := uint16(1), cm.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestConnectionLifetimeJitter(t *testing.T) {
+	cm := newTestConnectionManager(t, &connectionManagerOptions{
+		maxLifetime: time.Minute,
+	})
+	for i := 0; i < 100; i++ {
+		lifetime := cm.connectionLifetime()
+		if lifetime > cm.maxLifetime || lifetime < cm.maxLifetime-(cm.maxLifetime/10) {
+			t.Errorf("lifetime %v outside of expected range", lifetime)
+		}
+	}
+}
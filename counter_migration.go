@@ -0,0 +1,570 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	rpbRiakKV "github.com/basho/riak-go-client/rpb/riak_kv"
+	proto "github.com/golang/protobuf/proto"
+)
+
+var (
+	ErrCounterMigrationExecutorRequired = newClientError("[CounterMigration] Executor is required", nil)
+	ErrCounterMigrationSourceRequired   = newClientError("[CounterMigration] SourceBucket is required", nil)
+	ErrCounterMigrationTargetRequired   = newClientError("[CounterMigration] TargetBucketType is required", nil)
+	ErrCounterMigrationListingDisabled  = newClientError("[CounterMigration] Keys or AllowListing is required", nil)
+)
+
+// CounterMigrationProgress records how much of each legacy counter has been
+// migrated, so that a migration that is run again only writes the difference
+type CounterMigrationProgress interface {
+	// Migrated returns the legacy value migrated for the key, or 0 if none,
+	// and the legacy value of a write that was started but not confirmed, or
+	// the migrated value if there is none
+	Migrated(key string) (migrated int64, pending int64, err error)
+	// SetPending records the legacy value that is about to be written for
+	// the key
+	SetPending(key string, pending int64) error
+	// SetMigrated records the legacy value migrated for the key and clears
+	// its pending write
+	SetMigrated(key string, migrated int64) error
+}
+
+type counterMigrationRecord struct {
+	Key      string `json:"key"`
+	Migrated int64  `json:"migrated"`
+	Pending  *int64 `json:"pending,omitempty"`
+}
+
+func (r counterMigrationRecord) values() (int64, int64) {
+	if r.Pending != nil {
+		return r.Migrated, *r.Pending
+	}
+	return r.Migrated, r.Migrated
+}
+
+type memoryCounterMigrationProgress struct {
+	records map[string]counterMigrationRecord
+	sync.Mutex
+}
+
+// NewMemoryCounterMigrationProgress returns a CounterMigrationProgress that is
+// kept in memory, for migrations that are only rerun within one process
+func NewMemoryCounterMigrationProgress() CounterMigrationProgress {
+	return &memoryCounterMigrationProgress{
+		records: make(map[string]counterMigrationRecord),
+	}
+}
+
+func (p *memoryCounterMigrationProgress) Migrated(key string) (int64, int64, error) {
+	p.Lock()
+	defer p.Unlock()
+	migrated, pending := p.records[key].values()
+	return migrated, pending, nil
+}
+
+func (p *memoryCounterMigrationProgress) SetPending(key string, pending int64) error {
+	p.Lock()
+	defer p.Unlock()
+	record := p.records[key]
+	record.Pending = &pending
+	p.records[key] = record
+	return nil
+}
+
+func (p *memoryCounterMigrationProgress) SetMigrated(key string, migrated int64) error {
+	p.Lock()
+	defer p.Unlock()
+	p.records[key] = counterMigrationRecord{Key: key, Migrated: migrated}
+	return nil
+}
+
+// FileCounterMigrationProgress is a CounterMigrationProgress that appends each
+// record to a JSON lines file, so that progress survives restarts
+type FileCounterMigrationProgress struct {
+	file    *os.File
+	records map[string]counterMigrationRecord
+	sync.Mutex
+}
+
+// NewFileCounterMigrationProgress opens or creates a progress file. Records in
+// an existing file are loaded, the last record for a key taking precedence
+func NewFileCounterMigrationProgress(path string) (*FileCounterMigrationProgress, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	p := &FileCounterMigrationProgress{
+		file:    file,
+		records: make(map[string]counterMigrationRecord),
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := counterMigrationRecord{}
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// NB: a partially written last line is ignored
+			logWarn("[FileCounterMigrationProgress]", "ignoring invalid record in %s: %v", path, err)
+			continue
+		}
+		p.records[record.Key] = record
+	}
+	if err = scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Migrated implements CounterMigrationProgress
+func (p *FileCounterMigrationProgress) Migrated(key string) (int64, int64, error) {
+	p.Lock()
+	defer p.Unlock()
+	migrated, pending := p.records[key].values()
+	return migrated, pending, nil
+}
+
+// SetPending implements CounterMigrationProgress
+func (p *FileCounterMigrationProgress) SetPending(key string, pending int64) error {
+	p.Lock()
+	defer p.Unlock()
+	record := p.records[key]
+	record.Key = key
+	record.Pending = &pending
+	return p.write(record)
+}
+
+// SetMigrated implements CounterMigrationProgress
+func (p *FileCounterMigrationProgress) SetMigrated(key string, migrated int64) error {
+	p.Lock()
+	defer p.Unlock()
+	return p.write(counterMigrationRecord{Key: key, Migrated: migrated})
+}
+
+// write appends a record to the file, p must be locked
+func (p *FileCounterMigrationProgress) write(record counterMigrationRecord) error {
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	if _, err = p.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	p.records[record.Key] = record
+	return nil
+}
+
+// Close closes the progress file
+func (p *FileCounterMigrationProgress) Close() error {
+	return p.file.Close()
+}
+
+// CounterMigrationOptions configure a CounterMigration
+type CounterMigrationOptions struct {
+	Executor     CommandExecutor
+	SourceBucket string
+	// Keys are the legacy counters to migrate. If empty, the keys in
+	// SourceBucket are listed, which requires AllowListing
+	Keys         []string
+	AllowListing bool
+	// TargetBucketType must have the counter datatype, or the map datatype if
+	// TargetMapField is set
+	TargetBucketType string
+	// TargetBucket defaults to SourceBucket
+	TargetBucket string
+	// TargetMapField, if set, is the counter field of a Map CRDT to migrate
+	// each counter to
+	TargetMapField string
+	// Progress defaults to NewMemoryCounterMigrationProgress(). Its keys are
+	// namespaced by the source and target, so one Progress can be shared by
+	// several migrations
+	Progress CounterMigrationProgress
+	// AllowDecrement writes a negative increment when a legacy counter is
+	// below the amount already migrated. By default that counter fails
+	AllowDecrement bool
+	// Concurrency is the number of counters migrated at once, by default 1
+	Concurrency int
+}
+
+// CounterMigrationResult contains the outcome of CounterMigration.Run
+type CounterMigrationResult struct {
+	Keys int
+	// Migrated is the number of counters written
+	Migrated int
+	// Unchanged is the number of counters that had nothing left to migrate
+	Unchanged int
+	// Increment is the total amount written to the target counters
+	Increment int64
+	Errors    map[string]error
+}
+
+// CounterMigrationVerification contains the outcome of CounterMigration.Verify
+type CounterMigrationVerification struct {
+	Keys        int
+	SourceTotal int64
+	TargetTotal int64
+	// Mismatched are the keys whose legacy and target values differ
+	Mismatched []string
+	Errors     map[string]error
+}
+
+// CounterMigration moves legacy KV counters, stored with RpbCounterUpdateReq
+// in the default bucket type, to counter datatypes in a bucket type:
+//
+//	migration, err := riak.NewCounterMigration(&riak.CounterMigrationOptions{
+//		Executor:         cluster,
+//		SourceBucket:     "visits",
+//		AllowListing:     true,
+//		TargetBucketType: "counters",
+//		Progress:         progress,
+//	})
+//	result, err := migration.Run()
+//	verification, err := migration.Verify()
+//
+// Each counter is written as an increment of its legacy value less the amount
+// already migrated according to Progress, so running a migration again, for
+// instance after legacy counters were incremented, only adds the difference.
+// The legacy value is recorded as pending in Progress before each write and as
+// migrated after it. If the process stops in between, the next run compares
+// the target counter with both values to tell whether the write was applied;
+// this assumes only the migration writes to the target counters, and a
+// counter that matches neither fails until it is corrected by hand.
+type CounterMigration struct {
+	options *CounterMigrationOptions
+}
+
+// NewCounterMigration returns a CounterMigration for the provided options
+func NewCounterMigration(options *CounterMigrationOptions) (*CounterMigration, error) {
+	if options == nil {
+		return nil, ErrOptionsRequired
+	}
+	if options.Executor == nil {
+		return nil, ErrCounterMigrationExecutorRequired
+	}
+	if options.SourceBucket == "" {
+		return nil, ErrCounterMigrationSourceRequired
+	}
+	if options.TargetBucketType == "" {
+		return nil, ErrCounterMigrationTargetRequired
+	}
+	if len(options.Keys) == 0 && !options.AllowListing {
+		return nil, ErrCounterMigrationListingDisabled
+	}
+	o := *options
+	if o.TargetBucket == "" {
+		o.TargetBucket = o.SourceBucket
+	}
+	if o.Progress == nil {
+		o.Progress = NewMemoryCounterMigrationProgress()
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	return &CounterMigration{
+		options: &o,
+	}, nil
+}
+
+// Run migrates the counters. Errors for individual counters are returned in
+// the result; an error is only returned if the keys could not be listed
+func (m *CounterMigration) Run() (*CounterMigrationResult, error) {
+	keys, err := m.keys()
+	if err != nil {
+		return nil, err
+	}
+	result := &CounterMigrationResult{
+		Keys:   len(keys),
+		Errors: make(map[string]error),
+	}
+	var mutex sync.Mutex
+	m.forEachKey(keys, func(key string) {
+		increment, err := m.migrate(key)
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case err != nil:
+			logError("[CounterMigration]", "could not migrate %s: %v", key, err)
+			result.Errors[key] = err
+		case increment == 0:
+			result.Unchanged++
+		default:
+			result.Migrated++
+			result.Increment += increment
+		}
+	})
+	return result, nil
+}
+
+// Verify compares each legacy counter with its target counter
+func (m *CounterMigration) Verify() (*CounterMigrationVerification, error) {
+	keys, err := m.keys()
+	if err != nil {
+		return nil, err
+	}
+	verification := &CounterMigrationVerification{
+		Keys:   len(keys),
+		Errors: make(map[string]error),
+	}
+	var mutex sync.Mutex
+	m.forEachKey(keys, func(key string) {
+		source, err := m.fetchSource(key)
+		var target int64
+		if err == nil {
+			target, err = m.fetchTarget(key)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			verification.Errors[key] = err
+			return
+		}
+		verification.SourceTotal += source
+		verification.TargetTotal += target
+		if source != target {
+			verification.Mismatched = append(verification.Mismatched, key)
+		}
+	})
+	return verification, nil
+}
+
+// migrate migrates one counter and returns the increment written
+func (m *CounterMigration) migrate(key string) (int64, error) {
+	progressKey := m.progressKey(key)
+	migrated, pending, err := m.options.Progress.Migrated(progressKey)
+	if err != nil {
+		return 0, err
+	}
+	if pending != migrated {
+		if migrated, err = m.reconcile(key, migrated, pending); err != nil {
+			return 0, err
+		}
+	}
+	source, err := m.fetchSource(key)
+	if err != nil {
+		return 0, err
+	}
+	increment := source - migrated
+	if increment == 0 {
+		return 0, nil
+	}
+	if increment < 0 && !m.options.AllowDecrement {
+		return 0, fmt.Errorf("[CounterMigration] legacy counter %s is %d, below the %d already migrated; AllowDecrement is required", key, source, migrated)
+	}
+	if err = m.options.Progress.SetPending(progressKey, source); err != nil {
+		return 0, err
+	}
+	if err = m.incrementTarget(key, increment); err != nil {
+		return 0, err
+	}
+	return increment, m.options.Progress.SetMigrated(progressKey, source)
+}
+
+// reconcile resolves a pending write by comparing the target counter with the
+// values before and after it, and returns the amount migrated
+func (m *CounterMigration) reconcile(key string, migrated, pending int64) (int64, error) {
+	target, err := m.fetchTarget(key)
+	if err != nil {
+		return 0, err
+	}
+	switch target {
+	case pending:
+		logDebug("[CounterMigration]", "pending write of %s was applied", key)
+		migrated = pending
+	case migrated:
+		logDebug("[CounterMigration]", "pending write of %s was not applied", key)
+	default:
+		return 0, fmt.Errorf("[CounterMigration] target counter %s is %d after a pending write from %d to %d", key, target, migrated, pending)
+	}
+	return migrated, m.options.Progress.SetMigrated(m.progressKey(key), migrated)
+}
+
+// progressKey namespaces a key by the source and target of the migration
+func (m *CounterMigration) progressKey(key string) string {
+	parts := []string{
+		m.options.SourceBucket,
+		m.options.TargetBucketType,
+		m.options.TargetBucket,
+		m.options.TargetMapField,
+		key,
+	}
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func (m *CounterMigration) keys() ([]string, error) {
+	if len(m.options.Keys) > 0 {
+		return m.options.Keys, nil
+	}
+	cmd, err := NewListKeysCommandBuilder().
+		WithAllowListing().
+		WithBucket(m.options.SourceBucket).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	if err = m.options.Executor.Execute(cmd); err != nil {
+		return nil, err
+	}
+	return cmd.(*ListKeysCommand).Response.Keys, nil
+}
+
+func (m *CounterMigration) forEachKey(keys []string, f func(key string)) {
+	keyChan := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < m.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keyChan {
+				f(key)
+			}
+		}()
+	}
+	for _, key := range keys {
+		keyChan <- key
+	}
+	close(keyChan)
+	wg.Wait()
+}
+
+func (m *CounterMigration) fetchSource(key string) (int64, error) {
+	cmd := &fetchLegacyCounterCommand{
+		protobuf: &rpbRiakKV.RpbCounterGetReq{
+			Bucket: []byte(m.options.SourceBucket),
+			Key:    []byte(key),
+		},
+	}
+	if err := m.options.Executor.Execute(cmd); err != nil {
+		return 0, err
+	}
+	return cmd.Response.CounterValue, nil
+}
+
+func (m *CounterMigration) fetchTarget(key string) (int64, error) {
+	if m.options.TargetMapField != "" {
+		cmd, err := NewFetchMapCommandBuilder().
+			WithBucketType(m.options.TargetBucketType).
+			WithBucket(m.options.TargetBucket).
+			WithKey(key).
+			Build()
+		if err != nil {
+			return 0, err
+		}
+		if err = m.options.Executor.Execute(cmd); err != nil {
+			return 0, err
+		}
+		if rsp := cmd.(*FetchMapCommand).Response; rsp.Map != nil {
+			return rsp.Map.Counters[m.options.TargetMapField], nil
+		}
+		return 0, nil
+	}
+	cmd, err := NewFetchCounterCommandBuilder().
+		WithBucketType(m.options.TargetBucketType).
+		WithBucket(m.options.TargetBucket).
+		WithKey(key).
+		Build()
+	if err != nil {
+		return 0, err
+	}
+	if err = m.options.Executor.Execute(cmd); err != nil {
+		return 0, err
+	}
+	return cmd.(*FetchCounterCommand).Response.CounterValue, nil
+}
+
+func (m *CounterMigration) incrementTarget(key string, increment int64) error {
+	var cmd Command
+	var err error
+	if m.options.TargetMapField != "" {
+		mapOp := &MapOperation{}
+		mapOp.IncrementCounter(m.options.TargetMapField, increment)
+		cmd, err = NewUpdateMapCommandBuilder().
+			WithBucketType(m.options.TargetBucketType).
+			WithBucket(m.options.TargetBucket).
+			WithKey(key).
+			WithMapOperation(mapOp).
+			Build()
+	} else {
+		cmd, err = NewUpdateCounterCommandBuilder().
+			WithBucketType(m.options.TargetBucketType).
+			WithBucket(m.options.TargetBucket).
+			WithKey(key).
+			WithIncrement(increment).
+			Build()
+	}
+	if err != nil {
+		return err
+	}
+	return m.options.Executor.Execute(cmd)
+}
+
+// FetchLegacyCounter
+// RpbCounterGetReq
+// RpbCounterGetResp
+
+// fetchLegacyCounterCommand fetches a counter stored with RpbCounterUpdateReq
+type fetchLegacyCounterCommand struct {
+	commandImpl
+	retryableCommandImpl
+	Response *FetchCounterResponse
+	protobuf *rpbRiakKV.RpbCounterGetReq
+}
+
+func (cmd *fetchLegacyCounterCommand) Name() string {
+	return cmd.getName("FetchLegacyCounter")
+}
+
+func (cmd *fetchLegacyCounterCommand) constructPbRequest() (proto.Message, error) {
+	return cmd.protobuf, nil
+}
+
+func (cmd *fetchLegacyCounterCommand) onSuccess(msg proto.Message) error {
+	cmd.success = true
+	response := &FetchCounterResponse{}
+	if msg == nil {
+		response.IsNotFound = true
+	} else if rpbCounterGetResp, ok := msg.(*rpbRiakKV.RpbCounterGetResp); ok {
+		if rpbCounterGetResp.Value == nil {
+			response.IsNotFound = true
+		} else {
+			response.CounterValue = rpbCounterGetResp.GetValue()
+		}
+	} else {
+		return fmt.Errorf("[fetchLegacyCounterCommand] could not convert %v to RpbCounterGetResp", reflect.TypeOf(msg))
+	}
+	cmd.Response = response
+	return nil
+}
+
+func (cmd *fetchLegacyCounterCommand) getRequestCode() byte {
+	return rpbCode_RpbCounterGetReq
+}
+
+func (cmd *fetchLegacyCounterCommand) getResponseCode() byte {
+	return rpbCode_RpbCounterGetResp
+}
+
+func (cmd *fetchLegacyCounterCommand) getResponseProtobufMessage() proto.Message {
+	return &rpbRiakKV.RpbCounterGetResp{}
+}
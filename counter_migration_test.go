@@ -0,0 +1,380 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	rpbRiakDT "github.com/basho/riak-go-client/rpb/riak_dt"
+	rpbRiakKV "github.com/basho/riak-go-client/rpb/riak_kv"
+)
+
+// testCounterExecutor keeps legacy and target counters in memory
+type testCounterExecutor struct {
+	legacy  map[string]int64
+	target  map[string]int64
+	failing map[string]bool
+	writes  int
+	sync.Mutex
+}
+
+func newTestCounterExecutor(legacy map[string]int64) *testCounterExecutor {
+	return &testCounterExecutor{
+		legacy:  legacy,
+		target:  make(map[string]int64),
+		failing: make(map[string]bool),
+	}
+}
+
+func (e *testCounterExecutor) Execute(cmd Command) error {
+	e.Lock()
+	defer e.Unlock()
+	switch c := cmd.(type) {
+	case *ListKeysCommand:
+		keys := make([]string, 0, len(e.legacy))
+		for key := range e.legacy {
+			keys = append(keys, key)
+		}
+		c.Response = &ListKeysResponse{Keys: keys}
+	case *fetchLegacyCounterCommand:
+		c.Response = &FetchCounterResponse{CounterValue: e.legacy[string(c.protobuf.Key)]}
+	case *FetchCounterCommand:
+		c.Response = &FetchCounterResponse{CounterValue: e.target[string(c.protobuf.Key)]}
+	case *FetchMapCommand:
+		c.Response = &FetchMapResponse{
+			Map: &Map{Counters: map[string]int64{"visits": e.target[string(c.protobuf.Key)]}},
+		}
+	case *UpdateCounterCommand:
+		req := c.protobuf.(*rpbRiakDT.DtUpdateReq)
+		key := string(req.Key)
+		if e.failing[key] {
+			return errors.New("write failed")
+		}
+		e.writes++
+		e.target[key] += req.Op.CounterOp.GetIncrement()
+	case *UpdateMapCommand:
+		e.writes++
+		e.target[string(c.protobuf.Key)] += c.op.incrementCounters["visits"]
+	}
+	return nil
+}
+
+func TestCounterMigrationOnlyMigratesDifferenceOnRerun(t *testing.T) {
+	executor := newTestCounterExecutor(map[string]int64{"a": 5, "b": 7, "c": 0})
+	executor.failing["b"] = true
+	migration, err := NewCounterMigration(&CounterMigrationOptions{
+		Executor:         executor,
+		SourceBucket:     "visits",
+		AllowListing:     true,
+		TargetBucketType: "counters",
+		Concurrency:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := migration.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 1, result.Migrated; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 1, result.Unchanged; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if _, ok := result.Errors["b"]; !ok {
+		t.Errorf("expected error for b, got %v", result.Errors)
+	}
+
+	verification, err := migration.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"b"}, verification.Mismatched; len(actual) != 1 || actual[0] != expected[0] {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	executor.failing["b"] = false
+	executor.legacy["a"] = 6
+	if result, err = migration.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(8), result.Increment; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(6), executor.target["a"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	writes := executor.writes
+	if result, err = migration.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := writes, executor.writes; expected != actual {
+		t.Errorf("expected no writes on a rerun, got %v", actual-expected)
+	}
+
+	if verification, err = migration.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(13), verification.SourceTotal; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(13), verification.TargetTotal; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 0, len(verification.Mismatched); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestCounterMigrationToMapFieldWithFileProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riak-go-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "progress.jsonl")
+
+	executor := newTestCounterExecutor(map[string]int64{"a": 5, "b": 7})
+	run := func() *CounterMigrationResult {
+		progress, err := NewFileCounterMigrationProgress(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer progress.Close()
+		migration, err := NewCounterMigration(&CounterMigrationOptions{
+			Executor:         executor,
+			SourceBucket:     "visits",
+			Keys:             []string{"a", "b"},
+			TargetBucketType: "maps",
+			TargetBucket:     "users",
+			TargetMapField:   "visits",
+			Progress:         progress,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := migration.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if expected, actual := int64(12), run().Increment; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// NB: progress is loaded from the file by a new migration
+	executor.legacy["b"] = 10
+	if expected, actual := int64(3), run().Increment; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(10), executor.target["b"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+// testFailingCounterMigrationProgress fails to record migrated amounts, as if
+// the process stopped after writing to the target
+type testFailingCounterMigrationProgress struct {
+	CounterMigrationProgress
+	fail bool
+}
+
+func (p *testFailingCounterMigrationProgress) SetMigrated(key string, migrated int64) error {
+	if p.fail {
+		return errors.New("progress failed")
+	}
+	return p.CounterMigrationProgress.SetMigrated(key, migrated)
+}
+
+func TestCounterMigrationReconcilesPendingWrite(t *testing.T) {
+	executor := newTestCounterExecutor(map[string]int64{"a": 5, "b": 7})
+	progress := &testFailingCounterMigrationProgress{
+		CounterMigrationProgress: NewMemoryCounterMigrationProgress(),
+		fail:                     true,
+	}
+	executor.failing["b"] = true
+	migration, err := NewCounterMigration(&CounterMigrationOptions{
+		Executor:         executor,
+		SourceBucket:     "visits",
+		Keys:             []string{"a", "b"},
+		TargetBucketType: "counters",
+		Progress:         progress,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := migration.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(result.Errors); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// NB: the write of a was applied and the write of b was not
+	progress.fail = false
+	executor.failing["b"] = false
+	if result, err = migration.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(7), result.Increment; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(5), executor.target["a"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(7), executor.target["b"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	progress.fail = true
+	executor.legacy["a"] = 6
+	if _, err = migration.Run(); err != nil {
+		t.Fatal(err)
+	}
+	progress.fail = false
+	executor.target["a"] = 100
+	if result, err = migration.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.Errors["a"]; !ok {
+		t.Errorf("expected error reconciling a, got %v", result.Errors)
+	}
+}
+
+func TestCounterMigrationRefusesDecrement(t *testing.T) {
+	executor := newTestCounterExecutor(map[string]int64{"a": 5})
+	progress := NewMemoryCounterMigrationProgress()
+	options := &CounterMigrationOptions{
+		Executor:         executor,
+		SourceBucket:     "visits",
+		Keys:             []string{"a"},
+		TargetBucketType: "counters",
+		Progress:         progress,
+	}
+	migration, err := NewCounterMigration(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migration.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	executor.legacy["a"] = 3
+	result, err := migration.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.Errors["a"]; !ok {
+		t.Errorf("expected error for a, got %v", result.Errors)
+	}
+	if expected, actual := int64(5), executor.target["a"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	options.AllowDecrement = true
+	if migration, err = NewCounterMigration(options); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = migration.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(-2), result.Increment; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(3), executor.target["a"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestCounterMigrationNamespacesProgress(t *testing.T) {
+	executor := newTestCounterExecutor(map[string]int64{"a": 5})
+	progress := NewMemoryCounterMigrationProgress()
+	for _, bucket := range []string{"users", "accounts"} {
+		migration, err := NewCounterMigration(&CounterMigrationOptions{
+			Executor:         executor,
+			SourceBucket:     "visits",
+			Keys:             []string{"a"},
+			TargetBucketType: "counters",
+			TargetBucket:     bucket,
+			Progress:         progress,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := migration.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, result.Migrated; expected != actual {
+			t.Errorf("%s: expected %v, got %v", bucket, expected, actual)
+		}
+	}
+	if expected, actual := "visits/counters/a%2Fb//k", (&CounterMigration{options: &CounterMigrationOptions{
+		SourceBucket:     "visits",
+		TargetBucketType: "counters",
+		TargetBucket:     "a/b",
+	}}).progressKey("k"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestNewCounterMigrationValidatesOptions(t *testing.T) {
+	executor := newTestCounterExecutor(nil)
+	errs := []struct {
+		options  *CounterMigrationOptions
+		expected error
+	}{
+		{nil, ErrOptionsRequired},
+		{&CounterMigrationOptions{SourceBucket: "b", TargetBucketType: "t", Keys: []string{"k"}}, ErrCounterMigrationExecutorRequired},
+		{&CounterMigrationOptions{Executor: executor, TargetBucketType: "t", Keys: []string{"k"}}, ErrCounterMigrationSourceRequired},
+		{&CounterMigrationOptions{Executor: executor, SourceBucket: "b", Keys: []string{"k"}}, ErrCounterMigrationTargetRequired},
+		{&CounterMigrationOptions{Executor: executor, SourceBucket: "b", TargetBucketType: "t"}, ErrCounterMigrationListingDisabled},
+	}
+	for i, e := range errs {
+		if _, err := NewCounterMigration(e.options); err != e.expected {
+			t.Errorf("%d: expected %v, got %v", i, e.expected, err)
+		}
+	}
+}
+
+func TestFetchLegacyCounterCommand(t *testing.T) {
+	cmd := &fetchLegacyCounterCommand{}
+	value := int64(42)
+	if err := cmd.onSuccess(&rpbRiakKV.RpbCounterGetResp{Value: &value}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(42), cmd.Response.CounterValue; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if err := cmd.onSuccess(&rpbRiakKV.RpbCounterGetResp{}); err != nil {
+		t.Fatal(err)
+	}
+	if !cmd.Response.IsNotFound {
+		t.Error("expected IsNotFound")
+	}
+	if expected, actual := rpbCode_RpbCounterGetReq, cmd.getRequestCode(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -302,6 +302,22 @@ func (cmd *FetchCounterCommand) getResponseProtobufMessage() proto.Message {
 	return &rpbRiakDT.DtFetchResp{}
 }
 
+func (cmd *FetchCounterCommand) hedgeClone() Command {
+	return &FetchCounterCommand{
+		timeoutImpl: cmd.timeoutImpl,
+		protobuf:    cmd.protobuf,
+	}
+}
+
+func (cmd *FetchCounterCommand) hedgeAdopt(c Command) {
+	other := c.(*FetchCounterCommand)
+	cmd.commandImpl.adopt(&other.commandImpl)
+	if n := other.getLastNode(); n != nil {
+		cmd.setLastNode(n)
+	}
+	cmd.Response = other.Response
+}
+
 // FetchCounterResponse contains the response data for a FetchCounterCommand
 type FetchCounterResponse struct {
 	IsNotFound   bool
@@ -836,6 +852,22 @@ func (cmd *FetchSetCommand) getResponseProtobufMessage() proto.Message {
 	return &rpbRiakDT.DtFetchResp{}
 }
 
+func (cmd *FetchSetCommand) hedgeClone() Command {
+	return &FetchSetCommand{
+		timeoutImpl: cmd.timeoutImpl,
+		protobuf:    cmd.protobuf,
+	}
+}
+
+func (cmd *FetchSetCommand) hedgeAdopt(c Command) {
+	other := c.(*FetchSetCommand)
+	cmd.commandImpl.adopt(&other.commandImpl)
+	if n := other.getLastNode(); n != nil {
+		cmd.setLastNode(n)
+	}
+	cmd.Response = other.Response
+}
+
 // FetchSetResponse contains the response data for a FetchSetCommand
 type FetchSetResponse struct {
 	IsNotFound bool
@@ -1551,6 +1583,22 @@ func (cmd *FetchMapCommand) getResponseProtobufMessage() proto.Message {
 	return &rpbRiakDT.DtFetchResp{}
 }
 
+func (cmd *FetchMapCommand) hedgeClone() Command {
+	return &FetchMapCommand{
+		timeoutImpl: cmd.timeoutImpl,
+		protobuf:    cmd.protobuf,
+	}
+}
+
+func (cmd *FetchMapCommand) hedgeAdopt(c Command) {
+	other := c.(*FetchMapCommand)
+	cmd.commandImpl.adopt(&other.commandImpl)
+	if n := other.getLastNode(); n != nil {
+		cmd.setLastNode(n)
+	}
+	cmd.Response = other.Response
+}
+
 // FetchMapResponse contains the response data for a FetchMapCommand
 type FetchMapResponse struct {
 	IsNotFound bool
@@ -0,0 +1,322 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+var (
+	ErrCrdtLoaderExecutorRequired = newClientError("[CrdtLoader] Executor is required", nil)
+	ErrCrdtLoaderBucketRequired   = newClientError("[CrdtLoader] BucketType and Bucket are required", nil)
+	ErrCrdtLoadItemOperation      = newClientError("[CrdtLoader] item requires exactly one of MapOperation or SetAdditions", nil)
+)
+
+// CrdtLoadItem is one CRDT update for a CrdtLoader. If Key is empty, Riak
+// generates a key
+type CrdtLoadItem struct {
+	Key          string
+	MapOperation *MapOperation
+	SetAdditions [][]byte
+}
+
+// CrdtLoadCheckpoint records the positions in the stream of the items a
+// CrdtLoader has loaded, starting at 0, so that a load that is restarted skips
+// them. A restarted load must be given the same items in the same order
+type CrdtLoadCheckpoint interface {
+	IsLoaded(index int) (bool, error)
+	SetLoaded(index int) error
+}
+
+type memoryCrdtLoadCheckpoint struct {
+	loaded map[int]bool
+	sync.Mutex
+}
+
+// NewMemoryCrdtLoadCheckpoint returns a CrdtLoadCheckpoint kept in memory
+func NewMemoryCrdtLoadCheckpoint() CrdtLoadCheckpoint {
+	return &memoryCrdtLoadCheckpoint{
+		loaded: make(map[int]bool),
+	}
+}
+
+func (c *memoryCrdtLoadCheckpoint) IsLoaded(index int) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.loaded[index], nil
+}
+
+func (c *memoryCrdtLoadCheckpoint) SetLoaded(index int) error {
+	c.Lock()
+	defer c.Unlock()
+	c.loaded[index] = true
+	return nil
+}
+
+// FileCrdtLoadCheckpoint is a CrdtLoadCheckpoint that appends the index of
+// each loaded item to a file, one per line
+type FileCrdtLoadCheckpoint struct {
+	file   *os.File
+	loaded map[int]bool
+	sync.Mutex
+}
+
+// NewFileCrdtLoadCheckpoint opens or creates a checkpoint file and loads the
+// indexes already in it
+func NewFileCrdtLoadCheckpoint(path string) (*FileCrdtLoadCheckpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c := &FileCrdtLoadCheckpoint{
+		file:   file,
+		loaded: make(map[int]bool),
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		index, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			// NB: a partially written last line is ignored
+			logWarn("[FileCrdtLoadCheckpoint]", "ignoring invalid line in %s: %v", path, err)
+			continue
+		}
+		c.loaded[index] = true
+	}
+	if err = scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// IsLoaded implements CrdtLoadCheckpoint
+func (c *FileCrdtLoadCheckpoint) IsLoaded(index int) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.loaded[index], nil
+}
+
+// SetLoaded implements CrdtLoadCheckpoint
+func (c *FileCrdtLoadCheckpoint) SetLoaded(index int) error {
+	c.Lock()
+	defer c.Unlock()
+	if _, err := c.file.WriteString(strconv.Itoa(index) + "\n"); err != nil {
+		return err
+	}
+	c.loaded[index] = true
+	return nil
+}
+
+// Close closes the checkpoint file
+func (c *FileCrdtLoadCheckpoint) Close() error {
+	return c.file.Close()
+}
+
+// CrdtLoaderOptions configure a CrdtLoader
+type CrdtLoaderOptions struct {
+	Executor   CommandExecutor
+	BucketType string
+	Bucket     string
+	// Concurrency is the number of updates executed at once, by default 1
+	Concurrency int
+	// Checkpoint, if set, is used to skip items loaded by a previous run
+	Checkpoint CrdtLoadCheckpoint
+	// CollectGeneratedKeys collects the keys Riak generates for items without
+	// a key in CrdtLoadResult.GeneratedKeys
+	CollectGeneratedKeys bool
+	// OnError, if set, is called for each item that could not be loaded
+	OnError func(err *CrdtLoadError)
+}
+
+// CrdtLoadError is the error for one item of a load
+type CrdtLoadError struct {
+	// Index is the position of the item in the stream, starting at 0
+	Index      int
+	Key        string
+	InnerError error
+}
+
+func (e *CrdtLoadError) Error() string {
+	return fmt.Sprintf("CrdtLoadError|%d|%s|%v", e.Index, e.Key, e.InnerError)
+}
+
+// CrdtLoadResult contains the outcome of CrdtLoader.Load
+type CrdtLoadResult struct {
+	Loaded        int
+	Skipped       int
+	Errors        []*CrdtLoadError
+	GeneratedKeys []string
+}
+
+// CrdtLoader executes a stream of Map or set updates with bounded
+// parallelism, for instance to populate CRDTs during a migration:
+//
+//	loader, err := riak.NewCrdtLoader(&riak.CrdtLoaderOptions{
+//		Executor:    cluster,
+//		BucketType:  "maps",
+//		Bucket:      "users",
+//		Concurrency: 16,
+//		Checkpoint:  checkpoint,
+//	})
+//	items := make(chan *riak.CrdtLoadItem)
+//	go func() {
+//		defer close(items)
+//		for _, user := range users {
+//			op := &riak.MapOperation{}
+//			op.SetRegister("name", []byte(user.Name))
+//			items <- &riak.CrdtLoadItem{Key: user.ID, MapOperation: op}
+//		}
+//	}()
+//	result := loader.Load(items)
+type CrdtLoader struct {
+	options *CrdtLoaderOptions
+}
+
+// NewCrdtLoader returns a CrdtLoader for the provided options
+func NewCrdtLoader(options *CrdtLoaderOptions) (*CrdtLoader, error) {
+	if options == nil {
+		return nil, ErrOptionsRequired
+	}
+	if options.Executor == nil {
+		return nil, ErrCrdtLoaderExecutorRequired
+	}
+	if options.BucketType == "" || options.Bucket == "" {
+		return nil, ErrCrdtLoaderBucketRequired
+	}
+	o := *options
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	return &CrdtLoader{
+		options: &o,
+	}, nil
+}
+
+type indexedCrdtLoadItem struct {
+	index int
+	item  *CrdtLoadItem
+}
+
+// Load executes the items read from the channel until it is closed. Errors for
+// individual items are returned in the result
+func (l *CrdtLoader) Load(items <-chan *CrdtLoadItem) *CrdtLoadResult {
+	result := &CrdtLoadResult{}
+	var mutex sync.Mutex
+	itemChan := make(chan *indexedCrdtLoadItem)
+	var wg sync.WaitGroup
+	for i := 0; i < l.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range itemChan {
+				skipped, generatedKey, err := l.load(i)
+				mutex.Lock()
+				switch {
+				case err != nil:
+					loadErr := &CrdtLoadError{
+						Index:      i.index,
+						Key:        i.item.Key,
+						InnerError: err,
+					}
+					result.Errors = append(result.Errors, loadErr)
+					if l.options.OnError != nil {
+						l.options.OnError(loadErr)
+					}
+				case skipped:
+					result.Skipped++
+				default:
+					result.Loaded++
+					if generatedKey != "" && l.options.CollectGeneratedKeys {
+						result.GeneratedKeys = append(result.GeneratedKeys, generatedKey)
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	index := 0
+	for item := range items {
+		itemChan <- &indexedCrdtLoadItem{index: index, item: item}
+		index++
+	}
+	close(itemChan)
+	wg.Wait()
+	return result
+}
+
+// load executes the update for one item and returns whether it was skipped
+// and the generated key, if any
+func (l *CrdtLoader) load(i *indexedCrdtLoadItem) (bool, string, error) {
+	item := i.item
+	if (item.MapOperation == nil) == (len(item.SetAdditions) == 0) {
+		return false, "", ErrCrdtLoadItemOperation
+	}
+	checkpoint := l.options.Checkpoint
+	if checkpoint != nil {
+		loaded, err := checkpoint.IsLoaded(i.index)
+		if err != nil {
+			return false, "", err
+		}
+		if loaded {
+			return true, "", nil
+		}
+	}
+
+	var cmd Command
+	var err error
+	if item.MapOperation != nil {
+		cmd, err = NewUpdateMapCommandBuilder().
+			WithBucketType(l.options.BucketType).
+			WithBucket(l.options.Bucket).
+			WithKey(item.Key).
+			WithMapOperation(item.MapOperation).
+			Build()
+	} else {
+		cmd, err = NewUpdateSetCommandBuilder().
+			WithBucketType(l.options.BucketType).
+			WithBucket(l.options.Bucket).
+			WithKey(item.Key).
+			WithAdditions(item.SetAdditions...).
+			Build()
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if err = l.options.Executor.Execute(cmd); err != nil {
+		return false, "", err
+	}
+
+	var generatedKey string
+	switch c := cmd.(type) {
+	case *UpdateMapCommand:
+		if c.Response != nil {
+			generatedKey = c.Response.GeneratedKey
+		}
+	case *UpdateSetCommand:
+		if c.Response != nil {
+			generatedKey = c.Response.GeneratedKey
+		}
+	}
+	if checkpoint != nil {
+		if err = checkpoint.SetLoaded(i.index); err != nil {
+			return false, "", err
+		}
+	}
+	return false, generatedKey, nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type testCrdtLoaderExecutor struct {
+	executed  map[string]int
+	generated int
+	sync.Mutex
+}
+
+func (e *testCrdtLoaderExecutor) Execute(cmd Command) error {
+	e.Lock()
+	defer e.Unlock()
+	switch c := cmd.(type) {
+	case *UpdateMapCommand:
+		key := string(c.protobuf.Key)
+		if key == "bad" {
+			return errors.New("write failed")
+		}
+		c.Response = &UpdateMapResponse{}
+		if key == "" {
+			e.generated++
+			key = fmt.Sprintf("generated_%d", e.generated)
+			c.Response.GeneratedKey = key
+		}
+		e.executed[key]++
+	case *UpdateSetCommand:
+		e.executed[string(c.protobuf.Key)]++
+		c.Response = &UpdateSetResponse{}
+	}
+	return nil
+}
+
+func loadTestCrdtItems(loader *CrdtLoader, items ...*CrdtLoadItem) *CrdtLoadResult {
+	itemChan := make(chan *CrdtLoadItem)
+	go func() {
+		defer close(itemChan)
+		for _, item := range items {
+			itemChan <- item
+		}
+	}()
+	return loader.Load(itemChan)
+}
+
+func TestCrdtLoaderLoadsItemsAndReportsErrors(t *testing.T) {
+	executor := &testCrdtLoaderExecutor{executed: make(map[string]int)}
+	var onErrorCount int
+	loader, err := NewCrdtLoader(&CrdtLoaderOptions{
+		Executor:             executor,
+		BucketType:           "maps",
+		Bucket:               "users",
+		Concurrency:          4,
+		CollectGeneratedKeys: true,
+		OnError: func(err *CrdtLoadError) {
+			onErrorCount++
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []*CrdtLoadItem
+	for i := 0; i < 20; i++ {
+		op := &MapOperation{}
+		op.IncrementCounter("visits", 1)
+		items = append(items, &CrdtLoadItem{Key: fmt.Sprintf("user_%d", i), MapOperation: op})
+	}
+	items = append(items,
+		&CrdtLoadItem{Key: "bad", MapOperation: &MapOperation{}},
+		&CrdtLoadItem{Key: "empty"},
+		&CrdtLoadItem{MapOperation: &MapOperation{}},
+		&CrdtLoadItem{Key: "tags", SetAdditions: [][]byte{[]byte("a")}},
+	)
+
+	result := loadTestCrdtItems(loader, items...)
+	if expected, actual := 22, result.Loaded; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, len(result.Errors); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, onErrorCount; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	for _, loadErr := range result.Errors {
+		switch loadErr.Key {
+		case "bad":
+			if expected, actual := 20, loadErr.Index; expected != actual {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		case "empty":
+			if expected, actual := ErrCrdtLoadItemOperation, loadErr.InnerError; expected != actual {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		default:
+			t.Errorf("unexpected error %v", loadErr)
+		}
+	}
+	if expected, actual := []string{"generated_1"}, result.GeneratedKeys; len(actual) != 1 || expected[0] != actual[0] {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 1, executor.executed["tags"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestCrdtLoaderResumesFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riak-go-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	executor := &testCrdtLoaderExecutor{executed: make(map[string]int)}
+	load := func(keys ...string) *CrdtLoadResult {
+		checkpoint, err := NewFileCrdtLoadCheckpoint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer checkpoint.Close()
+		loader, err := NewCrdtLoader(&CrdtLoaderOptions{
+			Executor:   executor,
+			BucketType: "sets",
+			Bucket:     "tags",
+			Checkpoint: checkpoint,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var items []*CrdtLoadItem
+		for _, key := range keys {
+			items = append(items, &CrdtLoadItem{Key: key, SetAdditions: [][]byte{[]byte("a")}})
+		}
+		return loadTestCrdtItems(loader, items...)
+	}
+
+	load("a", "b")
+	result := load("a", "b", "c")
+	if expected, actual := 2, result.Skipped; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 1, result.Loaded; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if expected, actual := 1, executor.executed[key]; expected != actual {
+			t.Errorf("%s: expected %v, got %v", key, expected, actual)
+		}
+	}
+
+	// NB: later operations on a key already loaded are not skipped
+	result = load("a", "b", "c", "a", "a")
+	if expected, actual := 3, result.Skipped; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, result.Loaded; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 3, executor.executed["a"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestCrdtLoaderCheckpointsOperationsOnTheSameKey(t *testing.T) {
+	executor := &testCrdtLoaderExecutor{executed: make(map[string]int)}
+	checkpoint := NewMemoryCrdtLoadCheckpoint()
+	loader, err := NewCrdtLoader(&CrdtLoaderOptions{
+		Executor:    executor,
+		BucketType:  "maps",
+		Bucket:      "users",
+		Concurrency: 2,
+		Checkpoint:  checkpoint,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]*CrdtLoadItem, 2)
+	for i := range items {
+		op := &MapOperation{}
+		op.IncrementCounter("visits", 1)
+		items[i] = &CrdtLoadItem{Key: "user", MapOperation: op}
+	}
+
+	result := loadTestCrdtItems(loader, items...)
+	if expected, actual := 2, result.Loaded; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, executor.executed["user"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	result = loadTestCrdtItems(loader, items...)
+	if expected, actual := 2, result.Skipped; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, executor.executed["user"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestNewCrdtLoaderValidatesOptions(t *testing.T) {
+	if _, err := NewCrdtLoader(nil); err != ErrOptionsRequired {
+		t.Errorf("expected %v, got %v", ErrOptionsRequired, err)
+	}
+	if _, err := NewCrdtLoader(&CrdtLoaderOptions{BucketType: "maps", Bucket: "users"}); err != ErrCrdtLoaderExecutorRequired {
+		t.Errorf("expected %v, got %v", ErrCrdtLoaderExecutorRequired, err)
+	}
+	executor := &testCrdtLoaderExecutor{}
+	if _, err := NewCrdtLoader(&CrdtLoaderOptions{Executor: executor, BucketType: "maps"}); err != ErrCrdtLoaderBucketRequired {
+		t.Errorf("expected %v, got %v", ErrCrdtLoaderBucketRequired, err)
+	}
+}
@@ -0,0 +1,579 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Map field types used in riak struct tags
+const (
+	mapFieldCounter  = "counter"
+	mapFieldSet      = "set"
+	mapFieldRegister = "register"
+	mapFieldFlag     = "flag"
+	mapFieldMap      = "map"
+)
+
+var (
+	bytesType = reflect.TypeOf([]byte(nil))
+	timeType  = reflect.TypeOf(time.Time{})
+)
+
+// mapField describes a struct field mapped to a Map entry
+type mapField struct {
+	index int
+	name  string
+	kind  string
+	json  bool
+	// omitEmpty omits a register holding its zero value
+	omitEmpty bool
+}
+
+// getMapFields returns the fields of a struct type that have a riak tag
+func getMapFields(t reflect.Type) ([]*mapField, error) {
+	var fields []*mapField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("riak")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if f.PkgPath != "" {
+			return nil, fmt.Errorf("[Map] field %s.%s is unexported", t.Name(), f.Name)
+		}
+		parts := strings.Split(tag, ",")
+		field := &mapField{
+			index: i,
+			name:  parts[0],
+		}
+		if field.name == "" {
+			field.name = f.Name
+		}
+		if len(parts) > 1 {
+			field.kind = parts[1]
+		}
+		for i := 2; i < len(parts); i++ {
+			switch parts[i] {
+			case "json":
+				field.json = true
+			case "omitempty":
+				field.omitEmpty = true
+			}
+		}
+		kinds := mapFieldKinds(f.Type)
+		if field.json {
+			kinds = []string{mapFieldRegister}
+		}
+		if field.kind == "" && len(kinds) > 0 {
+			field.kind = kinds[0]
+		}
+		if !containsString(kinds, field.kind) {
+			return nil, fmt.Errorf("[Map] field %s.%s of type %v cannot be mapped as '%s'", t.Name(), f.Name, f.Type, field.kind)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// mapFieldKinds returns the Map entry types a Go type can be mapped to, the
+// first being the one used when the tag does not specify a type
+func mapFieldKinds(t reflect.Type) []string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []string{mapFieldCounter, mapFieldRegister}
+	case reflect.Float32, reflect.Float64, reflect.String:
+		return []string{mapFieldRegister}
+	case reflect.Bool:
+		return []string{mapFieldFlag}
+	case reflect.Slice:
+		if t == bytesType {
+			return []string{mapFieldRegister}
+		}
+		if t.Elem().Kind() == reflect.String || t.Elem() == bytesType {
+			return []string{mapFieldSet}
+		}
+	case reflect.Struct:
+		if t == timeType {
+			return []string{mapFieldRegister}
+		}
+		return []string{mapFieldMap}
+	case reflect.Ptr:
+		if t.Elem().Kind() == reflect.Struct && t.Elem() != timeType {
+			return []string{mapFieldMap}
+		}
+		// NB: a nil pointer is an absent register
+		if t.Elem().Kind() != reflect.Ptr && containsString(mapFieldKinds(t.Elem()), mapFieldRegister) {
+			return []string{mapFieldRegister}
+		}
+	}
+	return nil
+}
+
+// structValue returns the struct v refers to, which must be a struct or a
+// non-nil pointer to one
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("[Map] expected a struct or pointer to a struct, got %v", reflect.TypeOf(v))
+	}
+	return rv, nil
+}
+
+// UnmarshalMap decodes a Map into the struct pointed to by v using the riak
+// tags on its fields. Fields with no corresponding Map entry are set to their
+// zero value.
+//
+// The tag is the Map entry name followed by its type, which is inferred from
+// the field's Go type if omitted. Counters are signed integers, registers are
+// strings, []byte, signed integers, floats or time.Time, or pointers to them,
+// flags are bools, sets are []string or [][]byte and nested maps are structs
+// or pointers to structs. Registers use the encodings of the typed register
+// accessors on Map. The json option stores a field of any type in a register
+// as JSON. A register holding a zero value such as 0 is stored; use a pointer,
+// or the omitempty option, for a register that may be absent. Fields without
+// a riak tag are ignored:
+//
+//	type User struct {
+//		Name      string            `riak:"name,register"`
+//		Age       int64             `riak:"age,register"`
+//		Height    *float64          `riak:"height,register"`
+//		Nickname  string            `riak:"nickname,register,omitempty"`
+//		Joined    time.Time         `riak:"joined"`
+//		Prefs     map[string]string `riak:"prefs,register,json"`
+//		Visits    int64             `riak:"visits,counter"`
+//		Interests []string          `riak:"interests,set"`
+//		Admin     bool              `riak:"admin,flag"`
+//		Address   *Address          `riak:"address,map"`
+//	}
+func UnmarshalMap(m *Map, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("[Map] UnmarshalMap requires a non-nil pointer to a struct, got %v", reflect.TypeOf(v))
+	}
+	if m == nil {
+		m = &Map{}
+	}
+	return unmarshalMap(m, rv.Elem())
+}
+
+func unmarshalMap(m *Map, rv reflect.Value) error {
+	fields, err := getMapFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		fv := rv.Field(field.index)
+		fv.Set(reflect.Zero(fv.Type()))
+		switch field.kind {
+		case mapFieldCounter:
+			fv.SetInt(m.Counters[field.name])
+		case mapFieldRegister:
+			if value, ok := m.Registers[field.name]; ok {
+				if err := field.decodeRegister(fv, value); err != nil {
+					return err
+				}
+			}
+		case mapFieldFlag:
+			fv.SetBool(m.Flags[field.name])
+		case mapFieldSet:
+			if values, ok := m.Sets[field.name]; ok {
+				set := reflect.MakeSlice(fv.Type(), len(values), len(values))
+				for i, value := range values {
+					if fv.Type().Elem() == bytesType {
+						set.Index(i).SetBytes(value)
+					} else {
+						set.Index(i).SetString(string(value))
+					}
+				}
+				fv.Set(set)
+			}
+		case mapFieldMap:
+			nested, ok := m.Maps[field.name]
+			if !ok {
+				continue
+			}
+			if fv.Kind() == reflect.Ptr {
+				fv.Set(reflect.New(fv.Type().Elem()))
+				fv = fv.Elem()
+			}
+			if err := unmarshalMap(nested, fv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalMap encodes a struct, or pointer to a struct, as a Map using the
+// riak tags on its fields. Zero-valued counters, flags and sets, registers
+// that are nil or have the omitempty option and their zero value, and nil
+// nested maps are omitted
+func MarshalMap(v interface{}) (*Map, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return marshalMap(rv)
+}
+
+func marshalMap(rv reflect.Value) (*Map, error) {
+	fields, err := getMapFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	m := &Map{}
+	for _, field := range fields {
+		fv := rv.Field(field.index)
+		switch field.kind {
+		case mapFieldCounter:
+			if fv.Int() != 0 {
+				if m.Counters == nil {
+					m.Counters = make(map[string]int64)
+				}
+				m.Counters[field.name] = fv.Int()
+			}
+		case mapFieldRegister:
+			value, err := field.encodeRegister(fv)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				if m.Registers == nil {
+					m.Registers = make(map[string][]byte)
+				}
+				m.Registers[field.name] = value
+			}
+		case mapFieldFlag:
+			if fv.Bool() {
+				if m.Flags == nil {
+					m.Flags = make(map[string]bool)
+				}
+				m.Flags[field.name] = true
+			}
+		case mapFieldSet:
+			if fv.Len() > 0 {
+				if m.Sets == nil {
+					m.Sets = make(map[string][][]byte)
+				}
+				m.Sets[field.name] = setBytes(fv)
+			}
+		case mapFieldMap:
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			nested, err := marshalMap(fv)
+			if err != nil {
+				return nil, err
+			}
+			if m.Maps == nil {
+				m.Maps = make(map[string]*Map)
+			}
+			m.Maps[field.name] = nested
+		}
+	}
+	return m, nil
+}
+
+// DiffMap returns the MapOperation that changes the Map for the old struct
+// into the Map for the new one. Both must be of the same struct type.
+// Counters are incremented by their difference, sets have elements added and
+// removed, registers that become nil, or zero with the omitempty option, and
+// nested maps that become nil are removed. Entries in the Map that are not
+// mapped to struct fields are not changed.
+//
+// A MapOperation that removes anything must be sent with the Context of the
+// fetched Map; FetchMapResponse.NewUpdateMapCommandBuilder does this.
+func DiffMap(old, new interface{}) (*MapOperation, error) {
+	oldValue, err := structValue(old)
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := structValue(new)
+	if err != nil {
+		return nil, err
+	}
+	if oldValue.Type() != newValue.Type() {
+		return nil, fmt.Errorf("[Map] cannot diff %v and %v", oldValue.Type(), newValue.Type())
+	}
+	oldMap, err := marshalMap(oldValue)
+	if err != nil {
+		return nil, err
+	}
+	op := &MapOperation{}
+	if err = diffMap(oldMap, newValue, op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func diffMap(old *Map, rv reflect.Value, op *MapOperation) error {
+	fields, err := getMapFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		fv := rv.Field(field.index)
+		switch field.kind {
+		case mapFieldCounter:
+			if delta := fv.Int() - old.Counters[field.name]; delta != 0 {
+				op.IncrementCounter(field.name, delta)
+			}
+		case mapFieldRegister:
+			oldValue, ok := old.Registers[field.name]
+			value, err := field.encodeRegister(fv)
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				if ok {
+					op.RemoveRegister(field.name)
+				}
+			} else if !ok || !bytes.Equal(oldValue, value) {
+				op.SetRegister(field.name, value)
+			}
+		case mapFieldFlag:
+			if fv.Bool() != old.Flags[field.name] {
+				op.SetFlag(field.name, fv.Bool())
+			}
+		case mapFieldSet:
+			oldValues, values := old.Sets[field.name], setBytes(fv)
+			for _, value := range values {
+				if !containsBytes(oldValues, value) {
+					op.AddToSet(field.name, value)
+				}
+			}
+			for _, oldValue := range oldValues {
+				if !containsBytes(values, oldValue) {
+					op.RemoveFromSet(field.name, oldValue)
+				}
+			}
+		case mapFieldMap:
+			oldNested, ok := old.Maps[field.name]
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					if ok {
+						op.RemoveMap(field.name)
+					}
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if !ok {
+				oldNested = &Map{}
+			}
+			nestedOp := &MapOperation{}
+			if err := diffMap(oldNested, fv, nestedOp); err != nil {
+				return err
+			}
+			if !nestedOp.isEmpty() {
+				if op.maps == nil {
+					op.maps = make(map[string]*MapOperation)
+				}
+				op.maps[field.name] = nestedOp
+			}
+		}
+	}
+	return nil
+}
+
+// Unmarshal decodes the fetched Map into the struct pointed to by v. See
+// UnmarshalMap
+func (rsp *FetchMapResponse) Unmarshal(v interface{}) error {
+	return UnmarshalMap(rsp.Map, v)
+}
+
+// NewUpdateMapCommandBuilder returns an UpdateMapCommandBuilder with the
+// MapOperation that changes the fetched Map to match v, and the fetch Context.
+// The bucket type, bucket and key must still be set:
+//
+//	user := &User{}
+//	err = fetch.Response.Unmarshal(user)
+//	user.Visits++
+//	builder, err := fetch.Response.NewUpdateMapCommandBuilder(user)
+//	cmd, err = builder.
+//		WithBucketType("maps").
+//		WithBucket("users").
+//		WithKey("user_1").
+//		Build()
+func (rsp *FetchMapResponse) NewUpdateMapCommandBuilder(v interface{}) (*UpdateMapCommandBuilder, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	old := rsp.Map
+	if old == nil {
+		old = &Map{}
+	}
+	op := &MapOperation{}
+	if err = diffMap(old, rv, op); err != nil {
+		return nil, err
+	}
+	return NewUpdateMapCommandBuilder().
+		WithContext(rsp.Context).
+		WithMapOperation(op), nil
+}
+
+func (mapOp *MapOperation) isEmpty() bool {
+	for _, m := range mapOp.maps {
+		if !m.isEmpty() {
+			return false
+		}
+	}
+	return len(mapOp.incrementCounters) == 0 &&
+		len(mapOp.removeCounters) == 0 &&
+		len(mapOp.addToSets) == 0 &&
+		len(mapOp.removeFromSets) == 0 &&
+		len(mapOp.removeSets) == 0 &&
+		len(mapOp.registersToSet) == 0 &&
+		len(mapOp.removeRegisters) == 0 &&
+		len(mapOp.flagsToSet) == 0 &&
+		len(mapOp.removeFlags) == 0 &&
+		len(mapOp.removeMaps) == 0
+}
+
+// encodeRegister returns the register value for a field, or nil if the
+// register is absent: the field is a nil pointer, slice, map or interface,
+// or has the omitempty option and its zero value. See crdt_registers.go for
+// the encodings used
+func (field *mapField) encodeRegister(fv reflect.Value) ([]byte, error) {
+	if isNilValue(fv) || (field.omitEmpty && isZeroValue(fv)) {
+		return nil, nil
+	}
+	if field.json {
+		return json.Marshal(fv.Interface())
+	}
+	if fv.Kind() == reflect.Ptr {
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return []byte(fv.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeRegisterInt64(fv.Int()), nil
+	case reflect.Float32, reflect.Float64:
+		return encodeRegisterFloat64(fv.Float()), nil
+	case reflect.Struct:
+		return encodeRegisterTime(fv.Interface().(time.Time)), nil
+	}
+	if fv.Bytes() == nil {
+		return []byte{}, nil
+	}
+	return fv.Bytes(), nil
+}
+
+func (field *mapField) decodeRegister(fv reflect.Value, value []byte) error {
+	if field.json {
+		if err := json.Unmarshal(value, fv.Addr().Interface()); err != nil {
+			return newRegisterDecodeError(field.name, "JSON", value, err)
+		}
+		return nil
+	}
+	if fv.Kind() == reflect.Ptr {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := field.decodeRegister(ptr.Elem(), value); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(string(value))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := decodeRegisterInt64(field.name, value)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(i) {
+			return newRegisterDecodeError(field.name, fv.Type().String(), value, nil)
+		}
+		fv.SetInt(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := decodeRegisterFloat64(field.name, value)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Struct:
+		t, err := decodeRegisterTime(field.name, value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+	default:
+		fv.SetBytes(value)
+	}
+	return nil
+}
+
+func isNilValue(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+		return fv.IsNil()
+	}
+	return false
+}
+
+func isZeroValue(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+		return fv.IsNil() || (fv.Kind() == reflect.Slice && fv.Len() == 0)
+	case reflect.String:
+		return fv.Len() == 0
+	}
+	return reflect.DeepEqual(fv.Interface(), reflect.Zero(fv.Type()).Interface())
+}
+
+func setBytes(fv reflect.Value) [][]byte {
+	values := make([][]byte, fv.Len())
+	for i := range values {
+		if v := fv.Index(i); v.Kind() == reflect.String {
+			values[i] = []byte(v.String())
+		} else {
+			values[i] = v.Bytes()
+		}
+	}
+	return values
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsBytes(values [][]byte, value []byte) bool {
+	for _, v := range values {
+		if bytes.Equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,316 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testMapAddress struct {
+	City string `riak:"city,register"`
+}
+
+type testMapUser struct {
+	Name      string          `riak:"name,register"`
+	Avatar    []byte          `riak:"avatar"`
+	Visits    int64           `riak:"visits,counter"`
+	Interests []string        `riak:"interests,set"`
+	Admin     bool            `riak:"admin,flag"`
+	Address   *testMapAddress `riak:"address,map"`
+	Billing   testMapAddress  `riak:"billing,map"`
+	Ignored   string
+}
+
+func TestUnmarshalMap(t *testing.T) {
+	m := &Map{
+		Counters:  map[string]int64{"visits": 5},
+		Sets:      map[string][][]byte{"interests": {[]byte("go"), []byte("riak")}},
+		Registers: map[string][]byte{"name": []byte("Jane"), "avatar": {1, 2}, "unmapped": []byte("x")},
+		Flags:     map[string]bool{"admin": true},
+		Maps: map[string]*Map{
+			"address": {Registers: map[string][]byte{"city": []byte("Seattle")}},
+		},
+	}
+	user := &testMapUser{Ignored: "kept", Billing: testMapAddress{City: "stale"}}
+	if err := UnmarshalMap(m, user); err != nil {
+		t.Fatal(err)
+	}
+	expected := &testMapUser{
+		Name:      "Jane",
+		Avatar:    []byte{1, 2},
+		Visits:    5,
+		Interests: []string{"go", "riak"},
+		Admin:     true,
+		Address:   &testMapAddress{City: "Seattle"},
+		Ignored:   "kept",
+	}
+	if !reflect.DeepEqual(expected, user) {
+		t.Errorf("expected %+v, got %+v", expected, user)
+	}
+
+	if err := UnmarshalMap(m, *user); err == nil {
+		t.Error("expected error when not passing a pointer")
+	}
+}
+
+func TestMarshalMapRoundTrip(t *testing.T) {
+	user := &testMapUser{
+		Name:      "Jane",
+		Visits:    5,
+		Interests: []string{"go"},
+		Billing:   testMapAddress{City: "Portland"},
+	}
+	m, err := MarshalMap(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Flags["admin"]; ok {
+		t.Error("expected false flag to be omitted")
+	}
+	if _, ok := m.Maps["address"]; ok {
+		t.Error("expected nil nested map to be omitted")
+	}
+	decoded := &testMapUser{}
+	if err = UnmarshalMap(m, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(user, decoded) {
+		t.Errorf("expected %+v, got %+v", user, decoded)
+	}
+}
+
+func TestMapFieldTagErrors(t *testing.T) {
+	type wrongKind struct {
+		Name string `riak:"name,counter"`
+	}
+	if _, err := MarshalMap(&wrongKind{}); err == nil {
+		t.Error("expected error for string mapped as counter")
+	}
+	type unsupported struct {
+		Ratio complex128 `riak:"ratio"`
+	}
+	if _, err := MarshalMap(&unsupported{}); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+	type unexported struct {
+		name string `riak:"name"`
+	}
+	if _, err := MarshalMap(&unexported{}); err == nil {
+		t.Error("expected error for unexported field")
+	}
+}
+
+func TestDiffMap(t *testing.T) {
+	old := &testMapUser{
+		Name:      "Jane",
+		Avatar:    []byte{1},
+		Visits:    5,
+		Interests: []string{"go", "riak"},
+		Address:   &testMapAddress{City: "Seattle"},
+		Billing:   testMapAddress{City: "Portland"},
+	}
+	new := &testMapUser{
+		Name:      "Jane Doe",
+		Visits:    8,
+		Interests: []string{"riak", "erlang"},
+		Admin:     true,
+		Billing:   testMapAddress{City: "Portland"},
+	}
+	op, err := DiffMap(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(3), op.incrementCounters["visits"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "Jane Doe", string(op.registersToSet["name"]); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if !op.removeRegisters["avatar"] {
+		t.Error("expected emptied register to be removed")
+	}
+	if expected, actual := [][]byte{[]byte("erlang")}, op.addToSets["interests"]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := [][]byte{[]byte("go")}, op.removeFromSets["interests"]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if !op.flagsToSet["admin"] {
+		t.Error("expected admin flag to be set")
+	}
+	if !op.removeMaps["address"] {
+		t.Error("expected nil nested map to be removed")
+	}
+	if _, ok := op.maps["billing"]; ok {
+		t.Error("expected unchanged nested map not to be in the operation")
+	}
+
+	op, err = DiffMap(new, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !op.isEmpty() {
+		t.Errorf("expected empty operation, got %+v", op)
+	}
+
+	if _, err = DiffMap(old, &testMapAddress{}); err == nil {
+		t.Error("expected error for different types")
+	}
+}
+
+func TestFetchMapResponseNewUpdateMapCommandBuilderCarriesContext(t *testing.T) {
+	rsp := &FetchMapResponse{
+		Context: []byte("context"),
+		Map: &Map{
+			Counters: map[string]int64{"visits": 1},
+			Sets:     map[string][][]byte{"interests": {[]byte("go")}},
+			Maps: map[string]*Map{
+				"address": {Registers: map[string][]byte{"city": []byte("Seattle")}},
+			},
+		},
+	}
+	user := &testMapUser{}
+	if err := rsp.Unmarshal(user); err != nil {
+		t.Fatal(err)
+	}
+	user.Visits++
+	user.Interests = nil
+	user.Address.City = "Portland"
+
+	builder, err := rsp.NewUpdateMapCommandBuilder(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := builder.
+		WithBucketType("maps").
+		WithBucket("users").
+		WithKey("user_1").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := cmd.(*UpdateMapCommand)
+	if expected, actual := []byte("context"), update.protobuf.Context; !bytes.Equal(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(1), update.op.incrementCounters["visits"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "Portland", string(update.op.maps["address"].registersToSet["city"]); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := [][]byte{[]byte("go")}, update.op.removeFromSets["interests"]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+type testMapTypedRegisters struct {
+	Age    int64             `riak:"age,register"`
+	Score  float64           `riak:"score"`
+	Joined time.Time         `riak:"joined"`
+	Prefs  map[string]string `riak:"prefs,register,json"`
+}
+
+func TestMapTypedRegisterFields(t *testing.T) {
+	joined := time.Date(2016, 4, 1, 12, 30, 0, 500, time.FixedZone("PDT", -7*60*60))
+	v := &testMapTypedRegisters{
+		Age:    42,
+		Score:  0.5,
+		Joined: joined,
+		Prefs:  map[string]string{"theme": "dark"},
+	}
+	m, err := MarshalMap(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]byte{
+		"age":    []byte("42"),
+		"score":  []byte("0.5"),
+		"joined": []byte("2016-04-01T19:30:00.0000005Z"),
+		"prefs":  []byte(`{"theme":"dark"}`),
+	}
+	if !reflect.DeepEqual(expected, m.Registers) {
+		t.Errorf("expected %s, got %s", expected, m.Registers)
+	}
+
+	decoded := &testMapTypedRegisters{}
+	if err = UnmarshalMap(m, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Joined.Equal(joined) || decoded.Age != 42 || decoded.Score != 0.5 || decoded.Prefs["theme"] != "dark" {
+		t.Errorf("expected %+v, got %+v", v, decoded)
+	}
+
+	m.Registers["age"] = []byte("forty-two")
+	if err = UnmarshalMap(m, decoded); err == nil {
+		t.Error("expected error decoding a non-numeric register as an int64")
+	}
+}
+
+type testMapOptionalRegisters struct {
+	Age      int64     `riak:"age,register"`
+	Joined   time.Time `riak:"joined"`
+	Rank     *int64    `riak:"rank,register"`
+	Nickname string    `riak:"nickname,register,omitempty"`
+}
+
+func TestDiffMapZeroValuedRegisters(t *testing.T) {
+	rank := int64(0)
+	old := &testMapOptionalRegisters{Age: 5, Rank: &rank, Nickname: "jd"}
+	new := &testMapOptionalRegisters{}
+	op, err := DiffMap(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "0", string(op.registersToSet["age"]); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if op.removeRegisters["age"] {
+		t.Error("expected zero int64 register not to be removed")
+	}
+	if !op.removeRegisters["rank"] {
+		t.Error("expected nil pointer register to be removed")
+	}
+	if !op.removeRegisters["nickname"] {
+		t.Error("expected empty omitempty register to be removed")
+	}
+
+	m, err := MarshalMap(new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]byte{
+		"age":    []byte("0"),
+		"joined": encodeRegisterTime(time.Time{}),
+	}
+	if !reflect.DeepEqual(expected, m.Registers) {
+		t.Errorf("expected %s, got %s", expected, m.Registers)
+	}
+
+	m, err = MarshalMap(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &testMapOptionalRegisters{}
+	if err = UnmarshalMap(m, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Rank == nil || *decoded.Rank != 0 || decoded.Age != 5 || decoded.Nickname != "jd" {
+		t.Errorf("expected %+v, got %+v", old, decoded)
+	}
+}
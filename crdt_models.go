@@ -0,0 +1,525 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import "bytes"
+
+// The model types in this file hold a fetched CRDT value and its context,
+// apply local mutations to that value and record them, so that they can be
+// flushed to Riak with a single update command:
+//
+//	set := NewSetModel(fetch.Response)
+//	set.Add([]byte("a"))
+//	set.Remove([]byte("b"))
+//	cmd, err := set.NewUpdateSetCommandBuilder().
+//		WithBucketType("sets").
+//		WithBucket("myBucket").
+//		WithKey("myKey").
+//		Build()
+//
+// Models are not safe for concurrent use.
+
+// CounterModel is a local model of a counter CRDT
+type CounterModel struct {
+	value     int64
+	increment int64
+}
+
+// NewCounterModel returns a CounterModel for a fetched counter. rsp may be nil
+// for a new counter
+func NewCounterModel(rsp *FetchCounterResponse) *CounterModel {
+	c := &CounterModel{}
+	if rsp != nil {
+		c.value = rsp.CounterValue
+	}
+	return c
+}
+
+// Value returns the counter's value including local increments
+func (c *CounterModel) Value() int64 {
+	return c.value + c.increment
+}
+
+// Increment increments, or decrements if negative, the counter
+func (c *CounterModel) Increment(increment int64) *CounterModel {
+	c.increment += increment
+	return c
+}
+
+// HasChanges returns true if the counter has been changed locally
+func (c *CounterModel) HasChanges() bool {
+	return c.increment != 0
+}
+
+// NewUpdateCounterCommandBuilder returns an UpdateCounterCommandBuilder with the
+// local increment
+func (c *CounterModel) NewUpdateCounterCommandBuilder() *UpdateCounterCommandBuilder {
+	return NewUpdateCounterCommandBuilder().WithIncrement(c.increment)
+}
+
+// SetModel is a local model of a set CRDT
+type SetModel struct {
+	context []byte
+	value   [][]byte
+	adds    [][]byte
+	removes [][]byte
+}
+
+// NewSetModel returns a SetModel for a fetched set. rsp may be nil for a new
+// set
+func NewSetModel(rsp *FetchSetResponse) *SetModel {
+	s := &SetModel{}
+	if rsp != nil {
+		s.context = rsp.Context
+		s.value = copyByteSlices(rsp.SetValue)
+	}
+	return s
+}
+
+// Context returns the context of the fetched set
+func (s *SetModel) Context() []byte {
+	return s.context
+}
+
+// Value returns the elements of the set including local changes
+func (s *SetModel) Value() [][]byte {
+	return s.value
+}
+
+// Contains returns true if the set contains value
+func (s *SetModel) Contains(value []byte) bool {
+	return containsBytes(s.value, value)
+}
+
+// Add adds an element to the set
+func (s *SetModel) Add(value []byte) *SetModel {
+	s.removes = removeBytes(s.removes, value)
+	if !containsBytes(s.value, value) {
+		s.value = append(s.value, value)
+		s.adds = append(s.adds, value)
+	}
+	return s
+}
+
+// Remove removes an element from the set. Riak rejects the removal of
+// elements it does not know about, so only elements of the fetched set are
+// sent as removals
+func (s *SetModel) Remove(value []byte) *SetModel {
+	if !containsBytes(s.value, value) {
+		return s
+	}
+	s.value = removeBytes(s.value, value)
+	if containsBytes(s.adds, value) {
+		s.adds = removeBytes(s.adds, value)
+	} else {
+		s.removes = append(s.removes, value)
+	}
+	return s
+}
+
+// HasChanges returns true if the set has been changed locally
+func (s *SetModel) HasChanges() bool {
+	return len(s.adds) > 0 || len(s.removes) > 0
+}
+
+// NewUpdateSetCommandBuilder returns an UpdateSetCommandBuilder with the local
+// additions and removals and the fetched context
+func (s *SetModel) NewUpdateSetCommandBuilder() *UpdateSetCommandBuilder {
+	builder := NewUpdateSetCommandBuilder().
+		WithContext(s.context)
+	if len(s.adds) > 0 {
+		builder.WithAdditions(s.adds...)
+	}
+	if len(s.removes) > 0 {
+		builder.WithRemovals(s.removes...)
+	}
+	return builder
+}
+
+// GSetModel is a local model of a grow-only set CRDT
+type GSetModel struct {
+	context []byte
+	value   [][]byte
+	adds    [][]byte
+}
+
+// NewGSetModel returns a GSetModel for a fetched grow-only set. rsp may be nil
+// for a new set
+func NewGSetModel(rsp *FetchSetResponse) *GSetModel {
+	s := &GSetModel{}
+	if rsp != nil {
+		s.context = rsp.Context
+		s.value = copyByteSlices(rsp.SetValue)
+	}
+	return s
+}
+
+// Value returns the elements of the set including local additions
+func (s *GSetModel) Value() [][]byte {
+	return s.value
+}
+
+// Contains returns true if the set contains value
+func (s *GSetModel) Contains(value []byte) bool {
+	return containsBytes(s.value, value)
+}
+
+// Add adds an element to the set
+func (s *GSetModel) Add(value []byte) *GSetModel {
+	if !containsBytes(s.value, value) {
+		s.value = append(s.value, value)
+		s.adds = append(s.adds, value)
+	}
+	return s
+}
+
+// HasChanges returns true if elements have been added locally
+func (s *GSetModel) HasChanges() bool {
+	return len(s.adds) > 0
+}
+
+// NewUpdateGSetCommandBuilder returns an UpdateGSetCommandBuilder with the
+// local additions
+func (s *GSetModel) NewUpdateGSetCommandBuilder() *UpdateGSetCommandBuilder {
+	return NewUpdateGSetCommandBuilder().
+		WithContext(s.context).
+		WithAdditions(s.adds...)
+}
+
+// HllModel is a local model of a HyperLogLog CRDT. The cardinality can only be
+// estimated by Riak, so local additions are not reflected in it
+type HllModel struct {
+	cardinality uint64
+	adds        [][]byte
+}
+
+// NewHllModel returns a HllModel for a fetched HyperLogLog. rsp may be nil for a
+// new HyperLogLog
+func NewHllModel(rsp *FetchHllResponse) *HllModel {
+	h := &HllModel{}
+	if rsp != nil {
+		h.cardinality = rsp.Cardinality
+	}
+	return h
+}
+
+// Cardinality returns the fetched cardinality estimate
+func (h *HllModel) Cardinality() uint64 {
+	return h.cardinality
+}
+
+// Add adds an element to the HyperLogLog
+func (h *HllModel) Add(value []byte) *HllModel {
+	if !containsBytes(h.adds, value) {
+		h.adds = append(h.adds, value)
+	}
+	return h
+}
+
+// HasChanges returns true if elements have been added locally
+func (h *HllModel) HasChanges() bool {
+	return len(h.adds) > 0
+}
+
+// NewUpdateHllCommandBuilder returns an UpdateHllCommandBuilder with the local
+// additions
+func (h *HllModel) NewUpdateHllCommandBuilder() *UpdateHllCommandBuilder {
+	return NewUpdateHllCommandBuilder().WithAdditions(h.adds...)
+}
+
+// MapModel is a local model of a map CRDT, or of a map nested within one.
+// Mutations of nested maps are recorded in the MapOperation of the top-level
+// MapModel
+type MapModel struct {
+	context []byte
+	value   *Map
+	op      *MapOperation
+	parent  *MapModel
+	name    string
+}
+
+// NewMapModel returns a MapModel for a fetched map. rsp may be nil for a new
+// map
+func NewMapModel(rsp *FetchMapResponse) *MapModel {
+	m := &MapModel{
+		value: &Map{},
+	}
+	if rsp != nil {
+		m.context = rsp.Context
+		m.value = copyMap(rsp.Map)
+	}
+	return m
+}
+
+// Value returns the map including local changes
+func (m *MapModel) Value() *Map {
+	return m.getValue(false)
+}
+
+// Counter returns the value of a counter
+func (m *MapModel) Counter(name string) int64 {
+	return m.Value().Counters[name]
+}
+
+// IncrementCounter increments, or decrements if negative, a counter
+func (m *MapModel) IncrementCounter(name string, increment int64) *MapModel {
+	value := m.getValue(true)
+	if value.Counters == nil {
+		value.Counters = make(map[string]int64)
+	}
+	value.Counters[name] += increment
+	m.getOp().IncrementCounter(name, increment)
+	return m
+}
+
+// RemoveCounter removes a counter
+func (m *MapModel) RemoveCounter(name string) *MapModel {
+	delete(m.getValue(true).Counters, name)
+	m.getOp().RemoveCounter(name)
+	return m
+}
+
+// Set returns the elements of a set
+func (m *MapModel) Set(name string) [][]byte {
+	return m.Value().Sets[name]
+}
+
+// AddToSet adds an element to a set
+func (m *MapModel) AddToSet(name string, value []byte) *MapModel {
+	mapValue := m.getValue(true)
+	if containsBytes(mapValue.Sets[name], value) {
+		return m
+	}
+	if mapValue.Sets == nil {
+		mapValue.Sets = make(map[string][][]byte)
+	}
+	mapValue.Sets[name] = append(mapValue.Sets[name], value)
+	op := m.getOp()
+	if containsBytes(op.removeFromSets[name], value) {
+		op.removeFromSets[name] = removeBytes(op.removeFromSets[name], value)
+		if len(op.removeFromSets[name]) == 0 {
+			delete(op.removeFromSets, name)
+		}
+	} else {
+		op.AddToSet(name, value)
+	}
+	return m
+}
+
+// RemoveFromSet removes an element from a set
+func (m *MapModel) RemoveFromSet(name string, value []byte) *MapModel {
+	mapValue := m.getValue(true)
+	if !containsBytes(mapValue.Sets[name], value) {
+		return m
+	}
+	mapValue.Sets[name] = removeBytes(mapValue.Sets[name], value)
+	op := m.getOp()
+	if containsBytes(op.addToSets[name], value) {
+		op.addToSets[name] = removeBytes(op.addToSets[name], value)
+		if len(op.addToSets[name]) == 0 {
+			delete(op.addToSets, name)
+		}
+	} else {
+		op.RemoveFromSet(name, value)
+	}
+	return m
+}
+
+// RemoveSet removes a set
+func (m *MapModel) RemoveSet(name string) *MapModel {
+	delete(m.getValue(true).Sets, name)
+	m.getOp().RemoveSet(name)
+	return m
+}
+
+// Register returns the value of a register
+func (m *MapModel) Register(name string) []byte {
+	return m.Value().Registers[name]
+}
+
+// SetRegister sets a register
+func (m *MapModel) SetRegister(name string, value []byte) *MapModel {
+	mapValue := m.getValue(true)
+	if mapValue.Registers == nil {
+		mapValue.Registers = make(map[string][]byte)
+	}
+	mapValue.Registers[name] = value
+	m.getOp().SetRegister(name, value)
+	return m
+}
+
+// RemoveRegister removes a register
+func (m *MapModel) RemoveRegister(name string) *MapModel {
+	delete(m.getValue(true).Registers, name)
+	m.getOp().RemoveRegister(name)
+	return m
+}
+
+// Flag returns the value of a flag
+func (m *MapModel) Flag(name string) bool {
+	return m.Value().Flags[name]
+}
+
+// SetFlag enables or disables a flag
+func (m *MapModel) SetFlag(name string, value bool) *MapModel {
+	mapValue := m.getValue(true)
+	if mapValue.Flags == nil {
+		mapValue.Flags = make(map[string]bool)
+	}
+	mapValue.Flags[name] = value
+	m.getOp().SetFlag(name, value)
+	return m
+}
+
+// RemoveFlag removes a flag
+func (m *MapModel) RemoveFlag(name string) *MapModel {
+	delete(m.getValue(true).Flags, name)
+	m.getOp().RemoveFlag(name)
+	return m
+}
+
+// Map returns the MapModel for a nested map. The nested map is only created in
+// Riak if it is changed
+func (m *MapModel) Map(name string) *MapModel {
+	return &MapModel{
+		parent: m,
+		name:   name,
+	}
+}
+
+// RemoveMap removes a nested map
+func (m *MapModel) RemoveMap(name string) *MapModel {
+	delete(m.getValue(true).Maps, name)
+	m.getOp().RemoveMap(name)
+	return m
+}
+
+// HasChanges returns true if the map, or a map nested within it, has been
+// changed locally
+func (m *MapModel) HasChanges() bool {
+	op := m.root().op
+	return op != nil && !op.isEmpty()
+}
+
+// MapOperation returns the MapOperation recording the local changes to the
+// top-level map
+func (m *MapModel) MapOperation() *MapOperation {
+	return m.root().getOp()
+}
+
+// NewUpdateMapCommandBuilder returns an UpdateMapCommandBuilder with the local
+// changes to the top-level map and the fetched context
+func (m *MapModel) NewUpdateMapCommandBuilder() *UpdateMapCommandBuilder {
+	root := m.root()
+	return NewUpdateMapCommandBuilder().
+		WithContext(root.context).
+		WithMapOperation(root.getOp())
+}
+
+func (m *MapModel) root() *MapModel {
+	for m.parent != nil {
+		m = m.parent
+	}
+	return m
+}
+
+// getValue returns the local value of the map. If create is true, a nested map
+// that does not yet exist is created in its parent
+func (m *MapModel) getValue(create bool) *Map {
+	if m.parent == nil {
+		return m.value
+	}
+	parentValue := m.parent.getValue(create)
+	if value, ok := parentValue.Maps[m.name]; ok {
+		return value
+	}
+	if !create {
+		return &Map{}
+	}
+	if parentValue.Maps == nil {
+		parentValue.Maps = make(map[string]*Map)
+	}
+	value := &Map{}
+	parentValue.Maps[m.name] = value
+	return value
+}
+
+// getOp returns the MapOperation for the map, creating nested operations as
+// needed
+func (m *MapModel) getOp() *MapOperation {
+	if m.parent == nil {
+		if m.op == nil {
+			m.op = &MapOperation{}
+		}
+		return m.op
+	}
+	return m.parent.getOp().Map(m.name)
+}
+
+func copyMap(m *Map) *Map {
+	c := &Map{}
+	if m == nil {
+		return c
+	}
+	if m.Counters != nil {
+		c.Counters = make(map[string]int64, len(m.Counters))
+		for k, v := range m.Counters {
+			c.Counters[k] = v
+		}
+	}
+	if m.Sets != nil {
+		c.Sets = make(map[string][][]byte, len(m.Sets))
+		for k, v := range m.Sets {
+			c.Sets[k] = copyByteSlices(v)
+		}
+	}
+	if m.Registers != nil {
+		c.Registers = make(map[string][]byte, len(m.Registers))
+		for k, v := range m.Registers {
+			c.Registers[k] = v
+		}
+	}
+	if m.Flags != nil {
+		c.Flags = make(map[string]bool, len(m.Flags))
+		for k, v := range m.Flags {
+			c.Flags[k] = v
+		}
+	}
+	if m.Maps != nil {
+		c.Maps = make(map[string]*Map, len(m.Maps))
+		for k, v := range m.Maps {
+			c.Maps[k] = copyMap(v)
+		}
+	}
+	return c
+}
+
+func copyByteSlices(values [][]byte) [][]byte {
+	if values == nil {
+		return nil
+	}
+	c := make([][]byte, len(values))
+	copy(c, values)
+	return c
+}
+
+func removeBytes(values [][]byte, value []byte) [][]byte {
+	for i, v := range values {
+		if bytes.Equal(v, value) {
+			return append(values[:i:i], values[i+1:]...)
+		}
+	}
+	return values
+}
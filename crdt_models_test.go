@@ -0,0 +1,206 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCounterModel(t *testing.T) {
+	c := NewCounterModel(&FetchCounterResponse{CounterValue: 10})
+	if c.HasChanges() {
+		t.Error("expected no changes")
+	}
+	c.Increment(5).Increment(-2)
+	if expected, actual := int64(13), c.Value(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if !c.HasChanges() {
+		t.Error("expected changes")
+	}
+	builder := c.NewUpdateCounterCommandBuilder()
+	if expected, actual := int64(3), builder.increment; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSetModel(t *testing.T) {
+	fetched := [][]byte{[]byte("a"), []byte("b")}
+	s := NewSetModel(&FetchSetResponse{
+		Context:  []byte("context"),
+		SetValue: fetched,
+	})
+	s.Add([]byte("c")).
+		Add([]byte("d")).
+		Remove([]byte("d")).
+		Remove([]byte("a")).
+		Remove([]byte("unknown"))
+
+	if expected, actual := [][]byte{[]byte("b"), []byte("c")}, s.Value(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if !s.Contains([]byte("c")) || s.Contains([]byte("a")) {
+		t.Error("unexpected set contents")
+	}
+	if expected, actual := 2, len(fetched); expected != actual || !bytes.Equal(fetched[0], []byte("a")) {
+		t.Error("expected fetched value not to be modified")
+	}
+
+	cmd, err := s.NewUpdateSetCommandBuilder().
+		WithBucketType("sets").
+		WithBucket("bucket").
+		WithKey("key").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	protobuf := cmd.(*UpdateSetCommand).protobuf
+	if expected, actual := []byte("context"), protobuf.Context; !bytes.Equal(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if expected, actual := [][]byte{[]byte("c")}, protobuf.Op.SetOp.Adds; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if expected, actual := [][]byte{[]byte("a")}, protobuf.Op.SetOp.Removes; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+	s = NewSetModel(nil)
+	s.Remove([]byte("a"))
+	if s.HasChanges() {
+		t.Error("expected removal of unknown element to be ignored")
+	}
+}
+
+func TestGSetModel(t *testing.T) {
+	s := NewGSetModel(&FetchSetResponse{SetValue: [][]byte{[]byte("a")}})
+	s.Add([]byte("a")).Add([]byte("b"))
+	if expected, actual := 2, len(s.Value()); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	builder := s.NewUpdateGSetCommandBuilder()
+	if expected, actual := [][]byte{[]byte("b")}, builder.protobuf.Op.GsetOp.Adds; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestHllModel(t *testing.T) {
+	h := NewHllModel(&FetchHllResponse{Cardinality: 42})
+	h.Add([]byte("a")).Add([]byte("a"))
+	if expected, actual := uint64(42), h.Cardinality(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	builder := h.NewUpdateHllCommandBuilder()
+	if expected, actual := [][]byte{[]byte("a")}, builder.protobuf.Op.HllOp.Adds; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestMapModel(t *testing.T) {
+	rsp := &FetchMapResponse{
+		Context: []byte("context"),
+		Map: &Map{
+			Counters:  map[string]int64{"visits": 1},
+			Sets:      map[string][][]byte{"tags": {[]byte("go")}},
+			Registers: map[string][]byte{"name": []byte("Jane")},
+			Maps: map[string]*Map{
+				"address": {Registers: map[string][]byte{"city": []byte("Seattle")}},
+			},
+		},
+	}
+	m := NewMapModel(rsp)
+	if m.HasChanges() {
+		t.Error("expected no changes")
+	}
+
+	// NB: reading a nested map that does not exist must not create it
+	if expected, actual := int64(0), m.Map("billing").Counter("count"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if m.HasChanges() {
+		t.Error("expected reading a nested map not to record changes")
+	}
+
+	m.IncrementCounter("visits", 2).
+		SetRegister("name", []byte("Jane Doe")).
+		SetFlag("admin", true).
+		AddToSet("tags", []byte("riak")).
+		RemoveFromSet("tags", []byte("go"))
+	m.Map("address").SetRegister("city", []byte("Portland"))
+	m.Map("address").Map("geo").IncrementCounter("updates", 1)
+
+	if expected, actual := int64(3), m.Counter("visits"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "Jane Doe", string(m.Register("name")); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if !m.Flag("admin") {
+		t.Error("expected admin flag")
+	}
+	if expected, actual := [][]byte{[]byte("riak")}, m.Set("tags"); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if expected, actual := int64(1), m.Value().Maps["address"].Maps["geo"].Counters["updates"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "Seattle", string(rsp.Map.Maps["address"].Registers["city"]); expected != actual {
+		t.Errorf("expected fetched map not to be modified, got %v", actual)
+	}
+
+	cmd, err := m.Map("address").NewUpdateMapCommandBuilder().
+		WithBucketType("maps").
+		WithBucket("bucket").
+		WithKey("key").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := cmd.(*UpdateMapCommand)
+	if expected, actual := []byte("context"), update.protobuf.Context; !bytes.Equal(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	op := update.op
+	if expected, actual := int64(2), op.incrementCounters["visits"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := [][]byte{[]byte("go")}, op.removeFromSets["tags"]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if expected, actual := "Portland", string(op.maps["address"].registersToSet["city"]); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(1), op.maps["address"].maps["geo"].incrementCounters["updates"]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if _, ok := op.maps["billing"]; ok {
+		t.Error("expected unchanged nested map not to be in the operation")
+	}
+}
+
+func TestMapModelSetChangesCancelOut(t *testing.T) {
+	m := NewMapModel(&FetchMapResponse{
+		Map: &Map{Sets: map[string][][]byte{"tags": {[]byte("go")}}},
+	})
+	m.AddToSet("tags", []byte("riak")).
+		RemoveFromSet("tags", []byte("riak")).
+		RemoveFromSet("tags", []byte("go")).
+		AddToSet("tags", []byte("go"))
+	if m.HasChanges() {
+		t.Errorf("expected no changes, got %+v", m.MapOperation())
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Registers hold bytes. The typed register accessors on Map and MapOperation
+// use the following encodings, which are readable by other clients and by
+// Riak Search:
+//
+//	string     the UTF-8 bytes of the string
+//	int64      base 10, as by strconv.FormatInt
+//	float64    the shortest exact representation, as by strconv.FormatFloat(f, 'g', -1, 64)
+//	time.Time  RFC 3339 with nanoseconds in UTC, as by time.RFC3339Nano
+//	JSON       as by encoding/json
+//
+// Typed accessors return ErrMapRegisterNotFound if there is no register with
+// the key, and an error rather than a zero value if the register cannot be
+// decoded as the requested type.
+
+var ErrMapRegisterNotFound = newClientError("[Map] register not found", nil)
+
+// RegisterString returns the value of a register as a string
+func (m *Map) RegisterString(key string) (string, error) {
+	value, err := m.register(key)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// RegisterInt64 returns the value of a register as an int64
+func (m *Map) RegisterInt64(key string) (int64, error) {
+	value, err := m.register(key)
+	if err != nil {
+		return 0, err
+	}
+	return decodeRegisterInt64(key, value)
+}
+
+// RegisterFloat64 returns the value of a register as a float64
+func (m *Map) RegisterFloat64(key string) (float64, error) {
+	value, err := m.register(key)
+	if err != nil {
+		return 0, err
+	}
+	return decodeRegisterFloat64(key, value)
+}
+
+// RegisterTime returns the value of a register as a time.Time in UTC
+func (m *Map) RegisterTime(key string) (time.Time, error) {
+	value, err := m.register(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return decodeRegisterTime(key, value)
+}
+
+// RegisterJSON decodes the JSON value of a register into v
+func (m *Map) RegisterJSON(key string, v interface{}) error {
+	value, err := m.register(key)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(value, v); err != nil {
+		return newRegisterDecodeError(key, "JSON", value, err)
+	}
+	return nil
+}
+
+func (m *Map) register(key string) ([]byte, error) {
+	if m == nil {
+		return nil, ErrMapRegisterNotFound
+	}
+	value, ok := m.Registers[key]
+	if !ok {
+		return nil, ErrMapRegisterNotFound
+	}
+	return value, nil
+}
+
+// SetRegisterString sets a register to a string
+func (mapOp *MapOperation) SetRegisterString(key string, value string) *MapOperation {
+	return mapOp.SetRegister(key, []byte(value))
+}
+
+// SetRegisterInt64 sets a register to an int64
+func (mapOp *MapOperation) SetRegisterInt64(key string, value int64) *MapOperation {
+	return mapOp.SetRegister(key, encodeRegisterInt64(value))
+}
+
+// SetRegisterFloat64 sets a register to a float64
+func (mapOp *MapOperation) SetRegisterFloat64(key string, value float64) *MapOperation {
+	return mapOp.SetRegister(key, encodeRegisterFloat64(value))
+}
+
+// SetRegisterTime sets a register to a time.Time, which is stored in UTC
+func (mapOp *MapOperation) SetRegisterTime(key string, value time.Time) *MapOperation {
+	return mapOp.SetRegister(key, encodeRegisterTime(value))
+}
+
+// SetRegisterJSON sets a register to the JSON encoding of v
+func (mapOp *MapOperation) SetRegisterJSON(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	mapOp.SetRegister(key, value)
+	return nil
+}
+
+func encodeRegisterInt64(value int64) []byte {
+	return []byte(strconv.FormatInt(value, 10))
+}
+
+func decodeRegisterInt64(key string, value []byte) (int64, error) {
+	i, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, newRegisterDecodeError(key, "int64", value, err)
+	}
+	return i, nil
+}
+
+func encodeRegisterFloat64(value float64) []byte {
+	return []byte(strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func decodeRegisterFloat64(key string, value []byte) (float64, error) {
+	f, err := strconv.ParseFloat(string(value), 64)
+	if err != nil {
+		return 0, newRegisterDecodeError(key, "float64", value, err)
+	}
+	return f, nil
+}
+
+func encodeRegisterTime(value time.Time) []byte {
+	return []byte(value.UTC().Format(time.RFC3339Nano))
+}
+
+func decodeRegisterTime(key string, value []byte) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, string(value))
+	if err != nil {
+		return time.Time{}, newRegisterDecodeError(key, "time.Time", value, err)
+	}
+	return t.UTC(), nil
+}
+
+func newRegisterDecodeError(key, typ string, value []byte, err error) error {
+	return newClientError(fmt.Sprintf("[Map] register %s value %q is not a valid %s", key, value, typ), err)
+}
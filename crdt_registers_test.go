@@ -0,0 +1,88 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMapTypedRegisterRoundTrip(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 6, time.Local)
+	op := &MapOperation{}
+	op.SetRegisterString("name", "Jane").
+		SetRegisterInt64("age", -42).
+		SetRegisterFloat64("pi", math.Pi).
+		SetRegisterTime("updated", now)
+	if err := op.SetRegisterJSON("tags", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	m := &Map{Registers: op.registersToSet}
+
+	if s, err := m.RegisterString("name"); err != nil || s != "Jane" {
+		t.Errorf("expected Jane, got %v %v", s, err)
+	}
+	if i, err := m.RegisterInt64("age"); err != nil || i != -42 {
+		t.Errorf("expected -42, got %v %v", i, err)
+	}
+	if expected, actual := "-42", string(m.Registers["age"]); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if f, err := m.RegisterFloat64("pi"); err != nil || f != math.Pi {
+		t.Errorf("expected %v, got %v %v", math.Pi, f, err)
+	}
+	updated, err := m.RegisterTime("updated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.Equal(now) || updated.Location() != time.UTC {
+		t.Errorf("expected %v in UTC, got %v", now, updated)
+	}
+	var tags []string
+	if err = m.RegisterJSON("tags", &tags); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(tags); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestMapTypedRegisterErrors(t *testing.T) {
+	m := &Map{Registers: map[string][]byte{"name": []byte("Jane")}}
+	if _, err := m.RegisterInt64("missing"); err != ErrMapRegisterNotFound {
+		t.Errorf("expected %v, got %v", ErrMapRegisterNotFound, err)
+	}
+	var nilMap *Map
+	if _, err := nilMap.RegisterString("name"); err != ErrMapRegisterNotFound {
+		t.Errorf("expected %v, got %v", ErrMapRegisterNotFound, err)
+	}
+	if _, err := m.RegisterInt64("name"); err == nil {
+		t.Error("expected error decoding a string as an int64")
+	}
+	if _, err := m.RegisterFloat64("name"); err == nil {
+		t.Error("expected error decoding a string as a float64")
+	}
+	if _, err := m.RegisterTime("name"); err == nil {
+		t.Error("expected error decoding a string as a time.Time")
+	}
+	var v map[string]string
+	if err := m.RegisterJSON("name", &v); err == nil {
+		t.Error("expected error decoding a string as JSON")
+	}
+	if err := (&MapOperation{}).SetRegisterJSON("ch", make(chan int)); err == nil {
+		t.Error("expected error encoding a channel as JSON")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials are the user name and password used to authenticate a connection
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// CredentialsProvider supplies the Credentials used to authenticate new
+// connections. Credentials is called each time a connection is opened, so a
+// provider that returns rotated Credentials takes effect without restarting
+// the Cluster. Existing connections are not affected
+type CredentialsProvider interface {
+	Credentials() (*Credentials, error)
+}
+
+// CredentialsProviderFunc adapts a function, such as one that fetches
+// Credentials from a secrets manager, to the CredentialsProvider interface
+type CredentialsProviderFunc func() (*Credentials, error)
+
+// Credentials implements CredentialsProvider
+func (f CredentialsProviderFunc) Credentials() (*Credentials, error) {
+	return f()
+}
+
+type staticCredentialsProvider struct {
+	credentials Credentials
+}
+
+// NewStaticCredentialsProvider returns a CredentialsProvider that always
+// returns the provided user and password
+func NewStaticCredentialsProvider(user, password string) CredentialsProvider {
+	return &staticCredentialsProvider{
+		credentials: Credentials{
+			User:     user,
+			Password: password,
+		},
+	}
+}
+
+func (p *staticCredentialsProvider) Credentials() (*Credentials, error) {
+	c := p.credentials
+	return &c, nil
+}
+
+type envCredentialsProvider struct {
+	userVar     string
+	passwordVar string
+}
+
+// NewEnvCredentialsProvider returns a CredentialsProvider that reads the user
+// and password from the named environment variables each time it is called
+func NewEnvCredentialsProvider(userVar, passwordVar string) CredentialsProvider {
+	return &envCredentialsProvider{
+		userVar:     userVar,
+		passwordVar: passwordVar,
+	}
+}
+
+func (p *envCredentialsProvider) Credentials() (*Credentials, error) {
+	user, ok := os.LookupEnv(p.userVar)
+	if !ok {
+		return nil, fmt.Errorf("[envCredentialsProvider] environment variable %s is not set", p.userVar)
+	}
+	password, ok := os.LookupEnv(p.passwordVar)
+	if !ok {
+		return nil, fmt.Errorf("[envCredentialsProvider] environment variable %s is not set", p.passwordVar)
+	}
+	return &Credentials{
+		User:     user,
+		Password: password,
+	}, nil
+}
+
+// FileCredentialsProvider is a CredentialsProvider that reads a password from
+// a file, such as a mounted secret, and re-reads it when the file changes.
+// Trailing whitespace is removed from the password
+type FileCredentialsProvider struct {
+	user         string
+	passwordFile string
+	password     string
+	modTime      time.Time
+	sync.Mutex
+}
+
+// NewFileCredentialsProvider returns a FileCredentialsProvider for the provided
+// user and password file, which must be readable
+func NewFileCredentialsProvider(user, passwordFile string) (*FileCredentialsProvider, error) {
+	p := &FileCredentialsProvider{
+		user:         user,
+		passwordFile: passwordFile,
+	}
+	if _, err := p.Credentials(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Credentials implements CredentialsProvider. If the password file can no
+// longer be read, the last password read is returned
+func (p *FileCredentialsProvider) Credentials() (*Credentials, error) {
+	p.Lock()
+	defer p.Unlock()
+	info, err := os.Stat(p.passwordFile)
+	if err == nil && !info.ModTime().Equal(p.modTime) {
+		var data []byte
+		if data, err = ioutil.ReadFile(p.passwordFile); err == nil {
+			p.password = strings.TrimRight(string(data), " \t\r\n")
+			p.modTime = info.ModTime()
+			logDebug("[FileCredentialsProvider]", "read password from %s", p.passwordFile)
+		}
+	}
+	if err != nil {
+		if p.modTime.IsZero() {
+			return nil, err
+		}
+		logErr("[FileCredentialsProvider]", err)
+	}
+	return &Credentials{
+		User:     p.user,
+		Password: p.password,
+	}, nil
+}
+
+// AuthError is returned when a connection could not authenticate with Riak,
+// either because Riak rejected its credentials or because no credentials
+// could be obtained. It is distinct from network errors
+type AuthError struct {
+	User       string
+	InnerError error
+}
+
+func (e AuthError) Error() string {
+	return fmt.Sprintf("AuthError|%s|%v", e.User, e.InnerError)
+}
+
+// IsAuthError returns true if err is, or wraps, an AuthError
+func IsAuthError(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case AuthError:
+			return true
+		case ClientError:
+			err = e.InnerError
+		default:
+			return false
+		}
+	}
+	return false
+}
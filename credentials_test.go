@@ -0,0 +1,173 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStaticCredentialsProvider(t *testing.T) {
+	p := NewStaticCredentialsProvider("riakuser", "riakpass")
+	c, err := p.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "riakuser", c.User; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "riakpass", c.Password; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// NB: modifying the returned Credentials must not affect the provider
+	c.Password = "changed"
+	if c, _ = p.Credentials(); c.Password != "riakpass" {
+		t.Errorf("expected riakpass, got %v", c.Password)
+	}
+}
+
+func TestEnvCredentialsProvider(t *testing.T) {
+	os.Setenv("RIAK_GO_TEST_USER", "riakuser")
+	os.Unsetenv("RIAK_GO_TEST_PASSWORD")
+	defer os.Unsetenv("RIAK_GO_TEST_USER")
+	defer os.Unsetenv("RIAK_GO_TEST_PASSWORD")
+
+	p := NewEnvCredentialsProvider("RIAK_GO_TEST_USER", "RIAK_GO_TEST_PASSWORD")
+	if _, err := p.Credentials(); err == nil {
+		t.Error("expected error for missing password variable")
+	}
+
+	os.Setenv("RIAK_GO_TEST_PASSWORD", "riakpass")
+	c, err := p.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "riakpass", c.Password; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	os.Setenv("RIAK_GO_TEST_PASSWORD", "rotated")
+	if c, err = p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "rotated", c.Password; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestFileCredentialsProviderRereadsChangedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "riak-go-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+
+	if _, err = NewFileCredentialsProvider("riakuser", passwordFile); err == nil {
+		t.Error("expected error for missing password file")
+	}
+
+	if err = ioutil.WriteFile(passwordFile, []byte("riakpass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewFileCredentialsProvider("riakuser", passwordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "riakuser", c.User; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "riakpass", c.Password; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if err = ioutil.WriteFile(passwordFile, []byte("rotated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err = os.Chtimes(passwordFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "rotated", c.Password; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// NB: the last password read is used if the file goes away
+	if err = os.Remove(passwordFile); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "rotated", c.Password; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestConnectionManagerCreateReturnsAuthErrorWhenProviderFails(t *testing.T) {
+	providerErr := errors.New("vault unavailable")
+	cm, err := newConnectionManager(&connectionManagerOptions{
+		addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1},
+		authOptions: &AuthOptions{
+			CredentialsProvider: CredentialsProviderFunc(func() (*Credentials, error) {
+				return nil, providerErr
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cm.create()
+	if !IsAuthError(err) {
+		t.Fatalf("expected AuthError, got %v", err)
+	}
+	if expected, actual := providerErr, err.(AuthError).InnerError; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint16(0), cm.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestIsAuthError(t *testing.T) {
+	authErr := AuthError{User: "riakuser", InnerError: errors.New("denied")}
+	if !IsAuthError(authErr) {
+		t.Error("expected AuthError")
+	}
+	if !IsAuthError(newClientError("wrapped", authErr)) {
+		t.Error("expected wrapped AuthError")
+	}
+	if IsAuthError(newClientError("network", errors.New("connection refused"))) {
+		t.Error("expected network error not to be an AuthError")
+	}
+	if IsAuthError(nil) {
+		t.Error("expected nil not to be an AuthError")
+	}
+	if expected, actual := "AuthError|riakuser|denied", authErr.Error(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -52,17 +52,19 @@ func (e RiakError) Error() (s string) {
 
 // Client errors
 var (
-	ErrAddressRequired      = newClientError("RemoteAddress is required in options", nil)
-	ErrAuthMissingConfig    = newClientError("[Connection] authentication is missing TLS config", nil)
-	ErrAuthTLSUpgradeFailed = newClientError("[Connection] upgrading to TLS connection failed", nil)
-	ErrBucketRequired       = newClientError("Bucket is required", nil)
-	ErrKeyRequired          = newClientError("Key is required", nil)
-	ErrNilOptions           = newClientError("[Command] options must be non-nil", nil)
-	ErrOptionsRequired      = newClientError("Options are required", nil)
-	ErrZeroLength           = newClientError("[Command] 0 byte data response", nil)
-	ErrTableRequired        = newClientError("Table is required", nil)
-	ErrQueryRequired        = newClientError("Query is required", nil)
-	ErrListingDisabled      = newClientError("Bucket and key list operations are expensive and should not be used in production.", nil)
+	ErrAddressRequired        = newClientError("RemoteAddress is required in options", nil)
+	ErrAuthMissingConfig      = newClientError("[Connection] authentication is missing TLS config", nil)
+	ErrAuthTLSUpgradeFailed   = newClientError("[Connection] upgrading to TLS connection failed", nil)
+	ErrAuthMissingCertificate = newClientError("[Connection] authentication requires a client certificate in TLS config", nil)
+	ErrAuthMissingCredentials = newClientError("[Connection] credentials provider returned no credentials", nil)
+	ErrBucketRequired         = newClientError("Bucket is required", nil)
+	ErrKeyRequired            = newClientError("Key is required", nil)
+	ErrNilOptions             = newClientError("[Command] options must be non-nil", nil)
+	ErrOptionsRequired        = newClientError("Options are required", nil)
+	ErrZeroLength             = newClientError("[Command] 0 byte data response", nil)
+	ErrTableRequired          = newClientError("Table is required", nil)
+	ErrQueryRequired          = newClientError("Query is required", nil)
+	ErrListingDisabled        = newClientError("Bucket and key list operations are expensive and should not be used in production.", nil)
 )
 
 type ClientError struct {
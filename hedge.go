@@ -0,0 +1,245 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgeOptions enables hedged requests for read commands. When a command has
+// not completed after the hedge delay, the same request is sent to a second
+// node chosen by the NodeManager and the first successful response is used.
+// The other request is cancelled: if it has not been sent yet it is abandoned,
+// otherwise its response is discarded.
+//
+// The FetchValue, FetchCounter, FetchSet, FetchMap and TsFetchRow commands may
+// be hedged. Hedging only happens if the Cluster has more than one Node.
+type HedgeOptions struct {
+	// Delay is how long to wait before issuing a hedged request. When
+	// LatencyPercentile is set, it is the minimum delay
+	Delay time.Duration
+	// LatencyPercentile, if non-zero (e.g. 0.95), sets the delay to that
+	// percentile of the latencies recently observed for the command type
+	LatencyPercentile float64
+	// Commands restricts hedging to the named command types, e.g.
+	// "FetchValue". By default all hedgeable command types are hedged
+	Commands []string
+}
+
+const (
+	defaultHedgeDelay          = 50 * time.Millisecond
+	hedgeLatencySamples        = 512
+	hedgeLatencyMinSamples     = 64
+	hedgeLatencyRecalcInterval = 64
+)
+
+type hedger struct {
+	delay      time.Duration
+	percentile float64
+	commands   map[string]bool
+	latencies  map[string]*latencySamples
+	sync.Mutex
+}
+
+func newHedger(options *HedgeOptions) *hedger {
+	h := &hedger{
+		delay:      options.Delay,
+		percentile: options.LatencyPercentile,
+		latencies:  make(map[string]*latencySamples),
+	}
+	if h.delay <= 0 {
+		h.delay = defaultHedgeDelay
+	}
+	if h.percentile < 0 || h.percentile >= 1 {
+		h.percentile = 0
+	}
+	if len(options.Commands) > 0 {
+		h.commands = make(map[string]bool, len(options.Commands))
+		for _, name := range options.Commands {
+			h.commands[name] = true
+		}
+	}
+	return h
+}
+
+func (h *hedger) isHedged(name string) bool {
+	return h.commands == nil || h.commands[name]
+}
+
+// delayFor returns how long to wait for the first request of the named command
+// type before issuing a hedged request
+func (h *hedger) delayFor(name string) time.Duration {
+	if h.percentile == 0 {
+		return h.delay
+	}
+	h.Lock()
+	defer h.Unlock()
+	if ls, ok := h.latencies[name]; ok && ls.value > h.delay {
+		return ls.value
+	}
+	return h.delay
+}
+
+func (h *hedger) recordLatency(name string, latency time.Duration) {
+	if h.percentile == 0 {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	ls, ok := h.latencies[name]
+	if !ok {
+		ls = &latencySamples{
+			samples: make([]time.Duration, 0, hedgeLatencySamples),
+		}
+		h.latencies[name] = ls
+	}
+	ls.add(latency, h.percentile)
+}
+
+// latencySamples retains the most recent latencies for a command type, and the
+// configured percentile of them
+type latencySamples struct {
+	samples []time.Duration
+	next    int
+	added   int
+	value   time.Duration
+}
+
+func (ls *latencySamples) add(latency time.Duration, percentile float64) {
+	if len(ls.samples) < cap(ls.samples) {
+		ls.samples = append(ls.samples, latency)
+	} else {
+		ls.samples[ls.next] = latency
+		ls.next = (ls.next + 1) % len(ls.samples)
+	}
+	ls.added++
+	// NB: sorting on every sample is too expensive, so the percentile is only
+	// re-calculated periodically
+	if len(ls.samples) >= hedgeLatencyMinSamples && ls.added%hedgeLatencyRecalcInterval == 0 {
+		sorted := make([]time.Duration, len(ls.samples))
+		copy(sorted, ls.samples)
+		sort.Sort(durations(sorted))
+		ls.value = sorted[int(float64(len(sorted)-1)*percentile)]
+	}
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+func (c *Cluster) getHedgeableCommand(cmd Command) (hedgeableCommand, bool) {
+	if c.hedger == nil || len(c.nodes) < 2 {
+		return nil, false
+	}
+	hc, ok := cmd.(hedgeableCommand)
+	if !ok || !c.hedger.isHedged(commandTypeName(cmd)) {
+		return nil, false
+	}
+	return hc, true
+}
+
+// newHedgedAsync returns an Async used internally to execute one copy of a
+// hedged command
+func newHedgedAsync(async *Async, cmd Command, done chan Command) *Async {
+	return &Async{
+		Command:   cmd,
+		Done:      done,
+		startedAt: async.startedAt,
+		deadline:  async.deadline,
+		cancel:    make(chan struct{}),
+		internal:  true,
+	}
+}
+
+// executeHedged executes a copy of the command and, if it has not completed
+// after the hedge delay, a second copy. The outcome of the first copy to
+// succeed is adopted by the original command. If neither succeeds, the outcome
+// of the first copy is adopted
+func (c *Cluster) executeHedged(async *Async, hc hedgeableCommand) {
+	name := commandTypeName(async.Command)
+	done := make(chan Command, 2)
+
+	primary := newHedgedAsync(async, hc.hedgeClone(), done)
+	go c.execute(primary)
+	pending := 1
+
+	timer := time.NewTimer(c.hedger.delayFor(name))
+	defer timer.Stop()
+
+	var hedge, winner *Async
+	primaryDone := false
+	for pending > 0 && winner == nil {
+		select {
+		case <-timer.C:
+			hedge = newHedgedAsync(async, hc.hedgeClone(), done)
+			if rc, ok := primary.Command.(retryableCommand); ok {
+				// NB: ensures the NodeManager chooses a different node
+				if n := rc.getLastNode(); n != nil {
+					hedge.Command.(retryableCommand).setLastNode(n)
+				}
+			}
+			logDebug("[Cluster]", "hedging cmd '%s'", async.Command.Name())
+			go c.execute(hedge)
+			pending++
+		case cmd := <-done:
+			pending--
+			a := primary
+			if hedge != nil && cmd == hedge.Command {
+				a = hedge
+			} else {
+				primaryDone = true
+				if a.Error == nil && cmd.Success() {
+					c.hedger.recordLatency(name, time.Since(async.startedAt))
+				}
+			}
+			if a.Error == nil && cmd.Error() == nil {
+				winner = a
+			}
+		}
+	}
+
+	var err error
+	if winner == nil {
+		// NB: the primary is always complete when there is no winner
+		hc.hedgeAdopt(primary.Command)
+		async.attempts = primary.attempts
+		err = primary.Error
+	} else {
+		if hedge != nil {
+			close(primary.cancel)
+			close(hedge.cancel)
+		}
+		hc.hedgeAdopt(winner.Command)
+		async.attempts = winner.attempts
+		if !primaryDone {
+			// NB: a primary that was already sent still provides a latency sample
+			go func() {
+				for cmd := range done {
+					if cmd == primary.Command {
+						if primary.Error == nil && cmd.Success() {
+							c.hedger.recordLatency(name, time.Since(async.startedAt))
+						}
+						return
+					}
+				}
+			}()
+		}
+	}
+	c.commandDone(async, err)
+}
@@ -0,0 +1,174 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHedgerUsesFixedDelay(t *testing.T) {
+	h := newHedger(&HedgeOptions{})
+	if expected, actual := defaultHedgeDelay, h.delayFor("FetchValue"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	h.recordLatency("FetchValue", time.Second)
+	if expected, actual := defaultHedgeDelay, h.delayFor("FetchValue"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestHedgerUsesLatencyPercentile(t *testing.T) {
+	h := newHedger(&HedgeOptions{
+		Delay:             time.Millisecond * 10,
+		LatencyPercentile: 0.95,
+	})
+	for i := 1; i < hedgeLatencyMinSamples; i++ {
+		h.recordLatency("FetchValue", time.Duration(i)*time.Millisecond)
+	}
+	// NB: not enough samples yet
+	if expected, actual := time.Millisecond*10, h.delayFor("FetchValue"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	h.recordLatency("FetchValue", time.Duration(hedgeLatencyMinSamples)*time.Millisecond)
+	if expected, actual := time.Millisecond*60, h.delayFor("FetchValue"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := time.Millisecond*10, h.delayFor("FetchMap"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestHedgerLatencyPercentileIsNeverLessThanDelay(t *testing.T) {
+	h := newHedger(&HedgeOptions{
+		Delay:             time.Millisecond * 10,
+		LatencyPercentile: 0.5,
+	})
+	for i := 0; i < hedgeLatencyMinSamples; i++ {
+		h.recordLatency("FetchValue", time.Millisecond)
+	}
+	if expected, actual := time.Millisecond*10, h.delayFor("FetchValue"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestHedgerCommands(t *testing.T) {
+	h := newHedger(&HedgeOptions{})
+	if !h.isHedged("FetchValue") || !h.isHedged("TsFetchRow") {
+		t.Error("expected all hedgeable commands to be hedged by default")
+	}
+	h = newHedger(&HedgeOptions{
+		Commands: []string{"FetchMap"},
+	})
+	if !h.isHedged("FetchMap") {
+		t.Error("expected FetchMap to be hedged")
+	}
+	if h.isHedged("FetchValue") {
+		t.Error("expected FetchValue not to be hedged")
+	}
+}
+
+func TestCommandTypeName(t *testing.T) {
+	cmd := &FetchValueCommand{}
+	cmd.name = "FetchValue-42"
+	if expected, actual := "FetchValue", commandTypeName(cmd); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "Ping", commandTypeName(&PingCommand{}); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestClusterHedgesOnlyWithMultipleNodes(t *testing.T) {
+	node, err := NewNode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := NewCluster(&ClusterOptions{
+		Nodes:        []*Node{node},
+		HedgeOptions: &HedgeOptions{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := NewFetchValueCommandBuilder().
+		WithBucket("b").
+		WithKey("k").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cluster.getHedgeableCommand(cmd); ok {
+		t.Error("expected command not to be hedged with one node")
+	}
+
+	other, err := NewNode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.AddNode(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cluster.getHedgeableCommand(cmd); !ok {
+		t.Error("expected command to be hedged with two nodes")
+	}
+	if _, ok := cluster.getHedgeableCommand(&StoreValueCommand{}); ok {
+		t.Error("expected StoreValue not to be hedged")
+	}
+}
+
+func TestFetchValueHedgeCloneAndAdopt(t *testing.T) {
+	builder := NewFetchValueCommandBuilder().
+		WithBucket("b").
+		WithKey("k").
+		WithTimeout(time.Second)
+	cmd, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcmd := cmd.(*FetchValueCommand)
+	clone := fcmd.hedgeClone().(*FetchValueCommand)
+	if clone == fcmd {
+		t.Fatal("expected a new command")
+	}
+	if clone.protobuf != fcmd.protobuf {
+		t.Error("expected clone to send the same request")
+	}
+	if expected, actual := fcmd.getTimeout(), clone.getTimeout(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	node, err := NewNode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone.success = true
+	clone.Response = &FetchValueResponse{IsNotFound: true}
+	clone.setExecutedOn(node)
+	clone.setLastNode(node)
+	fcmd.hedgeAdopt(clone)
+	if !fcmd.Success() {
+		t.Error("expected adopted command to be successful")
+	}
+	if fcmd.Response != clone.Response {
+		t.Error("expected adopted command to have clone's response")
+	}
+	if expected, actual := node, fcmd.getExecutedOn(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := node, fcmd.getLastNode(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -114,6 +114,23 @@ func (cmd *FetchValueCommand) getResponseProtobufMessage() proto.Message {
 	return &rpbRiakKV.RpbGetResp{}
 }
 
+func (cmd *FetchValueCommand) hedgeClone() Command {
+	return &FetchValueCommand{
+		timeoutImpl: cmd.timeoutImpl,
+		protobuf:    cmd.protobuf,
+		resolver:    cmd.resolver,
+	}
+}
+
+func (cmd *FetchValueCommand) hedgeAdopt(c Command) {
+	other := c.(*FetchValueCommand)
+	cmd.commandImpl.adopt(&other.commandImpl)
+	if n := other.getLastNode(); n != nil {
+		cmd.setLastNode(n)
+	}
+	cmd.Response = other.Response
+}
+
 // FetchValueResponse contains the response data for a FetchValueCommand
 type FetchValueResponse struct {
 	IsNotFound  bool
@@ -0,0 +1,257 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitOptions configures a token bucket that allows Rate commands per
+// second, with bursts of up to Burst commands
+type RateLimitOptions struct {
+	Rate  float64
+	Burst uint16 // NB: defaults to Rate, rounded up
+}
+
+// ConcurrencyLimitOptions configures an adaptive limit on the number of
+// commands a Cluster executes at once. The limit is increased by one for
+// every limit's worth of commands that complete normally, and multiplied by
+// BackoffRatio when a command completes slower than LatencyThreshold or Riak
+// reports that it is overloaded
+type ConcurrencyLimitOptions struct {
+	InitialLimit     uint16 // NB: defaults to MaxLimit
+	MinLimit         uint16 // NB: defaults to 1
+	MaxLimit         uint16
+	LatencyThreshold time.Duration // NB: if zero, only overload errors reduce the limit
+	BackoffRatio     float64       // NB: defaults to 0.9
+}
+
+const (
+	defaultConcurrencyMaxLimit     = uint16(256)
+	defaultConcurrencyBackoffRatio = 0.9
+)
+
+// Reasons a command is rejected by a Cluster
+const (
+	RejectedRateLimit        = "rate limit exceeded"
+	RejectedCommandRateLimit = "command rate limit exceeded"
+	RejectedConcurrencyLimit = "concurrency limit exceeded"
+)
+
+// RejectedError is returned when a Cluster sheds load by refusing to execute
+// a command. Rejected commands are never sent to Riak
+type RejectedError struct {
+	Command    string        // NB: command type, e.g. "FetchValue"
+	Reason     string        // NB: one of the Rejected* constants
+	RetryAfter time.Duration // NB: for rate limits, the time until a command may be admitted
+}
+
+func (e RejectedError) Error() string {
+	return fmt.Sprintf("RejectedError|%s|%s", e.Command, e.Reason)
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	sync.Mutex
+}
+
+func newTokenBucket(options *RateLimitOptions) *tokenBucket {
+	burst := float64(options.Burst)
+	if burst == 0 {
+		burst = math.Max(1, math.Ceil(options.Rate))
+	}
+	return &tokenBucket{
+		rate:   options.Rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// take removes a token from the bucket if one is available. If not, the time
+// until one will be is returned
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// refund returns a token taken for a command that was then rejected
+func (b *tokenBucket) refund() {
+	b.Lock()
+	defer b.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+type concurrencyLimiter struct {
+	limit            float64
+	minLimit         float64
+	maxLimit         float64
+	inFlight         int
+	latencyThreshold time.Duration
+	backoffRatio     float64
+	sync.Mutex
+}
+
+func newConcurrencyLimiter(options *ConcurrencyLimitOptions) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		limit:            float64(options.InitialLimit),
+		minLimit:         float64(options.MinLimit),
+		maxLimit:         float64(options.MaxLimit),
+		latencyThreshold: options.LatencyThreshold,
+		backoffRatio:     options.BackoffRatio,
+	}
+	if l.maxLimit == 0 {
+		l.maxLimit = float64(defaultConcurrencyMaxLimit)
+	}
+	if l.minLimit == 0 {
+		l.minLimit = 1
+	}
+	if l.minLimit > l.maxLimit {
+		l.minLimit = l.maxLimit
+	}
+	if l.limit == 0 || l.limit > l.maxLimit {
+		l.limit = l.maxLimit
+	}
+	if l.limit < l.minLimit {
+		l.limit = l.minLimit
+	}
+	if l.backoffRatio <= 0 || l.backoffRatio >= 1 {
+		l.backoffRatio = defaultConcurrencyBackoffRatio
+	}
+	return l
+}
+
+func (l *concurrencyLimiter) acquire() bool {
+	l.Lock()
+	defer l.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *concurrencyLimiter) release(latency time.Duration, overloaded bool) {
+	l.Lock()
+	defer l.Unlock()
+	l.inFlight--
+	if overloaded || (l.latencyThreshold > 0 && latency > l.latencyThreshold) {
+		l.limit = math.Max(l.minLimit, l.limit*l.backoffRatio)
+	} else {
+		l.limit = math.Min(l.maxLimit, l.limit+1/l.limit)
+	}
+}
+
+func (l *concurrencyLimiter) getLimit() uint16 {
+	l.Lock()
+	defer l.Unlock()
+	return uint16(l.limit)
+}
+
+// isOverloadError returns true if err is, or wraps, a RiakError indicating
+// that Riak is overloaded
+func isOverloadError(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case RiakError:
+			return strings.Contains(e.Errmsg, "overload")
+		case ClientError:
+			err = e.InnerError
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// limiter decides whether a Cluster admits a command for execution
+type limiter struct {
+	rate        *tokenBucket
+	commands    map[string]*tokenBucket
+	concurrency *concurrencyLimiter
+}
+
+func newLimiter(options *ClusterOptions) *limiter {
+	if options.RateLimit == nil && len(options.CommandRateLimits) == 0 && options.ConcurrencyLimit == nil {
+		return nil
+	}
+	l := &limiter{}
+	if options.RateLimit != nil && options.RateLimit.Rate > 0 {
+		l.rate = newTokenBucket(options.RateLimit)
+	}
+	if len(options.CommandRateLimits) > 0 {
+		l.commands = make(map[string]*tokenBucket, len(options.CommandRateLimits))
+		for name, rlo := range options.CommandRateLimits {
+			if rlo != nil && rlo.Rate > 0 {
+				l.commands[name] = newTokenBucket(rlo)
+			}
+		}
+	}
+	if options.ConcurrencyLimit != nil {
+		l.concurrency = newConcurrencyLimiter(options.ConcurrencyLimit)
+	}
+	return l
+}
+
+func (l *limiter) admit(name string) error {
+	now := time.Now()
+	cb := l.commands[name]
+	if cb != nil {
+		if ok, retryAfter := cb.take(now); !ok {
+			return RejectedError{Command: name, Reason: RejectedCommandRateLimit, RetryAfter: retryAfter}
+		}
+	}
+	if l.rate != nil {
+		if ok, retryAfter := l.rate.take(now); !ok {
+			if cb != nil {
+				cb.refund()
+			}
+			return RejectedError{Command: name, Reason: RejectedRateLimit, RetryAfter: retryAfter}
+		}
+	}
+	if l.concurrency != nil && !l.concurrency.acquire() {
+		if cb != nil {
+			cb.refund()
+		}
+		if l.rate != nil {
+			l.rate.refund()
+		}
+		return RejectedError{Command: name, Reason: RejectedConcurrencyLimit}
+	}
+	return nil
+}
+
+func (l *limiter) release(async *Async, err error) {
+	if l.concurrency == nil {
+		return
+	}
+	overloaded := isOverloadError(err) || isOverloadError(async.Command.Error())
+	l.concurrency.release(time.Since(async.startedAt), overloaded)
+}
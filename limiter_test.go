@@ -0,0 +1,205 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(&RateLimitOptions{
+		Rate:  10,
+		Burst: 2,
+	})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take(now); !ok {
+			t.Fatalf("expected burst token %d to be available", i)
+		}
+	}
+	ok, retryAfter := b.take(now)
+	if ok {
+		t.Fatal("expected bucket to be empty")
+	}
+	if expected, actual := time.Millisecond*100, retryAfter; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if ok, _ := b.take(now.Add(time.Millisecond * 100)); !ok {
+		t.Error("expected a token to be available after refill")
+	}
+	// NB: refill never exceeds the burst size
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take(now); !ok {
+			t.Fatalf("expected burst token %d to be available", i)
+		}
+	}
+	if ok, _ := b.take(now); ok {
+		t.Error("expected bucket to be empty")
+	}
+}
+
+func TestTokenBucketDefaultBurst(t *testing.T) {
+	b := newTokenBucket(&RateLimitOptions{
+		Rate: 2.5,
+	})
+	if expected, actual := float64(3), b.burst; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	b = newTokenBucket(&RateLimitOptions{
+		Rate: 0.5,
+	})
+	if expected, actual := float64(1), b.burst; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestConcurrencyLimiterAIMD(t *testing.T) {
+	l := newConcurrencyLimiter(&ConcurrencyLimitOptions{
+		InitialLimit:     2,
+		MinLimit:         1,
+		MaxLimit:         4,
+		LatencyThreshold: time.Second,
+		BackoffRatio:     0.5,
+	})
+	if !l.acquire() || !l.acquire() {
+		t.Fatal("expected to acquire up to the limit")
+	}
+	if l.acquire() {
+		t.Fatal("expected acquire past the limit to fail")
+	}
+
+	// additive increase, roughly one per limit's worth of commands
+	l.release(time.Millisecond, false)
+	l.release(time.Millisecond, false)
+	l.acquire()
+	l.release(time.Millisecond, false)
+	if expected, actual := uint16(3), l.getLimit(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// multiplicative decrease on latency and overload
+	l.acquire()
+	l.release(time.Second*2, false)
+	if expected, actual := uint16(1), l.getLimit(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	l.acquire()
+	l.release(time.Millisecond, true)
+	if expected, actual := uint16(1), l.getLimit(); expected != actual {
+		t.Errorf("expected limit to stay at minimum, got %v", actual)
+	}
+	if expected, actual := 0, l.inFlight; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestConcurrencyLimiterDefaults(t *testing.T) {
+	l := newConcurrencyLimiter(&ConcurrencyLimitOptions{})
+	if expected, actual := defaultConcurrencyMaxLimit, l.getLimit(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := float64(1), l.minLimit; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := defaultConcurrencyBackoffRatio, l.backoffRatio; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestIsOverloadError(t *testing.T) {
+	overload := RiakError{Errcode: 0, Errmsg: "overload"}
+	if !isOverloadError(overload) {
+		t.Error("expected overload RiakError to be an overload error")
+	}
+	if !isOverloadError(newClientError(ErrClusterNoNodesAvailable, overload)) {
+		t.Error("expected wrapped overload RiakError to be an overload error")
+	}
+	if isOverloadError(RiakError{Errmsg: "notfound"}) {
+		t.Error("expected other RiakError not to be an overload error")
+	}
+	if isOverloadError(nil) || isOverloadError(ErrClusterShuttingDown) {
+		t.Error("expected non-Riak errors not to be overload errors")
+	}
+}
+
+func TestLimiterRefundsTokensWhenRejected(t *testing.T) {
+	l := newLimiter(&ClusterOptions{
+		RateLimit: &RateLimitOptions{
+			Rate:  1,
+			Burst: 2,
+		},
+		CommandRateLimits: map[string]*RateLimitOptions{
+			"FetchValue": {
+				Rate:  1,
+				Burst: 1,
+			},
+		},
+	})
+	if err := l.admit("FetchValue"); err != nil {
+		t.Fatal(err)
+	}
+	err := l.admit("FetchValue")
+	if rerr, ok := err.(RejectedError); !ok {
+		t.Fatalf("expected RejectedError, got %v", err)
+	} else {
+		if expected, actual := RejectedCommandRateLimit, rerr.Reason; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if rerr.RetryAfter <= 0 {
+			t.Error("expected positive RetryAfter")
+		}
+	}
+	// NB: the rejected FetchValue did not consume a global token
+	if err := l.admit("Ping"); err != nil {
+		t.Fatal(err)
+	}
+	err = l.admit("Ping")
+	if rerr, ok := err.(RejectedError); !ok || rerr.Reason != RejectedRateLimit {
+		t.Errorf("expected global rate limit RejectedError, got %v", err)
+	}
+}
+
+func TestClusterRejectsCommandsOverRateLimit(t *testing.T) {
+	cluster, err := NewCluster(&ClusterOptions{
+		CommandRateLimits: map[string]*RateLimitOptions{
+			"Ping": {
+				Rate:  0.001,
+				Burst: 1,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NB: cluster is not running, so the first command fails after being admitted
+	if err := cluster.Execute(&PingCommand{}); err == nil {
+		t.Fatal("expected error executing command on cluster that is not running")
+	} else if _, ok := err.(RejectedError); ok {
+		t.Fatal("expected first command to be admitted")
+	}
+	err = cluster.Execute(&PingCommand{})
+	if rerr, ok := err.(RejectedError); !ok {
+		t.Fatalf("expected RejectedError, got %v", err)
+	} else if expected, actual := "Ping", rerr.Command; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if err := cluster.Execute(&GetServerInfoCommand{}); err != nil {
+		if _, ok := err.(RejectedError); ok {
+			t.Error("expected other command types not to be limited")
+		}
+	}
+}
@@ -78,6 +78,7 @@ const rpbCode_TsGetReq byte = 96
 const rpbCode_TsGetResp byte = 97
 const rpbCode_TsListKeysReq byte = 98
 const rpbCode_TsListKeysResp byte = 99
+const rpbCode_TsTtbMsg byte = 104
 const rpbCode_RpbAuthReq byte = 253
 const rpbCode_RpbAuthResp byte = 254
 const rpbCode_RpbStartTls byte = 255
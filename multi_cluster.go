@@ -0,0 +1,237 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DatacenterCluster is a Cluster located in a datacenter
+type DatacenterCluster struct {
+	Datacenter string
+	Cluster    *Cluster
+}
+
+// String returns the datacenter and nodes of the Cluster
+func (dc *DatacenterCluster) String() string {
+	return fmt.Sprintf("%s%v", dc.Datacenter, dc.Cluster)
+}
+
+// MultiClusterOptions configures a MultiCluster. Commands are routed to
+// clusters in LocalDatacenter, then to the remaining datacenters in
+// FailoverOrder. Datacenters not listed in FailoverOrder are tried last, in
+// name order
+type MultiClusterOptions struct {
+	LocalDatacenter string
+	Clusters        []*DatacenterCluster
+	FailoverOrder   []string
+}
+
+// MultiCluster routes commands across Clusters in several datacenters, such as
+// Riak clusters connected by MDC replication. Commands execute on a healthy
+// Cluster in the local datacenter, or fail over to a remote one when no local
+// Cluster has a running Node.
+//
+// A Command that fails because its Cluster became unhealthy only fails over if
+// it never reached a Node, or if it is a read such as FetchValueCommand. A
+// write that a Node sent to Riak may have been applied, for instance before a
+// timeout, so replaying an UpdateCounterCommand or UpdateMapCommand in another
+// datacenter could apply it twice; its error is returned instead
+type MultiCluster struct {
+	local    string
+	clusters []*DatacenterCluster // NB: in routing order
+}
+
+// MultiCluster errors
+var (
+	ErrMultiClusterLocalDatacenterRequired = newClientError("[MultiCluster] LocalDatacenter is required", nil)
+	ErrMultiClusterClusterRequired         = newClientError("[MultiCluster] at least one cluster is required", nil)
+	ErrMultiClusterClusterMustBeNonNil     = newClientError("[MultiCluster] all clusters must be non-nil", nil)
+	ErrMultiClusterNoHealthyClusters       = newClientError("[MultiCluster] no healthy clusters available to execute command", nil)
+)
+
+// NewMultiCluster generates a new MultiCluster object using the provided
+// MultiClusterOptions object
+func NewMultiCluster(options *MultiClusterOptions) (*MultiCluster, error) {
+	if options == nil {
+		return nil, ErrOptionsRequired
+	}
+	if options.LocalDatacenter == "" {
+		return nil, ErrMultiClusterLocalDatacenterRequired
+	}
+	if len(options.Clusters) == 0 {
+		return nil, ErrMultiClusterClusterRequired
+	}
+
+	byDatacenter := make(map[string][]*DatacenterCluster)
+	var datacenters []string
+	for _, dc := range options.Clusters {
+		if dc == nil || dc.Cluster == nil {
+			return nil, ErrMultiClusterClusterMustBeNonNil
+		}
+		if _, ok := byDatacenter[dc.Datacenter]; !ok {
+			datacenters = append(datacenters, dc.Datacenter)
+		}
+		byDatacenter[dc.Datacenter] = append(byDatacenter[dc.Datacenter], dc)
+	}
+	sort.Strings(datacenters)
+
+	clusters := make([]*DatacenterCluster, 0, len(options.Clusters))
+	var addDatacenter = func(name string) {
+		clusters = append(clusters, byDatacenter[name]...)
+		delete(byDatacenter, name)
+	}
+	addDatacenter(options.LocalDatacenter)
+	for _, name := range options.FailoverOrder {
+		addDatacenter(name)
+	}
+	for _, name := range datacenters {
+		addDatacenter(name)
+	}
+
+	return &MultiCluster{
+		local:    options.LocalDatacenter,
+		clusters: clusters,
+	}, nil
+}
+
+// String returns a formatted string that lists the Clusters in routing order
+func (mc *MultiCluster) String() string {
+	return fmt.Sprintf("%v", mc.clusters)
+}
+
+// LocalDatacenter returns the name of the local datacenter
+func (mc *MultiCluster) LocalDatacenter() string {
+	return mc.local
+}
+
+// Clusters returns the Clusters of this MultiCluster in routing order
+func (mc *MultiCluster) Clusters() []*DatacenterCluster {
+	clusters := make([]*DatacenterCluster, len(mc.clusters))
+	copy(clusters, mc.clusters)
+	return clusters
+}
+
+// Start starts every Cluster. Clusters are started in parallel so that a slow
+// remote datacenter does not delay the local one
+func (mc *MultiCluster) Start() error {
+	errs := make([]error, len(mc.clusters))
+	wg := &sync.WaitGroup{}
+	for i, dc := range mc.clusters {
+		wg.Add(1)
+		go func(i int, dc *DatacenterCluster) {
+			defer wg.Done()
+			errs[i] = dc.Cluster.Start()
+		}(i, dc)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops every Cluster, returning the first error encountered
+func (mc *MultiCluster) Stop() (err error) {
+	for _, dc := range mc.clusters {
+		if serr := dc.Cluster.Stop(); serr != nil {
+			logErr("[MultiCluster]", serr)
+			if err == nil {
+				err = serr
+			}
+		}
+	}
+	return
+}
+
+// Execute (synchronously) the provided Command on a healthy Cluster, local
+// ones first. The Cluster that executed the Command is returned, even if
+// execution was not successful
+func (mc *MultiCluster) Execute(command Command) (*DatacenterCluster, error) {
+	if command == nil {
+		return nil, ErrClusterCommandRequired
+	}
+	return mc.execute(command)
+}
+
+// ExecuteAsync (asynchronously) executes the provided Command on a healthy
+// Cluster, local ones first. The Cluster that executed the Command is set in
+// the ExecutedBy field of async before completion is signaled
+func (mc *MultiCluster) ExecuteAsync(async *Async) error {
+	if async.Command == nil {
+		return ErrClusterCommandRequired
+	}
+	if async.Done == nil && async.Wait == nil {
+		return ErrClusterAsyncRequiresChannelOrWaitGroup
+	}
+	if async.Wait != nil {
+		async.Wait.Add(1)
+	}
+	go func() {
+		dc, err := mc.execute(async.Command)
+		async.ExecutedBy = dc
+		async.done(err)
+	}()
+	return nil
+}
+
+// NB: a Command is only executed on the next healthy Cluster if the Cluster
+// it executed on became unhealthy while executing it, and it either never
+// reached a Node or is a read. Other errors, including those returned by
+// Riak, are returned to the caller
+func (mc *MultiCluster) execute(command Command) (*DatacenterCluster, error) {
+	var last *DatacenterCluster
+	var err error
+	for _, dc := range mc.clusters {
+		if !dc.Cluster.isHealthy() {
+			continue
+		}
+		if last != nil {
+			logWarn("[MultiCluster]", "failing over cmd '%s' from %s to %s", command.Name(), last.Datacenter, dc.Datacenter)
+			command.onRetry()
+		}
+		last = dc
+		var async *Async
+		if async, err = dc.Cluster.executeAndWait(command); err == nil || dc.Cluster.isHealthy() {
+			return dc, err
+		}
+		if async.sent && !isReadCommand(command) {
+			logWarn("[MultiCluster]", "not failing over cmd '%s' from %s, it may have been applied", command.Name(), dc.Datacenter)
+			return dc, err
+		}
+	}
+	if last == nil {
+		return nil, ErrMultiClusterNoHealthyClusters
+	}
+	return last, err
+}
+
+// isReadCommand returns whether the Command only reads data, so that executing
+// it again cannot change what is stored
+func isReadCommand(command Command) bool {
+	switch command.(type) {
+	case *FetchValueCommand, *FetchCounterCommand, *FetchSetCommand, *FetchMapCommand, *FetchHllCommand,
+		*ListBucketsCommand, *ListKeysCommand, *FetchPreflistCommand, *SecondaryIndexQueryCommand,
+		*MapReduceCommand, *SearchCommand, *PingCommand, *GetServerInfoCommand,
+		*FetchBucketTypePropsCommand, *FetchBucketPropsCommand, *FetchIndexCommand, *FetchSchemaCommand,
+		*TsFetchRowCommand, *TsListKeysCommand, *fetchLegacyCounterCommand:
+		return true
+	}
+	return false
+}
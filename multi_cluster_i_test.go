@@ -0,0 +1,106 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build integration
+
+package riak
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestMultiClusterFailsOverToRemoteDatacenter(t *testing.T) {
+	tl := newTestListener(&testListenerOpts{test: t})
+	defer tl.stop()
+	tl.start()
+
+	// NB: nothing listens on the local node's address
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	localAddr := ln.Addr().String()
+	ln.Close()
+
+	newDatacenterCluster := func(datacenter, addr string) *DatacenterCluster {
+		node, err := NewNode(&NodeOptions{
+			RemoteAddress:  addr,
+			MinConnections: 0,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cluster, err := NewCluster(&ClusterOptions{
+			Nodes:             []*Node{node},
+			ExecutionAttempts: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &DatacenterCluster{
+			Datacenter: datacenter,
+			Cluster:    cluster,
+		}
+	}
+	local := newDatacenterCluster("us-east", localAddr)
+	remote := newDatacenterCluster("us-west", tl.addr.String())
+
+	mc, err := NewMultiCluster(&MultiClusterOptions{
+		LocalDatacenter: "us-east",
+		Clusters:        []*DatacenterCluster{remote, local},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := mc.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// first command fails on the local cluster, which becomes unhealthy
+	cmd := &PingCommand{}
+	dc, err := mc.Execute(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmd.Success() {
+		t.Error("expected successful ping")
+	}
+	if expected, actual := remote, dc; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// subsequent commands go straight to the remote cluster
+	wg := &sync.WaitGroup{}
+	async := &Async{
+		Command: &PingCommand{},
+		Wait:    wg,
+	}
+	if err := mc.ExecuteAsync(async); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if async.Error != nil {
+		t.Fatal(async.Error)
+	}
+	if expected, actual := remote, async.ExecutedBy; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
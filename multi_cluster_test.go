@@ -0,0 +1,199 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestDatacenterCluster(t *testing.T, datacenter string) *DatacenterCluster {
+	cluster, err := NewCluster(&ClusterOptions{
+		NoDefaultNode: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DatacenterCluster{
+		Datacenter: datacenter,
+		Cluster:    cluster,
+	}
+}
+
+func TestCreateMultiClusterRequiresOptions(t *testing.T) {
+	if _, err := NewMultiCluster(nil); err != ErrOptionsRequired {
+		t.Errorf("expected %v, got %v", ErrOptionsRequired, err)
+	}
+	if _, err := NewMultiCluster(&MultiClusterOptions{}); err != ErrMultiClusterLocalDatacenterRequired {
+		t.Errorf("expected %v, got %v", ErrMultiClusterLocalDatacenterRequired, err)
+	}
+	if _, err := NewMultiCluster(&MultiClusterOptions{LocalDatacenter: "us-east"}); err != ErrMultiClusterClusterRequired {
+		t.Errorf("expected %v, got %v", ErrMultiClusterClusterRequired, err)
+	}
+	_, err := NewMultiCluster(&MultiClusterOptions{
+		LocalDatacenter: "us-east",
+		Clusters:        []*DatacenterCluster{{Datacenter: "us-east"}},
+	})
+	if err != ErrMultiClusterClusterMustBeNonNil {
+		t.Errorf("expected %v, got %v", ErrMultiClusterClusterMustBeNonNil, err)
+	}
+}
+
+func TestMultiClusterRoutingOrder(t *testing.T) {
+	euWest := newTestDatacenterCluster(t, "eu-west")
+	usWest := newTestDatacenterCluster(t, "us-west")
+	usEast1 := newTestDatacenterCluster(t, "us-east")
+	usEast2 := newTestDatacenterCluster(t, "us-east")
+	apSouth := newTestDatacenterCluster(t, "ap-south")
+	mc, err := NewMultiCluster(&MultiClusterOptions{
+		LocalDatacenter: "us-east",
+		Clusters:        []*DatacenterCluster{euWest, usWest, usEast1, apSouth, usEast2},
+		FailoverOrder:   []string{"us-west"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "us-east", mc.LocalDatacenter(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	expected := []*DatacenterCluster{usEast1, usEast2, usWest, apSouth, euWest}
+	actual := mc.Clusters()
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %v, got %v", len(expected), len(actual))
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("position %d: expected %v, got %v", i, expected[i].Datacenter, actual[i].Datacenter)
+		}
+	}
+}
+
+func TestMultiClusterWithoutHealthyClusters(t *testing.T) {
+	mc, err := NewMultiCluster(&MultiClusterOptions{
+		LocalDatacenter: "us-east",
+		Clusters: []*DatacenterCluster{
+			newTestDatacenterCluster(t, "us-east"),
+			newTestDatacenterCluster(t, "us-west"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := mc.Execute(&PingCommand{})
+	if err != ErrMultiClusterNoHealthyClusters {
+		t.Errorf("expected %v, got %v", ErrMultiClusterNoHealthyClusters, err)
+	}
+	if dc != nil {
+		t.Errorf("expected nil cluster, got %v", dc)
+	}
+}
+
+// testFailingNodeManager fails every command, marking its nodes unhealthy as
+// if they went down while executing it. If sent is set, the command reached
+// a node before failing
+type testFailingNodeManager struct {
+	sent     bool
+	executed int
+}
+
+func (nm *testFailingNodeManager) ExecuteOnNode(nodes []*Node, command Command, previous *Node) (bool, error) {
+	nm.executed++
+	for _, node := range nodes {
+		node.setState(nodeHealthChecking)
+	}
+	return nm.sent, errors.New("timeout")
+}
+
+// testRecordingNodeManager succeeds at every command it executes
+type testRecordingNodeManager struct {
+	executed int
+}
+
+func (nm *testRecordingNodeManager) ExecuteOnNode(nodes []*Node, command Command, previous *Node) (bool, error) {
+	nm.executed++
+	return true, nil
+}
+
+func newTestRunningDatacenterCluster(t *testing.T, datacenter string, nm NodeManager) *DatacenterCluster {
+	node, err := NewNode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.setState(nodeRunning)
+	cluster, err := NewCluster(&ClusterOptions{
+		Nodes:             []*Node{node},
+		NodeManager:       nm,
+		ExecutionAttempts: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster.setState(clusterRunning)
+	return &DatacenterCluster{
+		Datacenter: datacenter,
+		Cluster:    cluster,
+	}
+}
+
+func TestMultiClusterFailsOverOnlyCommandsSafeToReplay(t *testing.T) {
+	tests := []struct {
+		command  Command
+		sent     bool
+		failover bool
+	}{
+		{&UpdateCounterCommand{}, true, false},
+		{&UpdateMapCommand{}, true, false},
+		{&UpdateCounterCommand{}, false, true},
+		{&FetchValueCommand{}, true, true},
+	}
+	for i, tt := range tests {
+		local := &testFailingNodeManager{sent: tt.sent}
+		remote := &testRecordingNodeManager{}
+		usEast := newTestRunningDatacenterCluster(t, "us-east", local)
+		usWest := newTestRunningDatacenterCluster(t, "us-west", remote)
+		mc, err := NewMultiCluster(&MultiClusterOptions{
+			LocalDatacenter: "us-east",
+			Clusters:        []*DatacenterCluster{usEast, usWest},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dc, err := mc.Execute(tt.command)
+		if expected, actual := 1, local.executed; expected != actual {
+			t.Errorf("%d: expected %v, got %v", i, expected, actual)
+		}
+		if tt.failover {
+			if err != nil {
+				t.Errorf("%d: expected no error, got %v", i, err)
+			}
+			if expected, actual := usWest, dc; expected != actual {
+				t.Errorf("%d: expected %v, got %v", i, expected, actual)
+			}
+			if expected, actual := 1, remote.executed; expected != actual {
+				t.Errorf("%d: expected %v, got %v", i, expected, actual)
+			}
+		} else {
+			if err == nil {
+				t.Errorf("%d: expected an error", i)
+			}
+			if expected, actual := usEast, dc; expected != actual {
+				t.Errorf("%d: expected %v, got %v", i, expected, actual)
+			}
+			if expected, actual := 0, remote.executed; expected != actual {
+				t.Errorf("%d: expected %v, got %v", i, expected, actual)
+			}
+		}
+	}
+}
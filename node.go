@@ -17,6 +17,7 @@ package riak
 import (
 	"fmt"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -32,17 +33,27 @@ const (
 
 // NodeOptions defines the RemoteAddress and operational configuration for connections to a Riak KV
 // instance
+//
+// MinConnections are dialed in parallel when the Node starts. Connections above MinConnections are
+// closed once idle for IdleTimeout, checked every IdleExpirationInterval. If MaxConnectionLifetime
+// is set, connections are closed after (up to 10% less than) that long regardless of use, and the
+// pool is refilled to MinConnections. If ConnectionWaitTimeout is set, a command that finds all
+// MaxConnections in use waits up to that long for one to be returned to the pool instead of
+// failing immediately.
 type NodeOptions struct {
-	RemoteAddress       string
-	MinConnections      uint16
-	MaxConnections      uint16
-	TempNetErrorRetries uint16
-	IdleTimeout         time.Duration
-	ConnectTimeout      time.Duration
-	RequestTimeout      time.Duration
-	HealthCheckInterval time.Duration
-	HealthCheckBuilder  CommandBuilder
-	AuthOptions         *AuthOptions
+	RemoteAddress          string
+	MinConnections         uint16
+	MaxConnections         uint16
+	TempNetErrorRetries    uint16
+	IdleTimeout            time.Duration
+	IdleExpirationInterval time.Duration
+	MaxConnectionLifetime  time.Duration
+	ConnectionWaitTimeout  time.Duration
+	ConnectTimeout         time.Duration
+	RequestTimeout         time.Duration
+	HealthCheckInterval    time.Duration
+	HealthCheckBuilder     CommandBuilder
+	AuthOptions            *AuthOptions
 }
 
 // Node is a struct that contains all of the information needed to connect and maintain connections
@@ -53,6 +64,8 @@ type Node struct {
 	healthCheckBuilder  CommandBuilder
 	stopChan            chan struct{}
 	cm                  *connectionManager
+	availableChans      []chan struct{}
+	availableMutex      sync.RWMutex
 	stateData
 }
 
@@ -86,6 +99,9 @@ func NewNode(options *NodeOptions) (*Node, error) {
 	if options.IdleTimeout == 0 {
 		options.IdleTimeout = defaultIdleTimeout
 	}
+	if options.IdleExpirationInterval == 0 {
+		options.IdleExpirationInterval = defaultIdleExpirationInterval
+	}
 	if options.ConnectTimeout == 0 {
 		options.ConnectTimeout = defaultConnectTimeout
 	}
@@ -107,19 +123,30 @@ func NewNode(options *NodeOptions) (*Node, error) {
 			healthCheckBuilder:  options.HealthCheckBuilder,
 		}
 
+		authOptions := options.AuthOptions
+		if authOptions != nil && authOptions.TlsConfig != nil {
+			nodeAuthOptions := *authOptions
+			nodeAuthOptions.TlsConfig = nodeTlsConfig(authOptions.TlsConfig, options.MaxConnections)
+			authOptions = &nodeAuthOptions
+		}
+
 		connMgrOpts := &connectionManagerOptions{
-			addr:                resolvedAddress,
-			minConnections:      options.MinConnections,
-			maxConnections:      options.MaxConnections,
-			tempNetErrorRetries: options.TempNetErrorRetries,
-			idleTimeout:         options.IdleTimeout,
-			connectTimeout:      options.ConnectTimeout,
-			requestTimeout:      options.RequestTimeout,
-			authOptions:         options.AuthOptions,
+			addr:                   resolvedAddress,
+			minConnections:         options.MinConnections,
+			maxConnections:         options.MaxConnections,
+			tempNetErrorRetries:    options.TempNetErrorRetries,
+			idleExpirationInterval: options.IdleExpirationInterval,
+			idleTimeout:            options.IdleTimeout,
+			maxLifetime:            options.MaxConnectionLifetime,
+			waitTimeout:            options.ConnectionWaitTimeout,
+			connectTimeout:         options.ConnectTimeout,
+			requestTimeout:         options.RequestTimeout,
+			authOptions:            authOptions,
 		}
 
 		var cm *connectionManager
 		if cm, err = newConnectionManager(connMgrOpts); err == nil {
+			cm.onReleased = n.notifyAvailable
 			n.cm = cm
 			n.initStateData("nodeCreated", "nodeRunning", "nodeHealthChecking", "nodeShuttingDown", "nodeShutdown", "nodeError")
 			n.setState(nodeCreated)
@@ -189,7 +216,10 @@ func (n *Node) execute(cmd Command) (bool, error) {
 		conn, err := n.cm.get()
 		if err != nil {
 			logErr("[Node]", err)
-			n.doHealthCheck()
+			// NB: an exhausted pool does not mean the node is unhealthy
+			if err != ErrConnMgrAllConnectionsInUse {
+				n.doHealthCheck()
+			}
 			return false, err
 		}
 
@@ -200,6 +230,9 @@ func (n *Node) execute(cmd Command) (bool, error) {
 		if rc, ok := cmd.(retryableCommand); ok {
 			rc.setLastNode(n)
 		}
+		if ec, ok := cmd.(executedOnCommand); ok {
+			ec.setExecutedOn(n)
+		}
 
 		logDebug("[Node]", "(%v) - executing command '%v'", n, cmd.Name())
 		err = conn.execute(cmd)
@@ -235,6 +268,50 @@ func (n *Node) execute(cmd Command) (bool, error) {
 	}
 }
 
+// freeConnections returns the number of idle connections in the pool plus
+// the number that may still be opened, or 0 if the node is not running
+func (n *Node) freeConnections() int {
+	if !n.isCurrentState(nodeRunning) {
+		return 0
+	}
+	free := int(n.cm.maxConnections) - int(n.cm.count()) + int(n.cm.q.count())
+	if free < 0 {
+		return 0
+	}
+	return free
+}
+
+// addAvailableChan registers a channel to be signaled, without blocking,
+// whenever this Node may be able to execute a command that it could not before:
+// a connection was returned to the pool or the Node recovered
+func (n *Node) addAvailableChan(c chan struct{}) {
+	n.availableMutex.Lock()
+	defer n.availableMutex.Unlock()
+	n.availableChans = append(n.availableChans, c)
+}
+
+func (n *Node) removeAvailableChan(c chan struct{}) {
+	n.availableMutex.Lock()
+	defer n.availableMutex.Unlock()
+	for i, ac := range n.availableChans {
+		if ac == c {
+			n.availableChans = append(n.availableChans[:i], n.availableChans[i+1:]...)
+			return
+		}
+	}
+}
+
+func (n *Node) notifyAvailable() {
+	n.availableMutex.RLock()
+	defer n.availableMutex.RUnlock()
+	for _, c := range n.availableChans {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
 func (n *Node) doHealthCheck() {
 	// NB: ensure we're not already healthchecking or shutting down
 	if n.isStateLessThan(nodeHealthChecking) {
@@ -313,6 +390,7 @@ func (n *Node) healthCheck() {
 					logDebug("[Node]", "(%v) healthcheck success, err: %v, success: %v", n, hcerr, hcmd.Success())
 					if n.ensureHealthCheckCanContinue() {
 						n.setState(nodeRunning)
+						n.notifyAvailable()
 					}
 					return
 				}
@@ -43,11 +43,8 @@ func (nm *defaultNodeManager) ExecuteOnNode(nodes []*Node, command Command, prev
 	var err error
 	executed := false
 
-	nm.RLock()
-	startingIndex := nm.nodeIndex
-	nm.RUnlock()
-
-	for {
+	// NB: each node is tried at most once
+	for i := 0; i < len(nodes); i++ {
 		nm.Lock()
 		if nm.nodeIndex >= len(nodes) {
 			nm.nodeIndex = 0
@@ -66,14 +63,6 @@ func (nm *defaultNodeManager) ExecuteOnNode(nodes []*Node, command Command, prev
 			logDebug("[DefaultNodeManager]", "executed '%s' on node '%s', err '%v'", command.Name(), node, err)
 			break
 		}
-
-		nm.RLock()
-		if startingIndex == nm.nodeIndex {
-			nm.RUnlock()
-			// logDebug("[DefaultNodeManager]", "startingIndex %d nm.nodeIndex %d", startingIndex, nm.nodeIndex)
-			break
-		}
-		nm.RUnlock()
 	}
 
 	return executed, err
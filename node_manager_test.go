@@ -0,0 +1,43 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"testing"
+)
+
+func TestDefaultNodeManagerTriesEachNodeOnce(t *testing.T) {
+	for _, nodeCount := range []int{1, 3} {
+		nodes := make([]*Node, nodeCount)
+		for i := range nodes {
+			node, err := NewNode(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes[i] = node
+		}
+		nm := &defaultNodeManager{}
+		// NB: nodes are not started, so none can execute the command
+		for i := 0; i < 2; i++ {
+			executed, err := nm.ExecuteOnNode(nodes, &PingCommand{}, nil)
+			if executed {
+				t.Error("expected command not to execute")
+			}
+			if err == nil {
+				t.Error("expected non-nil error")
+			}
+		}
+	}
+}
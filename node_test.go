@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 )
 
 func TestCreateNodeWithOptions(t *testing.T) {
@@ -32,6 +33,10 @@ func TestCreateNodeWithOptions(t *testing.T) {
 		HealthCheckInterval: tenSeconds,
 		HealthCheckBuilder:  builder,
 		TempNetErrorRetries: 16,
+
+		IdleExpirationInterval: time.Second,
+		MaxConnectionLifetime:  time.Minute,
+		ConnectionWaitTimeout:  threeSeconds,
 	}
 	node, err := NewNode(opts)
 	if err != nil {
@@ -71,6 +76,15 @@ func TestCreateNodeWithOptions(t *testing.T) {
 	if got, want := node.cm.tempNetErrorRetries, opts.TempNetErrorRetries; got != want {
 		t.Errorf("got %v, want %v", got, want)
 	}
+	if expected, actual := node.cm.idleExpirationInterval, opts.IdleExpirationInterval; expected != actual {
+		t.Errorf("expected %v, got: %v", expected, actual)
+	}
+	if expected, actual := node.cm.maxLifetime, opts.MaxConnectionLifetime; expected != actual {
+		t.Errorf("expected %v, got: %v", expected, actual)
+	}
+	if expected, actual := node.cm.waitTimeout, opts.ConnectionWaitTimeout; expected != actual {
+		t.Errorf("expected %v, got: %v", expected, actual)
+	}
 	if expected, actual := node.healthCheckInterval, opts.HealthCheckInterval; expected != actual {
 		t.Errorf("expected %v, got: %v", expected, actual)
 	}
@@ -165,3 +179,29 @@ func TestEnsureDefaultNodeValues(t *testing.T) {
 		t.Errorf("expected %v, got: %v", expected, actual)
 	}
 }
+
+func TestNodeFreeConnections(t *testing.T) {
+	node, err := NewNode(&NodeOptions{
+		RemoteAddress:  "127.0.0.1:8087",
+		MinConnections: 1,
+		MaxConnections: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 0, node.freeConnections(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// NB: no connections have been opened, so all may still be
+	node.setState(nodeRunning)
+	if expected, actual := 4, node.freeConnections(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	cluster, err := NewCluster(&ClusterOptions{Nodes: []*Node{node}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 4, cluster.freeConnections(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
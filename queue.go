@@ -14,7 +14,10 @@
 
 package riak
 
-import "sync"
+import (
+	"container/list"
+	"sync"
+)
 
 type queue struct {
 	queueSize uint16
@@ -116,3 +119,91 @@ func (q *queue) count() uint16 {
 func (q *queue) destroy() {
 	close(q.queueChan)
 }
+
+// commandQueue holds commands that could not be executed because no
+// connection was available. Commands are dequeued in the order in which they
+// were first enqueued, even if they are re-enqueued after failing to execute
+// again. Nodes signal waitChan when a queued command may be able to execute
+type commandQueue struct {
+	maxDepth uint16
+	seq      uint64
+	l        *list.List
+	waitChan chan struct{}
+	sync.Mutex
+}
+
+func newCommandQueue(maxDepth uint16) *commandQueue {
+	if maxDepth == 0 {
+		panic("[commandQueue] max depth must be greater than zero!")
+	}
+	return &commandQueue{
+		maxDepth: maxDepth,
+		l:        list.New(),
+		waitChan: make(chan struct{}, 1),
+	}
+}
+
+func (q *commandQueue) enqueue(async *Async) error {
+	if async == nil {
+		panic("attempt to enqueue nil value")
+	}
+	q.Lock()
+	defer q.Unlock()
+	if q.l.Len() >= int(q.maxDepth) {
+		return newClientError("attempt to enqueue when queue is full", nil)
+	}
+	if async.queueSeq == 0 {
+		q.seq++
+		async.queueSeq = q.seq
+		q.l.PushBack(async)
+		return nil
+	}
+	// NB: re-enqueued command, keep its original position
+	for e := q.l.Front(); e != nil; e = e.Next() {
+		if e.Value.(*Async).queueSeq > async.queueSeq {
+			q.l.InsertBefore(async, e)
+			return nil
+		}
+	}
+	q.l.PushBack(async)
+	return nil
+}
+
+// drain removes and returns all queued commands, oldest first
+func (q *commandQueue) drain() []*Async {
+	q.Lock()
+	defer q.Unlock()
+	if q.l.Len() == 0 {
+		return nil
+	}
+	asyncs := make([]*Async, 0, q.l.Len())
+	for e := q.l.Front(); e != nil; e = e.Next() {
+		asyncs = append(asyncs, e.Value.(*Async))
+	}
+	q.l.Init()
+	return asyncs
+}
+
+// dequeue removes and returns up to n of the oldest queued commands, oldest
+// first
+func (q *commandQueue) dequeue(n int) []*Async {
+	q.Lock()
+	defer q.Unlock()
+	if n > q.l.Len() {
+		n = q.l.Len()
+	}
+	if n <= 0 {
+		return nil
+	}
+	asyncs := make([]*Async, 0, n)
+	for len(asyncs) < n {
+		asyncs = append(asyncs, q.l.Remove(q.l.Front()).(*Async))
+	}
+	return asyncs
+}
+
+func (q *commandQueue) count() uint16 {
+	q.Lock()
+	defer q.Unlock()
+	return uint16(q.l.Len())
+}
@@ -92,3 +92,101 @@ func TestConcurrentIterateQueue(t *testing.T) {
 		t.Errorf("expected %v, got %v", expected, actual)
 	}
 }
+
+func TestCommandQueueDrainsInOrder(t *testing.T) {
+	q := newCommandQueue(3)
+	asyncs := []*Async{{}, {}, {}}
+	for _, a := range asyncs {
+		if err := q.enqueue(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.enqueue(&Async{}); err == nil {
+		t.Error("expected error when enqueuing to a full queue")
+	}
+	if expected, actual := uint16(3), q.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	drained := q.drain()
+	if expected, actual := len(asyncs), len(drained); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i, a := range asyncs {
+		if drained[i] != a {
+			t.Errorf("expected async %d at position %d", i, i)
+		}
+	}
+	if expected, actual := uint16(0), q.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if q.drain() != nil {
+		t.Error("expected nil when draining an empty queue")
+	}
+}
+
+func TestCommandQueueKeepsPositionOfReenqueuedCommands(t *testing.T) {
+	q := newCommandQueue(8)
+	first, second, third := &Async{}, &Async{}, &Async{}
+	for _, a := range []*Async{first, second, third} {
+		if err := q.enqueue(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.drain()
+
+	// NB: re-enqueued out of order, plus a command enqueued for the first time
+	fourth := &Async{}
+	for _, a := range []*Async{third, fourth, first, second} {
+		if err := q.enqueue(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []*Async{first, second, third, fourth}
+	drained := q.drain()
+	if len(expected) != len(drained) {
+		t.Fatalf("expected %v, got %v", len(expected), len(drained))
+	}
+	for i, a := range expected {
+		if drained[i] != a {
+			t.Errorf("unexpected async at position %d", i)
+		}
+	}
+}
+
+func TestCommandQueueDequeuesOldestCommands(t *testing.T) {
+	q := newCommandQueue(8)
+	asyncs := []*Async{{}, {}, {}, {}}
+	for _, a := range asyncs {
+		if err := q.enqueue(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.dequeue(0) != nil {
+		t.Error("expected nil when dequeuing no commands")
+	}
+	dequeued := q.dequeue(3)
+	if expected, actual := 3, len(dequeued); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i, a := range dequeued {
+		if asyncs[i] != a {
+			t.Errorf("unexpected async at position %d", i)
+		}
+	}
+
+	// NB: a dispatched command that is re-enqueued goes back before the rest
+	if err := q.enqueue(dequeued[1]); err != nil {
+		t.Fatal(err)
+	}
+	dequeued = q.dequeue(8)
+	if expected, actual := 2, len(dequeued); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if dequeued[0] != asyncs[1] || dequeued[1] != asyncs[3] {
+		t.Error("expected the re-enqueued command to be dequeued first")
+	}
+	if expected, actual := uint16(0), q.count(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package riakdebug provides an http.Handler that renders the state of a
+riak.Cluster - its nodes, connection pools and command queue - along with a
+trace of the most recently executed commands.
+
+	recorder := riakdebug.NewRecorder(512)
+	http.Handle("/debug/riak/", riakdebug.NewHandler(cluster, recorder))
+
+The handler responds with plain text by default, or JSON when the request
+includes format=json in its query string. Requests to a path ending in
+"/commands" only render the command trace.
+*/
+package riakdebug
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+// Handler is an http.Handler that renders the state of a Cluster
+type Handler struct {
+	cluster  *riak.Cluster
+	recorder *Recorder
+}
+
+// NewHandler returns a Handler for the provided Cluster. If recorder is
+// non-nil it is set as the Cluster's riak.CommandObserver and its traces are
+// included in the output
+func NewHandler(cluster *riak.Cluster, recorder *Recorder) *Handler {
+	if cluster == nil {
+		panic("[riakdebug] nil cluster argument")
+	}
+	if recorder != nil {
+		cluster.SetCommandObserver(recorder)
+	}
+	return &Handler{
+		cluster:  cluster,
+		recorder: recorder,
+	}
+}
+
+type commandView struct {
+	Command  string        `json:"command"`
+	Node     string        `json:"node,omitempty"`
+	Start    time.Time     `json:"start"`
+	Latency  time.Duration `json:"latency_ns"`
+	Attempts byte          `json:"attempts"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type stateView struct {
+	Cluster  *riak.ClusterStats `json:"cluster,omitempty"`
+	Commands []commandView      `json:"commands"`
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	view := &stateView{
+		Commands: h.commands(),
+	}
+	if !strings.HasSuffix(r.URL.Path, "/commands") {
+		view.Cluster = h.cluster.Stats()
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(view); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeText(w, view)
+}
+
+func (h *Handler) commands() []commandView {
+	if h.recorder == nil {
+		return []commandView{}
+	}
+	traces := h.recorder.Recent()
+	views := make([]commandView, len(traces))
+	for i, t := range traces {
+		views[i] = commandView{
+			Command:  t.Command,
+			Node:     t.Node,
+			Start:    t.Start,
+			Latency:  t.Duration,
+			Attempts: t.Attempts,
+		}
+		if t.Error != nil {
+			views[i].Error = t.Error.Error()
+		}
+	}
+	return views
+}
+
+func writeText(w io.Writer, view *stateView) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if cs := view.Cluster; cs != nil {
+		fmt.Fprintf(tw, "cluster\t%s\n", cs.State)
+		fmt.Fprintf(tw, "queue\t%d/%d\n\n", cs.QueueDepth, cs.QueueMaxDepth)
+		fmt.Fprintln(tw, "NODE\tSTATE\tOPEN\tAVAILABLE\tMIN\tMAX")
+		for _, ns := range cs.Nodes {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\n",
+				ns.Address, ns.State, ns.OpenConnections, ns.AvailableConnections,
+				ns.MinConnections, ns.MaxConnections)
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintln(tw, "START\tCOMMAND\tNODE\tLATENCY\tATTEMPTS\tERROR")
+	for _, cv := range view.Commands {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%d\t%s\n",
+			cv.Start.Format(time.RFC3339Nano), cv.Command, cv.Node, cv.Latency,
+			cv.Attempts, cv.Error)
+	}
+	tw.Flush()
+}
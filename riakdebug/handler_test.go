@@ -0,0 +1,135 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riakdebug
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+func newTestHandler(t *testing.T) *Handler {
+	node, err := riak.NewNode(&riak.NodeOptions{
+		RemoteAddress: "127.0.0.1:10017",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := riak.NewCluster(&riak.ClusterOptions{
+		Nodes: []*riak.Node{node},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := NewRecorder(8)
+	recorder.CommandExecuted(&riak.CommandTrace{
+		Command:  "FetchValue",
+		Node:     "127.0.0.1:10017",
+		Start:    time.Now(),
+		Duration: 5 * time.Millisecond,
+		Attempts: 1,
+	})
+	recorder.CommandExecuted(&riak.CommandTrace{
+		Command:  "StoreValue",
+		Start:    time.Now(),
+		Attempts: 3,
+		Error:    errors.New("no nodes"),
+	})
+	return NewHandler(cluster, recorder)
+}
+
+func TestHandlerRendersJSON(t *testing.T) {
+	h := newTestHandler(t)
+	req := httptest.NewRequest("GET", "/debug/riak/?format=json", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if expected, actual := http.StatusOK, rec.Code; expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "application/json", rec.Header().Get("Content-Type"); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	view := &stateView{}
+	if err := json.Unmarshal(rec.Body.Bytes(), view); err != nil {
+		t.Fatal(err)
+	}
+	if view.Cluster == nil {
+		t.Fatal("expected cluster stats")
+	}
+	if expected, actual := 1, len(view.Cluster.Nodes); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "127.0.0.1:10017", view.Cluster.Nodes[0].Address; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, len(view.Commands); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "StoreValue", view.Commands[0].Command; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "no nodes", view.Commands[0].Error; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 5*time.Millisecond, view.Commands[1].Latency; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestHandlerRendersCommandsOnly(t *testing.T) {
+	h := newTestHandler(t)
+	req := httptest.NewRequest("GET", "/debug/riak/commands?format=json", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	view := &stateView{}
+	if err := json.Unmarshal(rec.Body.Bytes(), view); err != nil {
+		t.Fatal(err)
+	}
+	if view.Cluster != nil {
+		t.Error("expected nil cluster stats")
+	}
+	if expected, actual := 2, len(view.Commands); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestHandlerRendersText(t *testing.T) {
+	h := newTestHandler(t)
+	req := httptest.NewRequest("GET", "/debug/riak/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	for _, s := range []string{"clusterCreated", "127.0.0.1:10017", "nodeCreated", "FetchValue", "no nodes"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected body to contain %q, got:\n%s", s, body)
+		}
+	}
+}
+
+func TestHandlerRejectsPost(t *testing.T) {
+	h := newTestHandler(t)
+	req := httptest.NewRequest("POST", "/debug/riak/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if expected, actual := http.StatusMethodNotAllowed, rec.Code; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
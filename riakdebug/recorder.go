@@ -0,0 +1,74 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riakdebug
+
+import (
+	"sync"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+const defaultRecorderSize = 256
+
+// Recorder is a riak.CommandObserver that keeps the last N command traces in a
+// ring buffer
+type Recorder struct {
+	traces []riak.CommandTrace
+	next   int
+	full   bool
+	sync.Mutex
+}
+
+// NewRecorder returns a Recorder that retains the given number of traces. If
+// size is zero, 256 traces are retained
+func NewRecorder(size int) *Recorder {
+	if size <= 0 {
+		size = defaultRecorderSize
+	}
+	return &Recorder{
+		traces: make([]riak.CommandTrace, size),
+	}
+}
+
+// CommandExecuted implements riak.CommandObserver
+func (r *Recorder) CommandExecuted(trace *riak.CommandTrace) {
+	r.Lock()
+	defer r.Unlock()
+	r.traces[r.next] = *trace
+	r.next++
+	if r.next == len(r.traces) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Recent returns the retained traces, most recent first
+func (r *Recorder) Recent() []riak.CommandTrace {
+	r.Lock()
+	defer r.Unlock()
+	count := r.next
+	if r.full {
+		count = len(r.traces)
+	}
+	recent := make([]riak.CommandTrace, count)
+	for i := 0; i < count; i++ {
+		idx := r.next - 1 - i
+		if idx < 0 {
+			idx += len(r.traces)
+		}
+		recent[i] = r.traces[idx]
+	}
+	return recent
+}
@@ -0,0 +1,50 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riakdebug
+
+import (
+	"fmt"
+	"testing"
+
+	riak "github.com/basho/riak-go-client"
+)
+
+func TestRecorderReturnsMostRecentFirst(t *testing.T) {
+	r := NewRecorder(3)
+	if expected, actual := 0, len(r.Recent()); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	for i := 0; i < 5; i++ {
+		r.CommandExecuted(&riak.CommandTrace{
+			Command: fmt.Sprintf("cmd-%d", i),
+		})
+	}
+	recent := r.Recent()
+	if expected, actual := 3, len(recent); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i, name := range []string{"cmd-4", "cmd-3", "cmd-2"} {
+		if expected, actual := name, recent[i].Command; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestRecorderDefaultSize(t *testing.T) {
+	r := NewRecorder(0)
+	if expected, actual := defaultRecorderSize, len(r.traces); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrSearchBulkExecutorRequired  = newClientError("[SearchBulkOperation] Executor is required", nil)
+	ErrSearchBulkIndexRequired     = newClientError("[SearchBulkOperation] Index is required", nil)
+	ErrSearchBulkQueryRequired     = newClientError("[SearchBulkOperation] Query is required", nil)
+	ErrSearchBulkTransformRequired = newClientError("[SearchBulkOperation] a transform is required", nil)
+	ErrSearchBulkSiblings          = newClientError("[SearchBulkOperation] object has siblings, set ConflictResolver", nil)
+	ErrSearchBulkDocumentID        = newClientError("[SearchBulkOperation] search results require _yz_id", nil)
+)
+
+// SearchBulkOptions configure a SearchBulkOperation. Index, Query,
+// FilterQuery and PageSize are used as for a SearchIterator
+type SearchBulkOptions struct {
+	Executor    CommandExecutor
+	Index       string
+	Query       string
+	FilterQuery string
+	PageSize    uint32
+	// Concurrency is the number of objects deleted or updated at once, by
+	// default 1
+	Concurrency int
+	// DryRun finds the objects that would be deleted or updated, and for
+	// Update fetches and transforms them, without writing anything
+	DryRun bool
+	// ConflictResolver is used when fetching objects for Update
+	ConflictResolver ConflictResolver
+	// OnProgress, if set, is called after each object
+	OnProgress func(progress *SearchBulkProgress)
+}
+
+// SearchBulkKey identifies an object found by a SearchBulkOperation
+type SearchBulkKey struct {
+	BucketType string
+	Bucket     string
+	Key        string
+}
+
+func (k SearchBulkKey) String() string {
+	return fmt.Sprintf("%s/%s/%s", k.BucketType, k.Bucket, k.Key)
+}
+
+// SearchBulkProgress is passed to SearchBulkOptions.OnProgress after each
+// object. Changed is true if the object was, or in a dry run would be,
+// deleted or updated
+type SearchBulkProgress struct {
+	Key       SearchBulkKey
+	Changed   bool
+	Err       error
+	Processed int
+	Total     int
+}
+
+// SearchBulkError is the error for one object of a SearchBulkOperation
+type SearchBulkError struct {
+	Key        SearchBulkKey
+	InnerError error
+}
+
+func (e *SearchBulkError) Error() string {
+	return fmt.Sprintf("SearchBulkError|%v|%v", e.Key, e.InnerError)
+}
+
+// SearchBulkResult contains the outcome of SearchBulkOperation.Delete or
+// Update. Matched is the number of objects found by the search; Changed
+// those deleted or updated, or that would be in a dry run; Unchanged those
+// the transform left as they were or that no longer exist
+type SearchBulkResult struct {
+	Matched   int
+	Changed   int
+	Unchanged int
+	Errors    []*SearchBulkError
+}
+
+// SearchBulkTransform returns the updated object, or nil to leave it
+// unchanged. The object may be modified and returned; its vclock is used if
+// the returned object has none
+type SearchBulkTransform func(object *Object) (*Object, error)
+
+// SearchBulkOperation deletes or updates every KV object matching a search
+// query:
+//
+//	op, err := riak.NewSearchBulkOperation(&riak.SearchBulkOptions{
+//		Executor:    cluster,
+//		Index:       "sessions",
+//		Query:       riak.SearchTerm("status_s", "expired").String(),
+//		Concurrency: 8,
+//		OnProgress: func(p *riak.SearchBulkProgress) {
+//			log.Printf("%d/%d %v", p.Processed, p.Total, p.Key)
+//		},
+//	})
+//	result, err := op.Delete()
+//
+// The keys of the matching objects are collected before any is changed, so
+// that deletes and updates, which change the search results once Solr
+// commits them, do not cause documents to be skipped. Each page is requested
+// from the start of the results sorted by _yz_id, filtered to the documents
+// after the last one seen, so unlike a SearchIterator there is no MaxStart
+// limit on the number of objects. Siblings indexed as separate documents are
+// processed once. Objects are not checked against the query again before
+// they are changed.
+type SearchBulkOperation struct {
+	options *SearchBulkOptions
+}
+
+// NewSearchBulkOperation returns a SearchBulkOperation for the provided
+// options
+func NewSearchBulkOperation(options *SearchBulkOptions) (*SearchBulkOperation, error) {
+	if options == nil {
+		return nil, ErrOptionsRequired
+	}
+	if options.Executor == nil {
+		return nil, ErrSearchBulkExecutorRequired
+	}
+	if options.Index == "" {
+		return nil, ErrSearchBulkIndexRequired
+	}
+	if options.Query == "" {
+		return nil, ErrSearchBulkQueryRequired
+	}
+	o := *options
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	return &SearchBulkOperation{
+		options: &o,
+	}, nil
+}
+
+// Keys returns the keys of the objects matching the query, without
+// duplicates
+func (op *SearchBulkOperation) Keys() ([]SearchBulkKey, error) {
+	pageSize := op.options.PageSize
+	if pageSize == 0 {
+		pageSize = defaultSearchIteratorPageSize
+	}
+	var keys []SearchBulkKey
+	seen := make(map[SearchBulkKey]bool)
+	lastID := ""
+	for {
+		builder := NewSearchCommandBuilder().
+			WithIndexName(op.options.Index).
+			WithQuery(op.options.Query).
+			WithNumRows(pageSize).
+			WithReturnFields(SearchSchemaUniqueKey, yzBucketTypeFld, yzBucketFld, yzKeyFld).
+			WithSortField(SearchSchemaUniqueKey + " asc")
+		if filterQuery := op.filterQuery(lastID); filterQuery != "" {
+			builder = builder.WithFilterQuery(filterQuery)
+		}
+		cmd, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		if err = op.options.Executor.Execute(cmd); err != nil {
+			return nil, err
+		}
+		docs := cmd.(*SearchCommand).Response.Docs
+		for _, doc := range docs {
+			// NB: without _yz_id the next page would repeat this one
+			if doc.Id == "" {
+				return nil, ErrSearchBulkDocumentID
+			}
+			lastID = doc.Id
+			key := SearchBulkKey{BucketType: doc.BucketType, Bucket: doc.Bucket, Key: doc.Key}
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		if uint32(len(docs)) < pageSize {
+			return keys, nil
+		}
+	}
+}
+
+// filterQuery returns FilterQuery restricted to the documents after lastID
+func (op *SearchBulkOperation) filterQuery(lastID string) string {
+	if lastID == "" {
+		return op.options.FilterQuery
+	}
+	after := SearchRange(SearchSchemaUniqueKey, lastID, nil, false)
+	if op.options.FilterQuery == "" {
+		return after.String()
+	}
+	return SearchAnd(searchQuery("("+op.options.FilterQuery+")"), after).String()
+}
+
+// Delete deletes every object matching the query. Errors for individual
+// objects are returned in the result; an error is only returned if the
+// search failed, in which case nothing is deleted
+func (op *SearchBulkOperation) Delete() (*SearchBulkResult, error) {
+	return op.run(op.delete)
+}
+
+// Update fetches every object matching the query, applies transform and
+// stores the objects it returns. Errors for individual objects, including
+// those returned by transform, are returned in the result; an error is only
+// returned if the search failed, in which case nothing is updated
+func (op *SearchBulkOperation) Update(transform SearchBulkTransform) (*SearchBulkResult, error) {
+	if transform == nil {
+		return nil, ErrSearchBulkTransformRequired
+	}
+	return op.run(func(key SearchBulkKey) (bool, error) {
+		return op.update(key, transform)
+	})
+}
+
+func (op *SearchBulkOperation) run(f func(key SearchBulkKey) (bool, error)) (*SearchBulkResult, error) {
+	keys, err := op.Keys()
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchBulkResult{
+		Matched: len(keys),
+	}
+	var mutex sync.Mutex
+	keyChan := make(chan SearchBulkKey)
+	var wg sync.WaitGroup
+	for i := 0; i < op.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keyChan {
+				changed, err := f(key)
+				mutex.Lock()
+				switch {
+				case err != nil:
+					logError("[SearchBulkOperation]", "could not process %v: %v", key, err)
+					result.Errors = append(result.Errors, &SearchBulkError{Key: key, InnerError: err})
+				case changed:
+					result.Changed++
+				default:
+					result.Unchanged++
+				}
+				if op.options.OnProgress != nil {
+					op.options.OnProgress(&SearchBulkProgress{
+						Key:       key,
+						Changed:   changed,
+						Err:       err,
+						Processed: result.Changed + result.Unchanged + len(result.Errors),
+						Total:     len(keys),
+					})
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		keyChan <- key
+	}
+	close(keyChan)
+	wg.Wait()
+	return result, nil
+}
+
+func (op *SearchBulkOperation) delete(key SearchBulkKey) (bool, error) {
+	if op.options.DryRun {
+		return true, nil
+	}
+	cmd, err := NewDeleteValueCommandBuilder().
+		WithBucketType(key.BucketType).
+		WithBucket(key.Bucket).
+		WithKey(key.Key).
+		Build()
+	if err != nil {
+		return false, err
+	}
+	if err = op.options.Executor.Execute(cmd); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (op *SearchBulkOperation) update(key SearchBulkKey, transform SearchBulkTransform) (bool, error) {
+	builder := NewFetchValueCommandBuilder().
+		WithBucketType(key.BucketType).
+		WithBucket(key.Bucket).
+		WithKey(key.Key)
+	if op.options.ConflictResolver != nil {
+		builder = builder.WithConflictResolver(op.options.ConflictResolver)
+	}
+	cmd, err := builder.Build()
+	if err != nil {
+		return false, err
+	}
+	if err = op.options.Executor.Execute(cmd); err != nil {
+		return false, err
+	}
+	rsp := cmd.(*FetchValueCommand).Response
+	if rsp == nil || rsp.IsNotFound || len(rsp.Values) == 0 || (len(rsp.Values) == 1 && rsp.Values[0].IsTombstone) {
+		return false, nil
+	}
+	if len(rsp.Values) > 1 {
+		return false, ErrSearchBulkSiblings
+	}
+	current := rsp.Values[0]
+	vclock := current.VClock
+	if vclock == nil {
+		vclock = rsp.VClock
+	}
+	updated, err := transform(current)
+	if err != nil || updated == nil {
+		return false, err
+	}
+	if op.options.DryRun {
+		return true, nil
+	}
+	storeBuilder := NewStoreValueCommandBuilder().
+		WithContent(updated).
+		WithBucketType(key.BucketType).
+		WithBucket(key.Bucket).
+		WithKey(key.Key)
+	if updated.VClock == nil {
+		storeBuilder = storeBuilder.WithVClock(vclock)
+	}
+	storeCmd, err := storeBuilder.Build()
+	if err != nil {
+		return false, err
+	}
+	if err = op.options.Executor.Execute(storeCmd); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,285 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSearchBulkDelete(t *testing.T) {
+	executor := newTestSearchExecutor(7)
+	// NB: siblings are indexed as separate documents with the same key
+	executor.docs = append(executor.docs, &SearchDoc{BucketType: "default", Bucket: "users", Key: "user_3", Id: "99999*default*users*user_3"})
+	executor.failKey = "user_5"
+	var progress []*SearchBulkProgress
+	op, err := NewSearchBulkOperation(&SearchBulkOptions{
+		Executor:    executor,
+		Index:       "users",
+		Query:       SearchTerm("status_s", "expired").String(),
+		PageSize:    3,
+		Concurrency: 4,
+		OnProgress: func(p *SearchBulkProgress) {
+			progress = append(progress, p)
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	result, err := op.Delete()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected, actual := 7, result.Matched; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 6, result.Changed; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 1, len(result.Errors); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "SearchBulkError|default/users/user_5|write failed", result.Errors[0].Error(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	sort.Strings(executor.deleted)
+	if expected, actual := "default/users/user_0", executor.deleted[0]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 6, len(executor.deleted); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	fields := "_yz_id,_yz_rt,_yz_rb,_yz_rk _yz_id asc"
+	if expected, actual := []string{fields, fields, fields}, executor.fields; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 7, len(progress); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i, p := range progress {
+		if expected, actual := i+1, p.Processed; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if expected, actual := 7, p.Total; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if expected, actual := p.Key.Key != "user_5", p.Changed; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestSearchBulkDeletePagesByID(t *testing.T) {
+	// NB: more documents than the default SearchIterator MaxStart
+	executor := newTestSearchExecutor(defaultSearchIteratorMaxStart + 5)
+	op, _ := NewSearchBulkOperation(&SearchBulkOptions{
+		Executor:    executor,
+		Index:       "users",
+		Query:       "*:*",
+		FilterQuery: "status_s:expired OR status_s:revoked",
+		PageSize:    1000,
+	})
+	result, err := op.Delete()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected, actual := defaultSearchIteratorMaxStart+5, result.Changed; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 11, len(executor.searches); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for _, start := range executor.searches {
+		if start != 0 {
+			t.Errorf("expected every search to start at 0, got %v", start)
+		}
+	}
+	if expected, actual := "status_s:expired OR status_s:revoked", executor.filters[0]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := `((status_s:expired OR status_s:revoked) AND _yz_id:{00999\*default\*users\*user_999 TO *})`, executor.filters[1]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	executor = newTestSearchExecutor(2)
+	executor.docs[1].Id = ""
+	op, _ = NewSearchBulkOperation(&SearchBulkOptions{Executor: executor, Index: "users", Query: "*:*"})
+	if _, err = op.Delete(); err != ErrSearchBulkDocumentID {
+		t.Errorf("expected %v, got %v", ErrSearchBulkDocumentID, err)
+	}
+}
+
+func TestSearchBulkDeleteDryRun(t *testing.T) {
+	executor := newTestSearchExecutor(5)
+	op, _ := NewSearchBulkOperation(&SearchBulkOptions{
+		Executor: executor,
+		Index:    "users",
+		Query:    "*:*",
+		DryRun:   true,
+	})
+	result, err := op.Delete()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected, actual := 5, result.Changed; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 0, len(executor.deleted); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSearchBulkUpdate(t *testing.T) {
+	executor := newTestSearchExecutor(6)
+	executor.failKey = "user_4"
+	executor.objects["user_3"] = []*Object{{Key: "user_3", IsTombstone: true}}
+	op, _ := NewSearchBulkOperation(&SearchBulkOptions{
+		Executor:    executor,
+		Index:       "users",
+		Query:       "*:*",
+		Concurrency: 2,
+	})
+	transformErr := errors.New("transform failed")
+	result, err := op.Update(func(o *Object) (*Object, error) {
+		switch o.Key {
+		case "user_0":
+			o.Value = []byte("expired")
+			return o, nil
+		case "user_2":
+			return &Object{Key: "other", Value: []byte("replaced"), ContentType: "text/plain"}, nil
+		case "user_5":
+			return nil, transformErr
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected, actual := 6, result.Matched; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, result.Changed; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, result.Unchanged; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, len(result.Errors); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	for _, e := range result.Errors {
+		if e.Key.Key == "user_5" && e.InnerError != transformErr {
+			t.Errorf("expected %v, got %v", transformErr, e.InnerError)
+		}
+	}
+
+	store := executor.stored["user_0"]
+	if store == nil {
+		t.Fatal("expected user_0 to be stored")
+	}
+	if expected, actual := "expired", string(store.value.Value); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "vclock_user_0", string(store.protobuf.Vclock); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	store = executor.stored["user_2"]
+	if store == nil {
+		t.Fatal("expected user_2 to be stored at its own key")
+	}
+	if expected, actual := "vclock_user_2", string(store.protobuf.Vclock); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "default/users", string(store.protobuf.Type)+"/"+string(store.protobuf.Bucket); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, len(executor.stored); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSearchBulkUpdateSiblings(t *testing.T) {
+	executor := newTestSearchExecutor(1)
+	executor.objects["user_0"] = append(executor.objects["user_0"], &Object{Key: "user_0", Value: []byte("sibling")})
+	transform := func(o *Object) (*Object, error) {
+		o.Value = []byte("updated")
+		return o, nil
+	}
+	op, _ := NewSearchBulkOperation(&SearchBulkOptions{Executor: executor, Index: "users", Query: "*:*"})
+	result, _ := op.Update(transform)
+	if expected, actual := 1, len(result.Errors); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := ErrSearchBulkSiblings, result.Errors[0].InnerError; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	op, _ = NewSearchBulkOperation(&SearchBulkOptions{
+		Executor:         executor,
+		Index:            "users",
+		Query:            "*:*",
+		ConflictResolver: &testFirstSiblingResolver{},
+		DryRun:           true,
+	})
+	result, _ = op.Update(transform)
+	if expected, actual := 1, result.Changed; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 0, len(executor.stored); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+type testFirstSiblingResolver struct{}
+
+func (r *testFirstSiblingResolver) Resolve(objs []*Object) []*Object {
+	return objs[:1]
+}
+
+func TestSearchBulkSearchError(t *testing.T) {
+	executor := newTestSearchExecutor(3)
+	executor.fail = true
+	op, _ := NewSearchBulkOperation(&SearchBulkOptions{Executor: executor, Index: "users", Query: "*:*"})
+	if _, err := op.Delete(); err != errTestSearchFailed {
+		t.Errorf("expected %v, got %v", errTestSearchFailed, err)
+	}
+	if expected, actual := 0, len(executor.deleted); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestNewSearchBulkOperationErrors(t *testing.T) {
+	executor := newTestSearchExecutor(0)
+	tests := []struct {
+		options  *SearchBulkOptions
+		expected error
+	}{
+		{nil, ErrOptionsRequired},
+		{&SearchBulkOptions{Index: "i", Query: "q"}, ErrSearchBulkExecutorRequired},
+		{&SearchBulkOptions{Executor: executor, Query: "q"}, ErrSearchBulkIndexRequired},
+		{&SearchBulkOptions{Executor: executor, Index: "i"}, ErrSearchBulkQueryRequired},
+	}
+	for _, tt := range tests {
+		if _, err := NewSearchBulkOperation(tt.options); err != tt.expected {
+			t.Errorf("expected %v, got %v", tt.expected, err)
+		}
+	}
+	op, _ := NewSearchBulkOperation(&SearchBulkOptions{Executor: executor, Index: "i", Query: "q"})
+	if _, err := op.Update(nil); err != ErrSearchBulkTransformRequired {
+		t.Errorf("expected %v, got %v", ErrSearchBulkTransformRequired, err)
+	}
+}
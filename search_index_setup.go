@@ -0,0 +1,218 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	ErrSearchIndexSetupClusterRequired = newClientError("[SearchIndexSetup] Cluster is required", nil)
+	ErrSearchIndexSetupIndexRequired   = newClientError("[SearchIndexSetup] Index is required", nil)
+	ErrSearchIndexSetupBucketRequired  = newClientError("[SearchIndexSetup] BucketType or Bucket is required", nil)
+)
+
+const (
+	defaultSearchIndexTimeout      = 60 * time.Second
+	defaultSearchIndexPollInterval = 500 * time.Millisecond
+)
+
+// SearchIndexSetupOptions are the options for SetupSearchIndex. Schema, when
+// set, is stored and used for the index; otherwise SchemaName names an
+// existing schema and defaults to _yz_default. When Bucket is empty the
+// search_index property is set on BucketType, which defaults to "default".
+// Timeout (default 60s) limits the time spent waiting for the index to be
+// available on every node, which is polled every PollInterval (default 500ms)
+type SearchIndexSetupOptions struct {
+	Cluster      *Cluster
+	Schema       *SearchSchema
+	SchemaName   string
+	Index        string
+	NVal         uint32
+	BucketType   string
+	Bucket       string
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// SetupSearchIndex stores a schema and index, waits until the index is
+// available on every node of the cluster, then sets the search_index property
+// of the bucket or bucket type. Yokozuna creates indexes asynchronously on
+// each node, and setting search_index fails until they exist:
+//
+//	changes, err := riak.SetupSearchIndex(&riak.SearchIndexSetupOptions{
+//		Cluster:    cluster,
+//		Schema:     schema,
+//		Index:      "users",
+//		BucketType: "maps",
+//		Bucket:     "users",
+//	})
+//
+// As with BucketSchemaConfig.Apply, only objects that differ from Riak are
+// written and the changes made are returned, so that it can be run each time
+// an application starts
+func SetupSearchIndex(options *SearchIndexSetupOptions) ([]*BucketSchemaChange, error) {
+	if options == nil || options.Cluster == nil {
+		return nil, ErrSearchIndexSetupClusterRequired
+	}
+	return setupSearchIndex(options, options.Cluster, options.Cluster.nodeExecutors)
+}
+
+func setupSearchIndex(options *SearchIndexSetupOptions, executor CommandExecutor, nodes func() []CommandExecutor) ([]*BucketSchemaChange, error) {
+	o := *options
+	if o.Index == "" {
+		return nil, ErrSearchIndexSetupIndexRequired
+	}
+	if o.BucketType == "" && o.Bucket == "" {
+		return nil, ErrSearchIndexSetupBucketRequired
+	}
+	if o.BucketType == "" {
+		o.BucketType = defaultBucketType
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultSearchIndexTimeout
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultSearchIndexPollInterval
+	}
+
+	index := &SearchIndexDefinition{Name: o.Index, Schema: o.SchemaName}
+	if o.NVal > 0 {
+		index.NVal = &o.NVal
+	}
+	config := &BucketSchemaConfig{Indexes: []*SearchIndexDefinition{index}}
+	if o.Schema != nil {
+		content, err := o.Schema.XML()
+		if err != nil {
+			return nil, err
+		}
+		config.Schemas = []*SearchSchemaDefinition{{Name: o.Schema.Name, Content: content}}
+		index.Schema = o.Schema.Name
+	}
+	applied, err := config.Apply(executor)
+	if err != nil {
+		return applied, err
+	}
+	if err = waitForSearchIndex(nodes(), o.Index, o.Timeout, o.PollInterval); err != nil {
+		return applied, err
+	}
+
+	props := &BucketProps{SearchIndex: &o.Index}
+	bucketType := &BucketTypeDefinition{Name: o.BucketType}
+	if o.Bucket == "" {
+		bucketType.Props = props
+	} else {
+		bucketType.Buckets = []*BucketDefinition{{Name: o.Bucket, Props: props}}
+	}
+	config = &BucketSchemaConfig{BucketTypes: []*BucketTypeDefinition{bucketType}}
+	changes, err := config.Apply(executor)
+	return append(applied, changes...), err
+}
+
+// WaitForSearchIndex waits until index is available on every node of the
+// cluster, for instance after executing a StoreIndexCommand. A timeout of 0
+// waits for up to 60s
+func (c *Cluster) WaitForSearchIndex(index string, timeout time.Duration) error {
+	if index == "" {
+		return ErrSearchIndexSetupIndexRequired
+	}
+	if timeout <= 0 {
+		timeout = defaultSearchIndexTimeout
+	}
+	return waitForSearchIndex(c.nodeExecutors(), index, timeout, defaultSearchIndexPollInterval)
+}
+
+// waitForSearchIndex polls each node until it returns index or timeout
+// elapses. Nodes that have the index are not polled again
+func waitForSearchIndex(nodes []CommandExecutor, index string, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for {
+		var pending []CommandExecutor
+		for _, node := range nodes {
+			found, err := searchIndexExists(node, index)
+			if err != nil {
+				logDebug("[SearchIndexSetup]", "could not fetch index %s from %v: %v", index, node, err)
+				lastErr = err
+			}
+			if !found {
+				pending = append(pending, node)
+			}
+		}
+		if len(pending) == 0 {
+			logDebug("[SearchIndexSetup]", "index %s is available on every node", index)
+			return nil
+		}
+		if !time.Now().Add(interval).Before(deadline) {
+			return newClientError(fmt.Sprintf("[SearchIndexSetup] index %s is not available on %v after %v", index, pending, timeout), lastErr)
+		}
+		nodes = pending
+		time.Sleep(interval)
+	}
+}
+
+func searchIndexExists(executor CommandExecutor, index string) (bool, error) {
+	cmd, err := NewFetchIndexCommandBuilder().
+		WithIndexName(index).
+		Build()
+	if err != nil {
+		return false, err
+	}
+	if err = executor.Execute(cmd); err != nil {
+		if isNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, i := range cmd.(*FetchIndexCommand).Response {
+		if i.Name == index {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nodeExecutor executes commands on a single node, without the retries
+// and queueing of a Cluster
+type nodeExecutor struct {
+	node *Node
+}
+
+func (e *nodeExecutor) Execute(cmd Command) error {
+	executed, err := e.node.execute(cmd)
+	if err != nil {
+		return err
+	}
+	if !executed {
+		return newClientError(fmt.Sprintf("[Node] (%v) could not execute command '%s'", e.node, cmd.Name()), nil)
+	}
+	return cmd.Error()
+}
+
+func (e *nodeExecutor) String() string {
+	return e.node.String()
+}
+
+// nodeExecutors returns an executor for each node of the cluster
+func (c *Cluster) nodeExecutors() []CommandExecutor {
+	c.Lock()
+	defer c.Unlock()
+	executors := make([]CommandExecutor, len(c.nodes))
+	for i, node := range c.nodes {
+		executors[i] = &nodeExecutor{node: node}
+	}
+	return executors
+}
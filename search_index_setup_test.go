@@ -0,0 +1,217 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testIndexNodeExecutor answers FetchIndexCommand with notfound until it has
+// been polled readyAfter times
+type testIndexNodeExecutor struct {
+	name       string
+	readyAfter int
+	err        error
+	polls      int
+	sync.Mutex
+}
+
+func (e *testIndexNodeExecutor) Execute(cmd Command) error {
+	e.Lock()
+	defer e.Unlock()
+	e.polls++
+	if e.err != nil {
+		return e.err
+	}
+	if e.readyAfter < 0 || e.polls <= e.readyAfter {
+		return RiakError{Errmsg: "notfound"}
+	}
+	c := cmd.(*FetchIndexCommand)
+	c.Response = []*SearchIndex{{Name: string(c.protobuf.Name), Schema: defaultSearchSchema, NVal: 3}}
+	return nil
+}
+
+func (e *testIndexNodeExecutor) String() string {
+	return e.name
+}
+
+func TestWaitForSearchIndex(t *testing.T) {
+	nodes := []*testIndexNodeExecutor{
+		{name: "node1", readyAfter: 0},
+		{name: "node2", readyAfter: 2},
+		{name: "node3", readyAfter: 1},
+	}
+	executors := make([]CommandExecutor, len(nodes))
+	for i, n := range nodes {
+		executors[i] = n
+	}
+	if err := waitForSearchIndex(executors, "users", time.Second, time.Millisecond); err != nil {
+		t.Fatal(err.Error())
+	}
+	for i, expected := range []int{1, 3, 2} {
+		if actual := nodes[i].polls; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestWaitForSearchIndexTimeout(t *testing.T) {
+	down := errors.New("connection refused")
+	executors := []CommandExecutor{
+		&testIndexNodeExecutor{name: "node1"},
+		&testIndexNodeExecutor{name: "node2", readyAfter: -1},
+		&testIndexNodeExecutor{name: "node3", err: down},
+	}
+	start := time.Now()
+	err := waitForSearchIndex(executors, "users", 50*time.Millisecond, 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected to give up after the timeout, took %v", elapsed)
+	}
+	if !strings.Contains(err.Error(), "index users is not available on [node2 node3] after 50ms") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if expected, actual := down, err.(ClientError).InnerError; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSetupSearchIndex(t *testing.T) {
+	executor := newTestBucketSchemaExecutor()
+	executor.bucketTypes["maps"] = &FetchBucketPropsResponse{NVal: 3}
+	node := &testIndexNodeExecutor{name: "node1", readyAfter: 1}
+	schema := newTestSearchSchema()
+	changes, err := setupSearchIndex(&SearchIndexSetupOptions{
+		Schema:       schema,
+		SchemaName:   "ignored",
+		Index:        "users_idx",
+		NVal:         5,
+		BucketType:   "maps",
+		Bucket:       "users",
+		PollInterval: time.Millisecond,
+	}, executor, func() []CommandExecutor { return []CommandExecutor{node} })
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected, actual := 3, len(changes); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "bucket maps/users: search_index \"\" -> \"users_idx\"", changes[2].String(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 2, node.polls; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 3, len(executor.stored); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	content, _ := schema.XML()
+	storeSchema := executor.stored[0].(*StoreSchemaCommand).protobuf
+	if expected, actual := "users", string(storeSchema.Schema.Name); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := content, string(storeSchema.Schema.Content); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	storeIndex := executor.stored[1].(*StoreIndexCommand).protobuf
+	if expected, actual := "users", string(storeIndex.Index.Schema); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint32(5), storeIndex.Index.GetNVal(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	storeBucket := executor.stored[2].(*StoreBucketPropsCommand).protobuf
+	if expected, actual := "maps/users", string(storeBucket.Type)+"/"+string(storeBucket.Bucket); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "users_idx", string(storeBucket.Props.SearchIndex); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSetupSearchIndexExisting(t *testing.T) {
+	index := "animals"
+	executor := newTestBucketSchemaExecutor()
+	executor.indexes[index] = &SearchIndex{Name: index, Schema: defaultSearchSchema, NVal: 3}
+	executor.bucketTypes[defaultBucketType] = &FetchBucketPropsResponse{NVal: 3, SearchIndex: index}
+	node := &testIndexNodeExecutor{name: "node1"}
+	changes, err := setupSearchIndex(&SearchIndexSetupOptions{
+		Index:      index,
+		BucketType: defaultBucketType,
+	}, executor, func() []CommandExecutor { return []CommandExecutor{node} })
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected, actual := 0, len(changes); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 0, len(executor.stored); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	executor.indexes[index].Schema = "other"
+	if _, err = setupSearchIndex(&SearchIndexSetupOptions{Index: index, Bucket: "cats"}, executor, nil); err == nil {
+		t.Error("expected an error for an index with a different schema")
+	}
+}
+
+func TestSetupSearchIndexOptions(t *testing.T) {
+	if _, err := SetupSearchIndex(nil); err != ErrSearchIndexSetupClusterRequired {
+		t.Errorf("expected %v, got %v", ErrSearchIndexSetupClusterRequired, err)
+	}
+	executor := newTestBucketSchemaExecutor()
+	if _, err := setupSearchIndex(&SearchIndexSetupOptions{Bucket: "b"}, executor, nil); err != ErrSearchIndexSetupIndexRequired {
+		t.Errorf("expected %v, got %v", ErrSearchIndexSetupIndexRequired, err)
+	}
+	if _, err := setupSearchIndex(&SearchIndexSetupOptions{Index: "i"}, executor, nil); err != ErrSearchIndexSetupBucketRequired {
+		t.Errorf("expected %v, got %v", ErrSearchIndexSetupBucketRequired, err)
+	}
+	invalid := newTestSearchSchema()
+	invalid.UniqueKey = "id"
+	if _, err := setupSearchIndex(&SearchIndexSetupOptions{Index: "i", Bucket: "b", Schema: invalid}, executor, nil); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+	if expected, actual := 0, len(executor.stored); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestClusterNodeExecutors(t *testing.T) {
+	node, err := NewNode(&NodeOptions{RemoteAddress: "127.0.0.1:8098"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cluster, err := NewCluster(&ClusterOptions{Nodes: []*Node{node}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	executors := cluster.nodeExecutors()
+	if expected, actual := 1, len(executors); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	// NB: the node has not been started so cannot execute the command
+	if err := executors[0].Execute(&PingCommand{}); err == nil {
+		t.Error("expected an error from a node that is not running")
+	}
+	if err := cluster.WaitForSearchIndex("", 0); err != ErrSearchIndexSetupIndexRequired {
+		t.Errorf("expected %v, got %v", ErrSearchIndexSetupIndexRequired, err)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSearchIteratorPageSize = 100
+	defaultSearchIteratorMaxStart = 10000
+)
+
+var (
+	ErrSearchIteratorExecutorRequired = newClientError("[SearchIterator] Executor is required", nil)
+	ErrSearchIteratorIndexRequired    = newClientError("[SearchIterator] Index is required", nil)
+	ErrSearchIteratorQueryRequired    = newClientError("[SearchIterator] Query is required", nil)
+	ErrSearchIteratorDeepPaging       = newClientError("[SearchIterator] more results exist beyond MaxStart, narrow the query", nil)
+)
+
+// SearchIteratorOptions configure a SearchIterator
+type SearchIteratorOptions struct {
+	Executor         CommandExecutor
+	Index            string
+	Query            string
+	FilterQuery      string
+	DefaultField     string
+	DefaultOperation string
+	ReturnFields     []string
+	// SortField should give a stable order, such as "_yz_id asc", so that
+	// pages neither skip nor repeat documents
+	SortField string
+	// PageSize is the number of documents fetched by each search, by
+	// default 100
+	PageSize uint32
+	// Start is the position of the first document, such as the Cursor of
+	// an earlier iterator
+	Start uint32
+	// MaxStart limits how deep the iterator pages, since Solr must collect
+	// every preceding document for each page. Iteration stops with
+	// ErrSearchIteratorDeepPaging if documents remain at MaxStart, or if
+	// Start is already at MaxStart. By default 10000
+	MaxStart uint32
+	// FetchObjects fetches the KV object for each document, available from
+	// Values
+	FetchObjects bool
+	// ConflictResolver is used when fetching objects
+	ConflictResolver ConflictResolver
+}
+
+// SearchIterator pages through the documents matching a search query
+//
+//	it, err := riak.NewSearchIterator(&riak.SearchIteratorOptions{
+//		Executor:  cluster,
+//		Index:     "users",
+//		Query:     "age_i:[30 TO *]",
+//		SortField: "_yz_id asc",
+//	})
+//	for it.Next() {
+//		var user User
+//		if err := it.Doc().Decode(&user); err != nil {
+//			return err
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type SearchIterator struct {
+	options  *SearchIteratorOptions
+	start    uint32
+	numFound uint32
+	searched bool
+	page     []*SearchDoc
+	index    int
+	done     bool
+	doc      *SearchDoc
+	values   []*Object
+	err      error
+}
+
+// NewSearchIterator returns a SearchIterator for the provided options. No
+// search is executed until Next is called
+func NewSearchIterator(options *SearchIteratorOptions) (*SearchIterator, error) {
+	if options == nil {
+		return nil, ErrOptionsRequired
+	}
+	if options.Executor == nil {
+		return nil, ErrSearchIteratorExecutorRequired
+	}
+	if options.Index == "" {
+		return nil, ErrSearchIteratorIndexRequired
+	}
+	if options.Query == "" {
+		return nil, ErrSearchIteratorQueryRequired
+	}
+	o := *options
+	if o.PageSize == 0 {
+		o.PageSize = defaultSearchIteratorPageSize
+	}
+	if o.MaxStart == 0 {
+		o.MaxStart = defaultSearchIteratorMaxStart
+	}
+	return &SearchIterator{
+		options: &o,
+		start:   o.Start,
+	}, nil
+}
+
+// Next advances to the next document, returning false when there are no
+// more documents or an error occurred
+func (it *SearchIterator) Next() bool {
+	it.doc = nil
+	it.values = nil
+	if it.err != nil {
+		return false
+	}
+	if it.index >= len(it.page) {
+		if it.done {
+			return false
+		}
+		if err := it.fetchPage(); err != nil {
+			it.err = err
+			return false
+		}
+		if len(it.page) == 0 {
+			return false
+		}
+	}
+	doc := it.page[it.index]
+	if it.options.FetchObjects {
+		values, err := it.fetchValues(doc)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.values = values
+	}
+	it.index++
+	it.start++
+	it.doc = doc
+	return true
+}
+
+func (it *SearchIterator) fetchPage() error {
+	it.page = nil
+	it.index = 0
+	if it.start >= it.options.MaxStart {
+		it.done = true
+		// NB: numFound is unknown to an iterator resumed at MaxStart
+		if !it.searched || it.start < it.numFound {
+			return ErrSearchIteratorDeepPaging
+		}
+		return nil
+	}
+	rows := it.options.PageSize
+	if remaining := it.options.MaxStart - it.start; rows > remaining {
+		rows = remaining
+	}
+	builder := NewSearchCommandBuilder().
+		WithIndexName(it.options.Index).
+		WithQuery(it.options.Query).
+		WithStart(it.start).
+		WithNumRows(rows)
+	if it.options.FilterQuery != "" {
+		builder = builder.WithFilterQuery(it.options.FilterQuery)
+	}
+	if it.options.DefaultField != "" {
+		builder = builder.WithDefaultField(it.options.DefaultField)
+	}
+	if it.options.DefaultOperation != "" {
+		builder = builder.WithDefaultOperation(it.options.DefaultOperation)
+	}
+	if len(it.options.ReturnFields) > 0 {
+		builder = builder.WithReturnFields(it.options.ReturnFields...)
+	}
+	if it.options.SortField != "" {
+		builder = builder.WithSortField(it.options.SortField)
+	}
+	cmd, err := builder.Build()
+	if err != nil {
+		return err
+	}
+	if err = it.options.Executor.Execute(cmd); err != nil {
+		return err
+	}
+	rsp := cmd.(*SearchCommand).Response
+	it.searched = true
+	it.numFound = rsp.NumFound
+	it.page = rsp.Docs
+	if uint32(len(it.page)) < rows || it.start+uint32(len(it.page)) >= it.numFound {
+		it.done = true
+	}
+	return nil
+}
+
+func (it *SearchIterator) fetchValues(doc *SearchDoc) ([]*Object, error) {
+	builder := NewFetchValueCommandBuilder().
+		WithBucketType(doc.BucketType).
+		WithBucket(doc.Bucket).
+		WithKey(doc.Key)
+	if it.options.ConflictResolver != nil {
+		builder = builder.WithConflictResolver(it.options.ConflictResolver)
+	}
+	cmd, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	if err = it.options.Executor.Execute(cmd); err != nil {
+		return nil, err
+	}
+	rsp := cmd.(*FetchValueCommand).Response
+	if rsp == nil || rsp.IsNotFound {
+		return nil, nil
+	}
+	return rsp.Values, nil
+}
+
+// Doc returns the current document
+func (it *SearchIterator) Doc() *SearchDoc {
+	return it.doc
+}
+
+// Values returns the KV object, or siblings, for the current document when
+// FetchObjects is set. It is empty if the object has been deleted since it
+// was indexed
+func (it *SearchIterator) Values() []*Object {
+	return it.values
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *SearchIterator) Err() error {
+	return it.err
+}
+
+// NumFound returns the number of matching documents reported by the latest
+// search
+func (it *SearchIterator) NumFound() uint32 {
+	return it.numFound
+}
+
+// Cursor returns the position of the next document, which can be passed as
+// Start to resume the iteration later
+func (it *SearchIterator) Cursor() uint32 {
+	return it.start
+}
+
+// Decode decodes the document's fields into the struct pointed to by v using
+// the search tags on its fields, which give the Solr field name such as
+// "name_s" or "age_i". Untagged fields are matched by field name. Slice
+// fields receive every value of a multi-valued field and other fields the
+// first. Strings, bools, integers, floats and time.Time, in RFC 3339 format,
+// are supported, as are pointers to them for optional fields.
+//
+//	type User struct {
+//		Key  string    `search:"_yz_rk"`
+//		Name string    `search:"name_s"`
+//		Age  int       `search:"age_i"`
+//		Tags []string  `search:"tags_ss"`
+//		Seen time.Time `search:"seen_dt"`
+//	}
+func (doc *SearchDoc) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("[SearchDoc] expected a pointer to a struct, got %v", reflect.TypeOf(v))
+	}
+	rv = rv.Elem()
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("search")
+		if name == "-" || f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		values, ok := doc.Fields[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		fv := rv.Field(i)
+		var err error
+		if fv.Kind() == reflect.Slice && fv.Type() != bytesType {
+			slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+			for j, value := range values {
+				if err = decodeSearchValue(slice.Index(j), value); err != nil {
+					break
+				}
+			}
+			fv.Set(slice)
+		} else {
+			err = decodeSearchValue(fv, values[0])
+		}
+		if err != nil {
+			return fmt.Errorf("[SearchDoc] field %s.%s: %v", t.Name(), f.Name, err)
+		}
+	}
+	return nil
+}
+
+func decodeSearchValue(fv reflect.Value, value string) error {
+	if fv.Kind() == reflect.Ptr {
+		fv.Set(reflect.New(fv.Type().Elem()))
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if fv.Type() == bytesType {
+			fv.SetBytes([]byte(value))
+			return nil
+		}
+	case reflect.Struct:
+		if fv.Type() == timeType {
+			tv, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return err
+			}
+			fv.Set(reflect.ValueOf(tv))
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported type %v", fv.Type())
+}
@@ -0,0 +1,357 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	errTestSearchFailed = errors.New("search failed")
+	testSearchIDRange   = regexp.MustCompile(`_yz_id:\{(\S+) TO \*\}`)
+)
+
+// testSearchExecutor answers searches from docs and KV commands from objects,
+// recording the searches, fetches, deletes and stores it executes
+type testSearchExecutor struct {
+	docs    []*SearchDoc
+	objects map[string][]*Object
+	// searches are the start of each search, fields its return fields and
+	// sort and filters its filter query
+	searches []uint32
+	fields   []string
+	filters  []string
+	fetches  []string
+	deleted  []string
+	stored   map[string]*StoreValueCommand
+	fail     bool
+	// failKey fails the KV commands for one key
+	failKey string
+	sync.Mutex
+}
+
+// newTestSearchExecutor returns an executor with n documents and objects,
+// except for the object of user_1, which is not found. Documents are in
+// _yz_id order
+func newTestSearchExecutor(n int) *testSearchExecutor {
+	e := &testSearchExecutor{
+		objects: make(map[string][]*Object),
+		stored:  make(map[string]*StoreValueCommand),
+	}
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("user_%d", i)
+		e.docs = append(e.docs, &SearchDoc{
+			BucketType: "default",
+			Bucket:     "users",
+			Key:        key,
+			Id:         fmt.Sprintf("%05d*default*users*%s", i, key),
+			Fields: map[string][]string{
+				"_yz_rk": {key},
+				"age_i":  {fmt.Sprintf("%d", 20+i)},
+			},
+		})
+		if key != "user_1" {
+			e.objects[key] = []*Object{{
+				Key:         key,
+				Value:       []byte(fmt.Sprintf("value_%d", i)),
+				ContentType: "text/plain",
+				VClock:      []byte("vclock_" + key),
+			}}
+		}
+	}
+	return e
+}
+
+func (e *testSearchExecutor) Execute(cmd Command) error {
+	e.Lock()
+	defer e.Unlock()
+	if e.fail {
+		return errTestSearchFailed
+	}
+	var key string
+	switch c := cmd.(type) {
+	case *SearchCommand:
+		start, rows := c.protobuf.GetStart(), c.protobuf.GetRows()
+		e.searches = append(e.searches, start)
+		e.fields = append(e.fields, string(bytes.Join(c.protobuf.Fl, []byte(",")))+" "+string(c.protobuf.Sort))
+		e.filters = append(e.filters, string(c.protobuf.Filter))
+		docs := e.docs
+		// NB: only the _yz_id range of SearchBulkOperation is supported
+		if match := testSearchIDRange.FindStringSubmatch(string(c.protobuf.Filter)); match != nil {
+			after := strings.Replace(match[1], `\`, "", -1)
+			docs = nil
+			for _, doc := range e.docs {
+				if doc.Id > after {
+					docs = append(docs, doc)
+				}
+			}
+		}
+		end := start + rows
+		if end > uint32(len(docs)) {
+			end = uint32(len(docs))
+		}
+		c.Response = &SearchResponse{NumFound: uint32(len(docs))}
+		if start < end {
+			c.Response.Docs = docs[start:end]
+		}
+		return nil
+	case *FetchValueCommand:
+		key = string(c.protobuf.GetKey())
+		e.fetches = append(e.fetches, key)
+	case *StoreValueCommand:
+		key = string(c.protobuf.GetKey())
+	case *DeleteValueCommand:
+		key = string(c.protobuf.GetKey())
+	}
+	if key == e.failKey {
+		return errors.New("write failed")
+	}
+	switch c := cmd.(type) {
+	case *FetchValueCommand:
+		values, ok := e.objects[key]
+		if !ok {
+			c.Response = &FetchValueResponse{IsNotFound: true}
+			return nil
+		}
+		if c.resolver != nil {
+			values = c.resolver.Resolve(values)
+		}
+		c.Response = &FetchValueResponse{Values: values}
+	case *StoreValueCommand:
+		e.stored[key] = c
+	case *DeleteValueCommand:
+		e.deleted = append(e.deleted, string(c.protobuf.Type)+"/"+string(c.protobuf.Bucket)+"/"+key)
+	}
+	return nil
+}
+
+func TestSearchIteratorPages(t *testing.T) {
+	executor := newTestSearchExecutor(7)
+	it, err := NewSearchIterator(&SearchIteratorOptions{
+		Executor: executor,
+		Index:    "users",
+		Query:    "*:*",
+		PageSize: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Doc().Key)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 7, len(keys); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := []uint32{0, 3, 6}, executor.searches; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint32(7), it.Cursor(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint32(7), it.NumFound(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSearchIteratorResumesFromCursor(t *testing.T) {
+	executor := newTestSearchExecutor(6)
+	it, _ := NewSearchIterator(&SearchIteratorOptions{
+		Executor: executor,
+		Index:    "users",
+		Query:    "*:*",
+		PageSize: 3,
+		Start:    4,
+	})
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Doc().Key)
+	}
+	if expected, actual := []string{"user_4", "user_5"}, keys; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSearchIteratorDeepPagingLimit(t *testing.T) {
+	executor := newTestSearchExecutor(10)
+	it, _ := NewSearchIterator(&SearchIteratorOptions{
+		Executor: executor,
+		Index:    "users",
+		Query:    "*:*",
+		PageSize: 3,
+		MaxStart: 5,
+	})
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if expected, actual := 5, count; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := ErrSearchIteratorDeepPaging, it.Err(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	executor = newTestSearchExecutor(5)
+	it, _ = NewSearchIterator(&SearchIteratorOptions{
+		Executor: executor,
+		Index:    "users",
+		Query:    "*:*",
+		PageSize: 5,
+		MaxStart: 5,
+	})
+	for it.Next() {
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("expected no error when all results fit, got %v", err)
+	}
+}
+
+func TestSearchIteratorResumesAtMaxStart(t *testing.T) {
+	executor := newTestSearchExecutor(10)
+	it, _ := NewSearchIterator(&SearchIteratorOptions{
+		Executor: executor,
+		Index:    "users",
+		Query:    "*:*",
+		PageSize: 3,
+		Start:    5,
+		MaxStart: 5,
+	})
+	if it.Next() {
+		t.Error("expected no documents")
+	}
+	if expected, actual := ErrSearchIteratorDeepPaging, it.Err(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 0, len(executor.searches); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSearchIteratorFetchesObjects(t *testing.T) {
+	executor := newTestSearchExecutor(3)
+	it, _ := NewSearchIterator(&SearchIteratorOptions{
+		Executor:     executor,
+		Index:        "users",
+		Query:        "*:*",
+		FetchObjects: true,
+	})
+	var found []string
+	for it.Next() {
+		for _, obj := range it.Values() {
+			found = append(found, obj.Key)
+		}
+	}
+	if expected, actual := []string{"user_0", "user_2"}, found; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 3, len(executor.fetches); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	executor.fail = true
+	it, _ = NewSearchIterator(&SearchIteratorOptions{Executor: executor, Index: "users", Query: "*:*"})
+	if it.Next() {
+		t.Error("expected Next to fail")
+	}
+	if it.Err() == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestNewSearchIteratorValidatesOptions(t *testing.T) {
+	executor := newTestSearchExecutor(0)
+	tests := []struct {
+		options  *SearchIteratorOptions
+		expected error
+	}{
+		{nil, ErrOptionsRequired},
+		{&SearchIteratorOptions{Index: "i", Query: "*:*"}, ErrSearchIteratorExecutorRequired},
+		{&SearchIteratorOptions{Executor: executor, Query: "*:*"}, ErrSearchIteratorIndexRequired},
+		{&SearchIteratorOptions{Executor: executor, Index: "i"}, ErrSearchIteratorQueryRequired},
+	}
+	for _, test := range tests {
+		if _, err := NewSearchIterator(test.options); err != test.expected {
+			t.Errorf("expected %v, got %v", test.expected, err)
+		}
+	}
+}
+
+func TestSearchDocDecode(t *testing.T) {
+	type user struct {
+		Key     string    `search:"_yz_rk"`
+		Name    string    `search:"name_s"`
+		Age     int       `search:"age_i"`
+		Score   float64   `search:"score"`
+		Active  bool      `search:"active_b"`
+		Tags    []string  `search:"tags_ss"`
+		Counts  []int64   `search:"counts_ls"`
+		Seen    time.Time `search:"seen_dt"`
+		Nick    *string   `search:"nick_s"`
+		City    string
+		Ignored string `search:"-"`
+	}
+	doc := &SearchDoc{
+		Fields: map[string][]string{
+			"_yz_rk":    {"user_1"},
+			"name_s":    {"Alice"},
+			"age_i":     {"42"},
+			"score":     {"1.5"},
+			"active_b":  {"true"},
+			"tags_ss":   {"a", "b"},
+			"counts_ls": {"1", "2"},
+			"seen_dt":   {"2016-01-02T03:04:05Z"},
+			"City":      {"Paris"},
+			"Ignored":   {"x"},
+		},
+	}
+	var u user
+	if err := doc.Decode(&u); err != nil {
+		t.Fatal(err)
+	}
+	expected := user{
+		Key:    "user_1",
+		Name:   "Alice",
+		Age:    42,
+		Score:  1.5,
+		Active: true,
+		Tags:   []string{"a", "b"},
+		Counts: []int64{1, 2},
+		Seen:   time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+		City:   "Paris",
+	}
+	if !reflect.DeepEqual(expected, u) {
+		t.Errorf("expected %+v, got %+v", expected, u)
+	}
+
+	doc.Fields["age_i"] = []string{"forty"}
+	if err := doc.Decode(&u); err == nil {
+		t.Error("expected an error for an invalid integer")
+	}
+	if err := doc.Decode(u); err == nil {
+		t.Error("expected an error for a non-pointer")
+	}
+}
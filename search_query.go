@@ -0,0 +1,241 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffixes of the dynamic fields in Yokozuna's default schema. Multi-valued
+// variants end in an extra s, such as "_ss"
+const (
+	SearchFieldString   = "_s"
+	SearchFieldInt      = "_i"
+	SearchFieldLong     = "_l"
+	SearchFieldFloat    = "_f"
+	SearchFieldDouble   = "_d"
+	SearchFieldBool     = "_b"
+	SearchFieldDate     = "_dt"
+	SearchFieldLocation = "_p"
+)
+
+// Suffixes Yokozuna gives the fields of indexed Maps. A nested Map's fields
+// are joined to its name with a dot, see SearchMapField
+const (
+	SearchFieldRegister = "_register"
+	SearchFieldCounter  = "_counter"
+	SearchFieldFlag     = "_flag"
+	SearchFieldSet      = "_set"
+	SearchFieldMap      = "_map"
+)
+
+// Bucket type, bucket and key fields Yokozuna adds to every document
+const (
+	SearchFieldBucketType = yzBucketTypeFld
+	SearchFieldBucket     = yzBucketFld
+	SearchFieldKey        = yzKeyFld
+)
+
+// searchSpecialChars are escaped with a backslash in terms
+const searchSpecialChars = `\+-!():^[]"{}~*?|&/`
+
+// searchDateLayout is the Solr date format, which must be in UTC
+const searchDateLayout = "2006-01-02T15:04:05.999Z"
+
+// SearchQuery is a Solr query built by the Search functions. Its String is
+// passed to SearchCommandBuilder.WithQuery or WithFilterQuery
+//
+//	query := riak.SearchAnd(
+//		riak.SearchTerm("name_s", userInput),
+//		riak.SearchRange("age_i", 18, nil, true),
+//		riak.SearchNot(riak.SearchTerm("status_s", "deleted")))
+//	cmd, err := riak.NewSearchCommandBuilder().
+//		WithIndexName("users").
+//		WithQuery(query.String()).
+//		Build()
+type SearchQuery interface {
+	String() string
+}
+
+type searchQuery string
+
+func (q searchQuery) String() string {
+	return string(q)
+}
+
+// EscapeSearchTerm escapes the characters Solr's query parser treats as
+// syntax, and whitespace, with a backslash
+func EscapeSearchTerm(term string) string {
+	var buf []byte
+	for _, r := range term {
+		if strings.ContainsRune(searchSpecialChars, r) || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, string(r)...)
+	}
+	return string(buf)
+}
+
+// formatSearchValue formats a value for a term or range. Strings are escaped
+// and times are formatted as Solr dates in UTC. nil matches any value
+func formatSearchValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "*"
+	case string:
+		switch value {
+		case "":
+			return `""`
+		case "AND", "OR", "NOT", "TO":
+			return `"` + value + `"`
+		}
+		return EscapeSearchTerm(value)
+	case time.Time:
+		return EscapeSearchTerm(value.UTC().Format(searchDateLayout))
+	case int:
+		return EscapeSearchTerm(strconv.Itoa(value))
+	case int32:
+		return EscapeSearchTerm(strconv.FormatInt(int64(value), 10))
+	case int64:
+		return EscapeSearchTerm(strconv.FormatInt(value, 10))
+	case uint32:
+		return strconv.FormatUint(uint64(value), 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case float32:
+		return EscapeSearchTerm(strconv.FormatFloat(float64(value), 'g', -1, 32))
+	case float64:
+		return EscapeSearchTerm(strconv.FormatFloat(value, 'g', -1, 64))
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return formatSearchValue(fmt.Sprint(v))
+}
+
+// SearchMapField returns the field name of a Map entry nested in Maps, such
+// as "address_map.city_register"
+func SearchMapField(names ...string) string {
+	return strings.Join(names, ".")
+}
+
+// SearchAll matches every document
+func SearchAll() SearchQuery {
+	return searchQuery("*:*")
+}
+
+// SearchTerm matches documents whose field has the value. Strings are
+// escaped, times are formatted as Solr dates, and nil matches any value
+func SearchTerm(field string, value interface{}) SearchQuery {
+	return searchQuery(EscapeSearchTerm(field) + ":" + formatSearchValue(value))
+}
+
+// SearchPhrase matches documents whose field contains the words of phrase in
+// order
+func SearchPhrase(field, phrase string) SearchQuery {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(phrase)
+	return searchQuery(EscapeSearchTerm(field) + `:"` + escaped + `"`)
+}
+
+// SearchRange matches documents whose field is between from and to, which
+// are formatted as for SearchTerm. A nil bound is unbounded
+func SearchRange(field string, from, to interface{}, inclusive bool) SearchQuery {
+	lower, upper := "{", "}"
+	if inclusive {
+		lower, upper = "[", "]"
+	}
+	return searchQuery(fmt.Sprintf("%s:%s%s TO %s%s", EscapeSearchTerm(field), lower, formatSearchValue(from), formatSearchValue(to), upper))
+}
+
+// SearchExists matches documents that have a value for field
+func SearchExists(field string) SearchQuery {
+	return SearchRange(field, nil, nil, true)
+}
+
+// SearchWildcard matches documents whose field matches pattern, where * is
+// any number of characters and ? is a single character. Other characters
+// are escaped
+func SearchWildcard(field, pattern string) SearchQuery {
+	var buf []byte
+	for _, r := range pattern {
+		if r == '*' || r == '?' {
+			buf = append(buf, byte(r))
+		} else {
+			buf = append(buf, EscapeSearchTerm(string(r))...)
+		}
+	}
+	return searchQuery(EscapeSearchTerm(field) + ":" + string(buf))
+}
+
+// SearchPrefix matches documents whose field starts with prefix
+func SearchPrefix(field, prefix string) SearchQuery {
+	return searchQuery(EscapeSearchTerm(field) + ":" + EscapeSearchTerm(prefix) + "*")
+}
+
+func searchBoolean(operator string, queries []SearchQuery) SearchQuery {
+	switch len(queries) {
+	case 0:
+		return SearchAll()
+	case 1:
+		return queries[0]
+	}
+	clauses := make([]string, len(queries))
+	for i, q := range queries {
+		clauses[i] = q.String()
+	}
+	return searchQuery("(" + strings.Join(clauses, " "+operator+" ") + ")")
+}
+
+// SearchAnd matches documents matching every query
+func SearchAnd(queries ...SearchQuery) SearchQuery {
+	return searchBoolean("AND", queries)
+}
+
+// SearchOr matches documents matching any query
+func SearchOr(queries ...SearchQuery) SearchQuery {
+	return searchBoolean("OR", queries)
+}
+
+// SearchNot matches documents not matching query. It is combined with *:*
+// so that it can be used on its own or within SearchAnd and SearchOr
+func SearchNot(query SearchQuery) SearchQuery {
+	return searchQuery("(*:* NOT " + query.String() + ")")
+}
+
+// SearchBoost multiplies the score of documents matching query by boost
+func SearchBoost(query SearchQuery, boost float64) SearchQuery {
+	return searchQuery(query.String() + "^" + strconv.FormatFloat(boost, 'g', -1, 64))
+}
+
+// SearchGeoDistance matches documents whose location field, such as a
+// "_p" field, is within distanceKm kilometres of lat,lon
+func SearchGeoDistance(field string, lat, lon, distanceKm float64) SearchQuery {
+	return searchQuery(fmt.Sprintf(`_query_:"{!geofilt sfield=%s pt=%s,%s d=%s}"`,
+		EscapeSearchTerm(field),
+		strconv.FormatFloat(lat, 'g', -1, 64),
+		strconv.FormatFloat(lon, 'g', -1, 64),
+		strconv.FormatFloat(distanceKm, 'g', -1, 64)))
+}
+
+// SearchGeoBoundingBox matches documents whose location field is within the
+// box with the given south west and north east corners
+func SearchGeoBoundingBox(field string, minLat, minLon, maxLat, maxLon float64) SearchQuery {
+	format := func(lat, lon float64) string {
+		return strconv.FormatFloat(lat, 'g', -1, 64) + "," + strconv.FormatFloat(lon, 'g', -1, 64)
+	}
+	return searchQuery(fmt.Sprintf("%s:[%s TO %s]", EscapeSearchTerm(field), format(minLat, minLon), format(maxLat, maxLon)))
+}
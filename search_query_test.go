@@ -0,0 +1,181 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"testing"
+	"time"
+
+	rpbRiakSCH "github.com/basho/riak-go-client/rpb/riak_search"
+)
+
+func TestEscapeSearchTerm(t *testing.T) {
+	tests := []struct {
+		term     string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"Hello World", `Hello\ World`},
+		{`a+b-c!d`, `a\+b\-c\!d`},
+		{`(x){y}[z]`, `\(x\)\{y\}\[z\]`},
+		{`a&&b||c`, `a\&\&b\|\|c`},
+		{`^"~*?:\/`, `\^\"\~\*\?\:\\\/`},
+		{"tab\tnew\nline", "tab\\\tnew\\\nline"},
+		{"héllo wörld", `héllo\ wörld`},
+	}
+	for _, tt := range tests {
+		if expected, actual := tt.expected, EscapeSearchTerm(tt.term); expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestSearchTerm(t *testing.T) {
+	date := time.Date(2016, time.March, 4, 5, 6, 7, 0, time.FixedZone("EST", -5*3600))
+	tests := []struct {
+		query    SearchQuery
+		expected string
+	}{
+		{SearchTerm("name_s", "Lion-O"), `name_s:Lion\-O`},
+		{SearchTerm("name_s", "Lion O"), `name_s:Lion\ O`},
+		{SearchTerm("name_s", "OR"), `name_s:"OR"`},
+		{SearchTerm("name_s", ""), `name_s:""`},
+		{SearchTerm("tags_ss", "c++"), `tags_ss:c\+\+`},
+		{SearchTerm("age_i", 30), "age_i:30"},
+		{SearchTerm("age_i", -30), `age_i:\-30`},
+		{SearchTerm("visits_l", int64(9007199254740993)), "visits_l:9007199254740993"},
+		{SearchTerm("ratio_f", float32(0.5)), "ratio_f:0.5"},
+		{SearchTerm("ratio_d", 1.25), "ratio_d:1.25"},
+		{SearchTerm("active_b", true), "active_b:true"},
+		{SearchTerm("created_dt", date), `created_dt:2016\-03\-04T10\:06\:07Z`},
+		{SearchTerm("name_s", nil), "name_s:*"},
+		{SearchTerm(SearchFieldBucketType, "users"), "_yz_rt:users"},
+		{SearchTerm(SearchFieldKey, "user:1"), `_yz_rk:user\:1`},
+		{SearchTerm(SearchMapField("address_map", "city_register"), "New York"), `address_map.city_register:New\ York`},
+		{SearchTerm("visits"+SearchFieldCounter, 10), "visits_counter:10"},
+		{SearchTerm("enterprise"+SearchFieldFlag, false), "enterprise_flag:false"},
+		{SearchTerm("interests"+SearchFieldSet, "thundercats"), "interests_set:thundercats"},
+	}
+	for _, tt := range tests {
+		if expected, actual := tt.expected, tt.query.String(); expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestSearchPhrase(t *testing.T) {
+	if expected, actual := `bio_tsd:"the \"quick\" fox\\"`, SearchPhrase("bio_tsd", `the "quick" fox\`).String(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := `title_s:"a: (b) OR c*"`, SearchPhrase("title_s", "a: (b) OR c*").String(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestSearchRange(t *testing.T) {
+	from := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(36*time.Hour + 500*time.Millisecond)
+	tests := []struct {
+		query    SearchQuery
+		expected string
+	}{
+		{SearchRange("age_i", 18, 65, true), "age_i:[18 TO 65]"},
+		{SearchRange("age_i", 18, 65, false), "age_i:{18 TO 65}"},
+		{SearchRange("age_i", 18, nil, true), "age_i:[18 TO *]"},
+		{SearchRange("temp_d", -1.5, nil, true), `temp_d:[\-1.5 TO *]`},
+		{SearchRange("name_s", "a b", "m", true), `name_s:[a\ b TO m]`},
+		{SearchRange("created_dt", from, to, true), `created_dt:[2016\-01\-01T00\:00\:00Z TO 2016\-01\-02T12\:00\:00.5Z]`},
+		{SearchExists("name_s"), "name_s:[* TO *]"},
+		{SearchGeoBoundingBox("location_p", 40.5, -74.25, 41, -73.5), "location_p:[40.5,-74.25 TO 41,-73.5]"},
+	}
+	for _, tt := range tests {
+		if expected, actual := tt.expected, tt.query.String(); expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestSearchWildcard(t *testing.T) {
+	tests := []struct {
+		query    SearchQuery
+		expected string
+	}{
+		{SearchWildcard("name_s", "Lion*"), "name_s:Lion*"},
+		{SearchWildcard("name_s", "L?on O*"), `name_s:L?on\ O*`},
+		{SearchWildcard("path_s", "/home/*:x"), `path_s:\/home\/*\:x`},
+		{SearchPrefix("name_s", "Lion*"), `name_s:Lion\**`},
+		{SearchPrefix("name_s", "Lion O"), `name_s:Lion\ O*`},
+	}
+	for _, tt := range tests {
+		if expected, actual := tt.expected, tt.query.String(); expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestSearchBoolean(t *testing.T) {
+	name := SearchTerm("name_s", "Lion-O")
+	age := SearchRange("age_i", 30, nil, true)
+	leader := SearchTerm("leader_b", true)
+	tests := []struct {
+		query    SearchQuery
+		expected string
+	}{
+		{SearchAnd(), "*:*"},
+		{SearchOr(name), `name_s:Lion\-O`},
+		{SearchAnd(name, age), `(name_s:Lion\-O AND age_i:[30 TO *])`},
+		{SearchOr(name, age, leader), `(name_s:Lion\-O OR age_i:[30 TO *] OR leader_b:true)`},
+		{SearchAnd(SearchOr(name, leader), SearchNot(age)), `((name_s:Lion\-O OR leader_b:true) AND (*:* NOT age_i:[30 TO *]))`},
+		{SearchNot(name), `(*:* NOT name_s:Lion\-O)`},
+		{SearchBoost(name, 2.5), `name_s:Lion\-O^2.5`},
+		{SearchOr(SearchBoost(name, 2), leader), `(name_s:Lion\-O^2 OR leader_b:true)`},
+	}
+	for _, tt := range tests {
+		if expected, actual := tt.expected, tt.query.String(); expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestSearchGeoDistance(t *testing.T) {
+	query := SearchAnd(SearchGeoDistance("location_p", 45.15, -93.85, 5), SearchTerm("type_s", "cafe"))
+	if expected, actual := `(_query_:"{!geofilt sfield=location_p pt=45.15,-93.85 d=5}" AND type_s:cafe)`, query.String(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestBuildSearchCommandWithSearchQuery(t *testing.T) {
+	query := SearchAnd(SearchTerm("name_s", "Lion O"), SearchRange("age_i", 30, nil, true))
+	filter := SearchTerm(SearchFieldBucket, "cats")
+	cmd, err := NewSearchCommandBuilder().
+		WithIndexName("indexName").
+		WithQuery(query.String()).
+		WithFilterQuery(filter.String()).
+		Build()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	protobuf, err := cmd.constructPbRequest()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req := protobuf.(*rpbRiakSCH.RpbSearchQueryReq)
+	if expected, actual := `(name_s:Lion\ O AND age_i:[30 TO *])`, string(req.Q); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "_yz_rb:cats", string(req.Filter); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,549 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Names of the uniqueKey and field type Yokozuna requires in every schema
+const (
+	SearchSchemaUniqueKey = "_yz_id"
+	SearchSchemaYzStrType = "_yz_str"
+)
+
+const searchSchemaVersion = "1.5"
+
+var (
+	ErrSearchSchemaNameRequired = newClientError("[SearchSchema] a schema name is required", nil)
+	ErrSearchSchemaContentEmpty = newClientError("[SearchSchema] schema content is empty", nil)
+)
+
+// searchSchemaYzFields are the fields Yokozuna uses to store and find Riak
+// objects, and whether Yokozuna needs them to be stored
+var searchSchemaYzFields = []struct {
+	name   string
+	stored bool
+}{
+	{SearchSchemaUniqueKey, true},
+	{"_yz_ed", false},
+	{"_yz_pn", false},
+	{"_yz_fpn", false},
+	{"_yz_vtag", false},
+	{yzKeyFld, true},
+	{yzBucketTypeFld, true},
+	{yzBucketFld, true},
+	{"_yz_err", false},
+}
+
+// SearchSchemaField is a field or dynamic field of a Solr schema. Attributes
+// holds any other attributes, such as default or docValues
+type SearchSchemaField struct {
+	Name        string
+	Type        string
+	Indexed     bool
+	Stored      bool
+	MultiValued bool
+	Required    bool
+	Attributes  map[string]string
+}
+
+// SearchSchemaFieldType is a field type of a Solr schema. Attributes holds
+// attributes other than name and class, such as sortMissingLast, and Content
+// the XML of its analyzers, which is kept as it is
+type SearchSchemaFieldType struct {
+	Name       string
+	Class      string
+	Attributes map[string]string
+	Content    string
+}
+
+// SearchSchemaCopyField copies the values of the fields matching Source to
+// Dest when a document is indexed
+type SearchSchemaCopyField struct {
+	Source string
+	Dest   string
+}
+
+// SearchSchema describes a Yokozuna (Solr) schema. NewSearchSchema returns a
+// schema with the fields and field type Yokozuna requires, to which the
+// fields of the indexed data are added:
+//
+//	schema := riak.NewSearchSchema("users")
+//	schema.FieldTypes = append(schema.FieldTypes,
+//		riak.SearchSchemaFieldType{Name: "string", Class: "solr.StrField"},
+//		riak.SearchSchemaFieldType{Name: "int", Class: "solr.TrieIntField"})
+//	schema.Fields = append(schema.Fields,
+//		riak.SearchSchemaField{Name: "name_s", Type: "string", Indexed: true, Stored: true})
+//	schema.DynamicFields = append(schema.DynamicFields,
+//		riak.SearchSchemaField{Name: "*_i", Type: "int", Indexed: true, Stored: true})
+//	cmd, err := schema.NewStoreSchemaCommandBuilder()
+type SearchSchema struct {
+	Name          string
+	Version       string
+	UniqueKey     string
+	Fields        []SearchSchemaField
+	DynamicFields []SearchSchemaField
+	FieldTypes    []SearchSchemaFieldType
+	CopyFields    []SearchSchemaCopyField
+}
+
+// NewSearchSchema returns a schema containing the _yz_* fields, the _yz_str
+// field type and the _yz_id uniqueKey that Yokozuna requires
+func NewSearchSchema(name string) *SearchSchema {
+	schema := &SearchSchema{
+		Name:      name,
+		Version:   searchSchemaVersion,
+		UniqueKey: SearchSchemaUniqueKey,
+		FieldTypes: []SearchSchemaFieldType{{
+			Name:       SearchSchemaYzStrType,
+			Class:      "solr.StrField",
+			Attributes: map[string]string{"sortMissingLast": "true"},
+		}},
+	}
+	for _, f := range searchSchemaYzFields {
+		schema.Fields = append(schema.Fields, SearchSchemaField{
+			Name:     f.name,
+			Type:     SearchSchemaYzStrType,
+			Indexed:  true,
+			Stored:   f.stored,
+			Required: f.name == SearchSchemaUniqueKey,
+		})
+	}
+	return schema
+}
+
+// Field returns the field with the given name, or nil if there is none
+func (s *SearchSchema) Field(name string) *SearchSchemaField {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+// FieldType returns the field type with the given name, or nil if there is
+// none
+func (s *SearchSchema) FieldType(name string) *SearchSchemaFieldType {
+	for i := range s.FieldTypes {
+		if s.FieldTypes[i].Name == name {
+			return &s.FieldTypes[i]
+		}
+	}
+	return nil
+}
+
+// MatchField returns the field Solr uses to index a field with the given
+// name: the field itself, or else the dynamic field with the longest
+// matching pattern. It returns nil if the field would not be indexed
+func (s *SearchSchema) MatchField(name string) *SearchSchemaField {
+	if f := s.Field(name); f != nil {
+		return f
+	}
+	var match *SearchSchemaField
+	for i := range s.DynamicFields {
+		f := &s.DynamicFields[i]
+		if matchSearchSchemaPattern(f.Name, name) && (match == nil || len(f.Name) > len(match.Name)) {
+			match = f
+		}
+	}
+	return match
+}
+
+func matchSearchSchemaPattern(pattern, name string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*"):
+		return strings.HasSuffix(name, pattern[1:])
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(name, pattern[:len(pattern)-1])
+	}
+	return pattern == name
+}
+
+func validSearchSchemaPattern(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.Count(pattern, "*") != 1 || len(pattern) < 2 {
+		return false
+	}
+	return strings.HasPrefix(pattern, "*") || strings.HasSuffix(pattern, "*")
+}
+
+// Validate checks that the schema can be stored and used by Yokozuna: the
+// _yz_* fields are present as Yokozuna requires, every field refers to a
+// defined field type, names are unique and copy fields refer to fields that
+// exist
+func (s *SearchSchema) Validate() error {
+	if s.Name == "" {
+		return ErrSearchSchemaNameRequired
+	}
+	types := make(map[string]bool, len(s.FieldTypes))
+	for _, t := range s.FieldTypes {
+		if t.Name == "" {
+			return fmt.Errorf("[SearchSchema] schema %s has a field type with no name", s.Name)
+		}
+		if types[t.Name] {
+			return fmt.Errorf("[SearchSchema] schema %s has duplicate field type %s", s.Name, t.Name)
+		}
+		if t.Class == "" {
+			return fmt.Errorf("[SearchSchema] field type %s has no class", t.Name)
+		}
+		types[t.Name] = true
+	}
+	if err := s.validateFields(s.Fields, "field", types); err != nil {
+		return err
+	}
+	if err := s.validateFields(s.DynamicFields, "dynamic field", types); err != nil {
+		return err
+	}
+	for _, f := range searchSchemaYzFields {
+		field := s.Field(f.name)
+		if field == nil {
+			return fmt.Errorf("[SearchSchema] schema %s is missing field %s required by Yokozuna", s.Name, f.name)
+		}
+		if !field.Indexed || field.MultiValued {
+			return fmt.Errorf("[SearchSchema] field %s must be indexed and single valued", f.name)
+		}
+		if f.stored && !field.Stored {
+			return fmt.Errorf("[SearchSchema] field %s must be stored", f.name)
+		}
+	}
+	if s.UniqueKey != SearchSchemaUniqueKey {
+		return fmt.Errorf("[SearchSchema] uniqueKey must be %s, got '%s'", SearchSchemaUniqueKey, s.UniqueKey)
+	}
+	return s.validateCopyFields()
+}
+
+func (s *SearchSchema) validateFields(fields []SearchSchemaField, kind string, types map[string]bool) error {
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if f.Name == "" {
+			return fmt.Errorf("[SearchSchema] schema %s has a %s with no name", s.Name, kind)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("[SearchSchema] schema %s has duplicate %s %s", s.Name, kind, f.Name)
+		}
+		names[f.Name] = true
+		if kind == "field" && strings.Contains(f.Name, "*") {
+			return fmt.Errorf("[SearchSchema] field %s must not contain '*', use a dynamic field", f.Name)
+		}
+		if kind == "dynamic field" && !validSearchSchemaPattern(f.Name) {
+			return fmt.Errorf("[SearchSchema] dynamic field %s must start or end with a single '*'", f.Name)
+		}
+		if kind == "field" && strings.HasPrefix(f.Name, "_yz") && !isSearchSchemaYzField(f.Name) {
+			return fmt.Errorf("[SearchSchema] field %s uses the _yz prefix reserved by Yokozuna", f.Name)
+		}
+		if !types[f.Type] {
+			return fmt.Errorf("[SearchSchema] %s %s has unknown type '%s'", kind, f.Name, f.Type)
+		}
+	}
+	return nil
+}
+
+func isSearchSchemaYzField(name string) bool {
+	for _, f := range searchSchemaYzFields {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SearchSchema) validateCopyFields() error {
+	sources := make(map[string]int)
+	for _, c := range s.CopyFields {
+		if c.Source == "" || c.Dest == "" {
+			return fmt.Errorf("[SearchSchema] schema %s has a copy field with no source or dest", s.Name)
+		}
+		if strings.HasPrefix(c.Dest, "_yz") {
+			return fmt.Errorf("[SearchSchema] copy field must not copy to Yokozuna field %s", c.Dest)
+		}
+		dest := s.MatchField(c.Dest)
+		if dest == nil {
+			return fmt.Errorf("[SearchSchema] copy field dest %s matches no field", c.Dest)
+		}
+		if strings.Contains(c.Source, "*") {
+			if !validSearchSchemaPattern(c.Source) {
+				return fmt.Errorf("[SearchSchema] copy field source %s must start or end with a single '*'", c.Source)
+			}
+			if !dest.MultiValued {
+				return fmt.Errorf("[SearchSchema] copy field dest %s must be multi valued to copy from %s", c.Dest, c.Source)
+			}
+			continue
+		}
+		source := s.MatchField(c.Source)
+		if source == nil {
+			return fmt.Errorf("[SearchSchema] copy field source %s matches no field", c.Source)
+		}
+		if source.MultiValued && !dest.MultiValued {
+			return fmt.Errorf("[SearchSchema] copy field dest %s must be multi valued to copy from %s", c.Dest, c.Source)
+		}
+		sources[c.Dest]++
+		if sources[c.Dest] > 1 && !dest.MultiValued {
+			return fmt.Errorf("[SearchSchema] copy field dest %s must be multi valued to copy from more than one field", c.Dest)
+		}
+	}
+	return nil
+}
+
+// XML validates the schema and renders it as Solr schema XML
+func (s *SearchSchema) XML() (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+	version := s.Version
+	if version == "" {
+		version = searchSchemaVersion
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\" ?>\n")
+	buf.WriteString("<schema")
+	writeSearchSchemaAttr(&buf, "name", s.Name)
+	writeSearchSchemaAttr(&buf, "version", version)
+	buf.WriteString(">\n  <fields>\n")
+	for _, f := range s.Fields {
+		writeSearchSchemaField(&buf, "field", &f)
+	}
+	for _, f := range s.DynamicFields {
+		writeSearchSchemaField(&buf, "dynamicField", &f)
+	}
+	buf.WriteString("  </fields>\n\n  <uniqueKey>")
+	xml.EscapeText(&buf, []byte(s.UniqueKey))
+	buf.WriteString("</uniqueKey>\n\n  <types>\n")
+	for _, t := range s.FieldTypes {
+		buf.WriteString("    <fieldType")
+		writeSearchSchemaAttr(&buf, "name", t.Name)
+		writeSearchSchemaAttr(&buf, "class", t.Class)
+		writeSearchSchemaAttrs(&buf, t.Attributes)
+		if content := strings.TrimSpace(t.Content); content != "" {
+			fmt.Fprintf(&buf, ">\n      %s\n    </fieldType>\n", content)
+		} else {
+			buf.WriteString(" />\n")
+		}
+	}
+	buf.WriteString("  </types>\n")
+	if len(s.CopyFields) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, c := range s.CopyFields {
+		buf.WriteString("  <copyField")
+		writeSearchSchemaAttr(&buf, "source", c.Source)
+		writeSearchSchemaAttr(&buf, "dest", c.Dest)
+		buf.WriteString(" />\n")
+	}
+	buf.WriteString("</schema>\n")
+	return buf.String(), nil
+}
+
+func writeSearchSchemaField(buf *bytes.Buffer, element string, f *SearchSchemaField) {
+	fmt.Fprintf(buf, "    <%s", element)
+	writeSearchSchemaAttr(buf, "name", f.Name)
+	writeSearchSchemaAttr(buf, "type", f.Type)
+	fmt.Fprintf(buf, ` indexed="%t" stored="%t" multiValued="%t"`, f.Indexed, f.Stored, f.MultiValued)
+	if f.Required {
+		buf.WriteString(` required="true"`)
+	}
+	writeSearchSchemaAttrs(buf, f.Attributes)
+	buf.WriteString(" />\n")
+}
+
+func writeSearchSchemaAttr(buf *bytes.Buffer, name, value string) {
+	fmt.Fprintf(buf, ` %s="`, name)
+	xml.EscapeText(buf, []byte(value))
+	buf.WriteString(`"`)
+}
+
+func writeSearchSchemaAttrs(buf *bytes.Buffer, attrs map[string]string) {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeSearchSchemaAttr(buf, name, attrs[name])
+	}
+}
+
+// NewStoreSchemaCommandBuilder validates the schema and returns a
+// StoreSchemaCommandBuilder for its XML
+func (s *SearchSchema) NewStoreSchemaCommandBuilder() (*StoreSchemaCommandBuilder, error) {
+	content, err := s.XML()
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreSchemaCommandBuilder().
+		WithSchemaName(s.Name).
+		WithSchema(content), nil
+}
+
+// searchSchemaElement holds the attributes and content of an element of a
+// schema being parsed
+type searchSchemaElement struct {
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",innerxml"`
+}
+
+// attributes returns the element's attributes, removing those named
+func (e *searchSchemaElement) attributes(names ...string) (map[string]string, map[string]string) {
+	named := make(map[string]string, len(names))
+	var others map[string]string
+	for _, attr := range e.Attrs {
+		found := false
+		for _, name := range names {
+			if attr.Name.Local == name {
+				named[name] = attr.Value
+				found = true
+			}
+		}
+		if !found {
+			if others == nil {
+				others = make(map[string]string)
+			}
+			others[attr.Name.Local] = attr.Value
+		}
+	}
+	return named, others
+}
+
+// ParseSearchSchema parses Solr schema XML, such as the content of a schema
+// fetched with FetchSchemaCommand. name is the name the schema is stored
+// under in Riak; when empty, the name attribute of the XML is used. Field
+// properties missing from the XML are resolved as Solr does, so that XML
+// renders them explicitly with the same meaning
+func ParseSearchSchema(name, content string) (*SearchSchema, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, ErrSearchSchemaContentEmpty
+	}
+	schema := &SearchSchema{Name: name}
+	var fieldAttrs, dynamicFieldAttrs []map[string]string
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, newClientError(fmt.Sprintf("[SearchSchema] invalid XML in schema %s", name), err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "schema" {
+			for _, attr := range start.Attr {
+				switch attr.Name.Local {
+				case "name":
+					if schema.Name == "" {
+						schema.Name = attr.Value
+					}
+				case "version":
+					schema.Version = attr.Value
+				}
+			}
+			continue
+		}
+		// NB: elements that are not part of the model, such as <fields> and
+		// <types>, are descended into so that their children are found
+		switch start.Name.Local {
+		case "field", "dynamicField", "fieldType", "fieldtype", "copyField", "uniqueKey":
+		default:
+			continue
+		}
+		e := &searchSchemaElement{}
+		if err := decoder.DecodeElement(e, &start); err != nil {
+			return nil, newClientError(fmt.Sprintf("[SearchSchema] invalid XML in schema %s", name), err)
+		}
+		switch start.Name.Local {
+		case "field", "dynamicField":
+			attrs, others := e.attributes(searchSchemaFieldAttrs...)
+			f := SearchSchemaField{
+				Name:       attrs["name"],
+				Type:       attrs["type"],
+				Attributes: others,
+			}
+			if start.Name.Local == "field" {
+				schema.Fields = append(schema.Fields, f)
+				fieldAttrs = append(fieldAttrs, attrs)
+			} else {
+				schema.DynamicFields = append(schema.DynamicFields, f)
+				dynamicFieldAttrs = append(dynamicFieldAttrs, attrs)
+			}
+		case "fieldType", "fieldtype":
+			attrs, others := e.attributes("name", "class")
+			schema.FieldTypes = append(schema.FieldTypes, SearchSchemaFieldType{
+				Name:       attrs["name"],
+				Class:      attrs["class"],
+				Attributes: others,
+				Content:    strings.TrimSpace(e.Content),
+			})
+		case "copyField":
+			attrs, _ := e.attributes("source", "dest")
+			schema.CopyFields = append(schema.CopyFields, SearchSchemaCopyField{
+				Source: attrs["source"],
+				Dest:   attrs["dest"],
+			})
+		case "uniqueKey":
+			schema.UniqueKey = strings.TrimSpace(e.Content)
+		}
+	}
+	// NB: field types may follow the fields that use them
+	for i := range schema.Fields {
+		schema.setFieldProperties(&schema.Fields[i], fieldAttrs[i])
+	}
+	for i := range schema.DynamicFields {
+		schema.setFieldProperties(&schema.DynamicFields[i], dynamicFieldAttrs[i])
+	}
+	return schema, nil
+}
+
+// searchSchemaFieldAttrs are the attributes of fields in SearchSchemaField
+var searchSchemaFieldAttrs = []string{"name", "type", "indexed", "stored", "multiValued", "required"}
+
+// setFieldProperties sets the boolean properties of a parsed field. As in
+// Solr, a property missing from a field is taken from its field type, and
+// otherwise defaults to indexed and stored
+func (s *SearchSchema) setFieldProperties(f *SearchSchemaField, attrs map[string]string) {
+	var typeAttrs map[string]string
+	if t := s.FieldType(f.Type); t != nil {
+		typeAttrs = t.Attributes
+	}
+	property := func(name string, defaultValue bool) bool {
+		if value, ok := attrs[name]; ok {
+			return value == "true"
+		}
+		if value, ok := typeAttrs[name]; ok {
+			return value == "true"
+		}
+		return defaultValue
+	}
+	f.Indexed = property("indexed", true)
+	f.Stored = property("stored", true)
+	f.MultiValued = property("multiValued", false)
+	f.Required = property("required", false)
+}
+
+// SearchSchema parses the content of a fetched schema
+func (s *Schema) SearchSchema() (*SearchSchema, error) {
+	return ParseSearchSchema(s.Name, s.Content)
+}
@@ -0,0 +1,292 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testYokozunaSchema is an abridged version of Yokozuna's default schema
+const testYokozunaSchema = `<?xml version="1.0" encoding="UTF-8" ?>
+<schema name="default" version="1.5">
+ <fields>
+   <!-- Dynamic fields for the _yz_default schema conventions -->
+   <dynamicField name="*_i"  type="int"    indexed="true"  stored="true"  multiValued="false"/>
+   <dynamicField name="*_is" type="int"    indexed="true"  stored="true"  multiValued="true"/>
+   <dynamicField name="*_s"  type="string" indexed="true"  stored="true"  multiValued="false"/>
+   <dynamicField name="*_ss" type="string" indexed="true"  stored="true"  multiValued="true"/>
+   <dynamicField name="*_tsd" type="text_general" indexed="true" stored="true" />
+   <dynamicField name="*" type="ignored" />
+
+   <field name="text" type="text_general" indexed="true" stored="false" multiValued="true"/>
+
+   <!-- All of these fields are required by Riak Search -->
+   <field name="_yz_id"   type="_yz_str" indexed="true" stored="true"  multiValued="false" required="true"/>
+   <field name="_yz_ed"   type="_yz_str" indexed="true" stored="false" multiValued="false"/>
+   <field name="_yz_pn"   type="_yz_str" indexed="true" stored="false" multiValued="false"/>
+   <field name="_yz_fpn"  type="_yz_str" indexed="true" stored="false" multiValued="false"/>
+   <field name="_yz_vtag" type="_yz_str" indexed="true" stored="false" multiValued="false"/>
+   <field name="_yz_rk"   type="_yz_str" indexed="true" stored="true"  multiValued="false"/>
+   <field name="_yz_rt"   type="_yz_str" indexed="true" stored="true"  multiValued="false"/>
+   <field name="_yz_rb"   type="_yz_str" indexed="true" stored="true"  multiValued="false"/>
+   <field name="_yz_err"  type="_yz_str" indexed="true" stored="false" multiValued="false"/>
+ </fields>
+
+ <uniqueKey>_yz_id</uniqueKey>
+
+ <types>
+    <fieldType name="_yz_str" class="solr.StrField" sortMissingLast="true" />
+    <fieldType name="string" class="solr.StrField" sortMissingLast="true" />
+    <fieldType name="int" class="solr.TrieIntField" precisionStep="0" positionIncrementGap="0"/>
+    <fieldtype name="ignored" stored="false" indexed="false" multiValued="true" class="solr.StrField" />
+    <fieldType name="text_general" class="solr.TextField" positionIncrementGap="100">
+      <analyzer type="index">
+        <tokenizer class="solr.StandardTokenizerFactory"/>
+        <filter class="solr.LowerCaseFilterFactory"/>
+      </analyzer>
+    </fieldType>
+ </types>
+
+ <copyField source="*_s" dest="text"/>
+</schema>`
+
+func TestParseSearchSchema(t *testing.T) {
+	schema, err := ParseSearchSchema("_yz_default", testYokozunaSchema)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := schema.Validate(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected, actual := "_yz_default", schema.Name; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "1.5", schema.Version; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := SearchSchemaUniqueKey, schema.UniqueKey; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 10, len(schema.Fields); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 6, len(schema.DynamicFields); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 5, len(schema.FieldTypes); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	expectedField := SearchSchemaField{Name: "*_tsd", Type: "text_general", Indexed: true, Stored: true}
+	if actual := schema.DynamicFields[4]; !reflect.DeepEqual(expectedField, actual) {
+		t.Errorf("expected %v, got %v", expectedField, actual)
+	}
+	ignored := schema.FieldType("ignored")
+	if ignored == nil {
+		t.Fatal("expected the lowercase fieldtype element to be parsed")
+	}
+	expectedAttributes := map[string]string{"stored": "false", "indexed": "false", "multiValued": "true"}
+	if actual := ignored.Attributes; !reflect.DeepEqual(expectedAttributes, actual) {
+		t.Errorf("expected %v, got %v", expectedAttributes, actual)
+	}
+	catchAll := schema.MatchField("address_map.city_register")
+	if catchAll.Indexed || catchAll.Stored || !catchAll.MultiValued {
+		t.Errorf("expected the properties of the ignored type, got %v", catchAll)
+	}
+	text := schema.FieldType("text_general")
+	if !strings.HasPrefix(text.Content, `<analyzer type="index">`) || !strings.HasSuffix(text.Content, "</analyzer>") {
+		t.Errorf("expected analyzer content, got %v", text.Content)
+	}
+	expectedCopy := []SearchSchemaCopyField{{Source: "*_s", Dest: "text"}}
+	if actual := schema.CopyFields; !reflect.DeepEqual(expectedCopy, actual) {
+		t.Errorf("expected %v, got %v", expectedCopy, actual)
+	}
+}
+
+func TestParseSearchSchemaErrors(t *testing.T) {
+	if _, err := ParseSearchSchema("empty", " \n"); err != ErrSearchSchemaContentEmpty {
+		t.Errorf("expected %v, got %v", ErrSearchSchemaContentEmpty, err)
+	}
+	if _, err := ParseSearchSchema("bad", "<schema><fields></schema>"); err == nil {
+		t.Error("expected an error for invalid XML")
+	}
+	schema, err := ParseSearchSchema("", `<schema name="fromXml"><field name="a" type="string"/></schema>`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected, actual := "fromXml", schema.Name; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if f := schema.Field("a"); f == nil || !f.Indexed || !f.Stored || f.MultiValued {
+		t.Errorf("expected Solr defaults for missing attributes, got %v", f)
+	}
+}
+
+func TestSearchSchemaRoundTrip(t *testing.T) {
+	schema, err := ParseSearchSchema("_yz_default", testYokozunaSchema)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	content, err := schema.XML()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	parsed, err := (&Schema{Name: "_yz_default", Content: content}).SearchSchema()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(schema, parsed) {
+		t.Errorf("expected %v, got %v", schema, parsed)
+	}
+}
+
+func newTestSearchSchema() *SearchSchema {
+	schema := NewSearchSchema("users")
+	schema.FieldTypes = append(schema.FieldTypes,
+		SearchSchemaFieldType{Name: "string", Class: "solr.StrField"},
+		SearchSchemaFieldType{Name: "int", Class: "solr.TrieIntField", Attributes: map[string]string{"precisionStep": "0"}})
+	schema.Fields = append(schema.Fields,
+		SearchSchemaField{Name: "all_ss", Type: "string", Indexed: true, MultiValued: true},
+		SearchSchemaField{Name: "name_s", Type: "string", Indexed: true, Stored: true, Attributes: map[string]string{"default": "<none>"}})
+	schema.DynamicFields = append(schema.DynamicFields,
+		SearchSchemaField{Name: "*_i", Type: "int", Indexed: true, Stored: true},
+		SearchSchemaField{Name: "*_ss", Type: "string", Indexed: true, Stored: true, MultiValued: true})
+	schema.CopyFields = append(schema.CopyFields,
+		SearchSchemaCopyField{Source: "name_s", Dest: "all_ss"},
+		SearchSchemaCopyField{Source: "*_ss", Dest: "all_ss"})
+	return schema
+}
+
+func TestSearchSchemaXML(t *testing.T) {
+	content, err := newTestSearchSchema().XML()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, expected := range []string{
+		`<schema name="users" version="1.5">`,
+		`<field name="_yz_id" type="_yz_str" indexed="true" stored="true" multiValued="false" required="true" />`,
+		`<field name="_yz_ed" type="_yz_str" indexed="true" stored="false" multiValued="false" />`,
+		`<field name="name_s" type="string" indexed="true" stored="true" multiValued="false" default="&lt;none&gt;" />`,
+		`<dynamicField name="*_ss" type="string" indexed="true" stored="true" multiValued="true" />`,
+		`<uniqueKey>_yz_id</uniqueKey>`,
+		`<fieldType name="_yz_str" class="solr.StrField" sortMissingLast="true" />`,
+		`<fieldType name="int" class="solr.TrieIntField" precisionStep="0" />`,
+		`<copyField source="*_ss" dest="all_ss" />`,
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("expected %v in %v", expected, content)
+		}
+	}
+}
+
+func TestSearchSchemaMatchField(t *testing.T) {
+	schema := newTestSearchSchema()
+	schema.DynamicFields = append(schema.DynamicFields,
+		SearchSchemaField{Name: "*", Type: "string"},
+		SearchSchemaField{Name: "attr_*", Type: "string", Indexed: true, MultiValued: true})
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"name_s", "name_s"},
+		{"age_i", "*_i"},
+		{"tags_ss", "*_ss"},
+		{"attr_color", "attr_*"},
+		{"address_map.city_register", "*"},
+	}
+	for _, tt := range tests {
+		f := schema.MatchField(tt.name)
+		if f == nil {
+			t.Errorf("expected %v, got nil", tt.expected)
+		} else if expected, actual := tt.expected, f.Name; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+	if f := NewSearchSchema("empty").MatchField("name_s"); f != nil {
+		t.Errorf("expected nil, got %v", f)
+	}
+}
+
+func TestSearchSchemaValidate(t *testing.T) {
+	tests := []struct {
+		change   func(s *SearchSchema)
+		expected string
+	}{
+		{func(s *SearchSchema) { s.Name = "" }, "a schema name is required"},
+		{func(s *SearchSchema) { s.Fields[10].Type = "strnig" }, "field name_s has unknown type 'strnig'"},
+		{func(s *SearchSchema) { s.DynamicFields[0].Type = "itn" }, "dynamic field *_i has unknown type 'itn'"},
+		{func(s *SearchSchema) { s.Fields[10].Name = "" }, "has a field with no name"},
+		{func(s *SearchSchema) { s.Fields[10].Name = "all_ss" }, "duplicate field all_ss"},
+		{func(s *SearchSchema) { s.Fields[10].Name = "name_*" }, "use a dynamic field"},
+		{func(s *SearchSchema) { s.Fields[10].Name = "_yz_name" }, "reserved by Yokozuna"},
+		{func(s *SearchSchema) { s.DynamicFields[0].Name = "*_i*" }, "must start or end with a single '*'"},
+		{func(s *SearchSchema) { s.DynamicFields[0].Name = "age_i" }, "must start or end with a single '*'"},
+		{func(s *SearchSchema) { s.DynamicFields[1].Name = "*_i" }, "duplicate dynamic field *_i"},
+		{func(s *SearchSchema) { s.FieldTypes[1].Class = "" }, "field type string has no class"},
+		{func(s *SearchSchema) { s.FieldTypes[2].Name = "string" }, "duplicate field type string"},
+		{func(s *SearchSchema) { s.Fields = s.Fields[1:] }, "missing field _yz_id required by Yokozuna"},
+		{func(s *SearchSchema) { s.Fields[5].Stored = false }, "field _yz_rk must be stored"},
+		{func(s *SearchSchema) { s.Fields[1].Indexed = false }, "field _yz_ed must be indexed and single valued"},
+		{func(s *SearchSchema) { s.Fields[6].MultiValued = true }, "field _yz_rt must be indexed and single valued"},
+		{func(s *SearchSchema) { s.UniqueKey = "id" }, "uniqueKey must be _yz_id, got 'id'"},
+		{func(s *SearchSchema) { s.CopyFields[0].Dest = "missing" }, "copy field dest missing matches no field"},
+		{func(s *SearchSchema) { s.CopyFields[0].Source = "nmae_s" }, "copy field source nmae_s matches no field"},
+		{func(s *SearchSchema) { s.CopyFields[0].Dest = "_yz_rk" }, "must not copy to Yokozuna field _yz_rk"},
+		{func(s *SearchSchema) { s.CopyFields[1].Source = "*_s*" }, "copy field source *_s* must start or end"},
+		{func(s *SearchSchema) { s.CopyFields[1].Dest = "name_s" }, "dest name_s must be multi valued to copy from *_ss"},
+		{func(s *SearchSchema) {
+			s.CopyFields = []SearchSchemaCopyField{{Source: "name_s", Dest: "count_i"}, {Source: "age_i", Dest: "count_i"}}
+		}, "dest count_i must be multi valued to copy from more than one field"},
+	}
+	for _, tt := range tests {
+		schema := newTestSearchSchema()
+		tt.change(schema)
+		err := schema.Validate()
+		if err == nil {
+			t.Errorf("expected error containing %v", tt.expected)
+		} else if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %v, got %v", tt.expected, err)
+		}
+	}
+	if err := newTestSearchSchema().Validate(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
+
+func TestSearchSchemaNewStoreSchemaCommandBuilder(t *testing.T) {
+	schema := newTestSearchSchema()
+	builder, err := schema.NewStoreSchemaCommandBuilder()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cmd, err := builder.Build()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	content, _ := schema.XML()
+	protobuf := cmd.(*StoreSchemaCommand).protobuf
+	if expected, actual := "users", string(protobuf.Schema.Name); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := content, string(protobuf.Schema.Content); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	schema.Fields[10].Type = "strnig"
+	if _, err := schema.NewStoreSchemaCommandBuilder(); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+}
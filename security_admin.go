@@ -0,0 +1,355 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Riak security permissions that may be granted to users and groups
+const (
+	PermissionGet           = "riak_kv.get"
+	PermissionPut           = "riak_kv.put"
+	PermissionDelete        = "riak_kv.delete"
+	PermissionIndex         = "riak_kv.index"
+	PermissionListKeys      = "riak_kv.list_keys"
+	PermissionListBuckets   = "riak_kv.list_buckets"
+	PermissionMapReduce     = "riak_kv.mapreduce"
+	PermissionGetBucket     = "riak_core.get_bucket"
+	PermissionSetBucket     = "riak_core.set_bucket"
+	PermissionGetBucketType = "riak_core.get_bucket_type"
+	PermissionSetBucketType = "riak_core.set_bucket_type"
+	PermissionSearchAdmin   = "search.admin"
+	PermissionSearchQuery   = "search.query"
+)
+
+// Riak security sources, which determine how users connecting from a network
+// authenticate
+const (
+	SourceTrust       = "trust"
+	SourcePassword    = "password"
+	SourceCertificate = "certificate"
+	SourcePam         = "pam"
+)
+
+// SecurityAll may be used in place of a list of users or groups to refer to
+// all of them
+const SecurityAll = "all"
+
+var (
+	ErrSecurityAdminRequiresExecutor = newClientError("[SecurityAdmin] executor is required", nil)
+	ErrSecurityAdminNameRequired     = newClientError("[SecurityAdmin] user or group name is required", nil)
+	ErrSecurityAdminPermissions      = newClientError("[SecurityAdmin] at least one permission is required", nil)
+	ErrSecurityAdminRoles            = newClientError("[SecurityAdmin] at least one user or group is required", nil)
+	ErrSecurityAdminBucketType       = newClientError("[SecurityAdmin] bucket type is required when bucket is set", nil)
+	ErrSecurityAdminCidrRequired     = newClientError("[SecurityAdmin] CIDR is required", nil)
+	ErrSecurityAdminSourceRequired   = newClientError("[SecurityAdmin] source is required", nil)
+)
+
+// SecurityAdminExecutor runs a `riak-admin security` command with the provided
+// arguments and returns its output
+type SecurityAdminExecutor interface {
+	Execute(args []string) (string, error)
+}
+
+// SecurityAdminExecutorFunc adapts a function to the SecurityAdminExecutor
+// interface
+type SecurityAdminExecutorFunc func(args []string) (string, error)
+
+// Execute implements SecurityAdminExecutor
+func (f SecurityAdminExecutorFunc) Execute(args []string) (string, error) {
+	return f(args)
+}
+
+type riakAdminExecutor struct {
+	command []string
+	quote   bool
+}
+
+// NewRiakAdminExecutor returns a SecurityAdminExecutor that runs riak-admin
+// locally. The command defaults to "riak-admin" and may include leading
+// arguments, for instance to run riak-admin on a Riak node via ssh:
+//
+//	executor := riak.NewRiakAdminExecutor("ssh", "riak@riak-1", "riak-admin")
+//
+// ssh passes its arguments to the remote shell, so when the command is ssh
+// each riak-admin argument is quoted for the shell. The leading arguments
+// are passed as they are.
+func NewRiakAdminExecutor(command ...string) SecurityAdminExecutor {
+	if len(command) == 0 {
+		command = []string{"riak-admin"}
+	}
+	return &riakAdminExecutor{
+		command: command,
+		quote:   filepath.Base(command[0]) == "ssh",
+	}
+}
+
+func (e *riakAdminExecutor) Execute(args []string) (string, error) {
+	output, err := exec.Command(e.command[0], e.commandArgs(args)...).CombinedOutput()
+	return string(output), err
+}
+
+func (e *riakAdminExecutor) commandArgs(args []string) []string {
+	cmdArgs := make([]string, 0, len(e.command)+len(args))
+	cmdArgs = append(cmdArgs, e.command[1:]...)
+	for _, arg := range args {
+		if e.quote {
+			arg = shellQuote(arg)
+		}
+		cmdArgs = append(cmdArgs, arg)
+	}
+	return cmdArgs
+}
+
+// shellQuote quotes s so that a POSIX shell reads it as a single word
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// SecurityAdminError is returned when a riak-admin security command fails.
+// Passwords in Args are redacted
+type SecurityAdminError struct {
+	Args       []string
+	Output     string
+	InnerError error
+}
+
+func (e SecurityAdminError) Error() string {
+	return fmt.Sprintf("SecurityAdminError|%s|%s|%v", strings.Join(e.Args, " "), e.Output, e.InnerError)
+}
+
+// UserOptions are the options for SecurityAdmin.AddUser and AlterUser. Only
+// options that are set are passed to riak-admin
+type UserOptions struct {
+	Password string
+	Groups   []string
+	// Options are any other options, such as "name" or "email"
+	Options map[string]string
+}
+
+// GroupOptions are the options for SecurityAdmin.AddGroup
+type GroupOptions struct {
+	Groups  []string
+	Options map[string]string
+}
+
+// SecurityResource identifies what permissions are granted on. An empty
+// BucketType means any bucket type; Bucket may only be set with a BucketType
+type SecurityResource struct {
+	BucketType string
+	Bucket     string
+}
+
+// SecurityAdmin manages Riak users, groups, permissions and sources. The
+// protocol buffers API has no security administration messages, so
+// SecurityAdmin builds `riak-admin security` commands and runs them with a
+// SecurityAdminExecutor:
+//
+//	admin, err := riak.NewSecurityAdmin(riak.NewRiakAdminExecutor())
+//	err = admin.AddUser("provisioner", &riak.UserOptions{Password: "secret"})
+//	err = admin.Grant([]string{riak.PermissionGet, riak.PermissionPut},
+//		&riak.SecurityResource{BucketType: "animals"}, "provisioner")
+type SecurityAdmin struct {
+	executor SecurityAdminExecutor
+}
+
+// NewSecurityAdmin returns a SecurityAdmin that uses the provided executor
+func NewSecurityAdmin(executor SecurityAdminExecutor) (*SecurityAdmin, error) {
+	if executor == nil {
+		return nil, ErrSecurityAdminRequiresExecutor
+	}
+	return &SecurityAdmin{
+		executor: executor,
+	}, nil
+}
+
+// Enable enables Riak security
+func (a *SecurityAdmin) Enable() error {
+	return a.run("enable")
+}
+
+// Disable disables Riak security
+func (a *SecurityAdmin) Disable() error {
+	return a.run("disable")
+}
+
+// AddUser adds a user.
+//
+// riak-admin only accepts a password on its command line, so while it runs
+// the password is visible to other users of the host running it, such as with
+// ps, and of the Riak node when run via ssh. It is redacted from logs and
+// errors
+func (a *SecurityAdmin) AddUser(user string, options *UserOptions) error {
+	return a.runUser("add-user", user, options)
+}
+
+// AlterUser changes the options of an existing user. As for AddUser, a
+// password is visible on the command line of riak-admin while it runs
+func (a *SecurityAdmin) AlterUser(user string, options *UserOptions) error {
+	return a.runUser("alter-user", user, options)
+}
+
+// DelUser deletes a user
+func (a *SecurityAdmin) DelUser(user string) error {
+	if user == "" {
+		return ErrSecurityAdminNameRequired
+	}
+	return a.run("del-user", user)
+}
+
+// AddGroup adds a group
+func (a *SecurityAdmin) AddGroup(group string, options *GroupOptions) error {
+	if group == "" {
+		return ErrSecurityAdminNameRequired
+	}
+	args := []string{"add-group", group}
+	if options != nil {
+		args = appendSecurityOptions(args, "", options.Groups, options.Options)
+	}
+	return a.run(args...)
+}
+
+// DelGroup deletes a group
+func (a *SecurityAdmin) DelGroup(group string) error {
+	if group == "" {
+		return ErrSecurityAdminNameRequired
+	}
+	return a.run("del-group", group)
+}
+
+// Grant grants permissions on a resource to users or groups. A nil resource
+// means any bucket type and bucket
+func (a *SecurityAdmin) Grant(permissions []string, resource *SecurityResource, roles ...string) error {
+	return a.runPermissions("grant", "to", permissions, resource, roles)
+}
+
+// Revoke revokes permissions on a resource from users or groups
+func (a *SecurityAdmin) Revoke(permissions []string, resource *SecurityResource, roles ...string) error {
+	return a.runPermissions("revoke", "from", permissions, resource, roles)
+}
+
+// AddSource sets how users connecting from the CIDR authenticate. Use
+// SecurityAll as the only user to refer to all users
+func (a *SecurityAdmin) AddSource(users []string, cidr, source string, options map[string]string) error {
+	if len(users) == 0 {
+		return ErrSecurityAdminRoles
+	}
+	if cidr == "" {
+		return ErrSecurityAdminCidrRequired
+	}
+	if source == "" {
+		return ErrSecurityAdminSourceRequired
+	}
+	args := []string{"add-source", strings.Join(users, ","), cidr, source}
+	args = appendSecurityOptions(args, "", nil, options)
+	return a.run(args...)
+}
+
+// DelSource removes the source for the users and CIDR
+func (a *SecurityAdmin) DelSource(users []string, cidr string) error {
+	if len(users) == 0 {
+		return ErrSecurityAdminRoles
+	}
+	if cidr == "" {
+		return ErrSecurityAdminCidrRequired
+	}
+	return a.run("del-source", strings.Join(users, ","), cidr)
+}
+
+func (a *SecurityAdmin) runUser(action, user string, options *UserOptions) error {
+	if user == "" {
+		return ErrSecurityAdminNameRequired
+	}
+	args := []string{action, user}
+	if options != nil {
+		args = appendSecurityOptions(args, options.Password, options.Groups, options.Options)
+	}
+	return a.run(args...)
+}
+
+func (a *SecurityAdmin) runPermissions(action, preposition string, permissions []string, resource *SecurityResource, roles []string) error {
+	if len(permissions) == 0 {
+		return ErrSecurityAdminPermissions
+	}
+	if len(roles) == 0 {
+		return ErrSecurityAdminRoles
+	}
+	args := []string{action, strings.Join(permissions, ","), "on"}
+	if resource == nil || resource.BucketType == "" {
+		if resource != nil && resource.Bucket != "" {
+			return ErrSecurityAdminBucketType
+		}
+		args = append(args, "any")
+	} else {
+		args = append(args, resource.BucketType)
+		if resource.Bucket != "" {
+			args = append(args, resource.Bucket)
+		}
+	}
+	args = append(args, preposition, strings.Join(roles, ","))
+	return a.run(args...)
+}
+
+func (a *SecurityAdmin) run(args ...string) error {
+	args = append([]string{"security"}, args...)
+	logDebug("[SecurityAdmin]", "running riak-admin %s", strings.Join(redactSecurityArgs(args), " "))
+	output, err := a.executor.Execute(args)
+	// NB: riak-admin reports some failures on its output with a zero exit status
+	if err != nil || strings.HasPrefix(strings.TrimSpace(output), "Error") {
+		return SecurityAdminError{
+			Args:       redactSecurityArgs(args),
+			Output:     strings.TrimSpace(output),
+			InnerError: err,
+		}
+	}
+	return nil
+}
+
+// appendSecurityOptions appends option=value arguments, sorted by option so
+// that the command line is stable
+func appendSecurityOptions(args []string, password string, groups []string, options map[string]string) []string {
+	if password != "" {
+		args = append(args, "password="+password)
+	}
+	if len(groups) > 0 {
+		args = append(args, "groups="+strings.Join(groups, ","))
+	}
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, k+"="+options[k])
+	}
+	return args
+}
+
+// redactSecurityArgs returns a copy of args with passwords removed, for logging
+func redactSecurityArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "password=") {
+			arg = "password=REDACTED"
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
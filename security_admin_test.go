@@ -0,0 +1,224 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testSecurityAdminExecutor struct {
+	args   [][]string
+	output string
+	err    error
+}
+
+func (e *testSecurityAdminExecutor) Execute(args []string) (string, error) {
+	e.args = append(e.args, args)
+	return e.output, e.err
+}
+
+func newTestSecurityAdmin(t *testing.T) (*SecurityAdmin, *testSecurityAdminExecutor) {
+	executor := &testSecurityAdminExecutor{}
+	admin, err := NewSecurityAdmin(executor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admin, executor
+}
+
+func TestSecurityAdminBuildsCommandLines(t *testing.T) {
+	admin, executor := newTestSecurityAdmin(t)
+
+	steps := []struct {
+		run      func() error
+		expected string
+	}{
+		{
+			func() error {
+				return admin.AddUser("riakuser", &UserOptions{
+					Password: "secret",
+					Groups:   []string{"admins", "ops"},
+					Options:  map[string]string{"name": "Riak", "email": "riak@example.com"},
+				})
+			},
+			"security add-user riakuser password=secret groups=admins,ops email=riak@example.com name=Riak",
+		},
+		{
+			func() error { return admin.AlterUser("riakuser", &UserOptions{Password: "rotated"}) },
+			"security alter-user riakuser password=rotated",
+		},
+		{
+			func() error { return admin.DelUser("riakuser") },
+			"security del-user riakuser",
+		},
+		{
+			func() error { return admin.AddGroup("admins", &GroupOptions{Groups: []string{"ops"}}) },
+			"security add-group admins groups=ops",
+		},
+		{
+			func() error { return admin.AddGroup("ops", nil) },
+			"security add-group ops",
+		},
+		{
+			func() error { return admin.DelGroup("admins") },
+			"security del-group admins",
+		},
+		{
+			func() error {
+				return admin.Grant([]string{PermissionGet, PermissionPut}, nil, "riakuser", "admins")
+			},
+			"security grant riak_kv.get,riak_kv.put on any to riakuser,admins",
+		},
+		{
+			func() error {
+				return admin.Grant([]string{PermissionGet}, &SecurityResource{BucketType: "animals", Bucket: "dogs"}, SecurityAll)
+			},
+			"security grant riak_kv.get on animals dogs to all",
+		},
+		{
+			func() error {
+				return admin.Revoke([]string{PermissionDelete}, &SecurityResource{BucketType: "animals"}, "riakuser")
+			},
+			"security revoke riak_kv.delete on animals from riakuser",
+		},
+		{
+			func() error { return admin.AddSource([]string{SecurityAll}, "127.0.0.1/32", SourceTrust, nil) },
+			"security add-source all 127.0.0.1/32 trust",
+		},
+		{
+			func() error {
+				return admin.AddSource([]string{"riakuser"}, "10.0.0.0/8", SourcePam, map[string]string{"service": "riak"})
+			},
+			"security add-source riakuser 10.0.0.0/8 pam service=riak",
+		},
+		{
+			func() error { return admin.DelSource([]string{"riakuser"}, "10.0.0.0/8") },
+			"security del-source riakuser 10.0.0.0/8",
+		},
+		{
+			func() error { return admin.Enable() },
+			"security enable",
+		},
+	}
+
+	for i, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if expected, actual := step.expected, strings.Join(executor.args[i], " "); expected != actual {
+			t.Errorf("step %d: expected %v, got %v", i, expected, actual)
+		}
+	}
+}
+
+func TestSecurityAdminValidatesArguments(t *testing.T) {
+	admin, executor := newTestSecurityAdmin(t)
+
+	errs := []struct {
+		expected error
+		actual   error
+	}{
+		{ErrSecurityAdminNameRequired, admin.AddUser("", nil)},
+		{ErrSecurityAdminNameRequired, admin.DelGroup("")},
+		{ErrSecurityAdminPermissions, admin.Grant(nil, nil, "riakuser")},
+		{ErrSecurityAdminRoles, admin.Revoke([]string{PermissionGet}, nil)},
+		{ErrSecurityAdminBucketType, admin.Grant([]string{PermissionGet}, &SecurityResource{Bucket: "dogs"}, "riakuser")},
+		{ErrSecurityAdminCidrRequired, admin.AddSource([]string{"riakuser"}, "", SourcePassword, nil)},
+		{ErrSecurityAdminSourceRequired, admin.AddSource([]string{"riakuser"}, "127.0.0.1/32", "", nil)},
+	}
+	for i, e := range errs {
+		if e.expected != e.actual {
+			t.Errorf("%d: expected %v, got %v", i, e.expected, e.actual)
+		}
+	}
+	if expected, actual := 0, len(executor.args); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if _, err := NewSecurityAdmin(nil); err != ErrSecurityAdminRequiresExecutor {
+		t.Errorf("expected %v, got %v", ErrSecurityAdminRequiresExecutor, err)
+	}
+}
+
+func TestSecurityAdminReturnsErrorWithRedactedPassword(t *testing.T) {
+	admin, executor := newTestSecurityAdmin(t)
+	executor.output = "Error: illegal_name_char\n"
+
+	err := admin.AddUser("riak user", &UserOptions{Password: "secret"})
+	adminErr, ok := err.(SecurityAdminError)
+	if !ok {
+		t.Fatalf("expected SecurityAdminError, got %v", err)
+	}
+	if expected, actual := []string{"security", "add-user", "riak user", "password=REDACTED"}, adminErr.Args; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "Error: illegal_name_char", adminErr.Output; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected password to be redacted, got %v", err)
+	}
+
+	exitErr := errors.New("exit status 1")
+	executor.output = ""
+	executor.err = exitErr
+	err = admin.DelUser("riakuser")
+	if adminErr, ok = err.(SecurityAdminError); !ok {
+		t.Fatalf("expected SecurityAdminError, got %v", err)
+	}
+	if expected, actual := exitErr, adminErr.InnerError; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestRiakAdminExecutorRunsCommand(t *testing.T) {
+	executor := NewRiakAdminExecutor("echo", "riak-admin")
+	output, err := executor.Execute([]string{"security", "status"})
+	if err != nil {
+		t.Skipf("echo is not available: %v", err)
+	}
+	if expected, actual := "riak-admin security status", strings.TrimSpace(output); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestRiakAdminExecutorQuotesArgumentsForSsh(t *testing.T) {
+	executor := NewRiakAdminExecutor("/usr/bin/ssh", "-p", "2222", "riak@riak-1", "riak-admin").(*riakAdminExecutor)
+	args := []string{"security", "add-user", "x; rm -rf /", "password=it's $(secret)", "name=`id`\n"}
+	cmdArgs := executor.commandArgs(args)
+	expected := []string{"-p", "2222", "riak@riak-1", "riak-admin", "'security'", "'add-user'", "'x; rm -rf /'", `'password=it'\''s $(secret)'`, "'name=`id`\n'"}
+	if !reflect.DeepEqual(expected, cmdArgs) {
+		t.Errorf("expected %v, got %v", expected, cmdArgs)
+	}
+
+	// NB: ssh joins its arguments with spaces for the remote shell
+	remote := strings.Join(cmdArgs[4:], " ")
+	output, err := exec.Command("sh", "-c", `printf '%s|' `+remote).Output()
+	if err != nil {
+		t.Skipf("sh is not available: %v", err)
+	}
+	if expected, actual := strings.Join(args, "|")+"|", string(output); expected != actual {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	local := NewRiakAdminExecutor("echo", "riak-admin").(*riakAdminExecutor)
+	if expected, actual := []string{"riak-admin", "x; rm -rf /"}, local.commandArgs([]string{"x; rm -rf /"}); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
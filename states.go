@@ -48,6 +48,8 @@ func (s *stateData) initStateData(desc ...string) {
 }
 
 func (s *stateData) String() string {
+	s.RLock()
+	defer s.RUnlock()
 	stateIdx := int(s.stateVal)
 	if len(s.stateDesc) > stateIdx {
 		return s.stateDesc[stateIdx]
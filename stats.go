@@ -0,0 +1,66 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+// ClusterStats is a point-in-time snapshot of a Cluster, its Nodes and its
+// command queue
+type ClusterStats struct {
+	State         string
+	QueueDepth    uint16 // NB: number of commands waiting in the command queue
+	QueueMaxDepth uint16
+	Nodes         []NodeStats
+}
+
+// NodeStats is a point-in-time snapshot of a Node and its connection pool
+type NodeStats struct {
+	Address              string
+	State                string
+	MinConnections       uint16
+	MaxConnections       uint16
+	OpenConnections      uint16 // NB: connections in the pool plus those executing commands
+	AvailableConnections uint16 // NB: idle connections waiting in the pool
+}
+
+// Stats returns a snapshot of the state of the Cluster and each of its Nodes
+func (c *Cluster) Stats() *ClusterStats {
+	c.Lock()
+	nodes := make([]*Node, len(c.nodes))
+	copy(nodes, c.nodes)
+	c.Unlock()
+
+	s := &ClusterStats{
+		State: c.stateData.String(),
+		Nodes: make([]NodeStats, len(nodes)),
+	}
+	if c.queueCommands {
+		s.QueueDepth = c.cq.count()
+		s.QueueMaxDepth = c.cq.maxDepth
+	}
+	for i, node := range nodes {
+		s.Nodes[i] = node.stats()
+	}
+	return s
+}
+
+func (n *Node) stats() NodeStats {
+	return NodeStats{
+		Address:              n.addr.String(),
+		State:                n.stateData.String(),
+		MinConnections:       n.cm.minConnections,
+		MaxConnections:       n.cm.maxConnections,
+		OpenConnections:      n.cm.count(),
+		AvailableConnections: n.cm.q.count(),
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"time"
+)
+
+// CommandTrace describes the outcome of a single Command passed to a Cluster
+type CommandTrace struct {
+	Command  string
+	Node     string // NB: empty if the Command never reached a Node
+	Start    time.Time
+	Duration time.Duration
+	Attempts byte
+	Error    error
+}
+
+// CommandObserver is notified by a Cluster each time it finishes executing a
+// Command, whether or not execution was successful. CommandExecuted is called
+// from the goroutine that executed the Command and must not block
+type CommandObserver interface {
+	CommandExecuted(trace *CommandTrace)
+}
+
+// SetCommandObserver sets the CommandObserver notified when this Cluster
+// finishes executing a Command. Passing nil disables tracing
+func (c *Cluster) SetCommandObserver(observer CommandObserver) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	c.observer = observer
+}
+
+func (c *Cluster) getCommandObserver() CommandObserver {
+	c.observerMutex.RLock()
+	defer c.observerMutex.RUnlock()
+	return c.observer
+}
+
+func (c *Cluster) traceCommand(async *Async, err error) {
+	observer := c.getCommandObserver()
+	if observer == nil {
+		return
+	}
+	cmd := async.Command
+	trace := &CommandTrace{
+		Command:  cmd.Name(),
+		Start:    async.startedAt,
+		Duration: time.Since(async.startedAt),
+		Attempts: async.attempts,
+		Error:    err,
+	}
+	if trace.Error == nil {
+		trace.Error = cmd.Error()
+	}
+	if ec, ok := cmd.(executedOnCommand); ok {
+		if n := ec.getExecutedOn(); n != nil {
+			trace.Node = n.addr.String()
+		}
+	}
+	observer.CommandExecuted(trace)
+}
@@ -0,0 +1,328 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Arrow flatbuffer enum and union values, from the Arrow format's Schema.fbs
+// and Message.fbs
+const (
+	arrowMetadataVersionV5     = 4
+	arrowHeaderSchema          = 1
+	arrowHeaderRecordBatch     = 3
+	arrowTypeInt               = 2
+	arrowTypeFloatingPoint     = 3
+	arrowTypeBinary            = 4
+	arrowTypeUtf8              = 5
+	arrowTypeBool              = 6
+	arrowTypeTimestamp         = 10
+	arrowPrecisionDouble       = 2
+	arrowTimeUnitMillisecond   = 1
+	arrowContinuationIndicator = 0xFFFFFFFF
+)
+
+// TsArrowEncoder writes results in the Apache Arrow IPC streaming format: a
+// schema message followed by one record batch for each call to WriteRows.
+// VARCHAR columns are Utf8, BLOB columns Binary, SINT64 columns 64 bit
+// signed Int, DOUBLE columns double precision FloatingPoint, TIMESTAMP
+// columns millisecond Timestamps in UTC and BOOLEAN columns Bool. Every
+// column is nullable.
+type TsArrowEncoder struct {
+	writer  io.Writer
+	columns []TsColumnDescription
+}
+
+// NewTsArrowEncoder returns a TsArrowEncoder writing to w
+func NewTsArrowEncoder(w io.Writer) *TsArrowEncoder {
+	return &TsArrowEncoder{writer: w}
+}
+
+// WriteHeader implements TsResultEncoder by writing the schema message
+func (e *TsArrowEncoder) WriteHeader(columns []TsColumnDescription) error {
+	e.columns = columns
+	fields := make([]fbTable, len(columns))
+	for i := range columns {
+		typeID, typeTable := arrowType(columns[i].GetType())
+		fields[i] = fbTable{
+			fbString(columns[i].GetName()),
+			fbScalar(1, 1),
+			fbScalar(1, uint64(typeID)),
+			fbChild(typeTable),
+			nil,
+			fbTableVector(nil),
+		}
+	}
+	schema := fbTable{
+		fbScalar(2, 0),
+		fbTableVector(fields),
+	}
+	return e.writeMessage(arrowHeaderSchema, schema, nil)
+}
+
+func arrowType(columnType string) (byte, fbTable) {
+	switch columnType {
+	case TsColumnTypeSint64:
+		return arrowTypeInt, fbTable{fbScalar(4, 64), fbScalar(1, 1)}
+	case TsColumnTypeDouble:
+		return arrowTypeFloatingPoint, fbTable{fbScalar(2, arrowPrecisionDouble)}
+	case TsColumnTypeTimestamp:
+		return arrowTypeTimestamp, fbTable{fbScalar(2, arrowTimeUnitMillisecond), fbString("UTC")}
+	case TsColumnTypeBoolean:
+		return arrowTypeBool, fbTable{}
+	case TsColumnTypeBlob:
+		return arrowTypeBinary, fbTable{}
+	}
+	return arrowTypeUtf8, fbTable{}
+}
+
+// WriteRows implements TsResultEncoder by writing a record batch message
+func (e *TsArrowEncoder) WriteRows(rows [][]TsCell) error {
+	var body []byte
+	var nodes, buffers [][2]int64
+	addBuffer := func(b []byte) {
+		buffers = append(buffers, [2]int64{int64(len(body)), int64(len(b))})
+		body = append(body, b...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+	}
+
+	n := len(rows)
+	for i := range e.columns {
+		columnType := e.columns[i].GetType()
+		validity := make([]byte, (n+7)/8)
+		nullCount := 0
+		cells := make([]*TsCell, n)
+		for j, row := range rows {
+			if i < len(row) && !row[i].IsNull() {
+				cells[j] = &row[i]
+				validity[j/8] |= 1 << uint(j%8)
+			} else {
+				nullCount++
+			}
+		}
+		nodes = append(nodes, [2]int64{int64(n), int64(nullCount)})
+		addBuffer(validity)
+
+		switch columnType {
+		case TsColumnTypeSint64, TsColumnTypeDouble, TsColumnTypeTimestamp:
+			values := make([]byte, 8*n)
+			for j, cell := range cells {
+				if cell == nil {
+					continue
+				}
+				var v uint64
+				switch columnType {
+				case TsColumnTypeSint64:
+					v = uint64(cell.GetSint64Value())
+				case TsColumnTypeDouble:
+					v = math.Float64bits(cell.GetDoubleValue())
+				case TsColumnTypeTimestamp:
+					v = uint64(cell.GetTimestampValue())
+				}
+				binary.LittleEndian.PutUint64(values[8*j:], v)
+			}
+			addBuffer(values)
+		case TsColumnTypeBoolean:
+			values := make([]byte, (n+7)/8)
+			for j, cell := range cells {
+				if cell != nil && cell.GetBooleanValue() {
+					values[j/8] |= 1 << uint(j%8)
+				}
+			}
+			addBuffer(values)
+		default:
+			offsets := make([]byte, 4*(n+1))
+			var data []byte
+			for j, cell := range cells {
+				if cell != nil {
+					data = append(data, cell.GetBlobValue()...)
+				}
+				binary.LittleEndian.PutUint32(offsets[4*(j+1):], uint32(len(data)))
+			}
+			addBuffer(offsets)
+			addBuffer(data)
+		}
+	}
+
+	batch := fbTable{
+		fbScalar(8, uint64(n)),
+		fbStructVector(nodes),
+		fbStructVector(buffers),
+	}
+	return e.writeMessage(arrowHeaderRecordBatch, batch, body)
+}
+
+// Close implements TsResultEncoder by writing the end of stream marker
+func (e *TsArrowEncoder) Close() error {
+	var b [8]byte
+	binary.LittleEndian.PutUint32(b[:], arrowContinuationIndicator)
+	_, err := e.writer.Write(b[:])
+	return err
+}
+
+// writeMessage writes an encapsulated message: the continuation indicator,
+// the padded metadata length, the Message flatbuffer and the body
+func (e *TsArrowEncoder) writeMessage(headerType byte, header fbTable, body []byte) error {
+	message := fbTable{
+		fbScalar(2, arrowMetadataVersionV5),
+		fbScalar(1, uint64(headerType)),
+		fbChild(header),
+		fbScalar(8, uint64(len(body))),
+	}
+	metadata := buildFlatbuffer(message)
+	for (len(metadata)+8)%8 != 0 {
+		metadata = append(metadata, 0)
+	}
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:], arrowContinuationIndicator)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(metadata)))
+	for _, b := range [][]byte{prefix[:], metadata, body} {
+		if _, err := e.writer.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fbField is a field of a flatbuffer table: either an inline scalar of size
+// bytes, or an offset to an object written after the table by child
+type fbField struct {
+	size   int
+	scalar uint64
+	child  func(b *fbBuilder) int
+}
+
+// fbTable is a flatbuffer table whose fields are indexed by field id. Absent
+// fields are nil
+type fbTable []*fbField
+
+func fbScalar(size int, v uint64) *fbField {
+	return &fbField{size: size, scalar: v}
+}
+
+func fbChild(t fbTable) *fbField {
+	return &fbField{size: 4, child: func(b *fbBuilder) int {
+		return b.table(t)
+	}}
+}
+
+func fbString(s string) *fbField {
+	return &fbField{size: 4, child: func(b *fbBuilder) int {
+		pos := b.alloc(4, 4)
+		b.putUint32(pos, uint32(len(s)))
+		b.buf = append(b.buf, s...)
+		b.buf = append(b.buf, 0)
+		return pos
+	}}
+}
+
+func fbTableVector(tables []fbTable) *fbField {
+	return &fbField{size: 4, child: func(b *fbBuilder) int {
+		pos := b.alloc(4+4*len(tables), 4)
+		b.putUint32(pos, uint32(len(tables)))
+		for i, t := range tables {
+			slot := pos + 4 + 4*i
+			b.putUint32(slot, uint32(b.table(t)-slot))
+		}
+		return pos
+	}}
+}
+
+// fbStructVector writes a vector of structs of two longs, such as the
+// FieldNode and Buffer structs of a RecordBatch
+func fbStructVector(structs [][2]int64) *fbField {
+	return &fbField{size: 4, child: func(b *fbBuilder) int {
+		// the elements must be 8 byte aligned, after the 4 byte length
+		for (len(b.buf)+4)%8 != 0 {
+			b.buf = append(b.buf, 0)
+		}
+		pos := b.alloc(4+16*len(structs), 4)
+		b.putUint32(pos, uint32(len(structs)))
+		for i, s := range structs {
+			binary.LittleEndian.PutUint64(b.buf[pos+4+16*i:], uint64(s[0]))
+			binary.LittleEndian.PutUint64(b.buf[pos+12+16*i:], uint64(s[1]))
+		}
+		return pos
+	}}
+}
+
+// fbBuilder writes a flatbuffer front to back, so that each object's
+// children follow it as unsigned offsets require
+type fbBuilder struct {
+	buf []byte
+}
+
+// buildFlatbuffer returns a flatbuffer with root as its root table
+func buildFlatbuffer(root fbTable) []byte {
+	b := &fbBuilder{}
+	pos := b.alloc(4, 4)
+	b.putUint32(pos, uint32(b.table(root)))
+	return b.buf
+}
+
+func (b *fbBuilder) alloc(n, align int) int {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	pos := len(b.buf)
+	b.buf = append(b.buf, make([]byte, n)...)
+	return pos
+}
+
+func (b *fbBuilder) putUint16(pos int, v uint16) {
+	binary.LittleEndian.PutUint16(b.buf[pos:], v)
+}
+
+func (b *fbBuilder) putUint32(pos int, v uint32) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], v)
+}
+
+// table writes the vtable, then the table, then the table's children, and
+// returns the position of the table
+func (b *fbBuilder) table(t fbTable) int {
+	vtable := b.alloc(4+2*len(t), 2)
+	start := b.alloc(4, 4)
+	positions := make([]int, len(t))
+	for i, f := range t {
+		if f == nil {
+			continue
+		}
+		positions[i] = b.alloc(f.size, f.size)
+		if f.child == nil {
+			for j := 0; j < f.size; j++ {
+				b.buf[positions[i]+j] = byte(f.scalar >> uint(8*j))
+			}
+		}
+	}
+	b.putUint16(vtable, uint16(4+2*len(t)))
+	b.putUint16(vtable+2, uint16(len(b.buf)-start))
+	for i, pos := range positions {
+		if pos != 0 {
+			b.putUint16(vtable+4+2*i, uint16(pos-start))
+		}
+	}
+	b.putUint32(start, uint32(int32(start-vtable)))
+	for i, f := range t {
+		if f != nil && f.child != nil {
+			b.putUint32(positions[i], uint32(f.child(b)-positions[i]))
+		}
+	}
+	return start
+}
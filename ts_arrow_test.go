@@ -0,0 +1,250 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// testFlatbuffer reads tables from a flatbuffer, checking the alignment of
+// what it reads
+type testFlatbuffer struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (fb *testFlatbuffer) uint32(pos int) int {
+	if pos%4 != 0 {
+		fb.t.Errorf("unaligned uint32 at %d", pos)
+	}
+	return int(binary.LittleEndian.Uint32(fb.buf[pos:]))
+}
+
+func (fb *testFlatbuffer) root() int {
+	return fb.uint32(0)
+}
+
+// field returns the position of a table's field, or 0 if it is absent
+func (fb *testFlatbuffer) field(table, id int) int {
+	vtable := table - int(int32(fb.uint32(table)))
+	vtableSize := int(binary.LittleEndian.Uint16(fb.buf[vtable:]))
+	if 4+2*id >= vtableSize {
+		return 0
+	}
+	offset := int(binary.LittleEndian.Uint16(fb.buf[vtable+4+2*id:]))
+	if offset == 0 {
+		return 0
+	}
+	return table + offset
+}
+
+func (fb *testFlatbuffer) scalar(table, id, size int) uint64 {
+	pos := fb.field(table, id)
+	if pos == 0 {
+		return 0
+	}
+	if pos%size != 0 {
+		fb.t.Errorf("unaligned field %d of size %d at %d", id, size, pos)
+	}
+	var v uint64
+	for i := 0; i < size; i++ {
+		v |= uint64(fb.buf[pos+i]) << uint(8*i)
+	}
+	return v
+}
+
+func (fb *testFlatbuffer) offset(table, id int) int {
+	pos := fb.field(table, id)
+	if pos == 0 {
+		return 0
+	}
+	return pos + fb.uint32(pos)
+}
+
+func (fb *testFlatbuffer) string(table, id int) string {
+	pos := fb.offset(table, id)
+	n := fb.uint32(pos)
+	return string(fb.buf[pos+4 : pos+4+n])
+}
+
+// vector returns the length and position of the first element of a vector
+func (fb *testFlatbuffer) vector(table, id int) (int, int) {
+	pos := fb.offset(table, id)
+	if pos == 0 {
+		fb.t.Errorf("missing vector %d", id)
+		return 0, 0
+	}
+	return fb.uint32(pos), pos + 4
+}
+
+func (fb *testFlatbuffer) tableAt(pos int) int {
+	return pos + fb.uint32(pos)
+}
+
+// readTestArrowMessage reads one encapsulated message, returning the
+// Message table, its body and the remaining stream
+func readTestArrowMessage(t *testing.T, stream []byte) (*testFlatbuffer, int, []byte, []byte) {
+	if expected, actual := uint32(0xFFFFFFFF), binary.LittleEndian.Uint32(stream); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	size := int(binary.LittleEndian.Uint32(stream[4:]))
+	if (8+size)%8 != 0 {
+		t.Errorf("metadata of %d bytes is not padded to 8 bytes", size)
+	}
+	fb := &testFlatbuffer{t: t, buf: stream[8 : 8+size]}
+	message := fb.root()
+	bodyLength := int(fb.scalar(message, 3, 8))
+	if bodyLength%8 != 0 {
+		t.Errorf("body of %d bytes is not padded to 8 bytes", bodyLength)
+	}
+	rest := stream[8+size:]
+	return fb, message, rest[:bodyLength], rest[bodyLength:]
+}
+
+func TestTsArrowEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	rsp := newTestTsExportResponse()
+	if err := rsp.Encode(NewTsArrowEncoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+
+	// schema
+	fb, message, body, stream := readTestArrowMessage(t, stream)
+	if expected, actual := uint64(arrowMetadataVersionV5), fb.scalar(message, 0, 2); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint64(arrowHeaderSchema), fb.scalar(message, 1, 1); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 0, len(body); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	schema := fb.offset(message, 2)
+	n, fields := fb.vector(schema, 1)
+	if expected, actual := len(rsp.Columns), n; expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	expectedTypes := []uint64{arrowTypeUtf8, arrowTypeTimestamp, arrowTypeFloatingPoint, arrowTypeInt, arrowTypeBool, arrowTypeBinary}
+	for i := 0; i < n; i++ {
+		field := fb.tableAt(fields + 4*i)
+		if expected, actual := rsp.Columns[i].GetName(), fb.string(field, 0); expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if expected, actual := uint64(1), fb.scalar(field, 1, 1); expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if expected, actual := expectedTypes[i], fb.scalar(field, 2, 1); expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if children, _ := fb.vector(field, 5); children != 0 {
+			t.Errorf("expected no children, got %v", children)
+		}
+		typeTable := fb.offset(field, 3)
+		switch expectedTypes[i] {
+		case arrowTypeTimestamp:
+			if expected, actual := uint64(arrowTimeUnitMillisecond), fb.scalar(typeTable, 0, 2); expected != actual {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+			if expected, actual := "UTC", fb.string(typeTable, 1); expected != actual {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		case arrowTypeInt:
+			if expected, actual := uint64(64), fb.scalar(typeTable, 0, 4); expected != actual {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+			if expected, actual := uint64(1), fb.scalar(typeTable, 1, 1); expected != actual {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		case arrowTypeFloatingPoint:
+			if expected, actual := uint64(arrowPrecisionDouble), fb.scalar(typeTable, 0, 2); expected != actual {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		}
+	}
+
+	// record batch
+	fb, message, body, stream = readTestArrowMessage(t, stream)
+	if expected, actual := uint64(arrowHeaderRecordBatch), fb.scalar(message, 1, 1); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	batch := fb.offset(message, 2)
+	if expected, actual := uint64(2), fb.scalar(batch, 0, 8); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	nodeCount, nodes := fb.vector(batch, 1)
+	bufferCount, buffers := fb.vector(batch, 2)
+	if expected, actual := 6, nodeCount; expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 14, bufferCount; expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if nodes%8 != 0 || buffers%8 != 0 {
+		t.Errorf("struct vectors are not 8 byte aligned: %d, %d", nodes, buffers)
+	}
+	expectedNullCounts := []uint64{0, 0, 0, 1, 0, 1}
+	for i, expected := range expectedNullCounts {
+		if actual := binary.LittleEndian.Uint64(fb.buf[nodes+16*i+8:]); expected != actual {
+			t.Errorf("column %d: expected %v, got %v", i, expected, actual)
+		}
+	}
+	buffer := func(i int) []byte {
+		offset := binary.LittleEndian.Uint64(fb.buf[buffers+16*i:])
+		length := binary.LittleEndian.Uint64(fb.buf[buffers+16*i+8:])
+		if offset%8 != 0 {
+			t.Errorf("buffer %d is not 8 byte aligned", i)
+		}
+		return body[offset : offset+length]
+	}
+	// region: validity, offsets, data
+	if expected, actual := `South "Atlantic", USPacific`, string(buffer(2)); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := uint32(20), binary.LittleEndian.Uint32(buffer(1)[4:]); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// time: validity, values
+	if expected, actual := uint64(1443806900103), binary.LittleEndian.Uint64(buffer(4)); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// temperature: validity, values
+	if expected, actual := 21.5, math.Float64frombits(binary.LittleEndian.Uint64(buffer(6))); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// uv_index: validity, values
+	if expected, actual := byte(1), buffer(7)[0]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(-4), int64(binary.LittleEndian.Uint64(buffer(8))); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// observed: validity, values
+	if expected, actual := byte(1), buffer(10)[0]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// binary: validity, offsets, data
+	if expected, actual := []byte{0, 1, 2}, buffer(13); !bytes.Equal(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// end of stream
+	if expected, actual := []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}, stream; !bytes.Equal(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
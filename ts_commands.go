@@ -150,6 +150,21 @@ func NewTimestampTsCellFromInt64(v int64) TsCell {
 	return TsCell{columnType: tsct, cell: &tsc}
 }
 
+// NewNullTsCell creates a TsCell with no value, for use in nullable columns
+func NewNullTsCell() TsCell {
+	return TsCell{columnType: riak_ts.TsColumnType_VARCHAR, cell: &riak_ts.TsCell{}}
+}
+
+// IsNull returns true if no value is stored within the cell
+func (c *TsCell) IsNull() bool {
+	return c.cell == nil ||
+		(c.cell.VarcharValue == nil &&
+			c.cell.Sint64Value == nil &&
+			c.cell.TimestampValue == nil &&
+			c.cell.BooleanValue == nil &&
+			c.cell.DoubleValue == nil)
+}
+
 // ToUnixMillis converts a time.Time to Unix milliseconds since UTC epoch
 func ToUnixMillis(t time.Time) int64 {
 	return t.UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
@@ -182,6 +197,7 @@ func (c *TsColumnDescription) setColumn(tsCol *riak_ts.TsColumnDescription) {
 type TsStoreRowsCommand struct {
 	commandImpl
 	retryableCommandImpl
+	ttbImpl
 	Response bool
 	protobuf *riak_ts.TsPutReq
 }
@@ -221,6 +237,7 @@ func (cmd *TsStoreRowsCommand) getResponseProtobufMessage() proto.Message {
 //		Build()
 type TsStoreRowsCommandBuilder struct {
 	protobuf *riak_ts.TsPutReq
+	useTtb   bool
 }
 
 // NewTsStoreRowsCommandBuilder is a factory function for generating the command builder struct
@@ -240,6 +257,13 @@ func (builder *TsStoreRowsCommandBuilder) WithRows(rows [][]TsCell) *TsStoreRows
 	return builder
 }
 
+// WithTermToBinary sets the command to use the term-to-binary encoding,
+// which is more compact than protobuf and is supported by Riak TS 1.3+
+func (builder *TsStoreRowsCommandBuilder) WithTermToBinary(useTtb bool) *TsStoreRowsCommandBuilder {
+	builder.useTtb = useTtb
+	return builder
+}
+
 // Build validates the configuration options provided then builds the command
 func (builder *TsStoreRowsCommandBuilder) Build() (Command, error) {
 	if builder.protobuf == nil {
@@ -251,6 +275,7 @@ func (builder *TsStoreRowsCommandBuilder) Build() (Command, error) {
 	}
 
 	return &TsStoreRowsCommand{
+		ttbImpl:  ttbImpl{useTtb: builder.useTtb},
 		protobuf: builder.protobuf,
 	}, nil
 }
@@ -260,6 +285,7 @@ type TsFetchRowCommand struct {
 	commandImpl
 	timeoutImpl
 	retryableCommandImpl
+	ttbImpl
 	Response *TsFetchRowResponse
 	protobuf *riak_ts.TsGetReq
 }
@@ -324,6 +350,23 @@ func (cmd *TsFetchRowCommand) getResponseProtobufMessage() proto.Message {
 	return &riak_ts.TsGetResp{}
 }
 
+func (cmd *TsFetchRowCommand) hedgeClone() Command {
+	return &TsFetchRowCommand{
+		timeoutImpl: cmd.timeoutImpl,
+		ttbImpl:     cmd.ttbImpl,
+		protobuf:    cmd.protobuf,
+	}
+}
+
+func (cmd *TsFetchRowCommand) hedgeAdopt(c Command) {
+	other := c.(*TsFetchRowCommand)
+	cmd.commandImpl.adopt(&other.commandImpl)
+	if n := other.getLastNode(); n != nil {
+		cmd.setLastNode(n)
+	}
+	cmd.Response = other.Response
+}
+
 // TsFetchRowResponse contains the response data for a TsFetchRowCommand
 type TsFetchRowResponse struct {
 	IsNotFound bool
@@ -346,6 +389,7 @@ type TsFetchRowResponse struct {
 type TsFetchRowCommandBuilder struct {
 	timeout  time.Duration
 	protobuf *riak_ts.TsGetReq
+	useTtb   bool
 }
 
 // NewTsFetchRowCommandBuilder is a factory function for generating the command builder struct
@@ -381,6 +425,13 @@ func (builder *TsFetchRowCommandBuilder) WithTimeout(timeout time.Duration) *TsF
 	return builder
 }
 
+// WithTermToBinary sets the command to use the term-to-binary encoding,
+// which is more compact than protobuf and is supported by Riak TS 1.3+
+func (builder *TsFetchRowCommandBuilder) WithTermToBinary(useTtb bool) *TsFetchRowCommandBuilder {
+	builder.useTtb = useTtb
+	return builder
+}
+
 // Build validates the configuration options provided then builds the command
 func (builder *TsFetchRowCommandBuilder) Build() (Command, error) {
 	if builder.protobuf == nil {
@@ -399,6 +450,7 @@ func (builder *TsFetchRowCommandBuilder) Build() (Command, error) {
 		timeoutImpl: timeoutImpl{
 			timeout: builder.timeout,
 		},
+		ttbImpl:  ttbImpl{useTtb: builder.useTtb},
 		protobuf: builder.protobuf,
 	}, nil
 }
@@ -508,10 +560,13 @@ func (builder *TsDeleteRowCommandBuilder) Build() (Command, error) {
 // TsQueryCommand is used to fetch / get a value from Riak TS
 type TsQueryCommand struct {
 	commandImpl
+	ttbImpl
 	Response *TsQueryResponse
 	protobuf *riak_ts.TsQueryReq
 	callback func([][]TsCell) error
-	done     bool
+	// header, if set, is called with the columns of each streamed response
+	header func([]TsColumnDescription) error
+	done   bool
 }
 
 // Name identifies this command
@@ -541,6 +596,16 @@ func (cmd *TsQueryCommand) onSuccess(msg proto.Message) error {
 
 			tsCols := queryResp.GetColumns()
 			tsRows := queryResp.GetRows()
+			if cmd.header != nil && cmd.protobuf.GetStream() {
+				columns := make([]TsColumnDescription, len(tsCols))
+				for i, tsCol := range tsCols {
+					columns[i].setColumn(tsCol)
+				}
+				if err := cmd.header(columns); err != nil {
+					cmd.Response = nil
+					return err
+				}
+			}
 			if tsCols != nil && tsRows != nil {
 				if tsCols != nil && response.Columns == nil {
 					response.Columns = make([]TsColumnDescription, 0)
@@ -605,6 +670,8 @@ type TsQueryResponse struct {
 type TsQueryCommandBuilder struct {
 	protobuf *riak_ts.TsQueryReq
 	callback func(rows [][]TsCell) error
+	encoder  TsResultEncoder
+	useTtb   bool
 }
 
 // NewTsQueryCommandBuilder is a factory function for generating the command builder struct
@@ -613,7 +680,9 @@ func NewTsQueryCommandBuilder() *TsQueryCommandBuilder {
 	return builder
 }
 
-// WithQuery sets the query to be used by the command
+// WithQuery sets the query to be used by the command. Use BindTsQuery or
+// TsSelectQueryBuilder to include values in the query rather than formatting
+// them into it.
 func (builder *TsQueryCommandBuilder) WithQuery(query string) *TsQueryCommandBuilder {
 	builder.protobuf.Query = &riak_ts.TsInterpolation{Base: []byte(query)}
 	return builder
@@ -635,6 +704,33 @@ func (builder *TsQueryCommandBuilder) WithCallback(callback func([][]TsCell) err
 	return builder
 }
 
+// WithEncoder sets the command to stream its results to encoder instead of a
+// callback. The encoder must be closed once the command has been executed
+//
+//	encoder := riak.NewTsCSVEncoder(file)
+//	cmd, err := riak.NewTsQueryCommandBuilder().
+//		WithQuery(query).
+//		WithEncoder(encoder).
+//		Build()
+//	...
+//	err = cluster.Execute(cmd)
+//	...
+//	err = encoder.Close()
+func (builder *TsQueryCommandBuilder) WithEncoder(encoder TsResultEncoder) *TsQueryCommandBuilder {
+	streaming := true
+	builder.protobuf.Stream = &streaming
+	builder.encoder = encoder
+	return builder
+}
+
+// WithTermToBinary sets the command to use the term-to-binary encoding,
+// which is more compact than protobuf and is supported by Riak TS 1.3+.
+// Streaming is not supported with term-to-binary.
+func (builder *TsQueryCommandBuilder) WithTermToBinary(useTtb bool) *TsQueryCommandBuilder {
+	builder.useTtb = useTtb
+	return builder
+}
+
 // Build validates the configuration options provided then builds the command
 func (builder *TsQueryCommandBuilder) Build() (Command, error) {
 	if builder.protobuf == nil {
@@ -645,14 +741,27 @@ func (builder *TsQueryCommandBuilder) Build() (Command, error) {
 		return nil, ErrQueryRequired
 	}
 
-	if builder.protobuf.GetStream() && builder.callback == nil {
+	if builder.protobuf.GetStream() && builder.callback == nil && builder.encoder == nil {
 		return nil, newClientError("TsQueryCommand requires a callback when streaming.", nil)
 	}
 
-	return &TsQueryCommand{
+	if builder.callback != nil && builder.encoder != nil {
+		return nil, newClientError("TsQueryCommand accepts a callback or an encoder, not both.", nil)
+	}
+
+	if builder.protobuf.GetStream() && builder.useTtb {
+		return nil, newClientError("TsQueryCommand does not support streaming with term-to-binary.", nil)
+	}
+
+	cmd := &TsQueryCommand{
+		ttbImpl:  ttbImpl{useTtb: builder.useTtb},
 		protobuf: builder.protobuf,
 		callback: builder.callback,
-	}, nil
+	}
+	if builder.encoder != nil {
+		cmd.header, cmd.callback = newTsEncoderCallbacks(builder.encoder)
+	}
+	return cmd, nil
 }
 
 // TsListKeys
@@ -0,0 +1,225 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// tsTimestampLayout is the layout timestamps are exported with, in UTC
+const tsTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// TsResultEncoder writes time series query results in another format.
+// WriteHeader is called once with the columns, followed by WriteRows for each
+// batch of rows, and Close once all rows have been written.
+//
+// A TsQueryResponse is written with its Encode method. Streamed results are
+// written as they arrive by passing the encoder to
+// TsQueryCommandBuilder.WithEncoder, in which case Close must be called once
+// the command has been executed.
+type TsResultEncoder interface {
+	WriteHeader(columns []TsColumnDescription) error
+	WriteRows(rows [][]TsCell) error
+	Close() error
+}
+
+// Encode writes the response with encoder and closes it
+func (rsp *TsQueryResponse) Encode(encoder TsResultEncoder) error {
+	if err := encoder.WriteHeader(rsp.Columns); err != nil {
+		return err
+	}
+	if len(rsp.Rows) > 0 {
+		if err := encoder.WriteRows(rsp.Rows); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// newTsEncoderCallbacks returns the streaming callbacks for a command that
+// write the columns of the first response, even if it has no rows, then every
+// row, with encoder
+func newTsEncoderCallbacks(encoder TsResultEncoder) (func([]TsColumnDescription) error, func([][]TsCell) error) {
+	headerWritten := false
+	header := func(columns []TsColumnDescription) error {
+		if headerWritten {
+			return nil
+		}
+		headerWritten = true
+		return encoder.WriteHeader(columns)
+	}
+	return header, encoder.WriteRows
+}
+
+func formatTsTimestamp(millis int64) string {
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(tsTimestampLayout)
+}
+
+// TsCSVEncoder writes results as CSV with a header row of column names.
+// Timestamps are written in RFC 3339 format in UTC with millisecond
+// precision, blobs are base64 encoded and nulls are empty fields
+type TsCSVEncoder struct {
+	writer  *csv.Writer
+	columns []TsColumnDescription
+}
+
+// NewTsCSVEncoder returns a TsCSVEncoder writing to w
+func NewTsCSVEncoder(w io.Writer) *TsCSVEncoder {
+	return &TsCSVEncoder{writer: csv.NewWriter(w)}
+}
+
+// WriteHeader implements TsResultEncoder
+func (e *TsCSVEncoder) WriteHeader(columns []TsColumnDescription) error {
+	e.columns = columns
+	record := make([]string, len(columns))
+	for i := range columns {
+		record[i] = columns[i].GetName()
+	}
+	return e.writer.Write(record)
+}
+
+// WriteRows implements TsResultEncoder
+func (e *TsCSVEncoder) WriteRows(rows [][]TsCell) error {
+	record := make([]string, len(e.columns))
+	for _, row := range rows {
+		for i := range record {
+			record[i] = ""
+			if i >= len(row) || row[i].IsNull() {
+				continue
+			}
+			cell := &row[i]
+			switch e.columns[i].GetType() {
+			case TsColumnTypeVarchar:
+				record[i] = cell.GetStringValue()
+			case TsColumnTypeBlob:
+				record[i] = base64.StdEncoding.EncodeToString(cell.GetBlobValue())
+			case TsColumnTypeSint64:
+				record[i] = strconv.FormatInt(cell.GetSint64Value(), 10)
+			case TsColumnTypeDouble:
+				record[i] = strconv.FormatFloat(cell.GetDoubleValue(), 'g', -1, 64)
+			case TsColumnTypeTimestamp:
+				record[i] = formatTsTimestamp(cell.GetTimestampValue())
+			case TsColumnTypeBoolean:
+				record[i] = strconv.FormatBool(cell.GetBooleanValue())
+			}
+		}
+		if err := e.writer.Write(record); err != nil {
+			return err
+		}
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// Close implements TsResultEncoder
+func (e *TsCSVEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// TsJSONLinesEncoder writes each row as a JSON object on its own line, with
+// the columns as keys in column order. Sint64 and double columns are numbers,
+// timestamps are RFC 3339 strings in UTC with millisecond precision, blobs
+// are base64 encoded strings and nulls, NaN and infinities are null
+type TsJSONLinesEncoder struct {
+	writer  *bufio.Writer
+	columns []TsColumnDescription
+	keys    [][]byte
+}
+
+// NewTsJSONLinesEncoder returns a TsJSONLinesEncoder writing to w
+func NewTsJSONLinesEncoder(w io.Writer) *TsJSONLinesEncoder {
+	return &TsJSONLinesEncoder{writer: bufio.NewWriter(w)}
+}
+
+// WriteHeader implements TsResultEncoder
+func (e *TsJSONLinesEncoder) WriteHeader(columns []TsColumnDescription) error {
+	e.columns = columns
+	e.keys = make([][]byte, len(columns))
+	for i := range columns {
+		key, err := json.Marshal(columns[i].GetName())
+		if err != nil {
+			return err
+		}
+		e.keys[i] = key
+	}
+	return nil
+}
+
+// WriteRows implements TsResultEncoder
+func (e *TsJSONLinesEncoder) WriteRows(rows [][]TsCell) error {
+	var buf []byte
+	for _, row := range rows {
+		buf = append(buf[:0], '{')
+		for i := range e.columns {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, e.keys[i]...)
+			buf = append(buf, ':')
+			if i >= len(row) || row[i].IsNull() {
+				buf = append(buf, "null"...)
+				continue
+			}
+			cell := &row[i]
+			switch e.columns[i].GetType() {
+			case TsColumnTypeVarchar:
+				s, err := json.Marshal(cell.GetStringValue())
+				if err != nil {
+					return err
+				}
+				buf = append(buf, s...)
+			case TsColumnTypeBlob:
+				buf = append(buf, '"')
+				buf = append(buf, base64.StdEncoding.EncodeToString(cell.GetBlobValue())...)
+				buf = append(buf, '"')
+			case TsColumnTypeSint64:
+				buf = strconv.AppendInt(buf, cell.GetSint64Value(), 10)
+			case TsColumnTypeDouble:
+				v := cell.GetDoubleValue()
+				if math.IsNaN(v) || math.IsInf(v, 0) {
+					buf = append(buf, "null"...)
+				} else {
+					buf = strconv.AppendFloat(buf, v, 'g', -1, 64)
+				}
+			case TsColumnTypeTimestamp:
+				buf = append(buf, '"')
+				buf = append(buf, formatTsTimestamp(cell.GetTimestampValue())...)
+				buf = append(buf, '"')
+			case TsColumnTypeBoolean:
+				buf = strconv.AppendBool(buf, cell.GetBooleanValue())
+			default:
+				buf = append(buf, "null"...)
+			}
+		}
+		buf = append(buf, '}', '\n')
+		if _, err := e.writer.Write(buf); err != nil {
+			return err
+		}
+	}
+	return e.writer.Flush()
+}
+
+// Close implements TsResultEncoder
+func (e *TsJSONLinesEncoder) Close() error {
+	return e.writer.Flush()
+}
@@ -0,0 +1,174 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/basho/riak-go-client/rpb/riak_ts"
+)
+
+func newTestTsExportResponse() *TsQueryResponse {
+	columns := []*riak_ts.TsColumnDescription{
+		{Name: []byte("region"), Type: riak_ts.TsColumnType_VARCHAR.Enum()},
+		{Name: []byte("time"), Type: riak_ts.TsColumnType_TIMESTAMP.Enum()},
+		{Name: []byte("temperature"), Type: riak_ts.TsColumnType_DOUBLE.Enum()},
+		{Name: []byte("uv_index"), Type: riak_ts.TsColumnType_SINT64.Enum()},
+		{Name: []byte("observed"), Type: riak_ts.TsColumnType_BOOLEAN.Enum()},
+		{Name: []byte("binary"), Type: riak_ts.TsColumnType_BLOB.Enum()},
+	}
+	rsp := &TsQueryResponse{}
+	for _, column := range columns {
+		rsp.Columns = append(rsp.Columns, TsColumnDescription{column: column})
+	}
+	rsp.Rows = [][]TsCell{
+		{
+			NewStringTsCell(`South "Atlantic", US`),
+			NewTimestampTsCellFromInt64(1443806900103),
+			NewDoubleTsCell(21.5),
+			NewSint64TsCell(-4),
+			NewBooleanTsCell(true),
+			NewBlobTsCell([]byte{0, 1, 2}),
+		},
+		{
+			NewStringTsCell("Pacific"),
+			NewTimestampTsCellFromInt64(0),
+			NewDoubleTsCell(math.NaN()),
+			NewNullTsCell(),
+			NewBooleanTsCell(false),
+			NewNullTsCell(),
+		},
+	}
+	return rsp
+}
+
+func TestTsCSVEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestTsExportResponse().Encode(NewTsCSVEncoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	expected := "region,time,temperature,uv_index,observed,binary\n" +
+		`"South ""Atlantic"", US",2015-10-02T17:28:20.103Z,21.5,-4,true,AAEC` + "\n" +
+		"Pacific,1970-01-01T00:00:00.000Z,NaN,,false,\n"
+	if actual := buf.String(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsJSONLinesEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestTsExportResponse().Encode(NewTsJSONLinesEncoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"region":"South \"Atlantic\", US","time":"2015-10-02T17:28:20.103Z","temperature":21.5,"uv_index":-4,"observed":true,"binary":"AAEC"}` + "\n" +
+		`{"region":"Pacific","time":"1970-01-01T00:00:00.000Z","temperature":null,"uv_index":null,"observed":false,"binary":null}` + "\n"
+	if actual := buf.String(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsQueryCommandStreamsToEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewTsCSVEncoder(&buf)
+	cmd, err := NewTsQueryCommandBuilder().
+		WithQuery("select * from WeatherByRegion").
+		WithEncoder(encoder).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp := newTestTsExportResponse()
+	var tsCols []*riak_ts.TsColumnDescription
+	for _, column := range rsp.Columns {
+		tsCols = append(tsCols, column.column)
+	}
+	for i, row := range rsp.Rows {
+		done := i == len(rsp.Rows)-1
+		if err := cmd.onSuccess(&riak_ts.TsQueryResp{
+			Columns: tsCols,
+			Rows:    convertFromTsRows([][]TsCell{row}),
+			Done:    &done,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected bytes.Buffer
+	if err := rsp.Encode(NewTsCSVEncoder(&expected)); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := expected.String(), buf.String(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if _, err := NewTsQueryCommandBuilder().
+		WithQuery("select * from WeatherByRegion").
+		WithCallback(func([][]TsCell) error { return nil }).
+		WithEncoder(encoder).
+		Build(); err == nil {
+		t.Error("expected an error for a callback and an encoder")
+	}
+}
+
+func TestTsQueryCommandStreamsEmptyResultToEncoder(t *testing.T) {
+	rsp := newTestTsExportResponse()
+	rsp.Rows = nil
+	var tsCols []*riak_ts.TsColumnDescription
+	for _, column := range rsp.Columns {
+		tsCols = append(tsCols, column.column)
+	}
+	encoders := map[string]func(*bytes.Buffer) TsResultEncoder{
+		"csv": func(buf *bytes.Buffer) TsResultEncoder {
+			return NewTsCSVEncoder(buf)
+		},
+		"arrow": func(buf *bytes.Buffer) TsResultEncoder {
+			return NewTsArrowEncoder(buf)
+		},
+	}
+	for name, newEncoder := range encoders {
+		var buf bytes.Buffer
+		encoder := newEncoder(&buf)
+		cmd, err := NewTsQueryCommandBuilder().
+			WithQuery("select * from WeatherByRegion").
+			WithEncoder(encoder).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := true
+		if err = cmd.onSuccess(&riak_ts.TsQueryResp{Columns: tsCols, Done: &done}); err != nil {
+			t.Fatal(err)
+		}
+		if err = encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var expected bytes.Buffer
+		if err = rsp.Encode(newEncoder(&expected)); err != nil {
+			t.Fatal(err)
+		}
+		if expected.Len() == 0 {
+			t.Errorf("%s: expected a header", name)
+		}
+		if expected, actual := expected.String(), buf.String(); expected != actual {
+			t.Errorf("%s: expected %q, got %q", name, expected, actual)
+		}
+	}
+}
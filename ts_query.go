@@ -0,0 +1,329 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Aggregate functions supported by Riak TS queries
+const (
+	TsAggregateAvg    = "AVG"
+	TsAggregateCount  = "COUNT"
+	TsAggregateMax    = "MAX"
+	TsAggregateMean   = "MEAN"
+	TsAggregateMin    = "MIN"
+	TsAggregateStddev = "STDDEV"
+	TsAggregateSum    = "SUM"
+)
+
+var (
+	ErrTsQueryNullParameter = newClientError("[TsQuery] null cannot be bound as a parameter, use WithNullCondition", nil)
+)
+
+var tsQueryOperators = []string{"=", "!=", "<", "<=", ">", ">="}
+
+// BindTsQuery replaces each ? placeholder in query with the corresponding
+// parameter, rendered as a literal of the parameter's type. Placeholders in
+// quoted strings and identifiers are left alone.
+//
+// Riak TS does not apply the Interpolations of a query, so parameters are
+// bound on the client instead.
+//
+//	query, err := riak.BindTsQuery(
+//		"select * from GeoCheckin where region = ? and time >= ? and time < ?",
+//		riak.NewStringTsCell(region),
+//		riak.NewTimestampTsCell(start),
+//		riak.NewTimestampTsCell(end))
+func BindTsQuery(query string, params ...TsCell) (string, error) {
+	var buf bytes.Buffer
+	var quote rune
+	next := 0
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// a doubled quote closes and reopens, which is how it is escaped
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			if next >= len(params) {
+				return "", fmt.Errorf("[TsQuery] query has more placeholders than the %d parameters", len(params))
+			}
+			literal, err := TsLiteral(params[next])
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(literal)
+			next++
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	if next != len(params) {
+		return "", fmt.Errorf("[TsQuery] query has %d placeholders, got %d parameters", next, len(params))
+	}
+	return buf.String(), nil
+}
+
+// TsLiteral renders a cell as a Riak TS query literal
+func TsLiteral(cell TsCell) (string, error) {
+	if cell.IsNull() {
+		return "", ErrTsQueryNullParameter
+	}
+	switch cell.GetDataType() {
+	case TsColumnTypeVarchar:
+		return "'" + strings.Replace(cell.GetStringValue(), "'", "''", -1) + "'", nil
+	case TsColumnTypeBlob:
+		return "0x" + hex.EncodeToString(cell.GetBlobValue()), nil
+	case TsColumnTypeSint64:
+		return strconv.FormatInt(cell.GetSint64Value(), 10), nil
+	case TsColumnTypeTimestamp:
+		return strconv.FormatInt(cell.GetTimestampValue(), 10), nil
+	case TsColumnTypeBoolean:
+		return strconv.FormatBool(cell.GetBooleanValue()), nil
+	case TsColumnTypeDouble:
+		v := cell.GetDoubleValue()
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("[TsQuery] %v cannot be used as a parameter", v)
+		}
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("[TsQuery] unsupported cell type '%s'", cell.GetDataType())
+}
+
+type tsCondition struct {
+	column   string
+	operator string
+	value    TsCell
+}
+
+type tsOrder struct {
+	column     string
+	descending bool
+}
+
+// TsSelectQueryBuilder builds SELECT queries for Riak TS tables, quoting
+// identifiers and rendering values with TsLiteral. Conditions are combined
+// with AND.
+//
+//	builder, err := riak.NewTsSelectQueryBuilder().
+//		WithTable("GeoCheckin").
+//		WithAggregate(riak.TsAggregateAvg, "temperature").
+//		WithCondition("region", "=", riak.NewStringTsCell("South Atlantic")).
+//		WithTimeRange("time", start, end).
+//		NewQueryCommandBuilder()
+type TsSelectQueryBuilder struct {
+	table      string
+	columns    []string
+	conditions []tsCondition
+	groupBy    []string
+	orderBy    []tsOrder
+	limit      uint64
+	offset     uint64
+	err        error
+}
+
+// NewTsSelectQueryBuilder is a factory function for generating the query builder struct
+func NewTsSelectQueryBuilder() *TsSelectQueryBuilder {
+	return &TsSelectQueryBuilder{}
+}
+
+// WithTable sets the table to select from
+func (builder *TsSelectQueryBuilder) WithTable(table string) *TsSelectQueryBuilder {
+	builder.table = table
+	return builder
+}
+
+// WithColumns adds columns to the selection. All columns are selected if no
+// columns or aggregates are added.
+func (builder *TsSelectQueryBuilder) WithColumns(columns ...string) *TsSelectQueryBuilder {
+	for _, column := range columns {
+		builder.columns = append(builder.columns, tsQuoteIdentifier(column))
+	}
+	return builder
+}
+
+// WithAggregate adds an aggregate of a column to the selection. The column
+// may be * for COUNT.
+func (builder *TsSelectQueryBuilder) WithAggregate(function, column string) *TsSelectQueryBuilder {
+	function = strings.ToUpper(function)
+	switch function {
+	case TsAggregateAvg, TsAggregateCount, TsAggregateMax, TsAggregateMean,
+		TsAggregateMin, TsAggregateStddev, TsAggregateSum:
+	default:
+		builder.setError(fmt.Errorf("[TsQuery] unknown aggregate function '%s'", function))
+		return builder
+	}
+	if column != "*" {
+		column = tsQuoteIdentifier(column)
+	} else if function != TsAggregateCount {
+		builder.setError(fmt.Errorf("[TsQuery] %s requires a column", function))
+		return builder
+	}
+	builder.columns = append(builder.columns, fmt.Sprintf("%s(%s)", function, column))
+	return builder
+}
+
+// WithCondition adds a comparison of a column with a value, where operator
+// is one of =, !=, <, <=, > or >=
+func (builder *TsSelectQueryBuilder) WithCondition(column, operator string, value TsCell) *TsSelectQueryBuilder {
+	if !containsString(tsQueryOperators, operator) {
+		builder.setError(fmt.Errorf("[TsQuery] unknown operator '%s'", operator))
+		return builder
+	}
+	builder.conditions = append(builder.conditions, tsCondition{column: column, operator: operator, value: value})
+	return builder
+}
+
+// WithTimeRange adds the condition start <= column < end
+func (builder *TsSelectQueryBuilder) WithTimeRange(column string, start, end time.Time) *TsSelectQueryBuilder {
+	return builder.
+		WithCondition(column, ">=", NewTimestampTsCell(start)).
+		WithCondition(column, "<", NewTimestampTsCell(end))
+}
+
+// WithNullCondition adds a condition that a column is, or is not, null
+func (builder *TsSelectQueryBuilder) WithNullCondition(column string, isNull bool) *TsSelectQueryBuilder {
+	operator := "IS NOT NULL"
+	if isNull {
+		operator = "IS NULL"
+	}
+	builder.conditions = append(builder.conditions, tsCondition{column: column, operator: operator})
+	return builder
+}
+
+// WithGroupBy groups the results by the given columns
+func (builder *TsSelectQueryBuilder) WithGroupBy(columns ...string) *TsSelectQueryBuilder {
+	builder.groupBy = append(builder.groupBy, columns...)
+	return builder
+}
+
+// WithOrderBy orders the results by a column, ascending unless descending is
+// set. It may be called once per column.
+func (builder *TsSelectQueryBuilder) WithOrderBy(column string, descending bool) *TsSelectQueryBuilder {
+	builder.orderBy = append(builder.orderBy, tsOrder{column: column, descending: descending})
+	return builder
+}
+
+// WithLimit sets the maximum number of rows returned
+func (builder *TsSelectQueryBuilder) WithLimit(limit uint64) *TsSelectQueryBuilder {
+	builder.limit = limit
+	return builder
+}
+
+// WithOffset sets the number of rows skipped, and requires a limit
+func (builder *TsSelectQueryBuilder) WithOffset(offset uint64) *TsSelectQueryBuilder {
+	builder.offset = offset
+	return builder
+}
+
+func (builder *TsSelectQueryBuilder) setError(err error) {
+	if builder.err == nil {
+		builder.err = err
+	}
+}
+
+// Query validates the configuration options provided then renders the query
+func (builder *TsSelectQueryBuilder) Query() (string, error) {
+	if builder.err != nil {
+		return "", builder.err
+	}
+	if builder.table == "" {
+		return "", ErrTableRequired
+	}
+	if builder.offset > 0 && builder.limit == 0 {
+		return "", newClientError("[TsQuery] OFFSET requires a LIMIT", nil)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("SELECT ")
+	if len(builder.columns) == 0 {
+		buf.WriteString("*")
+	} else {
+		buf.WriteString(strings.Join(builder.columns, ", "))
+	}
+	buf.WriteString(" FROM ")
+	buf.WriteString(tsQuoteIdentifier(builder.table))
+
+	for i, condition := range builder.conditions {
+		if i == 0 {
+			buf.WriteString(" WHERE ")
+		} else {
+			buf.WriteString(" AND ")
+		}
+		buf.WriteString(tsQuoteIdentifier(condition.column))
+		buf.WriteString(" ")
+		buf.WriteString(condition.operator)
+		if condition.value.cell == nil {
+			continue
+		}
+		literal, err := TsLiteral(condition.value)
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(" ")
+		buf.WriteString(literal)
+	}
+	if len(builder.groupBy) > 0 {
+		columns := make([]string, len(builder.groupBy))
+		for i, column := range builder.groupBy {
+			columns[i] = tsQuoteIdentifier(column)
+		}
+		buf.WriteString(" GROUP BY ")
+		buf.WriteString(strings.Join(columns, ", "))
+	}
+	if len(builder.orderBy) > 0 {
+		columns := make([]string, len(builder.orderBy))
+		for i, order := range builder.orderBy {
+			columns[i] = tsQuoteIdentifier(order.column)
+			if order.descending {
+				columns[i] += " DESC"
+			} else {
+				columns[i] += " ASC"
+			}
+		}
+		buf.WriteString(" ORDER BY ")
+		buf.WriteString(strings.Join(columns, ", "))
+	}
+	if builder.limit > 0 {
+		fmt.Fprintf(&buf, " LIMIT %d", builder.limit)
+	}
+	if builder.offset > 0 {
+		fmt.Fprintf(&buf, " OFFSET %d", builder.offset)
+	}
+	return buf.String(), nil
+}
+
+// NewQueryCommandBuilder returns a TsQueryCommandBuilder for the query
+func (builder *TsSelectQueryBuilder) NewQueryCommandBuilder() (*TsQueryCommandBuilder, error) {
+	query, err := builder.Query()
+	if err != nil {
+		return nil, err
+	}
+	return NewTsQueryCommandBuilder().WithQuery(query), nil
+}
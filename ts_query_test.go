@@ -0,0 +1,135 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTsLiteral(t *testing.T) {
+	tests := []struct {
+		cell     TsCell
+		expected string
+	}{
+		{NewStringTsCell("South Carolina"), "'South Carolina'"},
+		{NewStringTsCell("x' or '1'='1"), "'x'' or ''1''=''1'"},
+		{NewBlobTsCell([]byte{0x00, 0xab}), "0x00ab"},
+		{NewSint64TsCell(-42), "-42"},
+		{NewTimestampTsCellFromInt64(1443806900103), "1443806900103"},
+		{NewBooleanTsCell(true), "true"},
+		{NewDoubleTsCell(21.5), "21.5"},
+		{NewDoubleTsCell(3), "3.0"},
+	}
+	for _, test := range tests {
+		actual, err := TsLiteral(test.cell)
+		if err != nil {
+			t.Error(err)
+		}
+		if expected := test.expected; expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+	if _, err := TsLiteral(NewNullTsCell()); err != ErrTsQueryNullParameter {
+		t.Errorf("expected %v, got %v", ErrTsQueryNullParameter, err)
+	}
+	if _, err := TsLiteral(NewDoubleTsCell(math.NaN())); err == nil {
+		t.Error("expected an error for NaN")
+	}
+}
+
+func TestBindTsQuery(t *testing.T) {
+	query, err := BindTsQuery(
+		`select * from "Table?" where region = ? and note = 'why?' and time >= ? and time < ?`,
+		NewStringTsCell("it's"),
+		NewTimestampTsCellFromInt64(1000),
+		NewTimestampTsCellFromInt64(2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `select * from "Table?" where region = 'it''s' and note = 'why?' and time >= 1000 and time < 2000`
+	if actual := query; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if _, err := BindTsQuery("select * from t where a = ? and b = ?", NewSint64TsCell(1)); err == nil {
+		t.Error("expected an error for too few parameters")
+	}
+	if _, err := BindTsQuery("select * from t where a = ?", NewSint64TsCell(1), NewSint64TsCell(2)); err == nil {
+		t.Error("expected an error for too many parameters")
+	}
+}
+
+func TestTsSelectQueryBuilder(t *testing.T) {
+	start := time.Unix(1443806900, 0)
+	end := start.Add(15 * time.Minute)
+	builder := NewTsSelectQueryBuilder().
+		WithTable("WeatherByRegion").
+		WithColumns("region", "uv index").
+		WithAggregate("avg", "temperature").
+		WithAggregate(TsAggregateCount, "*").
+		WithCondition("region", "=", NewStringTsCell("South Atlantic")).
+		WithCondition("state", "=", NewStringTsCell("South Carolina")).
+		WithTimeRange("time", start, end).
+		WithNullCondition("temperature", false).
+		WithGroupBy("region", "uv index").
+		WithOrderBy("uv index", true).
+		WithLimit(10).
+		WithOffset(20)
+	query, err := builder.Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT region, "uv index", AVG(temperature), COUNT(*) FROM WeatherByRegion` +
+		` WHERE region = 'South Atlantic' AND state = 'South Carolina'` +
+		` AND time >= 1443806900000 AND time < 1443807800000 AND temperature IS NOT NULL` +
+		` GROUP BY region, "uv index" ORDER BY "uv index" DESC LIMIT 10 OFFSET 20`
+	if actual := query; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	cmdBuilder, err := builder.NewQueryCommandBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := string(cmdBuilder.protobuf.GetQuery().GetBase()); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	query, err = NewTsSelectQueryBuilder().WithTable("t").Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "SELECT * FROM t", query; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsSelectQueryBuilderErrors(t *testing.T) {
+	builders := map[string]*TsSelectQueryBuilder{
+		"no table":          NewTsSelectQueryBuilder(),
+		"unknown aggregate": NewTsSelectQueryBuilder().WithTable("t").WithAggregate("MEDIAN", "a"),
+		"star aggregate":    NewTsSelectQueryBuilder().WithTable("t").WithAggregate(TsAggregateSum, "*"),
+		"unknown operator":  NewTsSelectQueryBuilder().WithTable("t").WithCondition("a", "LIKE", NewStringTsCell("x")),
+		"null value":        NewTsSelectQueryBuilder().WithTable("t").WithCondition("a", "=", NewNullTsCell()),
+		"offset only":       NewTsSelectQueryBuilder().WithTable("t").WithOffset(5),
+	}
+	for name, builder := range builders {
+		if _, err := builder.Query(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,654 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/basho/riak-go-client/rpb/riak_ts"
+)
+
+// Time series column types, as returned by TsColumnDescription.GetType and
+// TsCell.GetDataType
+const (
+	TsColumnTypeVarchar   = "VARCHAR"
+	TsColumnTypeSint64    = "SINT64"
+	TsColumnTypeDouble    = "DOUBLE"
+	TsColumnTypeTimestamp = "TIMESTAMP"
+	TsColumnTypeBoolean   = "BOOLEAN"
+	TsColumnTypeBlob      = "BLOB"
+)
+
+// Time series quantum units
+const (
+	TsQuantumDays    = "d"
+	TsQuantumHours   = "h"
+	TsQuantumMinutes = "m"
+	TsQuantumSeconds = "s"
+)
+
+var (
+	ErrTsSchemaColumnsRequired      = newClientError("[TsTableSchema] at least one column is required", nil)
+	ErrTsSchemaPartitionKeyRequired = newClientError("[TsTableSchema] a partition key is required", nil)
+	ErrTsDescribeResponseRequired   = newClientError("[TsTableSchema] a DESCRIBE response is required", nil)
+)
+
+// TsColumn describes a column of a time series table
+type TsColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// TsQuantum describes how the timestamp column of a partition key is divided
+// into time ranges
+type TsQuantum struct {
+	Column   string
+	Interval int
+	Unit     string
+}
+
+// TsTableSchema describes a time series table. LocalKey defaults to the
+// partition key columns when empty.
+//
+//	schema := &riak.TsTableSchema{
+//		Table: "WeatherByRegion",
+//		Columns: []riak.TsColumn{
+//			{Name: "region", Type: riak.TsColumnTypeVarchar},
+//			{Name: "state", Type: riak.TsColumnTypeVarchar},
+//			{Name: "time", Type: riak.TsColumnTypeTimestamp},
+//			{Name: "temperature", Type: riak.TsColumnTypeDouble, Nullable: true},
+//		},
+//		PartitionKey: []string{"region", "state", "time"},
+//		Quantum:      &riak.TsQuantum{Column: "time", Interval: 15, Unit: riak.TsQuantumMinutes},
+//		LocalKey:     []string{"region", "state", "time"},
+//	}
+//	ddl, err := schema.DDL()
+type TsTableSchema struct {
+	Table        string
+	Columns      []TsColumn
+	PartitionKey []string
+	Quantum      *TsQuantum
+	LocalKey     []string
+}
+
+// TsRowError is returned when a row does not match a table schema
+type TsRowError struct {
+	Row     int
+	Column  string
+	Message string
+}
+
+func (e TsRowError) Error() string {
+	return fmt.Sprintf("TsRowError|%d|%s|%s", e.Row, e.Column, e.Message)
+}
+
+// Column returns the column with the given name, or nil if there is none
+func (s *TsTableSchema) Column(name string) *TsColumn {
+	for i := range s.Columns {
+		if s.Columns[i].Name == name {
+			return &s.Columns[i]
+		}
+	}
+	return nil
+}
+
+func (s *TsTableSchema) localKey() []string {
+	if len(s.LocalKey) == 0 {
+		return s.PartitionKey
+	}
+	return s.LocalKey
+}
+
+// Validate checks that the schema describes a table Riak TS can create
+func (s *TsTableSchema) Validate() error {
+	if s.Table == "" {
+		return ErrTableRequired
+	}
+	if len(s.Columns) == 0 {
+		return ErrTsSchemaColumnsRequired
+	}
+	seen := make(map[string]bool)
+	for _, column := range s.Columns {
+		if column.Name == "" {
+			return fmt.Errorf("[TsTableSchema] table %s has a column with no name", s.Table)
+		}
+		if seen[column.Name] {
+			return fmt.Errorf("[TsTableSchema] table %s has duplicate column %s", s.Table, column.Name)
+		}
+		seen[column.Name] = true
+		if _, ok := riak_ts.TsColumnType_value[column.Type]; !ok {
+			return fmt.Errorf("[TsTableSchema] column %s has unknown type '%s'", column.Name, column.Type)
+		}
+	}
+	if len(s.PartitionKey) == 0 {
+		return ErrTsSchemaPartitionKeyRequired
+	}
+	for _, key := range [][]string{s.PartitionKey, s.LocalKey} {
+		for _, name := range key {
+			column := s.Column(name)
+			if column == nil {
+				return fmt.Errorf("[TsTableSchema] key column %s is not defined in table %s", name, s.Table)
+			}
+			if column.Nullable {
+				return fmt.Errorf("[TsTableSchema] key column %s must not be nullable", name)
+			}
+		}
+	}
+	localKey := s.localKey()
+	if len(localKey) < len(s.PartitionKey) {
+		return fmt.Errorf("[TsTableSchema] local key of table %s must start with the partition key", s.Table)
+	}
+	for i, name := range s.PartitionKey {
+		if localKey[i] != name {
+			return fmt.Errorf("[TsTableSchema] local key of table %s must start with the partition key", s.Table)
+		}
+	}
+	if q := s.Quantum; q != nil {
+		if !containsString(s.PartitionKey, q.Column) {
+			return fmt.Errorf("[TsTableSchema] quantum column %s is not in the partition key", q.Column)
+		}
+		if s.Column(q.Column).Type != TsColumnTypeTimestamp {
+			return fmt.Errorf("[TsTableSchema] quantum column %s must be a timestamp", q.Column)
+		}
+		if q.Interval <= 0 {
+			return fmt.Errorf("[TsTableSchema] quantum interval must be positive, got %d", q.Interval)
+		}
+		switch q.Unit {
+		case TsQuantumDays, TsQuantumHours, TsQuantumMinutes, TsQuantumSeconds:
+		default:
+			return fmt.Errorf("[TsTableSchema] unknown quantum unit '%s'", q.Unit)
+		}
+	}
+	return nil
+}
+
+// DDL returns the CREATE TABLE statement for the schema
+func (s *TsTableSchema) DDL() (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CREATE TABLE %s (\n", tsQuoteIdentifier(s.Table))
+	for _, column := range s.Columns {
+		fmt.Fprintf(&buf, "\t%s %s", tsQuoteIdentifier(column.Name), strings.ToLower(column.Type))
+		if !column.Nullable {
+			buf.WriteString(" not null")
+		}
+		buf.WriteString(",\n")
+	}
+	partitionKey := make([]string, len(s.PartitionKey))
+	for i, name := range s.PartitionKey {
+		partitionKey[i] = tsQuoteIdentifier(name)
+		if s.Quantum != nil && s.Quantum.Column == name {
+			partitionKey[i] = fmt.Sprintf("quantum(%s, %d, '%s')", partitionKey[i], s.Quantum.Interval, s.Quantum.Unit)
+		}
+	}
+	localKey := make([]string, len(s.localKey()))
+	for i, name := range s.localKey() {
+		localKey[i] = tsQuoteIdentifier(name)
+	}
+	fmt.Fprintf(&buf, "\tPRIMARY KEY((%s), %s)\n)", strings.Join(partitionKey, ", "), strings.Join(localKey, ", "))
+	return buf.String(), nil
+}
+
+// NewCreateTableCommandBuilder returns a TsQueryCommandBuilder for the
+// schema's CREATE TABLE statement
+func (s *TsTableSchema) NewCreateTableCommandBuilder() (*TsQueryCommandBuilder, error) {
+	ddl, err := s.DDL()
+	if err != nil {
+		return nil, err
+	}
+	return NewTsQueryCommandBuilder().WithQuery(ddl), nil
+}
+
+// NewTsTableSchemaFromDescribe builds the schema of a table from the response
+// to a "DESCRIBE table" query. Responses from all Riak TS versions are
+// supported; the quantum is only available from versions that report it.
+func NewTsTableSchemaFromDescribe(table string, rsp *TsQueryResponse) (*TsTableSchema, error) {
+	if rsp == nil || len(rsp.Columns) == 0 {
+		return nil, ErrTsDescribeResponseRequired
+	}
+	indexes := make(map[string]int)
+	for i, column := range rsp.Columns {
+		indexes[strings.ToLower(column.GetName())] = i
+	}
+	index := func(names ...string) int {
+		for _, name := range names {
+			if i, ok := indexes[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	nameIdx := index("column")
+	typeIdx := index("type")
+	nullIdx := index("nullable", "is null")
+	partitionIdx := index("partition key", "primary key")
+	localIdx := index("local key")
+	intervalIdx := index("interval")
+	unitIdx := index("unit")
+	if nameIdx < 0 || typeIdx < 0 || nullIdx < 0 || partitionIdx < 0 || localIdx < 0 {
+		return nil, fmt.Errorf("[TsTableSchema] unrecognized DESCRIBE response for table %s", table)
+	}
+
+	cell := func(row []TsCell, i int) *TsCell {
+		if i < 0 || i >= len(row) || row[i].IsNull() {
+			return nil
+		}
+		return &row[i]
+	}
+	schema := &TsTableSchema{Table: table}
+	var partitionKey, localKey []string
+	for _, row := range rsp.Rows {
+		nameCell, typeCell, nullCell := cell(row, nameIdx), cell(row, typeIdx), cell(row, nullIdx)
+		if nameCell == nil || typeCell == nil || nullCell == nil {
+			return nil, fmt.Errorf("[TsTableSchema] incomplete DESCRIBE row for table %s", table)
+		}
+		column := TsColumn{
+			Name:     nameCell.GetStringValue(),
+			Type:     strings.ToUpper(typeCell.GetStringValue()),
+			Nullable: nullCell.GetBooleanValue(),
+		}
+		schema.Columns = append(schema.Columns, column)
+		if c := cell(row, partitionIdx); c != nil {
+			partitionKey = setTsKeyPosition(partitionKey, c.GetSint64Value(), column.Name)
+			interval, unit := cell(row, intervalIdx), cell(row, unitIdx)
+			if interval != nil && unit != nil {
+				schema.Quantum = &TsQuantum{
+					Column:   column.Name,
+					Interval: int(interval.GetSint64Value()),
+					Unit:     unit.GetStringValue(),
+				}
+			}
+		}
+		if c := cell(row, localIdx); c != nil {
+			localKey = setTsKeyPosition(localKey, c.GetSint64Value(), column.Name)
+		}
+	}
+	schema.PartitionKey = partitionKey
+	schema.LocalKey = localKey
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// setTsKeyPosition stores name at the 1-based position of a key
+func setTsKeyPosition(key []string, position int64, name string) []string {
+	if position < 1 {
+		return key
+	}
+	for int64(len(key)) < position {
+		key = append(key, "")
+	}
+	key[position-1] = name
+	return key
+}
+
+// ValidateRow checks that a row has a cell of the right type for each column
+// and that only nullable columns are null
+func (s *TsTableSchema) ValidateRow(row []TsCell) error {
+	return s.validateRow(0, row)
+}
+
+// ValidateRows checks every row with ValidateRow, returning the first error
+func (s *TsTableSchema) ValidateRows(rows [][]TsCell) error {
+	for i, row := range rows {
+		if err := s.validateRow(i, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TsTableSchema) validateRow(i int, row []TsCell) error {
+	if len(row) != len(s.Columns) {
+		return TsRowError{
+			Row:     i,
+			Message: fmt.Sprintf("expected %d cells, got %d", len(s.Columns), len(row)),
+		}
+	}
+	for j, column := range s.Columns {
+		cell := row[j]
+		if cell.IsNull() {
+			if !column.Nullable {
+				return TsRowError{Row: i, Column: column.Name, Message: "column is not nullable"}
+			}
+			continue
+		}
+		if !tsCellMatchesColumn(&cell, column.Type) {
+			return TsRowError{
+				Row:     i,
+				Column:  column.Name,
+				Message: fmt.Sprintf("expected %s, got %s", column.Type, cell.GetDataType()),
+			}
+		}
+	}
+	return nil
+}
+
+// tsCellMatchesColumn returns true if the cell can be stored in a column of
+// the given type. VARCHAR and BLOB share a wire representation.
+func tsCellMatchesColumn(cell *TsCell, columnType string) bool {
+	dataType := cell.GetDataType()
+	switch columnType {
+	case TsColumnTypeVarchar, TsColumnTypeBlob:
+		return dataType == TsColumnTypeVarchar || dataType == TsColumnTypeBlob
+	}
+	return dataType == columnType
+}
+
+// NewStoreRowsCommandBuilder validates rows against the schema and returns a
+// TsStoreRowsCommandBuilder for the schema's table
+func (s *TsTableSchema) NewStoreRowsCommandBuilder(rows [][]TsCell) (*TsStoreRowsCommandBuilder, error) {
+	if err := s.ValidateRows(rows); err != nil {
+		return nil, err
+	}
+	return NewTsStoreRowsCommandBuilder().WithTable(s.Table).WithRows(rows), nil
+}
+
+// getTsFields returns the struct fields of t by column name, using the
+// riakts tag or the field name if there is no tag
+func getTsFields(t reflect.Type) (map[string]int, error) {
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("riakts")
+		if tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		if !tsFieldSupported(f.Type) {
+			if tag == "" {
+				continue
+			}
+			return nil, fmt.Errorf("[TsTableSchema] field %s.%s of type %v cannot be mapped to a column", t.Name(), f.Name, f.Type)
+		}
+		fields[name] = i
+	}
+	return fields, nil
+}
+
+func tsFieldSupported(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return t == bytesType || t == timeType
+}
+
+// MarshalRow converts the struct v to a row of the schema using the riakts
+// tags on its fields, or the field names for untagged fields. Pointer fields
+// that are nil, and columns with no field, become null cells. The row is
+// validated before it is returned.
+//
+//	type Reading struct {
+//		Region      string    `riakts:"region"`
+//		State       string    `riakts:"state"`
+//		Time        time.Time `riakts:"time"`
+//		Temperature *float64  `riakts:"temperature"`
+//	}
+func (s *TsTableSchema) MarshalRow(v interface{}) ([]TsCell, error) {
+	rv, err := tsStructValue(v)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := getTsFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	row := make([]TsCell, len(s.Columns))
+	for i, column := range s.Columns {
+		row[i] = NewNullTsCell()
+		index, ok := fields[column.Name]
+		if !ok {
+			continue
+		}
+		fv := rv.Field(index)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if row[i], err = encodeTsCell(fv, column.Type); err != nil {
+			return nil, fmt.Errorf("[TsTableSchema] column %s: %v", column.Name, err)
+		}
+	}
+	if err := s.ValidateRow(row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// UnmarshalRow decodes a row of the schema into the struct pointed to by v,
+// as described in MarshalRow
+func (s *TsTableSchema) UnmarshalRow(row []TsCell, v interface{}) error {
+	names := make([]string, len(s.Columns))
+	for i, column := range s.Columns {
+		names[i] = column.Name
+	}
+	return unmarshalTsRow(names, row, v)
+}
+
+// UnmarshalTsRow decodes a row described by columns, such as those of a
+// TsQueryResponse, into the struct pointed to by v. Fields with no
+// corresponding column are left unchanged.
+func UnmarshalTsRow(columns []TsColumnDescription, row []TsCell, v interface{}) error {
+	names := make([]string, len(columns))
+	for i := range columns {
+		names[i] = columns[i].GetName()
+	}
+	return unmarshalTsRow(names, row, v)
+}
+
+// Unmarshal decodes the fetched row into the struct pointed to by v, as
+// described in UnmarshalTsRow
+func (rsp *TsFetchRowResponse) Unmarshal(v interface{}) error {
+	return UnmarshalTsRow(rsp.Columns, rsp.Row, v)
+}
+
+// Unmarshal decodes the rows into the slice of structs pointed to by v, as
+// described in UnmarshalTsRow
+func (rsp *TsQueryResponse) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("[TsQueryResponse] expected a pointer to a slice, got %v", reflect.TypeOf(v))
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	result := reflect.MakeSlice(slice.Type(), 0, len(rsp.Rows))
+	for _, row := range rsp.Rows {
+		elem := reflect.New(elemType)
+		if err := UnmarshalTsRow(rsp.Columns, row, elem.Interface()); err != nil {
+			return err
+		}
+		if isPtr {
+			result = reflect.Append(result, elem)
+		} else {
+			result = reflect.Append(result, elem.Elem())
+		}
+	}
+	slice.Set(result)
+	return nil
+}
+
+func unmarshalTsRow(names []string, row []TsCell, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("[TsTableSchema] expected a pointer to a struct, got %v", reflect.TypeOf(v))
+	}
+	rv = rv.Elem()
+	if len(row) != len(names) {
+		return fmt.Errorf("[TsTableSchema] expected %d cells, got %d", len(names), len(row))
+	}
+	fields, err := getTsFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		index, ok := fields[name]
+		if !ok {
+			continue
+		}
+		fv := rv.Field(index)
+		if row[i].IsNull() {
+			fv.Set(reflect.Zero(fv.Type()))
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			fv.Set(reflect.New(fv.Type().Elem()))
+			fv = fv.Elem()
+		}
+		if err := decodeTsCell(fv, &row[i]); err != nil {
+			return fmt.Errorf("[TsTableSchema] column %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func tsStructValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("[TsTableSchema] expected a struct or pointer to a struct, got %v", reflect.TypeOf(v))
+	}
+	return rv, nil
+}
+
+// encodeTsCell converts a field value to a cell of the given column type
+func encodeTsCell(fv reflect.Value, columnType string) (TsCell, error) {
+	switch columnType {
+	case TsColumnTypeVarchar, TsColumnTypeBlob:
+		var b []byte
+		switch {
+		case fv.Kind() == reflect.String:
+			b = []byte(fv.String())
+		case fv.Type() == bytesType:
+			b = fv.Bytes()
+		default:
+			return TsCell{}, fmt.Errorf("cannot store %v as %s", fv.Type(), columnType)
+		}
+		if columnType == TsColumnTypeBlob {
+			return NewBlobTsCell(b), nil
+		}
+		return NewStringTsCell(string(b)), nil
+	case TsColumnTypeSint64:
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return NewSint64TsCell(fv.Int()), nil
+		}
+	case TsColumnTypeDouble:
+		switch fv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return NewDoubleTsCell(fv.Float()), nil
+		}
+	case TsColumnTypeBoolean:
+		if fv.Kind() == reflect.Bool {
+			return NewBooleanTsCell(fv.Bool()), nil
+		}
+	case TsColumnTypeTimestamp:
+		if fv.Type() == timeType {
+			return NewTimestampTsCell(fv.Interface().(time.Time)), nil
+		}
+		if fv.Kind() == reflect.Int64 {
+			return NewTimestampTsCellFromInt64(fv.Int()), nil
+		}
+	}
+	return TsCell{}, fmt.Errorf("cannot store %v as %s", fv.Type(), columnType)
+}
+
+// decodeTsCell stores a non-null cell in a field value
+func decodeTsCell(fv reflect.Value, cell *TsCell) error {
+	dataType := cell.GetDataType()
+	switch dataType {
+	case TsColumnTypeVarchar, TsColumnTypeBlob:
+		switch {
+		case fv.Kind() == reflect.String:
+			fv.SetString(string(cell.GetBlobValue()))
+			return nil
+		case fv.Type() == bytesType:
+			fv.SetBytes(append([]byte(nil), cell.GetBlobValue()...))
+			return nil
+		}
+	case TsColumnTypeSint64:
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v := cell.GetSint64Value()
+			if fv.OverflowInt(v) {
+				return fmt.Errorf("value %d overflows %v", v, fv.Type())
+			}
+			fv.SetInt(v)
+			return nil
+		}
+	case TsColumnTypeDouble:
+		switch fv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			fv.SetFloat(cell.GetDoubleValue())
+			return nil
+		}
+	case TsColumnTypeBoolean:
+		if fv.Kind() == reflect.Bool {
+			fv.SetBool(cell.GetBooleanValue())
+			return nil
+		}
+	case TsColumnTypeTimestamp:
+		if fv.Type() == timeType {
+			fv.Set(reflect.ValueOf(cell.GetTimeValue()))
+			return nil
+		}
+		if fv.Kind() == reflect.Int64 {
+			fv.SetInt(cell.GetTimestampValue())
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot decode %s into %v", dataType, fv.Type())
+}
+
+// tsQuoteIdentifier double quotes a table or column name unless it is a
+// plain identifier
+func tsQuoteIdentifier(name string) string {
+	plain := name != ""
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			plain = false
+		}
+	}
+	if plain {
+		return name
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,309 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"testing"
+	"time"
+
+	"github.com/basho/riak-go-client/rpb/riak_ts"
+)
+
+func newTestTsSchema() *TsTableSchema {
+	return &TsTableSchema{
+		Table: "WeatherByRegion",
+		Columns: []TsColumn{
+			{Name: "region", Type: TsColumnTypeVarchar},
+			{Name: "state", Type: TsColumnTypeVarchar},
+			{Name: "time", Type: TsColumnTypeTimestamp},
+			{Name: "temperature", Type: TsColumnTypeDouble, Nullable: true},
+			{Name: "uv index", Type: TsColumnTypeSint64, Nullable: true},
+			{Name: "observed", Type: TsColumnTypeBoolean},
+			{Name: "binary", Type: TsColumnTypeBlob},
+		},
+		PartitionKey: []string{"region", "state", "time"},
+		Quantum:      &TsQuantum{Column: "time", Interval: 15, Unit: TsQuantumMinutes},
+	}
+}
+
+type testTsReading struct {
+	Region      string    `riakts:"region"`
+	State       string    `riakts:"state"`
+	Time        time.Time `riakts:"time"`
+	Temperature *float64  `riakts:"temperature"`
+	UVIndex     *int      `riakts:"uv index"`
+	Observed    bool      `riakts:"observed"`
+	Binary      []byte    `riakts:"binary"`
+	Ignored     string    `riakts:"-"`
+}
+
+func TestTsTableSchemaDDL(t *testing.T) {
+	ddl, err := newTestTsSchema().DDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `CREATE TABLE WeatherByRegion (
+	region varchar not null,
+	state varchar not null,
+	time timestamp not null,
+	temperature double,
+	"uv index" sint64,
+	observed boolean not null,
+	binary blob not null,
+	PRIMARY KEY((region, state, quantum(time, 15, 'm')), region, state, time)
+)`
+	if actual := ddl; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsTableSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *TsTableSchema)
+	}{
+		{"no table", func(s *TsTableSchema) { s.Table = "" }},
+		{"no columns", func(s *TsTableSchema) { s.Columns = nil }},
+		{"duplicate column", func(s *TsTableSchema) { s.Columns[1].Name = "region" }},
+		{"unknown type", func(s *TsTableSchema) { s.Columns[0].Type = "TEXT" }},
+		{"no partition key", func(s *TsTableSchema) { s.PartitionKey = nil }},
+		{"unknown key column", func(s *TsTableSchema) { s.PartitionKey = []string{"city"} }},
+		{"nullable key column", func(s *TsTableSchema) { s.LocalKey = []string{"region", "state", "time", "temperature"} }},
+		{"local key prefix", func(s *TsTableSchema) { s.LocalKey = []string{"state", "region", "time"} }},
+		{"quantum not in key", func(s *TsTableSchema) { s.Quantum.Column = "observed" }},
+		{"quantum interval", func(s *TsTableSchema) { s.Quantum.Interval = 0 }},
+		{"quantum unit", func(s *TsTableSchema) { s.Quantum.Unit = "w" }},
+	}
+	if err := newTestTsSchema().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		s := newTestTsSchema()
+		test.modify(s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func newTestTsDescribeResponse() *TsQueryResponse {
+	rsp := &TsQueryResponse{}
+	for _, name := range []string{"Column", "Type", "Nullable", "Partition Key", "Local Key", "Interval", "Unit", "Sort Order"} {
+		rsp.Columns = append(rsp.Columns, TsColumnDescription{column: &riak_ts.TsColumnDescription{Name: []byte(name)}})
+	}
+	key := func(v int64) TsCell {
+		if v == 0 {
+			return NewNullTsCell()
+		}
+		return NewSint64TsCell(v)
+	}
+	row := func(name, columnType string, nullable bool, partitionKey, localKey int64) []TsCell {
+		return []TsCell{
+			NewStringTsCell(name),
+			NewStringTsCell(columnType),
+			NewBooleanTsCell(nullable),
+			key(partitionKey),
+			key(localKey),
+			NewNullTsCell(),
+			NewNullTsCell(),
+			NewNullTsCell(),
+		}
+	}
+	rsp.Rows = [][]TsCell{
+		row("region", "varchar", false, 1, 1),
+		row("state", "varchar", false, 2, 2),
+		row("time", "timestamp", false, 3, 3),
+		row("temperature", "double", true, 0, 0),
+		row("uv index", "sint64", true, 0, 0),
+		row("observed", "boolean", false, 0, 0),
+		row("binary", "blob", false, 0, 0),
+	}
+	rsp.Rows[2][5] = NewSint64TsCell(15)
+	rsp.Rows[2][6] = NewStringTsCell("m")
+	return rsp
+}
+
+func TestNewTsTableSchemaFromDescribe(t *testing.T) {
+	schema, err := NewTsTableSchemaFromDescribe("WeatherByRegion", newTestTsDescribeResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDDL, _ := newTestTsSchema().DDL()
+	actualDDL, err := schema.DDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := expectedDDL, actualDDL; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if _, err := NewTsTableSchemaFromDescribe("WeatherByRegion", nil); err != ErrTsDescribeResponseRequired {
+		t.Errorf("expected %v, got %v", ErrTsDescribeResponseRequired, err)
+	}
+	rsp := newTestTsDescribeResponse()
+	rsp.Columns = rsp.Columns[1:]
+	if _, err := NewTsTableSchemaFromDescribe("WeatherByRegion", rsp); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestTsTableSchemaValidateRows(t *testing.T) {
+	schema := newTestTsSchema()
+	valid := []TsCell{
+		NewStringTsCell("South Atlantic"),
+		NewStringTsCell("South Carolina"),
+		NewTimestampTsCell(time.Now()),
+		NewNullTsCell(),
+		NewSint64TsCell(3),
+		NewBooleanTsCell(true),
+		NewStringTsCell("binary"),
+	}
+	if err := schema.ValidateRow(valid); err != nil {
+		t.Error(err)
+	}
+
+	wrongType := append([]TsCell(nil), valid...)
+	wrongType[3] = NewStringTsCell("hot")
+	notNull := append([]TsCell(nil), valid...)
+	notNull[5] = NewNullTsCell()
+
+	err := schema.ValidateRows([][]TsCell{valid, valid[1:], wrongType})
+	if rowErr, ok := err.(TsRowError); !ok {
+		t.Errorf("expected TsRowError, got %v", err)
+	} else if expected, actual := 1, rowErr.Row; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	err = schema.ValidateRows([][]TsCell{valid, wrongType})
+	if rowErr, ok := err.(TsRowError); !ok {
+		t.Errorf("expected TsRowError, got %v", err)
+	} else if expected, actual := "temperature", rowErr.Column; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	err = schema.ValidateRow(notNull)
+	if rowErr, ok := err.(TsRowError); !ok {
+		t.Errorf("expected TsRowError, got %v", err)
+	} else if expected, actual := "observed", rowErr.Column; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if _, err := schema.NewStoreRowsCommandBuilder([][]TsCell{notNull}); err == nil {
+		t.Error("expected an error")
+	}
+	builder, err := schema.NewStoreRowsCommandBuilder([][]TsCell{valid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "WeatherByRegion", string(builder.protobuf.GetTable()); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsTableSchemaMarshalRow(t *testing.T) {
+	schema := newTestTsSchema()
+	temperature := 21.5
+	reading := &testTsReading{
+		Region:      "South Atlantic",
+		State:       "South Carolina",
+		Time:        time.Unix(1443806900, 103*int64(time.Millisecond)),
+		Temperature: &temperature,
+		Observed:    true,
+		Binary:      []byte{0, 1, 2},
+		Ignored:     "ignored",
+	}
+	row, err := schema.MarshalRow(reading)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := TsColumnTypeBlob, row[6].GetDataType(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := true, row[4].IsNull(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := int64(1443806900103), row[2].GetTimestampValue(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	decoded := &testTsReading{}
+	if err := schema.UnmarshalRow(row, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := reading.Region, decoded.Region; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if !reading.Time.Equal(decoded.Time) {
+		t.Errorf("expected %v, got %v", reading.Time, decoded.Time)
+	}
+	if decoded.Temperature == nil || *decoded.Temperature != temperature {
+		t.Errorf("expected %v, got %v", temperature, decoded.Temperature)
+	}
+	if decoded.UVIndex != nil {
+		t.Errorf("expected nil, got %v", *decoded.UVIndex)
+	}
+	if expected, actual := "", decoded.Ignored; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if _, err := schema.MarshalRow(&struct {
+		Region string `riakts:"region"`
+	}{"South Atlantic"}); err == nil {
+		t.Error("expected an error for missing columns")
+	}
+	if _, err := schema.MarshalRow(&struct {
+		Region int `riakts:"region"`
+	}{1}); err == nil {
+		t.Error("expected an error for a mismatched type")
+	}
+}
+
+func TestTsQueryResponseUnmarshal(t *testing.T) {
+	rsp := &TsQueryResponse{
+		Columns: []TsColumnDescription{
+			{column: &riak_ts.TsColumnDescription{Name: []byte("region"), Type: riak_ts.TsColumnType_VARCHAR.Enum()}},
+			{column: &riak_ts.TsColumnDescription{Name: []byte("uv index"), Type: riak_ts.TsColumnType_SINT64.Enum()}},
+		},
+		Rows: [][]TsCell{
+			{NewStringTsCell("South Atlantic"), NewSint64TsCell(4)},
+			{NewStringTsCell("Pacific"), NewNullTsCell()},
+		},
+	}
+	var readings []testTsReading
+	if err := rsp.Unmarshal(&readings); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(readings); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := "Pacific", readings[1].Region; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if readings[0].UVIndex == nil || *readings[0].UVIndex != 4 {
+		t.Errorf("expected 4, got %v", readings[0].UVIndex)
+	}
+	if readings[1].UVIndex != nil {
+		t.Errorf("expected nil, got %v", *readings[1].UVIndex)
+	}
+
+	var pointers []*testTsReading
+	if err := rsp.Unmarshal(&pointers); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "South Atlantic", pointers[0].Region; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if err := rsp.Unmarshal(readings); err == nil {
+		t.Error("expected an error for a non-pointer")
+	}
+}
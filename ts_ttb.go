@@ -0,0 +1,233 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/basho/riak-go-client/rpb/riak_ts"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Atoms used by Riak TS term-to-binary messages
+const (
+	ttbTsPutReq        = "tsputreq"
+	ttbTsPutResp       = "tsputresp"
+	ttbTsGetReq        = "tsgetreq"
+	ttbTsGetResp       = "tsgetresp"
+	ttbTsQueryReq      = "tsqueryreq"
+	ttbTsQueryResp     = "tsqueryresp"
+	ttbTsInterpolation = "tsinterpolation"
+	ttbRpbErrorResp    = "rpberrorresp"
+	ttbUndefined       = "undefined"
+)
+
+// encodeTsTtbRequest encodes a TsPutReq, TsGetReq or TsQueryReq with
+// term-to-binary
+func encodeTsTtbRequest(msg proto.Message) ([]byte, error) {
+	e := newTtbEncoder()
+	switch req := msg.(type) {
+	case *riak_ts.TsPutReq:
+		// {tsputreq, Table, Columns, Rows}
+		e.writeTupleHeader(4)
+		e.writeAtom(ttbTsPutReq)
+		e.writeBinary(req.GetTable())
+		e.writeNil()
+		e.writeList(len(req.Rows), func(i int) {
+			cells := req.Rows[i].GetCells()
+			e.writeTupleHeader(len(cells))
+			for _, cell := range cells {
+				writeTsTtbCell(e, cell)
+			}
+		})
+	case *riak_ts.TsGetReq:
+		// {tsgetreq, Table, Key, Timeout}
+		e.writeTupleHeader(4)
+		e.writeAtom(ttbTsGetReq)
+		e.writeBinary(req.GetTable())
+		e.writeList(len(req.Key), func(i int) {
+			writeTsTtbCell(e, req.Key[i])
+		})
+		if req.Timeout == nil {
+			e.writeAtom(ttbUndefined)
+		} else {
+			e.writeInt(int64(req.GetTimeout()))
+		}
+	case *riak_ts.TsQueryReq:
+		// {tsqueryreq, {tsinterpolation, Base, Interpolations}, Stream, CoverContext}
+		e.writeTupleHeader(4)
+		e.writeAtom(ttbTsQueryReq)
+		e.writeTupleHeader(3)
+		e.writeAtom(ttbTsInterpolation)
+		e.writeBinary(req.GetQuery().GetBase())
+		e.writeNil()
+		e.writeBool(req.GetStream())
+		if req.CoverContext == nil {
+			e.writeAtom(ttbUndefined)
+		} else {
+			e.writeBinary(req.GetCoverContext())
+		}
+	default:
+		return nil, fmt.Errorf("[TTB] %v cannot be encoded", reflect.TypeOf(msg))
+	}
+	return e.bytes(), nil
+}
+
+func writeTsTtbCell(e *ttbEncoder, cell *riak_ts.TsCell) {
+	switch {
+	case cell == nil:
+		e.writeNil()
+	case cell.VarcharValue != nil:
+		e.writeBinary(cell.VarcharValue)
+	case cell.Sint64Value != nil:
+		e.writeInt(cell.GetSint64Value())
+	case cell.TimestampValue != nil:
+		e.writeInt(cell.GetTimestampValue())
+	case cell.BooleanValue != nil:
+		e.writeBool(cell.GetBooleanValue())
+	case cell.DoubleValue != nil:
+		e.writeFloat(cell.GetDoubleValue())
+	default:
+		e.writeNil()
+	}
+}
+
+// decodeTsTtbResponse decodes a term-to-binary response into msg, which is
+// the command's response protobuf message. A nil message is returned when
+// there is no data, as when the protobuf response is empty. An error response
+// is returned as a RiakError.
+func decodeTsTtbResponse(data []byte, msg proto.Message) (proto.Message, error) {
+	term, err := decodeTtb(data)
+	if err != nil {
+		return nil, err
+	}
+	if tuple, ok := term.(ttbTuple); ok && len(tuple) == 3 && tuple[0] == ttbAtom(ttbRpbErrorResp) {
+		errmsg, _ := tuple[1].([]byte)
+		errcode, _ := tuple[2].(int64)
+		return nil, RiakError{Errcode: uint32(errcode), Errmsg: string(errmsg)}
+	}
+	switch resp := msg.(type) {
+	case nil:
+		if term != ttbAtom(ttbTsPutResp) {
+			return nil, fmt.Errorf("[TTB] expected %s, got %v", ttbTsPutResp, term)
+		}
+		return nil, nil
+	case *riak_ts.TsGetResp:
+		columns, rows, err := decodeTsTtbResult(term, ttbTsGetResp)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		resp.Columns = columns
+		resp.Rows = rows
+		return resp, nil
+	case *riak_ts.TsQueryResp:
+		columns, rows, err := decodeTsTtbResult(term, ttbTsQueryResp)
+		if err != nil {
+			return nil, err
+		}
+		done := true
+		resp.Columns = columns
+		resp.Rows = rows
+		resp.Done = &done
+		return resp, nil
+	}
+	return nil, fmt.Errorf("[TTB] %v cannot be decoded", reflect.TypeOf(msg))
+}
+
+// decodeTsTtbResult decodes {Atom, {ColumnNames, ColumnTypes, Rows}}
+func decodeTsTtbResult(term interface{}, atom string) ([]*riak_ts.TsColumnDescription, []*riak_ts.TsRow, error) {
+	invalid := fmt.Errorf("[TTB] invalid %s", atom)
+	tuple, ok := term.(ttbTuple)
+	if !ok || len(tuple) != 2 || tuple[0] != ttbAtom(atom) {
+		return nil, nil, invalid
+	}
+	result, ok := tuple[1].(ttbTuple)
+	if !ok || len(result) != 3 {
+		return nil, nil, invalid
+	}
+	names, namesOk := result[0].([]interface{})
+	types, typesOk := result[1].([]interface{})
+	rows, rowsOk := result[2].([]interface{})
+	if !namesOk || !typesOk || !rowsOk || len(names) != len(types) {
+		return nil, nil, invalid
+	}
+
+	var columns []*riak_ts.TsColumnDescription
+	for i := range names {
+		name, nameOk := names[i].([]byte)
+		typeName, typeOk := types[i].(ttbAtom)
+		columnType, known := riak_ts.TsColumnType_value[strings.ToUpper(string(typeName))]
+		if !nameOk || !typeOk || !known {
+			return nil, nil, invalid
+		}
+		columns = append(columns, &riak_ts.TsColumnDescription{
+			Name: name,
+			Type: riak_ts.TsColumnType(columnType).Enum(),
+		})
+	}
+
+	var tsRows []*riak_ts.TsRow
+	for _, r := range rows {
+		row, ok := r.(ttbTuple)
+		if !ok || len(row) != len(columns) {
+			return nil, nil, invalid
+		}
+		cells := make([]*riak_ts.TsCell, len(row))
+		for i, value := range row {
+			cell, err := decodeTsTtbCell(value, columns[i].GetType())
+			if err != nil {
+				return nil, nil, err
+			}
+			cells[i] = cell
+		}
+		tsRows = append(tsRows, &riak_ts.TsRow{Cells: cells})
+	}
+	return columns, tsRows, nil
+}
+
+func decodeTsTtbCell(value interface{}, columnType riak_ts.TsColumnType) (*riak_ts.TsCell, error) {
+	cell := &riak_ts.TsCell{}
+	switch v := value.(type) {
+	case []interface{}:
+		if v != nil {
+			return nil, fmt.Errorf("[TTB] unexpected list in %v column", columnType)
+		}
+	case []byte:
+		cell.VarcharValue = v
+	case int64:
+		if columnType == riak_ts.TsColumnType_TIMESTAMP {
+			cell.TimestampValue = &v
+		} else {
+			cell.Sint64Value = &v
+		}
+	case float64:
+		cell.DoubleValue = &v
+	case ttbAtom:
+		if v != "true" && v != "false" {
+			return nil, fmt.Errorf("[TTB] unexpected atom '%s' in %v column", v, columnType)
+		}
+		b := v == "true"
+		cell.BooleanValue = &b
+	default:
+		return nil, fmt.Errorf("[TTB] unexpected %v in %v column", reflect.TypeOf(value), columnType)
+	}
+	return cell, nil
+}
@@ -0,0 +1,298 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basho/riak-go-client/rpb/riak_ts"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func newTestTsTtbRows() [][]TsCell {
+	return [][]TsCell{
+		{
+			NewStringTsCell("South Atlantic"),
+			NewTimestampTsCell(time.Unix(1443806900, 103*int64(time.Millisecond))),
+			NewDoubleTsCell(21.5),
+			NewSint64TsCell(-4),
+			NewBooleanTsCell(true),
+			NewBlobTsCell([]byte{0, 1}),
+			NewNullTsCell(),
+		},
+	}
+}
+
+var testTsTtbColumns = []*riak_ts.TsColumnDescription{
+	{Name: []byte("region"), Type: riak_ts.TsColumnType_VARCHAR.Enum()},
+	{Name: []byte("time"), Type: riak_ts.TsColumnType_TIMESTAMP.Enum()},
+	{Name: []byte("temperature"), Type: riak_ts.TsColumnType_DOUBLE.Enum()},
+	{Name: []byte("uv_index"), Type: riak_ts.TsColumnType_SINT64.Enum()},
+	{Name: []byte("observed"), Type: riak_ts.TsColumnType_BOOLEAN.Enum()},
+	{Name: []byte("binary"), Type: riak_ts.TsColumnType_BLOB.Enum()},
+	{Name: []byte("note"), Type: riak_ts.TsColumnType_VARCHAR.Enum()},
+}
+
+// encodeTestTsTtbResult encodes {Atom, {ColumnNames, ColumnTypes, Rows}} as
+// Riak TS does
+func encodeTestTsTtbResult(atom string, columns []*riak_ts.TsColumnDescription, rows [][]TsCell) []byte {
+	e := newTtbEncoder()
+	e.writeTupleHeader(2)
+	e.writeAtom(atom)
+	e.writeTupleHeader(3)
+	e.writeList(len(columns), func(i int) {
+		e.writeBinary(columns[i].GetName())
+	})
+	e.writeList(len(columns), func(i int) {
+		e.writeAtom(strings.ToLower(columns[i].GetType().String()))
+	})
+	e.writeList(len(rows), func(i int) {
+		e.writeTupleHeader(len(rows[i]))
+		for _, cell := range rows[i] {
+			writeTsTtbCell(e, cell.cell)
+		}
+	})
+	return append([]byte{rpbCode_TsTtbMsg}, e.bytes()...)
+}
+
+func TestTsStoreRowsTtbRequest(t *testing.T) {
+	cmd, err := NewTsStoreRowsCommandBuilder().
+		WithTable("WeatherByRegion").
+		WithRows(newTestTsTtbRows()).
+		WithTermToBinary(true).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := getRiakMessage(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := rpbCode_TsTtbMsg, msg[4]; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	term, err := decodeTtb(msg[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ttbTuple{
+		ttbAtom("tsputreq"),
+		[]byte("WeatherByRegion"),
+		[]interface{}(nil),
+		[]interface{}{
+			ttbTuple{
+				[]byte("South Atlantic"),
+				int64(1443806900103),
+				21.5,
+				int64(-4),
+				ttbAtom("true"),
+				[]byte{0, 1},
+				[]interface{}(nil),
+			},
+		},
+	}
+	if !reflect.DeepEqual(expected, term) {
+		t.Errorf("expected %v, got %v", expected, term)
+	}
+
+	rsp := append([]byte{rpbCode_TsTtbMsg}, append(newTtbEncoder().bytes(), ttbAtomExt, 0, 9)...)
+	rsp = append(rsp, "tsputresp"...)
+	decoded, err := decodeRiakMessage(cmd, rsp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.onSuccess(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := true, cmd.(*TsStoreRowsCommand).Response; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsFetchRowTtbMatchesProtobuf(t *testing.T) {
+	key := newTestTsTtbRows()[0][:2]
+	build := func(useTtb bool) *TsFetchRowCommand {
+		cmd, err := NewTsFetchRowCommandBuilder().
+			WithTable("WeatherByRegion").
+			WithKey(key).
+			WithTimeout(time.Second).
+			WithTermToBinary(useTtb).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmd.(*TsFetchRowCommand)
+	}
+
+	ttbCmd := build(true)
+	msg, err := getRiakMessage(ttbCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	term, err := decodeTtb(msg[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedReq := ttbTuple{
+		ttbAtom("tsgetreq"),
+		[]byte("WeatherByRegion"),
+		[]interface{}{[]byte("South Atlantic"), int64(1443806900103)},
+		int64(1000),
+	}
+	if !reflect.DeepEqual(expectedReq, term) {
+		t.Errorf("expected %v, got %v", expectedReq, term)
+	}
+
+	pbCmd := build(false)
+	pbResp, err := proto.Marshal(&riak_ts.TsGetResp{
+		Columns: testTsTtbColumns,
+		Rows:    convertFromTsRows(newTestTsTtbRows()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeRiakMessage(pbCmd, append([]byte{rpbCode_TsGetResp}, pbResp...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pbCmd.onSuccess(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	rsp := encodeTestTsTtbResult("tsgetresp", testTsTtbColumns, newTestTsTtbRows())
+	decoded, err = decodeRiakMessage(ttbCmd, rsp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ttbCmd.onSuccess(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pbCmd.Response, ttbCmd.Response) {
+		t.Errorf("expected %v, got %v", pbCmd.Response, ttbCmd.Response)
+	}
+	if expected, actual := TsColumnTypeBlob, ttbCmd.Response.Row[5].GetDataType(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	notFoundCmd := build(true)
+	decoded, err = decodeRiakMessage(notFoundCmd, encodeTestTsTtbResult("tsgetresp", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notFoundCmd.onSuccess(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := true, notFoundCmd.Response.IsNotFound; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsQueryTtbMatchesProtobuf(t *testing.T) {
+	build := func(useTtb bool) *TsQueryCommand {
+		cmd, err := NewTsQueryCommandBuilder().
+			WithQuery("select * from WeatherByRegion").
+			WithTermToBinary(useTtb).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmd.(*TsQueryCommand)
+	}
+
+	ttbCmd := build(true)
+	msg, err := getRiakMessage(ttbCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	term, err := decodeTtb(msg[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedReq := ttbTuple{
+		ttbAtom("tsqueryreq"),
+		ttbTuple{ttbAtom("tsinterpolation"), []byte("select * from WeatherByRegion"), []interface{}(nil)},
+		ttbAtom("false"),
+		ttbAtom("undefined"),
+	}
+	if !reflect.DeepEqual(expectedReq, term) {
+		t.Errorf("expected %v, got %v", expectedReq, term)
+	}
+
+	done := true
+	pbCmd := build(false)
+	pbResp, err := proto.Marshal(&riak_ts.TsQueryResp{
+		Columns: testTsTtbColumns,
+		Rows:    convertFromTsRows(newTestTsTtbRows()),
+		Done:    &done,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeRiakMessage(pbCmd, append([]byte{rpbCode_TsQueryResp}, pbResp...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pbCmd.onSuccess(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err = decodeRiakMessage(ttbCmd, encodeTestTsTtbResult("tsqueryresp", testTsTtbColumns, newTestTsTtbRows()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ttbCmd.onSuccess(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pbCmd.Response, ttbCmd.Response) {
+		t.Errorf("expected %v, got %v", pbCmd.Response, ttbCmd.Response)
+	}
+	if expected, actual := true, ttbCmd.done; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if _, err := NewTsQueryCommandBuilder().
+		WithQuery("select * from WeatherByRegion").
+		WithStreaming(true).
+		WithCallback(func([][]TsCell) error { return nil }).
+		WithTermToBinary(true).
+		Build(); err == nil {
+		t.Error("expected an error for streaming with term-to-binary")
+	}
+}
+
+func TestTsTtbErrorResponse(t *testing.T) {
+	cmd, err := NewTsQueryCommandBuilder().
+		WithQuery("select * from Missing").
+		WithTermToBinary(true).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTtbEncoder()
+	e.writeTupleHeader(3)
+	e.writeAtom("rpberrorresp")
+	e.writeBinary([]byte("no such table"))
+	e.writeInt(1019)
+	_, err = decodeRiakMessage(cmd, append([]byte{rpbCode_TsTtbMsg}, e.bytes()...))
+	if riakErr, ok := err.(RiakError); !ok {
+		t.Errorf("expected RiakError, got %v", err)
+	} else if expected, actual := uint32(1019), riakErr.Errcode; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
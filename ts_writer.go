@@ -0,0 +1,357 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/basho/riak-go-client/rpb/riak_ts"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	defaultTsWriterBatchSize       = 100
+	defaultTsWriterMaxBatchBytes   = 1024 * 1024
+	defaultTsWriterFlushInterval   = time.Second
+	defaultTsWriterConcurrency     = 4
+	defaultTsWriterMaxRetries      = 3
+	defaultTsWriterRetryBackoff    = 100 * time.Millisecond
+	defaultTsWriterQueueSize       = 1000
+	defaultTsWriterErrorBufferSize = 100
+)
+
+var (
+	ErrTsWriterExecutorRequired = newClientError("[TsWriter] Executor is required", nil)
+	ErrTsWriterClosed           = newClientError("[TsWriter] writer is closed", nil)
+)
+
+// TsWriterOptions configure a TsWriter. Zero values are replaced by defaults
+type TsWriterOptions struct {
+	// Executor writes the batches. A Cluster spreads them across its nodes
+	Executor CommandExecutor
+	Table    string
+	// Schema, if set, is used to validate rows as they are written
+	Schema *TsTableSchema
+	// BatchSize is the number of rows written by one request, by default 100
+	BatchSize int
+	// MaxBatchBytes is the encoded size above which a batch is split, by
+	// default 1 MiB
+	MaxBatchBytes int
+	// FlushInterval is the longest a row waits for its batch to fill, by
+	// default 1 second
+	FlushInterval time.Duration
+	// Concurrency is the number of batches written at once, by default 4
+	Concurrency int
+	// MaxRetries is the number of times a failed batch is retried, by
+	// default 3. A negative value disables retries
+	MaxRetries int
+	// RetryBackoff is multiplied by the attempt number to give the delay
+	// before a retry, by default 100ms
+	RetryBackoff time.Duration
+	// QueueSize is the number of rows buffered before Write blocks, by
+	// default 1000
+	QueueSize int
+	// ErrorBufferSize is the capacity of the Errors channel, by default 100.
+	// Errors are logged and dropped when it is full
+	ErrorBufferSize int
+	// UseTtb writes batches with the term-to-binary encoding
+	UseTtb bool
+}
+
+// TsWriteError reports a batch that could not be written
+type TsWriteError struct {
+	Rows       [][]TsCell
+	Attempts   int
+	InnerError error
+}
+
+func (e *TsWriteError) Error() string {
+	return fmt.Sprintf("TsWriteError|%d|%d|%v", len(e.Rows), e.Attempts, e.InnerError)
+}
+
+// TsWriter accepts rows for a table asynchronously and writes them in
+// batches. Failed batches are retried, and reported on the Errors channel
+// once retries are exhausted.
+//
+//	writer, err := riak.NewTsWriter(&riak.TsWriterOptions{
+//		Executor: cluster,
+//		Table:    "WeatherByRegion",
+//	})
+//	go func() {
+//		for err := range writer.Errors() {
+//			log.Println(err)
+//		}
+//	}()
+//	for _, row := range rows {
+//		if err := writer.Write(row); err != nil {
+//			return err
+//		}
+//	}
+//	writer.Close()
+type TsWriter struct {
+	options *TsWriterOptions
+	rows    chan []TsCell
+	flushes chan chan struct{}
+	batches chan [][]TsCell
+	errors  chan *TsWriteError
+	workers sync.WaitGroup
+
+	mutex  sync.RWMutex
+	closed bool
+
+	inFlight     int
+	inFlightCond *sync.Cond
+}
+
+// NewTsWriter returns a TsWriter for the provided options and starts its
+// goroutines, which run until Close is called
+func NewTsWriter(options *TsWriterOptions) (*TsWriter, error) {
+	if options == nil {
+		return nil, ErrOptionsRequired
+	}
+	if options.Executor == nil {
+		return nil, ErrTsWriterExecutorRequired
+	}
+	if options.Table == "" {
+		return nil, ErrTableRequired
+	}
+	o := *options
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultTsWriterBatchSize
+	}
+	if o.MaxBatchBytes <= 0 {
+		o.MaxBatchBytes = defaultTsWriterMaxBatchBytes
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultTsWriterFlushInterval
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultTsWriterConcurrency
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	} else if o.MaxRetries == 0 {
+		o.MaxRetries = defaultTsWriterMaxRetries
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = defaultTsWriterRetryBackoff
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultTsWriterQueueSize
+	}
+	if o.ErrorBufferSize <= 0 {
+		o.ErrorBufferSize = defaultTsWriterErrorBufferSize
+	}
+
+	w := &TsWriter{
+		options: &o,
+		rows:    make(chan []TsCell, o.QueueSize),
+		flushes: make(chan chan struct{}),
+		batches: make(chan [][]TsCell),
+		errors:  make(chan *TsWriteError, o.ErrorBufferSize),
+	}
+	w.inFlightCond = sync.NewCond(&sync.Mutex{})
+	go w.batch()
+	for i := 0; i < o.Concurrency; i++ {
+		w.workers.Add(1)
+		go w.work()
+	}
+	return w, nil
+}
+
+// Write queues a row to be written, blocking while the queue is full. The
+// row is validated first if the writer has a Schema
+func (w *TsWriter) Write(row []TsCell) error {
+	if w.options.Schema != nil {
+		if err := w.options.Schema.ValidateRow(row); err != nil {
+			return err
+		}
+	}
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if w.closed {
+		return ErrTsWriterClosed
+	}
+	w.rows <- row
+	return nil
+}
+
+// Errors returns the channel batches that could not be written are reported
+// on. It is closed by Close
+func (w *TsWriter) Errors() <-chan *TsWriteError {
+	return w.errors
+}
+
+// Flush writes the rows queued so far without waiting for their batches to
+// fill, and waits until every batch in flight has been written or reported
+// as an error
+func (w *TsWriter) Flush() error {
+	w.mutex.RLock()
+	if w.closed {
+		w.mutex.RUnlock()
+		return ErrTsWriterClosed
+	}
+	done := make(chan struct{})
+	w.flushes <- done
+	w.mutex.RUnlock()
+	<-done
+	w.waitInFlight()
+	return nil
+}
+
+// Close writes the rows queued so far, waits for every batch to be written
+// or reported as an error, and closes the Errors channel
+func (w *TsWriter) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return ErrTsWriterClosed
+	}
+	w.closed = true
+	close(w.rows)
+	w.mutex.Unlock()
+	w.workers.Wait()
+	close(w.errors)
+	return nil
+}
+
+// batch collects rows into batches until the rows channel is closed
+func (w *TsWriter) batch() {
+	defer close(w.batches)
+	ticker := time.NewTicker(w.options.FlushInterval)
+	defer ticker.Stop()
+
+	var batch [][]TsCell
+	add := func(row []TsCell) {
+		batch = append(batch, row)
+		if len(batch) >= w.options.BatchSize {
+			w.dispatch(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case row, ok := <-w.rows:
+			if !ok {
+				w.dispatch(batch)
+				return
+			}
+			add(row)
+		case <-ticker.C:
+			w.dispatch(batch)
+			batch = nil
+		case done := <-w.flushes:
+			// rows queued before the flush may not have been received yet
+			for n := len(w.rows); n > 0; n-- {
+				add(<-w.rows)
+			}
+			w.dispatch(batch)
+			batch = nil
+			close(done)
+		}
+	}
+}
+
+func (w *TsWriter) dispatch(batch [][]TsCell) {
+	if len(batch) == 0 {
+		return
+	}
+	w.inFlightCond.L.Lock()
+	w.inFlight++
+	w.inFlightCond.L.Unlock()
+	w.batches <- batch
+}
+
+func (w *TsWriter) waitInFlight() {
+	w.inFlightCond.L.Lock()
+	for w.inFlight > 0 {
+		w.inFlightCond.Wait()
+	}
+	w.inFlightCond.L.Unlock()
+}
+
+func (w *TsWriter) work() {
+	defer w.workers.Done()
+	for batch := range w.batches {
+		for _, rows := range w.split(batch) {
+			w.write(rows)
+		}
+		w.inFlightCond.L.Lock()
+		w.inFlight--
+		w.inFlightCond.Broadcast()
+		w.inFlightCond.L.Unlock()
+	}
+}
+
+// split halves rows until each part encodes to at most MaxBatchBytes. A
+// single row is never split
+func (w *TsWriter) split(rows [][]TsCell) [][][]TsCell {
+	if len(rows) <= 1 || w.encodedSize(rows) <= w.options.MaxBatchBytes {
+		return [][][]TsCell{rows}
+	}
+	mid := len(rows) / 2
+	return append(w.split(rows[:mid]), w.split(rows[mid:])...)
+}
+
+func (w *TsWriter) encodedSize(rows [][]TsCell) int {
+	req := &riak_ts.TsPutReq{
+		Table: []byte(w.options.Table),
+		Rows:  convertFromTsRows(rows),
+	}
+	if w.options.UseTtb {
+		if b, err := encodeTsTtbRequest(req); err == nil {
+			return len(b)
+		}
+	}
+	return proto.Size(req)
+}
+
+// write stores rows, retrying up to MaxRetries times
+func (w *TsWriter) write(rows [][]TsCell) {
+	var err error
+	attempts := 0
+	for attempts <= w.options.MaxRetries {
+		if attempts > 0 {
+			time.Sleep(time.Duration(attempts) * w.options.RetryBackoff)
+		}
+		attempts++
+		var cmd Command
+		cmd, err = NewTsStoreRowsCommandBuilder().
+			WithTable(w.options.Table).
+			WithRows(rows).
+			WithTermToBinary(w.options.UseTtb).
+			Build()
+		if err == nil {
+			err = w.options.Executor.Execute(cmd)
+		}
+		if err == nil {
+			return
+		}
+		logDebug("[TsWriter]", "writing %d rows to %s failed (attempt %d): %v", len(rows), w.options.Table, attempts, err)
+	}
+	writeErr := &TsWriteError{
+		Rows:       rows,
+		Attempts:   attempts,
+		InnerError: err,
+	}
+	select {
+	case w.errors <- writeErr:
+	default:
+		logErr("[TsWriter] error buffer is full, dropping error", writeErr)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testTsWriterExecutor struct {
+	batches  []int
+	failures int
+	sync.Mutex
+}
+
+func (e *testTsWriterExecutor) Execute(cmd Command) error {
+	e.Lock()
+	defer e.Unlock()
+	c := cmd.(*TsStoreRowsCommand)
+	if e.failures > 0 {
+		e.failures--
+		return errors.New("node unavailable")
+	}
+	e.batches = append(e.batches, len(c.protobuf.Rows))
+	c.Response = true
+	return nil
+}
+
+func (e *testTsWriterExecutor) rowCount() int {
+	e.Lock()
+	defer e.Unlock()
+	n := 0
+	for _, size := range e.batches {
+		n += size
+	}
+	return n
+}
+
+func newTestTsWriterRow(i int) []TsCell {
+	return []TsCell{
+		NewStringTsCell("South Atlantic"),
+		NewStringTsCell("South Carolina"),
+		NewTimestampTsCellFromInt64(int64(i)),
+	}
+}
+
+func TestTsWriterBatchesRows(t *testing.T) {
+	executor := &testTsWriterExecutor{}
+	writer, err := NewTsWriter(&TsWriterOptions{
+		Executor:      executor,
+		Table:         "WeatherByRegion",
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		Concurrency:   3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 25; i++ {
+		if err := writer.Write(newTestTsWriterRow(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 25, executor.rowCount(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	executor.Lock()
+	for _, size := range executor.batches {
+		if size > 10 {
+			t.Errorf("expected batches of at most 10 rows, got %v", size)
+		}
+	}
+	executor.Unlock()
+
+	for i := 0; i < 5; i++ {
+		writer.Write(newTestTsWriterRow(i))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 30, executor.rowCount(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if _, ok := <-writer.Errors(); ok {
+		t.Error("expected no errors and a closed channel")
+	}
+	if expected, actual := ErrTsWriterClosed, writer.Write(newTestTsWriterRow(0)); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := ErrTsWriterClosed, writer.Flush(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsWriterFlushesOnInterval(t *testing.T) {
+	executor := &testTsWriterExecutor{}
+	writer, err := NewTsWriter(&TsWriterOptions{
+		Executor:      executor,
+		Table:         "WeatherByRegion",
+		FlushInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	writer.Write(newTestTsWriterRow(0))
+	deadline := time.Now().Add(5 * time.Second)
+	for executor.rowCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if expected, actual := 1, executor.rowCount(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsWriterSplitsLargeBatches(t *testing.T) {
+	executor := &testTsWriterExecutor{}
+	writer, err := NewTsWriter(&TsWriterOptions{
+		Executor:      executor,
+		Table:         "WeatherByRegion",
+		BatchSize:     8,
+		MaxBatchBytes: 150,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		writer.Write(newTestTsWriterRow(i))
+	}
+	writer.Close()
+	if expected, actual := 8, executor.rowCount(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	for _, size := range executor.batches {
+		rows := make([][]TsCell, size)
+		for i := range rows {
+			rows[i] = newTestTsWriterRow(0)
+		}
+		if actual := writer.encodedSize(rows); size > 1 && actual > 150 {
+			t.Errorf("expected at most 150 bytes, got %v", actual)
+		}
+	}
+	if len(executor.batches) < 2 {
+		t.Errorf("expected the batch to be split, got %v", executor.batches)
+	}
+}
+
+func TestTsWriterRetriesAndReportsErrors(t *testing.T) {
+	executor := &testTsWriterExecutor{failures: 2}
+	writer, err := NewTsWriter(&TsWriterOptions{
+		Executor:      executor,
+		Table:         "WeatherByRegion",
+		FlushInterval: time.Hour,
+		Concurrency:   1,
+		MaxRetries:    2,
+		RetryBackoff:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(newTestTsWriterRow(0))
+	writer.Flush()
+	if expected, actual := 1, executor.rowCount(); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	executor.Lock()
+	executor.failures = 3
+	executor.Unlock()
+	writer.Write(newTestTsWriterRow(1))
+	writer.Close()
+	var writeErrs []*TsWriteError
+	for err := range writer.Errors() {
+		writeErrs = append(writeErrs, err)
+	}
+	if expected, actual := 1, len(writeErrs); expected != actual {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 3, writeErrs[0].Attempts; expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected, actual := 1, len(writeErrs[0].Rows); expected != actual {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTsWriterValidatesRows(t *testing.T) {
+	schema := &TsTableSchema{
+		Table: "WeatherByRegion",
+		Columns: []TsColumn{
+			{Name: "region", Type: TsColumnTypeVarchar},
+			{Name: "state", Type: TsColumnTypeVarchar},
+			{Name: "time", Type: TsColumnTypeTimestamp},
+		},
+		PartitionKey: []string{"region", "state", "time"},
+	}
+	writer, err := NewTsWriter(&TsWriterOptions{
+		Executor: &testTsWriterExecutor{},
+		Table:    "WeatherByRegion",
+		Schema:   schema,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if err := writer.Write(newTestTsWriterRow(0)); err != nil {
+		t.Error(err)
+	}
+	if _, ok := writer.Write(newTestTsWriterRow(0)[:2]).(TsRowError); !ok {
+		t.Error("expected TsRowError")
+	}
+}
+
+func TestNewTsWriterValidatesOptions(t *testing.T) {
+	if _, err := NewTsWriter(nil); err != ErrOptionsRequired {
+		t.Errorf("expected %v, got %v", ErrOptionsRequired, err)
+	}
+	if _, err := NewTsWriter(&TsWriterOptions{Table: "t"}); err != ErrTsWriterExecutorRequired {
+		t.Errorf("expected %v, got %v", ErrTsWriterExecutorRequired, err)
+	}
+	if _, err := NewTsWriter(&TsWriterOptions{Executor: &testTsWriterExecutor{}}); err != ErrTableRequired {
+		t.Errorf("expected %v, got %v", ErrTableRequired, err)
+	}
+}
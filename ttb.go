@@ -0,0 +1,375 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Erlang external term format tags used by the term-to-binary (TTB) encoding
+const (
+	ttbVersion          byte = 131
+	ttbNewFloatExt      byte = 70
+	ttbSmallIntegerExt  byte = 97
+	ttbIntegerExt       byte = 98
+	ttbFloatExt         byte = 99
+	ttbAtomExt          byte = 100
+	ttbSmallTupleExt    byte = 104
+	ttbLargeTupleExt    byte = 105
+	ttbNilExt           byte = 106
+	ttbStringExt        byte = 107
+	ttbListExt          byte = 108
+	ttbBinaryExt        byte = 109
+	ttbSmallBigExt      byte = 110
+	ttbLargeBigExt      byte = 111
+	ttbSmallAtomExt     byte = 115
+	ttbAtomUtf8Ext      byte = 118
+	ttbSmallAtomUtf8Ext byte = 119
+)
+
+// ttbAtom is a decoded Erlang atom
+type ttbAtom string
+
+// ttbTuple is a decoded Erlang tuple
+type ttbTuple []interface{}
+
+// ttbEncoder writes terms in the Erlang external term format
+type ttbEncoder struct {
+	buf bytes.Buffer
+}
+
+func newTtbEncoder() *ttbEncoder {
+	e := &ttbEncoder{}
+	e.buf.WriteByte(ttbVersion)
+	return e
+}
+
+func (e *ttbEncoder) bytes() []byte {
+	return e.buf.Bytes()
+}
+
+func (e *ttbEncoder) writeUint16(v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *ttbEncoder) writeUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *ttbEncoder) writeAtom(s string) {
+	e.buf.WriteByte(ttbAtomExt)
+	e.writeUint16(uint16(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *ttbEncoder) writeBool(v bool) {
+	if v {
+		e.writeAtom("true")
+	} else {
+		e.writeAtom("false")
+	}
+}
+
+func (e *ttbEncoder) writeBinary(b []byte) {
+	e.buf.WriteByte(ttbBinaryExt)
+	e.writeUint32(uint32(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *ttbEncoder) writeInt(v int64) {
+	switch {
+	case v >= 0 && v <= math.MaxUint8:
+		e.buf.WriteByte(ttbSmallIntegerExt)
+		e.buf.WriteByte(byte(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		e.buf.WriteByte(ttbIntegerExt)
+		e.writeUint32(uint32(int32(v)))
+	default:
+		sign := byte(0)
+		magnitude := uint64(v)
+		if v < 0 {
+			sign = 1
+			magnitude = uint64(-v)
+		}
+		var digits []byte
+		for magnitude > 0 {
+			digits = append(digits, byte(magnitude))
+			magnitude >>= 8
+		}
+		e.buf.WriteByte(ttbSmallBigExt)
+		e.buf.WriteByte(byte(len(digits)))
+		e.buf.WriteByte(sign)
+		e.buf.Write(digits)
+	}
+}
+
+func (e *ttbEncoder) writeFloat(v float64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+	e.buf.WriteByte(ttbNewFloatExt)
+	e.buf.Write(b[:])
+}
+
+func (e *ttbEncoder) writeTupleHeader(arity int) {
+	if arity <= math.MaxUint8 {
+		e.buf.WriteByte(ttbSmallTupleExt)
+		e.buf.WriteByte(byte(arity))
+	} else {
+		e.buf.WriteByte(ttbLargeTupleExt)
+		e.writeUint32(uint32(arity))
+	}
+}
+
+func (e *ttbEncoder) writeNil() {
+	e.buf.WriteByte(ttbNilExt)
+}
+
+// writeList writes a proper list of length n, calling writeElement to write
+// each element
+func (e *ttbEncoder) writeList(n int, writeElement func(i int)) {
+	if n > 0 {
+		e.buf.WriteByte(ttbListExt)
+		e.writeUint32(uint32(n))
+		for i := 0; i < n; i++ {
+			writeElement(i)
+		}
+	}
+	e.writeNil()
+}
+
+// decodeTtb decodes a term in the Erlang external term format. Atoms decode
+// to ttbAtom, tuples to ttbTuple, lists to []interface{}, binaries to []byte,
+// integers to int64 and floats to float64.
+func decodeTtb(data []byte) (interface{}, error) {
+	if len(data) == 0 || data[0] != ttbVersion {
+		return nil, newClientError("[TTB] missing external term format version", nil)
+	}
+	d := &ttbDecoder{data: data, pos: 1}
+	term, err := d.term()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, newClientError(fmt.Sprintf("[TTB] %d unexpected bytes after term", len(d.data)-d.pos), nil)
+	}
+	return term, nil
+}
+
+type ttbDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *ttbDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, newClientError("[TTB] unexpected end of data", nil)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *ttbDecoder) uint8() (int, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return int(b[0]), nil
+}
+
+func (d *ttbDecoder) uint16() (int, error) {
+	b, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(b)), nil
+}
+
+func (d *ttbDecoder) uint32() (int, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *ttbDecoder) term() (interface{}, error) {
+	tag, err := d.uint8()
+	if err != nil {
+		return nil, err
+	}
+	switch byte(tag) {
+	case ttbSmallIntegerExt:
+		v, err := d.uint8()
+		return int64(v), err
+	case ttbIntegerExt:
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	case ttbSmallBigExt, ttbLargeBigExt:
+		var n int
+		if byte(tag) == ttbSmallBigExt {
+			n, err = d.uint8()
+		} else {
+			n, err = d.uint32()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return d.bignum(n)
+	case ttbNewFloatExt:
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case ttbFloatExt:
+		b, err := d.next(31)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.ParseFloat(strings.TrimRight(string(b), "\x00"), 64)
+	case ttbAtomExt, ttbAtomUtf8Ext, ttbSmallAtomExt, ttbSmallAtomUtf8Ext:
+		var n int
+		if byte(tag) == ttbAtomExt || byte(tag) == ttbAtomUtf8Ext {
+			n, err = d.uint16()
+		} else {
+			n, err = d.uint8()
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return ttbAtom(b), nil
+	case ttbSmallTupleExt, ttbLargeTupleExt:
+		var n int
+		if byte(tag) == ttbSmallTupleExt {
+			n, err = d.uint8()
+		} else {
+			n, err = d.uint32()
+		}
+		if err != nil {
+			return nil, err
+		}
+		elements, err := d.elements(n)
+		if err != nil {
+			return nil, err
+		}
+		return ttbTuple(elements), nil
+	case ttbNilExt:
+		return []interface{}(nil), nil
+	case ttbStringExt:
+		n, err := d.uint16()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, n)
+		for i, c := range b {
+			list[i] = int64(c)
+		}
+		return list, nil
+	case ttbListExt:
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		list, err := d.elements(n)
+		if err != nil {
+			return nil, err
+		}
+		tail, err := d.term()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := tail.([]interface{}); !ok || t != nil {
+			return nil, newClientError("[TTB] improper lists are not supported", nil)
+		}
+		return list, nil
+	case ttbBinaryExt:
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	}
+	return nil, newClientError(fmt.Sprintf("[TTB] unsupported term tag %d", tag), nil)
+}
+
+// elements decodes n terms. Every term takes at least one byte, so a count
+// larger than the remaining data is rejected before it is allocated
+func (d *ttbDecoder) elements(n int) ([]interface{}, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, newClientError(fmt.Sprintf("[TTB] %d elements exceed the %d bytes remaining", n, len(d.data)-d.pos), nil)
+	}
+	list := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		term, err := d.term()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, term)
+	}
+	return list, nil
+}
+
+func (d *ttbDecoder) bignum(n int) (interface{}, error) {
+	sign, err := d.uint8()
+	if err != nil {
+		return nil, err
+	}
+	digits, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	var magnitude uint64
+	for i := len(digits) - 1; i >= 0; i-- {
+		if magnitude > math.MaxUint64>>8 {
+			return nil, newClientError("[TTB] integer does not fit in 64 bits", nil)
+		}
+		magnitude = magnitude<<8 | uint64(digits[i])
+	}
+	if sign == 0 {
+		if magnitude > math.MaxInt64 {
+			return nil, newClientError("[TTB] integer does not fit in 64 bits", nil)
+		}
+		return int64(magnitude), nil
+	}
+	if magnitude > 1<<63 {
+		return nil, newClientError("[TTB] integer does not fit in 64 bits", nil)
+	}
+	return -int64(magnitude), nil
+}
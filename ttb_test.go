@@ -0,0 +1,120 @@
+// Copyright 2015-present Basho Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package riak
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTtbRoundTrip(t *testing.T) {
+	e := newTtbEncoder()
+	ints := []int64{0, 255, 256, -1, math.MaxInt32, math.MinInt32, math.MaxInt32 + 1, math.MinInt32 - 1, math.MaxInt64, math.MinInt64}
+	e.writeTupleHeader(6)
+	e.writeAtom("tsputreq")
+	e.writeBinary([]byte("table"))
+	e.writeBool(true)
+	e.writeFloat(-1.5)
+	e.writeList(len(ints), func(i int) {
+		e.writeInt(ints[i])
+	})
+	e.writeList(0, nil)
+
+	term, err := decodeTtb(e.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedInts := make([]interface{}, len(ints))
+	for i, v := range ints {
+		expectedInts[i] = v
+	}
+	expected := ttbTuple{
+		ttbAtom("tsputreq"),
+		[]byte("table"),
+		ttbAtom("true"),
+		-1.5,
+		expectedInts,
+		[]interface{}(nil),
+	}
+	if !reflect.DeepEqual(expected, term) {
+		t.Errorf("expected %v, got %v", expected, term)
+	}
+}
+
+func TestTtbEncodesIntegersCompactly(t *testing.T) {
+	tests := []struct {
+		v        int64
+		expected []byte
+	}{
+		{7, []byte{ttbVersion, ttbSmallIntegerExt, 7}},
+		{-2, []byte{ttbVersion, ttbIntegerExt, 0xff, 0xff, 0xff, 0xfe}},
+		{1 << 32, []byte{ttbVersion, ttbSmallBigExt, 5, 0, 0, 0, 0, 0, 1}},
+		{-(1 << 32), []byte{ttbVersion, ttbSmallBigExt, 5, 1, 0, 0, 0, 0, 1}},
+	}
+	for _, test := range tests {
+		e := newTtbEncoder()
+		e.writeInt(test.v)
+		if expected, actual := test.expected, e.bytes(); !bytes.Equal(expected, actual) {
+			t.Errorf("%d: expected %v, got %v", test.v, expected, actual)
+		}
+	}
+}
+
+func TestTtbDecodesAlternativeEncodings(t *testing.T) {
+	floatExt := make([]byte, 31)
+	copy(floatExt, "2.50000000000000000000e+00")
+	tests := []struct {
+		data     []byte
+		expected interface{}
+	}{
+		{[]byte{ttbVersion, ttbSmallAtomUtf8Ext, 2, 'o', 'k'}, ttbAtom("ok")},
+		{[]byte{ttbVersion, ttbStringExt, 0, 2, 1, 2}, []interface{}{int64(1), int64(2)}},
+		{append([]byte{ttbVersion, ttbFloatExt}, floatExt...), 2.5},
+		{[]byte{ttbVersion, ttbLargeTupleExt, 0, 0, 0, 1, ttbNilExt}, ttbTuple{[]interface{}(nil)}},
+	}
+	for _, test := range tests {
+		term, err := decodeTtb(test.data)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(test.expected, term) {
+			t.Errorf("expected %v, got %v", test.expected, term)
+		}
+	}
+}
+
+func TestTtbDecodeErrors(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":          {},
+		"no version":     {ttbSmallIntegerExt, 1},
+		"truncated":      {ttbVersion, ttbBinaryExt, 0, 0, 0, 5, 'a'},
+		"trailing bytes": {ttbVersion, ttbNilExt, ttbNilExt},
+		"improper list":  {ttbVersion, ttbListExt, 0, 0, 0, 1, ttbNilExt, ttbSmallIntegerExt, 1},
+		"big overflow":   {ttbVersion, ttbSmallBigExt, 9, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		"unknown tag":    {ttbVersion, 1},
+		"large tuple":    {ttbVersion, ttbLargeTupleExt, 0x7f, 0xff, 0xff, 0xff},
+		"large list":     {ttbVersion, ttbListExt, 0x7f, 0xff, 0xff, 0xff},
+		"long list":      {ttbVersion, ttbListExt, 0xff, 0xff, 0xff, 0xff, ttbNilExt},
+		"long tuple":     {ttbVersion, ttbSmallTupleExt, 2, ttbNilExt},
+	}
+	for name, data := range tests {
+		if _, err := decodeTtb(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}